@@ -0,0 +1,317 @@
+package clrcore
+
+import (
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Confidence values of the lexer detection signals. The confidences of the
+// signals matched by a lexer are combined as independent probabilities.
+const (
+	ModelineConfidence    = 0.95 // Emacs or Vim modeline naming the lexer
+	ShebangConfidence     = 0.9  // #! interpreter line matching the lexer
+	FileNameConfidence    = 0.9  // file name equal to a lexer file name
+	FilePatternConfidence = 0.7  // file name matching a lexer file name pattern, up to +0.1 for literal characters
+	MimeTypeConfidence    = 0.7  // mime type of the lexer
+	// The value returned by LexerInfo.AnalyseText is used as confidence.
+	MaxScoreConfidence     = 0.5 // upper bound of the confidence derived from the lexer score
+	scoreConfidenceScaling = 10  // score with half of MaxScoreConfidence
+)
+
+// DefaultAnalysePrefixSize is the default size of the text prefix given to the
+// AnalyseText functions.
+const DefaultAnalysePrefixSize = 4096
+
+// DetectOptions are the lexer detection options.
+type DetectOptions struct {
+	// AnalysePrefixSize is the maximum size of the text prefix given to the
+	// AnalyseText functions. DefaultAnalysePrefixSize is used when 0.
+	AnalysePrefixSize int
+	// Workers is the maximum number of lexers run concurrently to compute their
+	// score. GOMAXPROCS is used when 0.
+	Workers int
+}
+
+// Candidate is a lexer detected by DetectLexer.
+type Candidate struct {
+	Info       *LexerInfo
+	Confidence float64 // Combined confidence of the matched signals in [0,1].
+	Score      int     // Score of the lexer on the text, or 0 if it was not run.
+}
+
+// DetectLexer return the lexers that may be used to parse the text, sorted by
+// decreasing confidence. It is equivalent to DetectLexerWithOptions with nil
+// options.
+func DetectLexer(fileName, mimeType, text string) []Candidate {
+	return DetectLexerWithOptions(fileName, mimeType, text, nil)
+}
+
+// DetectLexerWithOptions return the lexers that may be used to parse the text,
+// sorted by decreasing confidence. The fileName and mimeType are optional.
+// The signals are, by decreasing confidence, an Emacs or Vim modeline naming
+// the lexer, the interpreter of a #! line, the file name patterns, the mime
+// type, and the value returned by the AnalyseText function of the lexer on a
+// prefix of the text. Lexing the text to get the lexer score is only used to
+// break the tie between the candidates with the highest confidence, which are
+// all the lexers when no signal match. Lexers with the same confidence are sorted
+// in registration order, so that the result is always the same. The options
+// may be nil.
+func DetectLexerWithOptions(fileName, mimeType, text string, opts *DetectOptions) []Candidate {
+	if opts == nil {
+		opts = &DetectOptions{}
+	}
+	confidences := make(map[*LexerInfo]float64)
+	add := func(info *LexerInfo, confidence float64) {
+		confidences[info] = 1 - (1-confidences[info])*(1-confidence)
+	}
+	if fileName != "" {
+		base := filepath.Base(fileName)
+		for _, info := range lexersList {
+			var best float64
+			for _, pattern := range info.FileNames {
+				if ok, _ := filepath.Match(pattern, base); ok {
+					if c := filePatternConfidence(pattern); c > best {
+						best = c
+					}
+				}
+			}
+			if best > 0 {
+				add(info, best)
+			}
+		}
+	}
+	if mimeType != "" {
+		for _, info := range lexersByMimeType[mimeType] {
+			add(info, MimeTypeConfidence)
+		}
+	}
+	if interpreter := shebangInterpreter(text); interpreter != "" {
+		for _, info := range lexersList {
+			if matchInterpreter(interpreter, info.Interpreters) {
+				add(info, ShebangConfidence)
+			}
+		}
+	}
+	if mode := modeline(text); mode != "" {
+		for _, info := range lexersList {
+			for _, name := range info.Names {
+				if strings.ToLower(name) == mode {
+					add(info, ModelineConfidence)
+					break
+				}
+			}
+		}
+	}
+	prefix := textPrefix(text, opts.AnalysePrefixSize)
+	for _, info := range lexersList {
+		if info.AnalyseText == nil {
+			continue
+		}
+		if c := info.AnalyseText(prefix); c > 0 {
+			if c > 1 {
+				c = 1
+			}
+			add(info, c)
+		}
+	}
+	var candidates []Candidate
+	for _, info := range lexersList {
+		candidates = append(candidates, Candidate{Info: info, Confidence: confidences[info]})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	// break the tie of the candidates with the highest confidence with their score
+	var n int
+	for n < len(candidates) && candidates[n].Confidence == candidates[0].Confidence {
+		n++
+	}
+	if n > 1 {
+		scoreCandidates(candidates[:n], text, opts.Workers)
+		for i := range candidates[:n] {
+			if c := &candidates[i]; c.Score > 0 {
+				c.Confidence = 1 - (1-c.Confidence)*(1-scoreConfidence(c.Score))
+			}
+		}
+		sort.SliceStable(candidates[:n], func(i, j int) bool {
+			return candidates[i].Confidence > candidates[j].Confidence
+		})
+	}
+	for n = 0; n < len(candidates) && candidates[n].Confidence > 0; n++ {
+	}
+	return candidates[:n]
+}
+
+// scoreCandidates sets the score of the candidates by running at most workers
+// lexers concurrently.
+func scoreCandidates(candidates []Candidate, text string, workers int, stopMarkers ...string) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(candidates) {
+		workers = len(candidates)
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				candidates[i].Score = lexerScore(candidates[i].Info, text, stopMarkers...)
+			}
+		}()
+	}
+	for i := range candidates {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// textPrefix return the prefix of text of at most size bytes, cut at a rune start.
+func textPrefix(text string, size int) string {
+	if size <= 0 {
+		size = DefaultAnalysePrefixSize
+	}
+	if len(text) <= size {
+		return text
+	}
+	for size > 0 && !utf8.RuneStart(text[size]) {
+		size--
+	}
+	return text[:size]
+}
+
+// lexerScore return the score of the lexer on the whole text, or 0 if the
+// lexer can't be instantiated.
+func lexerScore(info *LexerInfo, text string, stopMarkers ...string) int {
+	l, err := info.NewLexer(text, stopMarkers...)
+	if err != nil || l == nil {
+		return 0
+	}
+	for !l.NextLexeme().Type.IsA(Stop) {
+	}
+	return l.Score()
+}
+
+// scoreConfidence return the confidence derived from a strictly positive score.
+func scoreConfidence(score int) float64 {
+	return MaxScoreConfidence * float64(score) / float64(score+scoreConfidenceScaling)
+}
+
+// filePatternConfidence return the confidence of a file name matching pattern.
+// A pattern without meta characters is a file name. Otherwise, the more literal
+// characters the pattern has, the more specific it is.
+func filePatternConfidence(pattern string) float64 {
+	var literals int
+	var inClass bool
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+		case c == '\\':
+			i++
+			literals++
+		case c != '*' && c != '?':
+			literals++
+		}
+	}
+	if literals == len(pattern) {
+		return FileNameConfidence
+	}
+	if literals > 10 {
+		literals = 10
+	}
+	return FilePatternConfidence + 0.01*float64(literals)
+}
+
+// ShebangMatch return true if text starts with a #! line whose interpreter
+// matches one of the name patterns (e.g. "python*"). See LexerInfo.Interpreters.
+func ShebangMatch(text string, patterns []string) bool {
+	return matchInterpreter(shebangInterpreter(text), patterns)
+}
+
+// matchInterpreter return true if the interpreter is not empty and matches one
+// of the name patterns.
+func matchInterpreter(interpreter string, patterns []string) bool {
+	if interpreter == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, interpreter); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// shebangInterpreter return the base name of the interpreter of the #! line
+// at the start of text, or an empty string if there is none. With env, the
+// interpreter is its first argument that is not an option.
+func shebangInterpreter(text string) string {
+	if !strings.HasPrefix(text, "#!") {
+		return ""
+	}
+	line := text[2:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				interpreter = filepath.Base(f)
+				break
+			}
+		}
+	}
+	return interpreter
+}
+
+var (
+	emacsModeRe = regexp.MustCompile(`-\*-\s*(?:(?:.*;)?\s*mode:\s*([\w+#-]+)|([\w+#-]+))\s*(?:;.*)?-\*-`)
+	vimModeRe   = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex)(?:[<=>]?\d*)?:.*\b(?:ft|filetype|syntax|syn)=([\w+#-]+)`)
+)
+
+// modeline return the lower case mode name of the Emacs modeline in the first
+// two lines, or else the file type of the Vim modeline in the first or last five
+// lines. Return an empty string if there is none.
+func modeline(text string) string {
+	lines := strings.SplitN(text, "\n", 6)
+	if len(lines) > 5 {
+		lines = lines[:5]
+	}
+	for i, line := range lines {
+		if i == 2 {
+			break
+		}
+		if m := emacsModeRe.FindStringSubmatch(line); m != nil {
+			return strings.ToLower(m[1] + m[2])
+		}
+	}
+	// append the last five lines
+	i := len(text)
+	for n := 0; n < 5 && i > 0; n++ {
+		i = strings.LastIndexByte(text[:i-1], '\n') + 1
+	}
+	lines = append(lines, strings.Split(text[i:], "\n")...)
+	for _, line := range lines {
+		if m := vimModeRe.FindStringSubmatch(line); m != nil {
+			return strings.ToLower(m[1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,248 @@
+package clrcore
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShebangInterpreter(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{in: "#!/bin/sh\necho", out: "sh"},
+		{in: "#! /usr/bin/python3 -u", out: "python3"},
+		{in: "#!/usr/bin/env python", out: "python"},
+		{in: "#!/usr/bin/env -S LANG=C perl -w\n", out: "perl"},
+		{in: "#!\n", out: ""},
+		{in: " #!/bin/sh", out: ""},
+	}
+	for _, test := range tests {
+		if out := shebangInterpreter(test.in); out != test.out {
+			t.Errorf("got %q, expected %q for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestShebangMatch(t *testing.T) {
+	patterns := []string{"python*", "pypy*"}
+	tests := []struct {
+		in  string
+		out bool
+	}{
+		{in: "#!/usr/bin/env python3\n", out: true},
+		{in: "#!/usr/local/bin/pypy -O\n", out: true},
+		{in: "#!/bin/sh\necho hi\n", out: false},
+		{in: "#!\n", out: false},
+		{in: "import os\n", out: false},
+	}
+	for _, test := range tests {
+		if out := ShebangMatch(test.in, patterns); out != test.out {
+			t.Errorf("got %v, expected %v for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestModeline(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{in: "# -*- mode: Python -*-\n", out: "python"},
+		{in: "#!/bin/sh\n# -*- coding: utf-8; mode: sh -*-\n", out: "sh"},
+		{in: "/* -*- c++ -*- */", out: "c++"},
+		{in: "# -*- coding: utf-8 -*-\n", out: ""},
+		{in: "1\n2\n# -*- mode: python -*-\n", out: ""},
+		{in: "// vim: set ft=go:\n", out: "go"},
+		{in: "1\n2\n3\n4\n5\n6\n7\n8\n# vim: filetype=python\n", out: "python"},
+		{in: "1\n2\n3\n4\n5\n# vi: syntax=c\n7\n8\n9\n10\n11\n", out: ""},
+		{in: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n# vim:ft=python\n\n", out: "python"},
+		{in: "novim: ft=python", out: ""},
+	}
+	for _, test := range tests {
+		if out := modeline(test.in); out != test.out {
+			t.Errorf("got %q, expected %q for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestFilePatternConfidence(t *testing.T) {
+	tests := []struct {
+		in  string
+		out float64
+	}{
+		{in: "Makefile", out: FileNameConfidence},
+		{in: "*.go", out: FilePatternConfidence + 0.03},
+		{in: "*.[ch]", out: FilePatternConfidence + 0.01},
+		{in: "*.d.ts", out: FilePatternConfidence + 0.05},
+		{in: "*.very-long-extension", out: FilePatternConfidence + 0.1},
+	}
+	for _, test := range tests {
+		if out := filePatternConfidence(test.in); out < test.out-1e-9 || out > test.out+1e-9 {
+			t.Errorf("got %f, expected %f for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestDetectLexer(t *testing.T) {
+	newLexerInfo := func(name string, fileNames, mimeTypes, interpreters []string, signature string) *LexerInfo {
+		return &LexerInfo{
+			Names:        []string{name},
+			FileNames:    fileNames,
+			MimeTypes:    mimeTypes,
+			Interpreters: interpreters,
+			NewLexer: func(text string, stopMarkers ...string) (Lexer, error) {
+				return &DummyLexer{score: 5 * strings.Count(text, signature)}, nil
+			},
+		}
+	}
+	c := newLexerInfo("detect-c", []string{"*.c", "*.h"}, []string{"text/x-detect-c"}, nil, "printf")
+	cpp := newLexerInfo("detect-cpp", []string{"*.cpp", "*.h"}, nil, nil, "::")
+	py := newLexerInfo("detect-py", []string{"*.py"}, nil, []string{"python*"}, "def ")
+	mk := newLexerInfo("detect-make", []string{"Makefile", "*.mk"}, nil, nil, "$(")
+	for _, info := range []*LexerInfo{c, cpp, py, mk} {
+		registerTestLexer(t, info)
+	}
+	tests := []struct {
+		fileName, mimeType, text string
+		out                      []*LexerInfo
+	}{
+		{fileName: "x.h", text: "", out: []*LexerInfo{c, cpp}},
+		{fileName: "x.h", text: "std::cout", out: []*LexerInfo{cpp, c}},
+		{fileName: "dir/x.h", text: "printf", out: []*LexerInfo{c, cpp}},
+		{fileName: "Makefile", text: "", out: []*LexerInfo{mk}},
+		{fileName: "x.txt", mimeType: "text/x-detect-c", text: "", out: []*LexerInfo{c}},
+		{fileName: "x.py", mimeType: "text/x-detect-c", text: "def def def def", out: []*LexerInfo{py, c}},
+		{text: "#!/usr/bin/env python3\n", out: []*LexerInfo{py}},
+		{fileName: "x.h", text: "#!/usr/bin/python\n", out: []*LexerInfo{py, c, cpp}},
+		{fileName: "x.mk", text: "# vim: ft=detect-c\n", out: []*LexerInfo{c, mk}},
+	}
+	for _, test := range tests {
+		var out []*LexerInfo
+		var prev float64 = 1
+		for _, candidate := range DetectLexer(test.fileName, test.mimeType, test.text) {
+			if candidate.Confidence > prev || candidate.Confidence <= 0 {
+				t.Errorf("unexpected confidence %f after %f", candidate.Confidence, prev)
+			}
+			prev = candidate.Confidence
+			for _, info := range []*LexerInfo{c, cpp, py, mk} {
+				if candidate.Info == info {
+					out = append(out, info)
+				}
+			}
+		}
+		if !equalLexerInfos(out, test.out) {
+			t.Errorf("got %s, expected %s for %q %q %q", lexerInfoNames(out), lexerInfoNames(test.out),
+				test.fileName, test.mimeType, test.text)
+		}
+	}
+	// lexers are ranked by score when no other signal match
+	candidates := DetectLexer("", "", "$( $( $( $( $( $( $(")
+	if len(candidates) == 0 || candidates[0].Info != mk || candidates[0].Score != 35 {
+		t.Errorf("expected %s first by score in %v", mk.Names[0], candidates)
+	}
+}
+
+func TestDetectLexerAnalyseText(t *testing.T) {
+	var lexed, running, maxRunning int32
+	newLexerInfo := func(name string, fileNames []string, signature string) *LexerInfo {
+		return &LexerInfo{
+			Names:     []string{name},
+			FileNames: fileNames,
+			AnalyseText: func(text string) float64 {
+				if len(text) > 16 {
+					t.Errorf("got text prefix of %d bytes, expected at most 16", len(text))
+				}
+				if strings.Contains(text, signature) {
+					return 0.8
+				}
+				return 0
+			},
+			NewLexer: func(text string, stopMarkers ...string) (Lexer, error) {
+				atomic.AddInt32(&lexed, 1)
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				return &DummyLexer{score: strings.Count(text, signature)}, nil
+			},
+		}
+	}
+	a := newLexerInfo("analyse-a", []string{"*.ab"}, "aaa")
+	b := newLexerInfo("analyse-b", []string{"*.ab"}, "bbb")
+	registerTestLexer(t, a)
+	registerTestLexer(t, b)
+	opts := &DetectOptions{AnalysePrefixSize: 16, Workers: 2}
+
+	// the analysis breaks the file name tie without lexing
+	candidates := DetectLexerWithOptions("x.ab", "", "bbb                 aaa aaa", opts)
+	if len(candidates) < 2 || candidates[0].Info != b || candidates[1].Info != a {
+		t.Errorf("expected %s before %s in %v", b.Names[0], a.Names[0], candidates)
+	}
+	if lexed != 0 {
+		t.Errorf("got %d lexers run, expected 0", lexed)
+	}
+	// the score breaks the remaining tie
+	candidates = DetectLexerWithOptions("x.ab", "", "                 aaa bbb aaa", opts)
+	if len(candidates) < 2 || candidates[0].Info != a || candidates[0].Score != 2 || candidates[1].Score != 1 {
+		t.Errorf("expected %s first with score 2 in %v", a.Names[0], candidates)
+	}
+	if lexed != 2 {
+		t.Errorf("got %d lexers run, expected 2", lexed)
+	}
+	// all the lexers are run when no signal match
+	atomic.StoreInt32(&lexed, 0)
+	atomic.StoreInt32(&maxRunning, 0)
+	candidates = DetectLexerWithOptions("", "", "                 aaa", &DetectOptions{AnalysePrefixSize: 16, Workers: 1})
+	var names []string
+	for _, c := range candidates {
+		names = append(names, c.Info.Names[0])
+	}
+	if list := strings.Join(names, ","); !strings.Contains(list, "analyse-a") || strings.Contains(list, "analyse-b") {
+		t.Errorf("expected only %s in %s", a.Names[0], list)
+	}
+	if lexed != 2 || maxRunning != 1 {
+		t.Errorf("got %d lexers run with at most %d concurrently, expected 2 and 1", lexed, maxRunning)
+	}
+}
+
+func TestTextPrefix(t *testing.T) {
+	tests := []struct {
+		in   string
+		size int
+		out  string
+	}{
+		{in: "abc", size: 2, out: "ab"},
+		{in: "abc", size: 3, out: "abc"},
+		{in: "aé", size: 2, out: "a"},
+		{in: "aé", size: 3, out: "aé"},
+	}
+	for _, test := range tests {
+		if out := textPrefix(test.in, test.size); out != test.out {
+			t.Errorf("got %q, expected %q for %q and %d", out, test.out, test.in, test.size)
+		}
+	}
+}
+
+func equalLexerInfos(a, b []*LexerInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func lexerInfoNames(infos []*LexerInfo) string {
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Names[0]
+	}
+	return strings.Join(names, ", ")
+}
@@ -29,3 +29,50 @@ func (l Lexeme) IsA(t *LexemeType) bool {
 	}
 	return l.Type.IsA(t)
 }
+
+// A Position is the location of a lexeme in the input text.
+type Position struct {
+	Offset int // Byte offset, starting at 0.
+	Line   int // Line number, starting at 1.
+	Column int // Column number in runes, starting at 1.
+}
+
+// StartPosition is the position of the first lexeme of a text.
+var StartPosition = Position{Offset: 0, Line: 1, Column: 1}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Advance return the position following str when str is at position p.
+func (p Position) Advance(str string) Position {
+	p.Offset += len(str)
+	for _, r := range str {
+		if r == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	return p
+}
+
+// add return the position rel, relative to a text starting at position p, as
+// a position in the text containing it.
+func (p Position) add(rel Position) Position {
+	p.Offset += rel.Offset
+	if rel.Line > 1 {
+		p.Line += rel.Line - 1
+		p.Column = rel.Column
+	} else {
+		p.Column += rel.Column - 1
+	}
+	return p
+}
+
+// A Positioner is a Lexer able to return the position of the last lexeme
+// returned by NextLexeme.
+type Positioner interface {
+	Position() Position
+}
@@ -40,3 +40,24 @@ func TestLexeme(t *testing.T) {
 		t.Error("expected lexeme type not to be nil")
 	}
 }
+
+func TestPositionAdvance(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Position
+	}{
+		{in: "", out: Position{Offset: 0, Line: 1, Column: 1}},
+		{in: "abc", out: Position{Offset: 3, Line: 1, Column: 4}},
+		{in: "äbc", out: Position{Offset: 4, Line: 1, Column: 4}},
+		{in: "ab\nc", out: Position{Offset: 4, Line: 2, Column: 2}},
+		{in: "ab\n\n", out: Position{Offset: 4, Line: 3, Column: 1}},
+	}
+	for _, test := range tests {
+		if out := StartPosition.Advance(test.in); out != test.out {
+			t.Errorf("got %+v, expected %+v for %q", out, test.out, test.in)
+		}
+	}
+	if s := (Position{Line: 3, Column: 7}).String(); s != "3:7" {
+		t.Errorf("got %q, expected %q", s, "3:7")
+	}
+}
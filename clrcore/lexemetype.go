@@ -189,4 +189,10 @@ var (
 	CodePunctuation = NewLexemeType(Code, "Code.Punctuation")
 	// CodeDelimiter is a delimiter (e.g. (), {}, [])
 	CodeDelimiter = NewLexemeType(Code, "Code.Delimiter")
+	// CodePreprocessor is a preprocessor directive (e.g. #include, #define)
+	CodePreprocessor = NewLexemeType(Code, "Code.Preprocessor")
+	// CodePreprocessorFile is the file of an include directive (e.g. <stdio.h>)
+	CodePreprocessorFile = NewLexemeType(CodePreprocessor, "Code.Preprocessor.File")
+	// CodeStringRegex is a regular expression literal (e.g. /ab+c/g)
+	CodeStringRegex = NewLexemeType(CodeString, "Code.String.Regex")
 )
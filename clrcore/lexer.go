@@ -2,7 +2,9 @@ package clrcore
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,9 +19,19 @@ type LexerInfo struct {
 	MimeTypes []string
 	// File name patterns used to identify language by file names.
 	FileNames []string
+	// Interpreters are the name patterns of the interpreters in #! lines
+	// identifying the language (e.g. "python*").
+	Interpreters []string
 	// NewLexer is a function instantiating a lexer ready to parse the given text.
 	// The lexer will return a StopLexer when one of the stopMarkers is found in the text.
 	NewLexer func(text string, stopMarkers ...string) (Lexer, error)
+	// AnalyseText is an optional function returning the likelihood, in [0,1],
+	// that the text is in the language. It is a cheap signature based detection
+	// applied to a prefix of the text. See DetectLexer.
+	AnalyseText func(text string) float64
+	// NewReaderLexer is an optional function instantiating a lexer parsing the text
+	// read from r as it goes. See NewLexerFromReader.
+	NewReaderLexer func(r io.Reader, stopMarkers ...string) (Lexer, error)
 }
 
 // A Lexer has a lexeme iterator method NextLexeme() iterator methods.
@@ -49,34 +61,43 @@ func RegisterLexer(l *LexerInfo) {
 	if l == nil {
 		return
 	}
+	if err := checkLexer(l); err != nil {
+		panic(err.Error())
+	}
+	for _, name := range l.Names {
+		lexersByName[name] = l
+	}
+	lexersList = append(lexersList, l)
+	for _, mimeType := range l.MimeTypes {
+		lexersByMimeType[mimeType] = append(lexersByMimeType[mimeType], l)
+	}
+	for _, fileName := range l.FileNames {
+		lexersByFileName[fileName] = append(lexersByFileName[fileName], l)
+	}
+}
+
+// checkLexer return an error if the lexer is invalid or one of its names is
+// already registered.
+func checkLexer(l *LexerInfo) error {
 	if len(l.Names) == 0 {
-		panic("lexer has no names defined")
+		return errors.New("lexer has no names defined")
 	}
 	if l.NewLexer == nil {
-		panic("lexer has no NewLexer function defined")
+		return errors.New("lexer has no NewLexer function defined")
 	}
 	// check for name duplicates
 	for _, name := range l.Names {
 		if _, ok := lexersByName[name]; ok {
-			panic(fmt.Sprintf("lexer name %q already registered", name))
+			return fmt.Errorf("lexer name %q already registered", name)
 		}
 	}
 	// check that fileNames are valid
 	for _, fileName := range l.FileNames {
 		if _, err := filepath.Match(fileName, "     "); err != nil {
-			panic(fmt.Sprintf("lexer %q has invalid file name pattern %q", l.Names[0], fileName))
+			return fmt.Errorf("lexer %q has invalid file name pattern %q", l.Names[0], fileName)
 		}
 	}
-	for _, name := range l.Names {
-		lexersByName[name] = l
-	}
-	lexersList = append(lexersList, l)
-	for _, mimeType := range l.MimeTypes {
-		lexersByMimeType[mimeType] = append(lexersByMimeType[mimeType], l)
-	}
-	for _, fileName := range l.FileNames {
-		lexersByFileName[fileName] = append(lexersByFileName[fileName], l)
-	}
+	return nil
 }
 
 // Lexers return a copy of list of all the LexerInfo.
@@ -98,7 +119,8 @@ func LexersByMimeType(mimeType string) []*LexerInfo {
 	return append([]*LexerInfo(nil), q...)
 }
 
-// LexersByFileName return a list of lexers whose file name pattern match the given file name.
+// LexersByFileName return a list of lexers whose file name pattern match the given file name,
+// in registration order.
 func LexersByFileName(fileName string) []*LexerInfo {
 	if fileName == "" || fileName[len(fileName)-1] == os.PathSeparator {
 		return nil
@@ -109,43 +131,66 @@ func LexersByFileName(fileName string) []*LexerInfo {
 			break
 		}
 	}
-	matchedLexers := make(map[*LexerInfo]struct{})
-	for k, v := range lexersByFileName {
-		if ok, _ := filepath.Match(k, fileName); ok {
-			for _, l := range v {
-				matchedLexers[l] = struct{}{}
+	var res []*LexerInfo
+	for _, l := range lexersList {
+		for _, pattern := range l.FileNames {
+			if ok, _ := filepath.Match(pattern, fileName); ok {
+				res = append(res, l)
+				break
 			}
 		}
 	}
-	res := make([]*LexerInfo, 0, len(matchedLexers))
-	for l := range matchedLexers {
-		res = append(res, l)
-	}
 	return res
 }
 
-// LexerByScore select the lexer from the lexers slice with the highest score.
-// When two or more lexers have the same highest score, the first one is picked.
-// It is thus advised to order the lexers by decreasing preference order.
-// If lexers is nil, the search is performed on all lexers.
+// LexerByScore select the lexer from the lexers slice most likely to parse
+// the text. The lexers with the highest AnalyseText value on a prefix of the
+// text, up to the first stop marker, are the candidates. When there is more
+// than one, the text is lexed by each candidate, and the one with the highest
+// score is picked. When two or more lexers have the same highest score, the
+// first one is picked. It is thus advised to order the lexers by decreasing
+// preference order. Return nil if no lexer has an AnalyseText value or a
+// score greater than 0. If lexers is nil, the search is performed on all lexers.
 func LexerByScore(text string, lexers []*LexerInfo, stopMarkers ...string) *LexerInfo {
 	if lexers == nil {
 		lexers = lexersList
 	}
-	var bestScore int
-	var bestLexer *LexerInfo
-	for _, lexer := range lexers {
-		l, err := lexer.NewLexer(text, stopMarkers...)
-		if err != nil || l == nil {
-			continue
+	prefix := textPrefix(text, 0)
+	for _, marker := range stopMarkers {
+		if i := strings.Index(prefix, marker); marker != "" && i >= 0 {
+			prefix = prefix[:i]
 		}
-		for !l.NextLexeme().Type.IsA(Stop) {
+	}
+	var candidates []Candidate
+	for _, info := range lexers {
+		var c float64
+		if info.AnalyseText != nil {
+			c = info.AnalyseText(prefix)
 		}
-		if l.Score() > bestScore {
-			bestScore = l.Score()
-			bestLexer = lexer
+		switch {
+		case len(candidates) == 0 || c > candidates[0].Confidence:
+			candidates = append(candidates[:0], Candidate{Info: info, Confidence: c})
+		case c == candidates[0].Confidence:
+			candidates = append(candidates, Candidate{Info: info, Confidence: c})
 		}
 	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if len(candidates) > 1 || candidates[0].Confidence <= 0 {
+		scoreCandidates(candidates, text, 0, stopMarkers...)
+	}
+	var bestScore int
+	var bestLexer *LexerInfo
+	for _, c := range candidates {
+		if c.Score > bestScore {
+			bestScore = c.Score
+			bestLexer = c.Info
+		}
+	}
+	if bestLexer == nil && candidates[0].Confidence > 0 {
+		bestLexer = candidates[0].Info
+	}
 	return bestLexer
 }
 
@@ -2,6 +2,9 @@ package clrcore
 
 import (
 	"path"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -126,6 +129,42 @@ func (l *DummyLexer) Score() int {
 	return l.score
 }
 
+// registerTestLexer registers the lexer until the end of the test, so that it
+// doesn't take part in the lexer selections of the other tests.
+func registerTestLexer(t *testing.T, l *LexerInfo) {
+	RegisterLexer(l)
+	t.Cleanup(func() { unregisterLexer(l) })
+}
+
+// unregisterLexer removes the lexer from the registry.
+func unregisterLexer(l *LexerInfo) {
+	for _, name := range l.Names {
+		delete(lexersByName, name)
+	}
+	lexersList = removeLexer(lexersList, l)
+	for _, mimeType := range l.MimeTypes {
+		if lexersByMimeType[mimeType] = removeLexer(lexersByMimeType[mimeType], l); len(lexersByMimeType[mimeType]) == 0 {
+			delete(lexersByMimeType, mimeType)
+		}
+	}
+	for _, fileName := range l.FileNames {
+		if lexersByFileName[fileName] = removeLexer(lexersByFileName[fileName], l); len(lexersByFileName[fileName]) == 0 {
+			delete(lexersByFileName, fileName)
+		}
+	}
+}
+
+// removeLexer return a copy of lexers without l.
+func removeLexer(lexers []*LexerInfo, l *LexerInfo) []*LexerInfo {
+	var res []*LexerInfo
+	for _, info := range lexers {
+		if info != l {
+			res = append(res, info)
+		}
+	}
+	return res
+}
+
 func TestLexerByScore(t *testing.T) {
 	l1 := &LexerInfo{
 		Names: []string{"l1"},
@@ -159,6 +198,55 @@ func TestLexerByScore(t *testing.T) {
 	}
 }
 
+func TestLexerByScoreAnalyse(t *testing.T) {
+	var mu sync.Mutex
+	var lexed []string
+	newLexerInfo := func(name string, analyse float64, score int) *LexerInfo {
+		return &LexerInfo{
+			Names: []string{name},
+			AnalyseText: func(text string) float64 {
+				if strings.Contains(text, "stop") {
+					t.Errorf("got text after the stop marker in %q", text)
+				}
+				return analyse
+			},
+			NewLexer: func(text string, stopMarkers ...string) (Lexer, error) {
+				mu.Lock()
+				lexed = append(lexed, name)
+				mu.Unlock()
+				return &DummyLexer{score: score}, nil
+			},
+		}
+	}
+	a := newLexerInfo("a", 0.2, 20)
+	b := newLexerInfo("b", 0.5, 0)
+	c := newLexerInfo("c", 0.5, 10)
+	d := newLexerInfo("d", 0, 0)
+	tests := []struct {
+		lexers []*LexerInfo
+		out    *LexerInfo
+		lexed  string
+	}{
+		{lexers: []*LexerInfo{a, b}, out: b, lexed: ""},
+		{lexers: []*LexerInfo{a, b, c}, out: c, lexed: "b,c"},
+		{lexers: []*LexerInfo{b, b}, out: b, lexed: "b,b"},
+		{lexers: []*LexerInfo{d, a}, out: a, lexed: ""},
+		{lexers: []*LexerInfo{d}, out: nil, lexed: "d"},
+		{lexers: []*LexerInfo{}, out: nil, lexed: ""},
+	}
+	for _, test := range tests {
+		lexed = nil
+		out := LexerByScore("text stop", test.lexers, "stop")
+		if out != test.out {
+			t.Errorf("got lexer %p, expected %p for %d lexers", out, test.out, len(test.lexers))
+		}
+		sort.Strings(lexed)
+		if got := strings.Join(lexed, ","); got != test.lexed {
+			t.Errorf("got lexers %q run, expected %q", got, test.lexed)
+		}
+	}
+}
+
 func TestNormalize(t *testing.T) {
 	tests := []struct {
 		inStr    string
@@ -2,19 +2,52 @@ package clrcore
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"regexp"
+	"regexp/syntax"
 	"sync"
+
+	"github.com/chmike/clrz/clrregexp"
 )
 
 // LexerDef is a list of LexerDefMode instances initialized once.
+// At initialization, the rules of each mode are indexed by the bytes their
+// match may start with, so that only the rules that may match the text are
+// tried. Adjacent regex rules with a bounded match length are merged into one
+// regexp.
 type LexerDef struct {
-	Name     string
-	Modes    []*LexerDefMode  // List of lexer modes, first is entry point.
-	InitFunc LexerDefInitFunc // Lexer definition initialization function.
-	once     sync.Once        // Ensure the definition is initialized only once at first use.
+	Name       string
+	Modes      []*LexerDefMode          // List of lexer modes, first is entry point.
+	InitFunc   LexerDefInitFunc         // Lexer definition initialization function.
+	NoOptimize bool                     // Try all rules of the mode in sequence (for benchmarks and debugging).
+	Recovery   Recovery                 // Policy when no rule of the current mode matches the text.
+	once       sync.Once                // Ensure the definition is initialized only once at first use.
+	modeByName map[string]*LexerDefMode // Index of the modes by name.
 }
 
+// Recovery is the policy of a LexerEngine when no rule of the current mode
+// matches the text. The recovered text is output and the lexing goes on with
+// the next rules. The zero value stops the lexer with a StopLexer lexeme.
+type Recovery uint8
+
+const (
+	// RecoverRune outputs the unmatched rune as a TextInvalid lexeme.
+	RecoverRune Recovery = 1 << iota
+	// RecoverWord outputs the unmatched text up to the next white space as a
+	// TextInvalid lexeme.
+	RecoverWord
+	// RecoverNewLine outputs an unmatched newline as a TextNewLine lexeme and
+	// resets the mode to the root mode, like the Pygments lexers. After text
+	// was recovered, the mode is also reset at the next newline matched by a
+	// rule, so that an error doesn't leave the lexer in a wrong mode.
+	RecoverNewLine
+)
+
+// RecoveryPenalty is the value subtracted from the score of a LexerEngine for
+// each TextInvalid lexeme output by its Recovery.
+const RecoveryPenalty = 1
+
 // LexerDefInitFunc is a function that initialize a LexerDef.
 // It is called once at first LexerDef use.
 type LexerDefInitFunc func(d *LexerDef)
@@ -26,6 +59,9 @@ type LexerDefInitFunc func(d *LexerDef)
 type LexerDefMode struct {
 	Name  string         // LexerDefMode name used for referencing (reserved: "root")
 	Rules []LexerDefRule // Rules executed in sequence until one return true.
+
+	steps    []ruleStep       // All rules of the mode.
+	dispatch *[256][]ruleStep // Rules that may match a text starting with the byte, or nil.
 }
 
 // A LexerDefRule defines a condition and action to perform.
@@ -45,7 +81,14 @@ func (d *LexerDef) Init() (err error) {
 			err = fmt.Errorf("LexerDef %q has no modes", d.Name)
 			return
 		}
+		if err = d.expandIncludes(); err != nil {
+			return
+		}
+		d.modeByName = make(map[string]*LexerDefMode, len(d.Modes))
 		for _, m := range d.Modes {
+			if _, ok := d.modeByName[m.Name]; !ok {
+				d.modeByName[m.Name] = m
+			}
 			if len(m.Rules) == 0 {
 				err = fmt.Errorf("mode %q in LexerDef %q has no rules", m.Name, d.Name)
 				return
@@ -56,11 +99,79 @@ func (d *LexerDef) Init() (err error) {
 					return
 				}
 			}
+			m.optimize(!d.NoOptimize)
 		}
 	})
 	return
 }
 
+// expandIncludes replaces the IncludeRules of the modes with the rules of the
+// included modes.
+func (d *LexerDef) expandIncludes() error {
+	modes := make(map[string]*LexerDefMode)
+	for _, m := range d.Modes {
+		modes[m.Name] = m
+	}
+	expanded := make(map[*LexerDefMode][]LexerDefRule)
+	active := make(map[*LexerDefMode]bool)
+	var expand func(m *LexerDefMode) ([]LexerDefRule, error)
+	expand = func(m *LexerDefMode) ([]LexerDefRule, error) {
+		if rules, ok := expanded[m]; ok {
+			return rules, nil
+		}
+		active[m] = true
+		var rules []LexerDefRule
+		for i, r := range m.Rules {
+			inc, ok := r.(*IncludeRule)
+			if !ok {
+				rules = append(rules, r)
+				continue
+			}
+			im := modes[inc.Mode]
+			switch {
+			case im == nil:
+				return nil, fmt.Errorf("include of unknown mode '%s' (LexerDef=%q, Mode=%q, Rule=%d)", inc.Mode, d.Name, m.Name, i)
+			case active[im]:
+				return nil, fmt.Errorf("recursive include of mode '%s' (LexerDef=%q, Mode=%q, Rule=%d)", inc.Mode, d.Name, m.Name, i)
+			}
+			sub, err := expand(im)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, sub...)
+		}
+		delete(active, m)
+		expanded[m] = rules
+		return rules, nil
+	}
+	for _, m := range d.Modes {
+		rules, err := expand(m)
+		if err != nil {
+			return err
+		}
+		m.Rules = rules
+	}
+	return nil
+}
+
+// IncludeRule is replaced by the rules of the named mode of the LexerDef when
+// it is initialized.
+type IncludeRule struct {
+	Mode string // Name of the included mode.
+}
+
+// Init initializes the IncludeRule.
+func (r *IncludeRule) Init() error {
+	return nil
+}
+
+// Exec sets an error because an IncludeRule must be replaced by the rules of
+// the included mode.
+func (r *IncludeRule) Exec(l *LexerEngine) bool {
+	l.err = fmt.Errorf("unexpanded include of mode '%s' (LexerDef='%s', Mode='%s', Rule=%d)", r.Mode, l.def.Name, l.mode.Name, l.ruleIdx)
+	return true
+}
+
 // FuncDefRule is for an Exec function defined in the LexerDef.
 type FuncDefRule struct {
 	ExecFunc FuncDefRuleExec
@@ -81,12 +192,48 @@ func (r *FuncDefRule) Exec(l *LexerEngine) bool {
 	return r.ExecFunc(l)
 }
 
+// RegexEngine is the regular expression engine of a RegexDefRule.
+type RegexEngine int
+
+const (
+	// AutoEngine uses the RE2Engine, or the BacktrackEngine when the regex is
+	// not supported by the RE2Engine.
+	AutoEngine RegexEngine = iota
+	// RE2Engine is the regexp package. Its matching time is linear, but it
+	// doesn't support lookarounds, backreferences, possessive quantifiers and
+	// atomic groups.
+	RE2Engine
+	// BacktrackEngine is the clrregexp package, compatible with the Python
+	// regular expressions of the Pygments lexers. The number of steps of a
+	// match is limited.
+	BacktrackEngine
+)
+
+// String return the name of the regex engine.
+func (e RegexEngine) String() string {
+	switch e {
+	case AutoEngine:
+		return "auto"
+	case RE2Engine:
+		return "re2"
+	case BacktrackEngine:
+		return "backtrack"
+	}
+	return fmt.Sprintf("RegexEngine(%d)", int(e))
+}
+
 // RegexDefRule is a regex rule with an associated function.
 type RegexDefRule struct {
-	Re   string           // regex pattern to trigger RegexDefRule
-	Do   RegexDefRuleFunc // action to perform when this RegexDefRule is triggered
-	cp   *regexp.Regexp   // compiled regex RegexDefRule wrapped in "^(?<re>)"
-	once sync.Once        // to ensure it's compiled only once
+	Re        string            // regex pattern to trigger RegexDefRule
+	Do        RegexDefRuleFunc  // action to perform when this RegexDefRule is triggered
+	Engine    RegexEngine       // regex engine, AutoEngine by default
+	StepLimit int               // maximum number of steps of a BacktrackEngine match, clrregexp.DefaultStepLimit if 0
+	cp        *regexp.Regexp    // compiled regex RegexDefRule wrapped in "^(?<re>)"
+	bt        *clrregexp.Regexp // compiled regex when using the BacktrackEngine
+	first     byteSet           // bytes a match may start with
+	nullable  bool              // true if the regex may match the empty string
+	bounded   bool              // true if the regex match length is bounded
+	once      sync.Once         // to ensure it's compiled only once
 }
 
 // RegexDefRuleFunc is a function called when the associated regex is triggered.
@@ -99,24 +246,74 @@ var bufPool = sync.Pool{
 	},
 }
 
-// Init initialize the regex def rule only once.
+// Init initialize the regex def rule only once. With the AutoEngine, the error
+// of the BacktrackEngine is returned when both engines fail to compile the regex.
 func (r *RegexDefRule) Init() (err error) {
 	r.once.Do(func() {
-		buf := bufPool.Get().(*bytes.Buffer)
-		defer bufPool.Put(buf)
-		buf.Reset()
-		fmt.Fprintf(buf, `\A(?:%s)`, r.Re)
-		if r.cp, err = regexp.Compile(buf.String()); err != nil {
+		switch r.Engine {
+		case AutoEngine, RE2Engine:
+			if err = r.compileRE2(); err == nil || r.Engine == RE2Engine {
+				return
+			}
+		case BacktrackEngine:
+		default:
+			err = fmt.Errorf("invalid regex engine %d", int(r.Engine))
 			return
 		}
+		if r.bt, err = clrregexp.Compile(r.Re); err != nil {
+			return
+		}
+		r.bt = r.bt.WithStepLimit(r.StepLimit)
+		// any byte may start a match
+		r.first, r.nullable = byteSet{}, true
 	})
 	return
 }
 
+// compileRE2 compiles the regex with the RE2Engine.
+func (r *RegexDefRule) compileRE2() (err error) {
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(buf)
+	buf.Reset()
+	fmt.Fprintf(buf, `\A(?:%s)`, r.Re)
+	if r.cp, err = regexp.Compile(buf.String()); err != nil {
+		return
+	}
+	var re *syntax.Regexp
+	if re, err = syntax.Parse(buf.String(), syntax.Perl); err != nil {
+		return
+	}
+	r.first, r.nullable = firstBytes(re)
+	r.bounded = boundedRegexp(re)
+	return
+}
+
+// UsedEngine return the engine used by the initialized rule, RE2Engine or
+// BacktrackEngine. It return AutoEngine when the rule is not initialized.
+func (r *RegexDefRule) UsedEngine() RegexEngine {
+	switch {
+	case r.bt != nil:
+		return BacktrackEngine
+	case r.cp != nil:
+		return RE2Engine
+	}
+	return AutoEngine
+}
+
 // Exec executes the regex def rule. Return true when execution of rules must
 // restart from the first rule of the mode.
 func (r *RegexDefRule) Exec(l *LexerEngine) bool {
+	if r.bt != nil {
+		return r.execBacktrack(l)
+	}
 	match := r.cp.FindStringSubmatchIndex(l.str)
+	// when reading from an io.Reader, the match may continue in the next chunk
+	for match != nil && match[1] == len(l.str) && l.readChunk() {
+		match = r.cp.FindStringSubmatchIndex(l.str)
+	}
+	if l.err != nil {
+		return true
+	}
 	if match == nil {
 		return false
 	}
@@ -124,6 +321,59 @@ func (r *RegexDefRule) Exec(l *LexerEngine) bool {
 	return r.Do(l, match)
 }
 
+// execBacktrack executes the regex def rule with the BacktrackEngine. The text
+// preceding the remaining text is visible to the lookbehind assertions.
+func (r *RegexDefRule) execBacktrack(l *LexerEngine) bool {
+	off := len(l.text) - len(l.str)
+	match, hitEnd, err := r.bt.MatchAtHitEnd(l.text, off)
+	// when reading from an io.Reader, the match may depend on the next chunk
+	for err == nil && hitEnd && l.readChunk() {
+		off = len(l.text) - len(l.str)
+		match, hitEnd, err = r.bt.MatchAtHitEnd(l.text, off)
+	}
+	if err != nil {
+		l.err = fmt.Errorf("%s (LexerDef='%s', Mode='%s', Rule=%d)", err, l.def.Name, l.mode.Name, l.ruleIdx)
+	}
+	if l.err != nil {
+		return true
+	}
+	if match == nil {
+		return false
+	}
+	// the match indexes are relative to the remaining text
+	for i := range match {
+		if match[i] >= 0 {
+			match[i] -= off
+		}
+	}
+	return r.Do(l, match)
+}
+
+// RuleEngine is the regex engine used by a RegexDefRule of a LexerDef.
+type RuleEngine struct {
+	Mode   string      // Name of the mode.
+	Rule   int         // Index of the rule in the mode.
+	Re     string      // Regex of the rule.
+	Engine RegexEngine // RE2Engine or BacktrackEngine.
+}
+
+// RuleEngines return the regex engine used by each RegexDefRule of the
+// LexerDef, in mode and rule order. The LexerDef is initialized if required.
+func (d *LexerDef) RuleEngines() ([]RuleEngine, error) {
+	if err := d.Init(); err != nil {
+		return nil, err
+	}
+	var res []RuleEngine
+	for _, m := range d.Modes {
+		for i, r := range m.Rules {
+			if rr, ok := r.(*RegexDefRule); ok {
+				res = append(res, RuleEngine{Mode: m.Name, Rule: i, Re: rr.Re, Engine: rr.UsedEngine()})
+			}
+		}
+	}
+	return res, nil
+}
+
 // All execute list of RegexDefRuleFunc in sequence, abort when l.err is not nil.
 // The last action return value yields the return value.
 func All(actions ...RegexDefRuleFunc) RegexDefRuleFunc {
@@ -138,6 +388,45 @@ func All(actions ...RegexDefRuleFunc) RegexDefRuleFunc {
 	}
 }
 
+// PopMatchAs returns a function that extracts the whole match as one lexeme of
+// type t, ignoring the groups of the regexp.
+func PopMatchAs(t *LexemeType) RegexDefRuleFunc {
+	return func(l *LexerEngine, match []int) bool {
+		l.PopLexeme(t, match[1])
+		return true
+	}
+}
+
+// PopWith returns a function that extracts the lexeme found by pop, a Lexeme
+// method like Lexeme.PopTripleDoubleQuotedString, in the remaining text starting
+// at the first group of the match. The text preceding the group, like a string
+// prefix, is included in the lexeme. The rule doesn't match when pop return a
+// nil lexeme. When reading from an io.Reader, the input is read until the lexeme
+// ends before the end of the buffered text.
+func PopWith(pop func(*Lexeme) Lexeme) RegexDefRuleFunc {
+	return func(l *LexerEngine, match []int) bool {
+		if len(match) < 4 || match[2] < 0 {
+			l.err = fmt.Errorf("no first group in the match (LexerDef='%s', Mode='%s', Rule=%d)", l.def.Name, l.mode.Name, l.ruleIdx)
+			return true
+		}
+		start := match[2]
+		rest := Lexeme{Str: l.str[start:]}
+		lexeme := pop(&rest)
+		for len(rest.Str) == 0 && l.readChunk() {
+			rest = Lexeme{Str: l.str[start:]}
+			lexeme = pop(&rest)
+		}
+		if l.err != nil {
+			return true
+		}
+		if lexeme.IsNil() {
+			return false
+		}
+		l.PopLexeme(lexeme.Type, start+len(lexeme.Str))
+		return true
+	}
+}
+
 // PopMatch returns a function that extracts matching lexemes from the input string,
 // and assign the given lexeme type to each group.
 // The number of lexeme types must match the number of groups, or it must be one
@@ -156,8 +445,9 @@ func PopMatch(lexemeTypes ...*LexemeType) RegexDefRuleFunc {
 			// if match[0] != 0 {
 			// 	l.QueueLexeme(Lexeme{Type: Text, Str: l.str[:match[0]]})
 			// }
-			l.QueueLexeme(Lexeme{Type: lexemeTypes[0], Str: l.str[match[0]:match[1]]})
-			l.str = l.str[match[1]:]
+			if l.QueueLexeme(Lexeme{Type: lexemeTypes[0], Str: l.str[match[0]:match[1]]}); l.err == nil {
+				l.str = l.str[match[1]:]
+			}
 			return true
 		}
 		// The regexp has one or more groups
@@ -166,34 +456,70 @@ func PopMatch(lexemeTypes ...*LexemeType) RegexDefRuleFunc {
 			l.err = fmt.Errorf("invalid number of lexemeTypes (LexerDef='%s', Mode='%s', Rule=%d)", l.def.Name, l.mode.Name, l.ruleIdx)
 			return true
 		}
-		maxEnd := 0
-		prevEnd := 0
-		for i := 1; i < n; i++ {
+		prevEnd := match[0]
+		for i := 1; i <= n; i++ {
 			beg, end := match[i*2], match[i*2+1]
-			if end <= maxEnd {
+			// skip unmatched and empty groups
+			if beg < 0 || beg == end {
+				continue
+			}
+			if beg < prevEnd {
+				// the text of the queued lexemes is not parsed again
+				l.str = l.str[prevEnd:]
 				l.err = fmt.Errorf("overlapping regex groups (LexerDef='%s', Mode='%s', Rule=%d)", l.def.Name, l.mode.Name, l.ruleIdx)
 				return true
 			}
 			if prevEnd < beg {
 				l.QueueLexeme(Lexeme{Type: Text, Str: l.str[prevEnd:beg]})
 			}
-			if beg != end {
-				l.QueueLexeme(Lexeme{Type: lexemeTypes[i], Str: l.str[beg:end]})
-			}
-			if maxEnd < end {
-				maxEnd = end
+			if l.QueueLexeme(Lexeme{Type: lexemeTypes[i-1], Str: l.str[beg:end]}); l.err != nil {
+				// the text of the queued lexemes is not parsed again
+				l.str = l.str[beg:]
+				return true
 			}
 			prevEnd = end
 		}
-		beg, end := match[len(match)-1], match[1]
-		if beg < end {
-			if end <= maxEnd {
+		if prevEnd < match[1] {
+			l.QueueLexeme(Lexeme{Type: Text, Str: l.str[prevEnd:match[1]]})
+		}
+		l.str = l.str[match[1]:]
+		return true
+	}
+}
+
+// ByGroups returns a function that applies each action to the text of its group
+// as if it was the whole match, like the Pygments bygroups. The groups following
+// the groups of the actions are ignored, and the number of actions can't exceed
+// the number of groups. Text outside of the groups is output as lexeme of type
+// Text. Groups containing no chars are skipped.
+func ByGroups(actions ...RegexDefRuleFunc) RegexDefRuleFunc {
+	return func(l *LexerEngine, match []int) bool {
+		if len(actions) > len(match)/2-1 {
+			l.err = fmt.Errorf("invalid number of group actions (LexerDef='%s', Mode='%s', Rule=%d)", l.def.Name, l.mode.Name, l.ruleIdx)
+			return true
+		}
+		// pos is the position in the match of the remaining text
+		pos := match[0]
+		for i, action := range actions {
+			beg, end := match[i*2+2], match[i*2+3]
+			if beg < 0 || beg == end {
+				continue
+			}
+			if beg < pos {
 				l.err = fmt.Errorf("overlapping regex groups (LexerDef='%s', Mode='%s', Rule=%d)", l.def.Name, l.mode.Name, l.ruleIdx)
 				return true
 			}
-			l.QueueLexeme(Lexeme{Type: Text, Str: l.str[beg:end]})
+			if pos < beg {
+				l.PopLexeme(Text, beg-pos)
+			}
+			if action(l, []int{0, end - beg}); l.err != nil {
+				return true
+			}
+			pos = end
+		}
+		if pos < match[1] {
+			l.PopLexeme(Text, match[1]-pos)
 		}
-		l.str = l.str[end:]
 		return true
 	}
 }
@@ -222,6 +548,96 @@ func PopMode() RegexDefRuleFunc {
 	}
 }
 
+// PushCurrentMode add current mode to stack, leaving the current mode unchanged.
+func PushCurrentMode() RegexDefRuleFunc {
+	return func(l *LexerEngine, match []int) bool {
+		l.modeStack = append(l.modeStack, l.mode)
+		return true
+	}
+}
+
+// PopModes set current mode to the one removed n times from the top of the mode
+// stack. Unlike PopMode, popping an empty mode stack leaves the current mode
+// unmodified without error, as the Pygments "#pop" states do.
+func PopModes(n int) RegexDefRuleFunc {
+	return func(l *LexerEngine, match []int) bool {
+		for i := 0; i < n && len(l.modeStack) > 0; i++ {
+			l.PopMode()
+		}
+		return true
+	}
+}
+
+// LexMatch returns a function that lexes the whole match with the lexer
+// registered with the given name, and queues its lexemes as if output by l. An
+// empty lexerName selects the LexerDef of l, starting with the given mode pushed
+// over its first mode when mode is not empty. The score of the lexer is added to
+// the score of l, and the text it couldn't lex is queued as a Text lexeme.
+func LexMatch(lexerName, mode string) RegexDefRuleFunc {
+	return func(l *LexerEngine, match []int) bool {
+		text := l.str[:match[1]]
+		var sub Lexer
+		if lexerName == "" {
+			e, err := NewLexerEngine(l.def, text, nil, l.extend)
+			if err != nil {
+				l.err = err
+				return true
+			}
+			if mode != "" {
+				if e.PushMode(mode); e.err != nil {
+					l.err = e.err
+					return true
+				}
+			}
+			sub = e
+		} else {
+			info := LexerByName(lexerName)
+			if info == nil {
+				l.err = fmt.Errorf("unknown lexer '%s' (LexerDef='%s', Mode='%s', Rule=%d)", lexerName, l.def.Name, l.mode.Name, l.ruleIdx)
+				return true
+			}
+			var err error
+			if sub, err = info.NewLexer(text); err != nil {
+				l.err = err
+				return true
+			}
+		}
+		for {
+			lexeme := sub.NextLexeme()
+			if lexeme.Type == StopError {
+				// the text of the queued lexemes is not parsed again
+				l.str = l.str[len(text)-len(sub.RemainingText()):]
+				l.err = errors.New(lexeme.Str)
+				return true
+			}
+			if lexeme.IsA(Stop) {
+				break
+			}
+			l.QueueLexeme(lexeme)
+		}
+		if rest := sub.RemainingText(); rest != "" {
+			l.QueueLexeme(Lexeme{Type: Text, Str: rest})
+		}
+		l.score += sub.Score()
+		l.str = l.str[match[1]:]
+		return true
+	}
+}
+
+// Using delegates the lexing of the remaining text to the lexer registered with
+// the given name until one of the stopMarkers is found. See LexerEngine.Delegate.
+func Using(lexerName string, stopMarkers ...string) RegexDefRuleFunc {
+	return func(l *LexerEngine, match []int) bool {
+		info := LexerByName(lexerName)
+		if info == nil {
+			l.err = fmt.Errorf("unknown lexer '%s' (LexerDef='%s', Mode='%s', Rule=%d)", lexerName, l.def.Name, l.mode.Name, l.ruleIdx)
+			return true
+		}
+		l.Delegate(info, stopMarkers...)
+		return true
+	}
+}
+
 // Predefined RegexLexerRules
 var (
 	WhiteSpaceRule        = &RegexDefRule{Re: `[ \t\f\v]+`, Do: PopMatch(TextWhiteSpace)}
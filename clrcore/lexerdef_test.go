@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestLexerDefInit(t *testing.T) {
@@ -115,7 +116,9 @@ func TestLexerDefExec(t *testing.T) {
 	}
 	lexemes = []Lexeme{
 		{Text, "10"},
-		{CodeIdentifierKeyword, "Test2"},
+		{CodeIdentifier, "Test2"},
+		{Text, " "},
+		{CodeIdentifierKeyword, "toto"},
 		{Text, " \n"},
 		{TextWhiteSpace, "  "},
 		{CodeIdentifierFunction, "ABC"},
@@ -199,7 +202,7 @@ func TestLexerDefExec(t *testing.T) {
 	}
 	lexemes = []Lexeme{
 		{Text, "13"},
-		{CodeIdentifierKeyword, "Test123"},
+		{CodeIdentifier, "Test123"},
 		{StopError, "overlapping regex groups (LexerDef='TestLexerDefExec', Mode='root', Rule=5)"},
 	}
 	for _, expect := range lexemes {
@@ -214,7 +217,7 @@ func TestLexerDefExec(t *testing.T) {
 	}
 	lexemes = []Lexeme{
 		{Text, "14"},
-		{CodeIdentifierKeyword, "Test123"},
+		{CodeIdentifier, "Test123"},
 		{StopError, "overlapping regex groups (LexerDef='TestLexerDefExec', Mode='root', Rule=6)"},
 	}
 	for _, expect := range lexemes {
@@ -277,3 +280,368 @@ func TestLexerDefPushPop(t *testing.T) {
 		t.Errorf("got score %d, expected %d", lexer.Score(), 5)
 	}
 }
+
+func TestPopMatchOptionalGroups(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestPopMatchOptionalGroups",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					WhiteSpaceRule,
+					&RegexDefRule{Re: "([a-z]+)(:)?( *)([0-9]+)",
+						Do: PopMatch(CodeIdentifier, CodePunctuation, TextWhiteSpace, CodeNumberInteger)},
+				}},
+			}
+		},
+	}
+	lexer, err := NewLexerEngine(def, "ab:12 cd 34", nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{CodeIdentifier, "ab"},
+		{CodePunctuation, ":"},
+		{CodeNumberInteger, "12"},
+		{TextWhiteSpace, " "},
+		{CodeIdentifier, "cd"},
+		{TextWhiteSpace, " "},
+		{CodeNumberInteger, "34"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+}
+
+func TestPopWith(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestPopWith",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					WhiteSpaceRule,
+					&RegexDefRule{Re: `[rb]?(""")`, Do: PopWith((*Lexeme).PopTripleDoubleQuotedString)},
+					&RegexDefRule{Re: `([-+.0-9])`, Do: PopWith((*Lexeme).PopNumber)},
+					&RegexDefRule{Re: `[-+.]`, Do: PopMatch(CodeOperator)},
+					&RegexDefRule{Re: `[a-z]+`, Do: PopWith((*Lexeme).PopASCIIIdentifier)},
+				}},
+			}
+		},
+	}
+	text := `"""a"b""" r"""c` + "\n" + `d""" -1.5 +x y"""z`
+	expect := []Lexeme{
+		{CodeStringMultiline, `"""a"b"""`},
+		{TextWhiteSpace, " "},
+		{CodeStringMultiline, `r"""c` + "\n" + `d"""`},
+		{TextWhiteSpace, " "},
+		{CodeNumberDecimal, "-1.5"},
+		{TextWhiteSpace, " "},
+		{CodeOperator, "+"},
+		{StopError, "no first group in the match (LexerDef='TestPopWith', Mode='root', Rule=4)"},
+	}
+	lexer, err := NewLexerEngine(def, text, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, e := range expect {
+		if lexeme := lexer.NextLexeme(); lexeme != e {
+			t.Errorf("got %s, expected %s", lexeme, e)
+		}
+	}
+
+	// the unterminated string is read up to the end of input
+	text = "\"\"\"" + strings.Repeat("a", 100) + "\"\"\" "
+	lexer, err = NewReaderLexerEngine(def, iotest.OneByteReader(strings.NewReader(text)), 8, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect = []Lexeme{
+		{CodeStringMultiline, text[:len(text)-1]},
+		{TextWhiteSpace, " "},
+		{StopEndOfString, ""},
+	}
+	for _, e := range expect {
+		if lexeme := lexer.NextLexeme(); lexeme != e {
+			t.Errorf("got %s, expected %s", lexeme, e)
+		}
+	}
+}
+
+func TestRegexDefRuleEngine(t *testing.T) {
+	newDef := func() *LexerDef {
+		return &LexerDef{
+			Name: "TestRegexDefRuleEngine",
+			InitFunc: func(d *LexerDef) {
+				d.Modes = []*LexerDefMode{
+					{Name: "root", Rules: []LexerDefRule{
+						WhiteSpaceRule,
+						&RegexDefRule{Re: `(?<=\.)\w+`, Do: PopMatch(CodeIdentifierMethod)},
+						&RegexDefRule{Re: `\w+(?=\()`, Do: PopMatch(CodeIdentifierFunction)},
+						&RegexDefRule{Re: `(['"])(.*?\1)`, Do: PopMatch(CodeDelimiter, CodeString)},
+						&RegexDefRule{Re: `\w+`, Do: PopMatch(CodeIdentifier)},
+						&RegexDefRule{Re: `[.()]`, Do: PopMatch(CodeDelimiter), Engine: BacktrackEngine},
+					}},
+				}
+			},
+		}
+	}
+	text := `a.b f(x) "y'z" 'q'`
+	expect := []Lexeme{
+		{CodeIdentifier, "a"},
+		{CodeDelimiter, "."},
+		{CodeIdentifierMethod, "b"},
+		{TextWhiteSpace, " "},
+		{CodeIdentifierFunction, "f"},
+		{CodeDelimiter, "("},
+		{CodeIdentifier, "x"},
+		{CodeDelimiter, ")"},
+		{TextWhiteSpace, " "},
+		{CodeDelimiter, `"`},
+		{CodeString, `y'z"`},
+		{TextWhiteSpace, " "},
+		{CodeDelimiter, `'`},
+		{CodeString, `q'`},
+		{StopEndOfString, ""},
+	}
+	def := newDef()
+	lexer, err := NewLexerEngine(def, text, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, e := range expect {
+		if lexeme := lexer.NextLexeme(); lexeme != e {
+			t.Errorf("got %s, expected %s", lexeme, e)
+		}
+	}
+	for _, chunkSize := range []int{1, 3} {
+		lexer, err := NewReaderLexerEngine(newDef(), strings.NewReader(text), chunkSize, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, e := range expect {
+			if lexeme := lexer.NextLexeme(); lexeme != e {
+				t.Errorf("got %s, expected %s with chunk size %d", lexeme, e, chunkSize)
+			}
+		}
+	}
+	engines, err := def.RuleEngines()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectEngines := []RegexEngine{RE2Engine, BacktrackEngine, BacktrackEngine, BacktrackEngine, RE2Engine, BacktrackEngine}
+	if len(engines) != len(expectEngines) {
+		t.Fatalf("got %d rule engines, expected %d", len(engines), len(expectEngines))
+	}
+	for i, e := range engines {
+		if e.Mode != "root" || e.Rule != i || e.Engine != expectEngines[i] {
+			t.Errorf("got %+v, expected rule %d with engine %s", e, i, expectEngines[i])
+		}
+	}
+	if s := BacktrackEngine.String(); s != "backtrack" {
+		t.Errorf("got %q, expected %q", s, "backtrack")
+	}
+}
+
+func TestRegexDefRuleEngineErrors(t *testing.T) {
+	rule := &RegexDefRule{Re: `\w+(?=\()`, Engine: RE2Engine}
+	if err := rule.Init(); err == nil {
+		t.Error("unexpected nil error")
+	}
+	rule = &RegexDefRule{Re: `(?<=[a)`}
+	if err := rule.Init(); err == nil || !strings.Contains(err.Error(), "unterminated character set") {
+		t.Errorf("got error %v, expected backtracking engine error", err)
+	}
+	rule = &RegexDefRule{Re: `a`, Engine: RegexEngine(5)}
+	if err := rule.Init(); err == nil {
+		t.Error("unexpected nil error")
+	}
+	def := &LexerDef{
+		Name: "TestRegexDefRuleEngineErrors",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					&RegexDefRule{Re: `(a*)*b`, Do: PopMatch(CodeIdentifier), Engine: BacktrackEngine, StepLimit: 1000},
+				}},
+			}
+		},
+	}
+	lexer, err := NewLexerEngine(def, strings.Repeat("a", 30), nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexeme := lexer.NextLexeme()
+	expect := "regexp step limit exceeded (LexerDef='TestRegexDefRuleEngineErrors', Mode='root', Rule=0)"
+	if lexeme.Type != StopError || lexeme.Str != expect {
+		t.Errorf("got %s, expected %s", lexeme, Lexeme{StopError, expect})
+	}
+}
+
+func TestIncludeRule(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestIncludeRule",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					&IncludeRule{Mode: "space"},
+					&RegexDefRule{Re: `[a-z]+`, Do: PopMatch(CodeIdentifier)},
+					&RegexDefRule{Re: `"`, Do: All(PopMatch(CodeString), PushMode("string"))},
+				}},
+				{Name: "space", Rules: []LexerDefRule{
+					&IncludeRule{Mode: "newline"},
+					WhiteSpaceRule,
+				}},
+				{Name: "newline", Rules: []LexerDefRule{
+					NewLineRule,
+				}},
+				{Name: "string", Rules: []LexerDefRule{
+					&RegexDefRule{Re: `"`, Do: All(PopMatch(CodeString), PopMode())},
+					&IncludeRule{Mode: "newline"},
+					&RegexDefRule{Re: `[^"\n]+`, Do: PopMatch(CodeString)},
+				}},
+			}
+		},
+	}
+	lexer, err := NewLexerEngine(def, "ab \"c d\ne\"\n", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{CodeIdentifier, "ab"},
+		{TextWhiteSpace, " "},
+		{CodeString, "\""},
+		{CodeString, "c d"},
+		{TextNewLine, "\n"},
+		{CodeString, "e"},
+		{CodeString, "\""},
+		{TextNewLine, "\n"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+	if n := len(def.Modes[1].Rules); n != 2 {
+		t.Errorf("got %d rules in mode 'space', expected 2", n)
+	}
+}
+
+func TestIncludeRuleErrors(t *testing.T) {
+	tests := []struct {
+		modes  []*LexerDefMode
+		expect string
+	}{
+		{
+			modes: []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{WhiteSpaceRule, &IncludeRule{Mode: "other"}}},
+			},
+			expect: `include of unknown mode 'other' (LexerDef="TestIncludeRuleErrors", Mode="root", Rule=1)`,
+		},
+		{
+			modes: []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{&IncludeRule{Mode: "a"}}},
+				{Name: "a", Rules: []LexerDefRule{&IncludeRule{Mode: "b"}}},
+				{Name: "b", Rules: []LexerDefRule{WhiteSpaceRule, &IncludeRule{Mode: "a"}}},
+			},
+			expect: `recursive include of mode 'a' (LexerDef="TestIncludeRuleErrors", Mode="b", Rule=1)`,
+		},
+	}
+	for _, test := range tests {
+		modes := test.modes
+		def := &LexerDef{
+			Name:     "TestIncludeRuleErrors",
+			InitFunc: func(d *LexerDef) { d.Modes = modes },
+		}
+		if _, err := NewLexerEngine(def, "", nil, nil); err == nil || err.Error() != test.expect {
+			t.Errorf("got error %v, expected %s", err, test.expect)
+		}
+	}
+}
+
+func TestPygmentsRuleFuncs(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestPygmentsRuleFuncs",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					WhiteSpaceRule,
+					&RegexDefRule{Re: `(\w+)(=)`, Do: PopMatchAs(CodeIdentifierVariable)},
+					&RegexDefRule{Re: `(\w+)(:)(\[[^\]]*\])`, Do: ByGroups(PopMatch(CodeIdentifierFunction), PopMatch(CodePunctuation), LexMatch("", "list"))},
+					&RegexDefRule{Re: `\(`, Do: All(PopMatch(CodeDelimiter), PushMode("nested"))},
+					&RegexDefRule{Re: `\)`, Do: All(PopMatch(CodeDelimiter), PopModes(1))},
+					&RegexDefRule{Re: `[0-9]+`, Do: PopMatch(CodeNumberInteger)},
+				}},
+				{Name: "nested", Rules: []LexerDefRule{
+					&RegexDefRule{Re: `\(`, Do: All(PopMatch(CodeDelimiter), PushCurrentMode())},
+					&RegexDefRule{Re: `\)\)`, Do: All(PopMatch(CodeDelimiter), PopModes(2))},
+					&RegexDefRule{Re: `\)`, Do: All(PopMatch(CodeDelimiter), PopModes(1))},
+					&RegexDefRule{Re: `[a-z]+`, Do: PopMatch(CodeIdentifier)},
+				}},
+				{Name: "list", Rules: []LexerDefRule{
+					&RegexDefRule{Re: `[\[\],]`, Do: PopMatch(CodePunctuation)},
+					&RegexDefRule{Re: `[a-z]+`, Do: PopMatch(CodeIdentifier)},
+				}},
+			}
+		},
+	}
+	lexer, err := NewLexerEngine(def, "a= k:[b,c;] ((x))) 1", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{CodeIdentifierVariable, "a="},
+		{TextWhiteSpace, " "},
+		{CodeIdentifierFunction, "k"},
+		{CodePunctuation, ":"},
+		{CodePunctuation, "["},
+		{CodeIdentifier, "b"},
+		{CodePunctuation, ","},
+		{CodeIdentifier, "c"},
+		{Text, ";]"}, // not lexed by the list mode
+		{TextWhiteSpace, " "},
+		{CodeDelimiter, "("},
+		{CodeDelimiter, "("},
+		{CodeIdentifier, "x"},
+		{CodeDelimiter, "))"},
+		{CodeDelimiter, ")"}, // popping the empty mode stack is ignored
+		{TextWhiteSpace, " "},
+		{CodeNumberInteger, "1"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+
+	def = &LexerDef{
+		Name: "TestPygmentsRuleFuncs",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					&RegexDefRule{Re: `a`, Do: LexMatch("unknown lexer", "")},
+					&RegexDefRule{Re: `b`, Do: LexMatch("", "unknown mode")},
+					&RegexDefRule{Re: `(c)`, Do: ByGroups(PopMatch(Text), PopMatch(Text))},
+				}},
+			}
+		},
+	}
+	for text, expect := range map[string]string{
+		"a": "unknown lexer 'unknown lexer' (LexerDef='TestPygmentsRuleFuncs', Mode='root', Rule=0)",
+		"b": "LexerDef 'TestPygmentsRuleFuncs' has no mode 'unknown mode'",
+		"c": "invalid number of group actions (LexerDef='TestPygmentsRuleFuncs', Mode='root', Rule=2)",
+	} {
+		lexer, err := NewLexerEngine(def, text, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if lexeme := lexer.NextLexeme(); lexeme != (Lexeme{StopError, expect}) {
+			t.Errorf("got %s, expected %s", lexeme, Lexeme{StopError, expect})
+		}
+	}
+}
@@ -3,7 +3,10 @@ package clrcore
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // LexerEngine is an engine to decompose an input text into lexemes based on
@@ -12,17 +15,48 @@ type LexerEngine struct {
 	def         *LexerDef       // The LexerDef currently used.
 	stopMarkers []string        // String markers stopping the lexer.
 	score       int             // The score of the parsed text with the given definition.
-	str         string          // Text remaining to be parsed (slice of text.Str).
-	outBuf      []Lexeme        // Buffer for output lexemes.
+	str         string          // Text remaining to be parsed (suffix of text).
+	text        string          // Text ending with str, the text before str is visible to lookbehinds.
+	outBuf      []queuedLexeme  // Buffer for output lexemes.
 	outIdx      int             // Index of next lexeme in outBuf to output.
 	mode        *LexerDefMode   // Current mode in RegexLexerDef.
 	ruleIdx     int             // Current rule index of the current mode.
 	modeStack   []*LexerDefMode // Stack of modes.
 	err         error           // Last error.
 	stopLexeme  Lexeme          // First stop lexeme issued or nil lexeme.
+	base        int             // Offset in the input of the start of text.
+	consumed    Position        // Position in the input of a consumed offset, at most the one of str.
+	queuePos    Position        // Position following the last lexeme queued.
+	queueOff    int             // Offset of str when the last lexeme was queued.
+	lexemePos   Position        // Position of the last lexeme output.
 	extend      interface{}     // Language specific additionnal information.
+	src         io.Reader       // Source of the text not yet read, nil if none.
+	chunkSize   int             // Number of bytes to read from src at once.
+	pending     []byte          // Bytes read from src not yet in str (incomplete rune).
+	rbuf        []byte          // Buffer to read from src.
+	sub         Lexer           // Lexer the text is delegated to, nil if none.
+	subStart    Position        // Position of the text delegated to the sub lexer.
+	subPos      Position        // Position in the delegated text of the next sub lexeme.
+	subSrc      bool            // True when the sub lexer reads from src.
+	queued      int             // Number of bytes of text queued.
+	progress    int             // Value of queued when a rule last made progress.
+	stalls      int             // Number of consecutive rules executed without progress.
+	invalids    int             // Number of TextInvalid lexemes output by the recovery.
+	resetAt     int             // Value of invalids when the mode was last reset at a newline.
+	newLine     bool            // True when a TextNewLine lexeme was queued by the current rule.
+	last        Lexeme          // Last significant lexeme queued.
 }
 
+// queuedLexeme is a lexeme in the queue with its position in the input.
+type queuedLexeme struct {
+	lexeme Lexeme
+	pos    Position
+}
+
+// maxStalls is the number of consecutive rules executed without queuing text
+// after which the lexer is assumed to loop forever and stops with an error.
+const maxStalls = 1000
+
 // NewLexerEngine returns a LexerEngine that will use the LexerDef to
 // parse the input text into lexemes. The parsing will stop when an end marker is found
 // in the text or the end of the text is reached.
@@ -34,8 +68,12 @@ func NewLexerEngine(def *LexerDef, text string, stopMarkers []string, extend int
 		def:         def,
 		stopMarkers: stopMarkers,
 		str:         text,
-		outBuf:      make([]Lexeme, 0, 4),
+		text:        text,
+		outBuf:      make([]queuedLexeme, 0, 4),
 		mode:        def.Modes[0],
+		consumed:    StartPosition,
+		queuePos:    StartPosition,
+		lexemePos:   StartPosition,
 		extend:      extend,
 	}, nil
 }
@@ -44,10 +82,30 @@ func NewLexerEngine(def *LexerDef, text string, stopMarkers []string, extend int
 // make sense once a Stop lexeme has been reached. When trying multiple lexer
 // on a piece of text, the lexer with the highest score will be picked.
 func (l *LexerEngine) Score() int {
-	return l.score
+	return l.score - l.invalids*RecoveryPenalty
+}
+
+// Invalids return the number of TextInvalid lexemes output by the Recovery of
+// the LexerDef, each one lowering the score by RecoveryPenalty.
+func (l *LexerEngine) Invalids() int {
+	return l.invalids
+}
+
+// Extend return the language specific information given to NewLexerEngine.
+func (l *LexerEngine) Extend() interface{} {
+	return l.extend
+}
+
+// LastLexeme return the last lexeme queued that is not a white space, a newline
+// or a comment, or a nil lexeme if there is none. It allows rules to resolve the
+// ambiguities depending on the previous token, like a / starting a regular
+// expression or being a division.
+func (l *LexerEngine) LastLexeme() Lexeme {
+	return l.last
 }
 
 // RemainingText return a Text lexeme containing the remaining text to parse.
+// When reading from an io.Reader, only the buffered text is returned.
 func (l *LexerEngine) RemainingText() string {
 	return l.str
 }
@@ -58,18 +116,69 @@ func (l *LexerEngine) NextLexeme() (lexeme Lexeme) {
 	if !l.stopLexeme.IsNil() {
 		return l.stopLexeme
 	}
-	if l.QueueEmpty() {
+	// rules may only change the mode without queuing lexemes
+	for l.QueueEmpty() {
 		l.GetLexemes()
 	}
-	lexeme = l.UnqueueLexeme()
+	lexeme, l.lexemePos = l.unqueue()
 	if lexeme.IsA(Stop) {
 		l.stopLexeme = lexeme
 	}
 	return
 }
 
+// Position return the position of the last lexeme returned by NextLexeme. The
+// positions are computed from the input consumed when the lexemes are queued.
+func (l *LexerEngine) Position() Position {
+	return l.lexemePos
+}
+
+// offset return the offset in the input of the remaining text.
+func (l *LexerEngine) offset() int {
+	return l.base + len(l.text) - len(l.str)
+}
+
+// position return the position in the input of the remaining text. The
+// consumed text is scanned once, and must still be in l.text.
+func (l *LexerEngine) position() Position {
+	if off := l.offset(); off > l.consumed.Offset {
+		l.consumed = l.consumed.Advance(l.text[l.consumed.Offset-l.base : off-l.base])
+	}
+	return l.consumed
+}
+
 // QueueLexeme appends lexeme to the back of outBuf, growing it when required.
+// Empty lexemes are dropped, except stop lexemes, and a lexeme with a nil type
+// sets l.err to an error. The lexeme is at the start of the remaining text when the remaining text changed since the last lexeme queued,
+// otherwise it follows the last lexeme queued, as the groups of PopMatch.
 func (l *LexerEngine) QueueLexeme(lexeme Lexeme) {
+	if off := l.offset(); off != l.queueOff {
+		l.queuePos, l.queueOff = l.position(), off
+	}
+	l.queue(lexeme, l.queuePos)
+	if l.err == nil && !lexeme.IsA(Stop) {
+		l.queuePos = l.queuePos.Advance(lexeme.Str)
+		l.newLine = l.newLine || lexeme.IsA(TextNewLine)
+	}
+}
+
+// queue appends lexeme at position pos to the back of outBuf. An empty lexeme
+// is dropped, so that a rule queuing only empty lexemes makes no progress and
+// is stopped by checkProgress.
+func (l *LexerEngine) queue(lexeme Lexeme, pos Position) {
+	if lexeme.Type == nil {
+		l.err = errors.New("lexeme with undefined LexemeType")
+		return
+	}
+	if !lexeme.IsA(Stop) {
+		if lexeme.Str == "" {
+			return
+		}
+		l.queued += len(lexeme.Str)
+		if !lexeme.IsA(TextWhiteSpace) && !lexeme.IsA(TextNewLine) && !lexeme.IsA(CodeComment) {
+			l.last = lexeme
+		}
+	}
 	if l.outIdx == len(l.outBuf) { // queue is empty
 		l.outBuf = l.outBuf[:1]
 		l.outIdx = 0
@@ -79,11 +188,11 @@ func (l *LexerEngine) QueueLexeme(lexeme Lexeme) {
 		l.outBuf = l.outBuf[:copy(l.outBuf, l.outBuf[l.outIdx:])+1]
 		l.outIdx = 0
 	} else { // queue buffer must grow
-		tmp := make([]Lexeme, 2*cap(l.outBuf))
+		tmp := make([]queuedLexeme, 2*cap(l.outBuf))
 		l.outBuf = tmp[:copy(tmp, l.outBuf[l.outIdx:])+1]
 		l.outIdx = 0
 	}
-	l.outBuf[len(l.outBuf)-1] = lexeme
+	l.outBuf[len(l.outBuf)-1] = queuedLexeme{lexeme: lexeme, pos: pos}
 }
 
 // QueueEmpty return true if the lexeme queue is empty.
@@ -94,21 +203,115 @@ func (l *LexerEngine) QueueEmpty() bool {
 // UnqueueLexeme extract and return the front most lexeme from the queue,
 // or a StopError lexeme if the queue is empty.
 func (l *LexerEngine) UnqueueLexeme() (lexeme Lexeme) {
+	lexeme, _ = l.unqueue()
+	return
+}
+
+// unqueue extract and return the front most lexeme from the queue and its
+// position, or a StopError lexeme at the remaining text if the queue is empty.
+func (l *LexerEngine) unqueue() (Lexeme, Position) {
 	if l.outIdx == len(l.outBuf) {
-		return Lexeme{StopError, "can't unqueue lexeme from an empty queue"}
+		return Lexeme{StopError, "can't unqueue lexeme from an empty queue"}, l.position()
 	}
-	lexeme = l.outBuf[l.outIdx]
+	q := l.outBuf[l.outIdx]
 	l.outIdx++
-	return
+	return q.lexeme, q.pos
+}
+
+// PopLexeme queues a lexeme of type t with the end first bytes of the
+// remaining text, and removes them from the remaining text.
+func (l *LexerEngine) PopLexeme(t *LexemeType, end int) {
+	if l.QueueLexeme(Lexeme{Type: t, Str: l.str[:end]}); l.err == nil {
+		l.str = l.str[end:]
+	}
+}
+
+// Delegate lexes the remaining text with a lexer of the given kind until it stops.
+// Its lexemes are queued as if output by l, and its score is added to the score of
+// l. The sub lexer stops when one of the stopMarkers, or one of the stop markers of
+// l, is found. The lexing then resumes with the current mode of l at the stop marker.
+func (l *LexerEngine) Delegate(info *LexerInfo, stopMarkers ...string) {
+	stopMarkers = append(append([]string(nil), stopMarkers...), l.stopMarkers...)
+	l.subStart, l.subPos = l.position(), StartPosition
+	var err error
+	if l.src != nil {
+		l.sub, err = NewLexerFromReader(info, l.RemainingReader(), stopMarkers...)
+		l.str, l.text, l.src, l.pending, l.subSrc = "", "", nil, nil, true
+		l.base = l.subStart.Offset
+	} else {
+		l.sub, err = info.NewLexer(l.str, stopMarkers...)
+	}
+	if err != nil {
+		l.sub = nil
+		l.err = err
+	}
+}
+
+// getSubLexeme queues the next lexeme of the sub lexer. When the sub lexer stops,
+// the lexing resumes with l at the stop marker.
+func (l *LexerEngine) getSubLexeme() {
+	lexeme := l.sub.NextLexeme()
+	if p, ok := l.sub.(Positioner); ok {
+		l.subPos = p.Position()
+	}
+	if lexeme.Type == nil || !lexeme.IsA(Stop) {
+		l.queue(lexeme, l.subStart.add(l.subPos))
+		l.subPos = l.subPos.Advance(lexeme.Str)
+		return
+	}
+	if lexeme.Type == StopError {
+		l.err = errors.New(lexeme.Str)
+		return
+	}
+	marker := ""
+	if lexeme.Type == StopLexer {
+		marker = lexeme.Str
+	}
+	l.score += l.sub.Score()
+	switch rl, ok := l.sub.(ReaderLexer); {
+	case ok && l.subSrc:
+		l.src = io.MultiReader(strings.NewReader(marker), rl.RemainingReader())
+		l.consumed = l.subStart.add(l.subPos)
+		l.base = l.consumed.Offset
+	case l.subSrc:
+		l.str = marker + l.sub.RemainingText()
+		l.text = l.str
+		l.consumed = l.subStart.add(l.subPos)
+		l.base = l.consumed.Offset
+	default:
+		// the delegated text stays in l.text, before l.str
+		rest := marker + l.sub.RemainingText()
+		if !strings.HasSuffix(l.str, rest) {
+			l.err = fmt.Errorf("remaining text of the sub lexer is not a suffix of its input (LexerDef='%s', Mode='%s')", l.def.Name, l.mode.Name)
+			return
+		}
+		l.str = l.str[len(l.str)-len(rest):]
+	}
+	l.sub, l.subSrc = nil, false
 }
 
 // GetLexemes extracts lexemes from the text and queue them in outBuf.
 func (l *LexerEngine) GetLexemes() {
+	if l.sub != nil {
+		if l.getSubLexeme(); l.err != nil {
+			l.QueueLexeme(Lexeme{Type: StopError, Str: l.err.Error()})
+		}
+		return
+	}
+	l.fill()
+	if l.err != nil {
+		l.QueueLexeme(Lexeme{Type: StopError, Str: l.err.Error()})
+		return
+	}
 	if len(l.str) == 0 {
 		l.QueueLexeme(Lexeme{Type: StopEndOfString})
 		return
 	}
-	for l.ruleIdx = 0; l.ruleIdx < len(l.mode.Rules); l.ruleIdx++ {
+	steps := l.mode.steps
+	if l.mode.dispatch != nil {
+		steps = l.mode.dispatch[l.str[0]]
+	}
+	for i := 0; ; i++ {
 		for _, stopMarker := range l.stopMarkers {
 			if strings.HasPrefix(l.str, stopMarker) {
 				l.QueueLexeme(Lexeme{StopLexer, stopMarker})
@@ -116,28 +319,100 @@ func (l *LexerEngine) GetLexemes() {
 				return
 			}
 		}
-		done := l.mode.Rules[l.ruleIdx].Exec(l)
+		if i == len(steps) {
+			// when reading from an io.Reader, a rule may match with more text
+			if len(l.str) < 2*l.chunkSize && l.readChunk() {
+				i = -1
+				continue
+			}
+			break
+		}
+		l.ruleIdx = steps[i].idx
+		done := steps[i].rule.Exec(l)
+		if l.err == nil && done {
+			l.checkProgress()
+		}
 		if l.err != nil {
 			l.QueueLexeme(Lexeme{Type: StopError, Str: l.err.Error()})
 			return
 		}
 		if done {
+			l.resetAtNewLine()
 			return
 		}
 	}
-	l.QueueLexeme(Lexeme{Type: StopLexer})
+	if l.err != nil {
+		l.QueueLexeme(Lexeme{Type: StopError, Str: l.err.Error()})
+		return
+	}
+	if !l.recover() {
+		l.QueueLexeme(Lexeme{Type: StopLexer})
+	}
+}
+
+// recover applies the Recovery of the LexerDef to the unmatched text, and
+// return false if the lexer must stop.
+func (l *LexerEngine) recover() bool {
+	recovery := l.def.Recovery
+	if recovery&RecoverNewLine != 0 && l.str[0] == '\n' {
+		l.PopLexeme(TextNewLine, 1)
+		l.mode, l.modeStack = l.def.Modes[0], l.modeStack[:0]
+		l.resetAt, l.newLine = l.invalids, false
+		return true
+	}
+	if recovery&(RecoverRune|RecoverWord) == 0 {
+		return false
+	}
+	r, n := utf8.DecodeRuneInString(l.str)
+	if recovery&RecoverWord != 0 && !unicode.IsSpace(r) {
+		word := l.str[n:]
+		if i := strings.IndexFunc(word, unicode.IsSpace); i >= 0 {
+			word = word[:i]
+		}
+		// the stop markers end the invalid text
+		for _, stopMarker := range l.stopMarkers {
+			if i := strings.Index(word, stopMarker); i >= 0 && stopMarker != "" {
+				word = word[:i]
+			}
+		}
+		n += len(word)
+	}
+	l.PopLexeme(TextInvalid, n)
+	l.invalids++
+	return true
+}
+
+// resetAtNewLine resets the mode to the root mode when the rule just executed
+// queued a newline, the Recovery of the LexerDef has RecoverNewLine, and text
+// was recovered since the last reset.
+func (l *LexerEngine) resetAtNewLine() {
+	if l.newLine && l.def.Recovery&RecoverNewLine != 0 && l.invalids > l.resetAt {
+		l.mode, l.modeStack = l.def.Modes[0], l.modeStack[:0]
+		l.resetAt = l.invalids
+	}
+	l.newLine = false
+}
+
+// checkProgress sets l.err to an error when too many consecutive rules were
+// executed without queuing text, like a rule matching the empty string.
+func (l *LexerEngine) checkProgress() {
+	if l.queued != l.progress {
+		l.progress, l.stalls = l.queued, 0
+		return
+	}
+	if l.stalls++; l.stalls == maxStalls {
+		l.err = fmt.Errorf("no progress after %d rules (LexerDef='%s', Mode='%s', Rule=%d)", maxStalls, l.def.Name, l.mode.Name, l.ruleIdx)
+	}
 }
 
 // PushMode set the current mode to the named mode.
 func (l *LexerEngine) PushMode(name string) {
-	for _, m := range l.def.Modes {
-		if m.Name == name {
-			l.modeStack = append(l.modeStack, l.mode)
-			l.mode = m
-			return
-		}
+	if m := l.def.modeByName[name]; m != nil {
+		l.modeStack = append(l.modeStack, l.mode)
+		l.mode = m
+		return
 	}
-	l.err = fmt.Errorf("LexerDef %q has no mode %q", l.def.Name, name)
+	l.err = fmt.Errorf("LexerDef '%s' has no mode '%s'", l.def.Name, name)
 }
 
 // PopMode set the current mode to the stacked mode.
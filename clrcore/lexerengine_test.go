@@ -2,12 +2,15 @@ package clrcore
 
 import (
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestLexerEngineQueue(t *testing.T) {
 	lexer := &LexerEngine{
-		outBuf: make([]Lexeme, 0, 4),
+		outBuf: make([]queuedLexeme, 0, 4),
 	}
 	if !lexer.QueueEmpty() {
 		t.Error("unexpected non-empty queue")
@@ -136,6 +139,74 @@ func TestLexerEngineStopMarker(t *testing.T) {
 	}
 }
 
+func TestLexerEngineExtend(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestLexerEngineExtend",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					&FuncDefRule{ExecFunc: func(l *LexerEngine) bool {
+						l.PopLexeme(l.Extend().(*LexemeType), len(l.RemainingText()))
+						return true
+					}},
+				}},
+			}
+		},
+	}
+	l, err := NewLexerEngine(def, "abc", nil, CodeComment)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lexeme := l.NextLexeme(); lexeme != (Lexeme{Type: CodeComment, Str: "abc"}) {
+		t.Errorf("got lexeme %v, expected a Code.Comment", lexeme)
+	}
+}
+
+func TestLexerEngineLastLexeme(t *testing.T) {
+	var lasts []Lexeme
+	def := &LexerDef{
+		Name: "TestLexerEngineLastLexeme",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					&FuncDefRule{ExecFunc: func(l *LexerEngine) bool {
+						lasts = append(lasts, l.LastLexeme())
+						return false
+					}},
+					&RegexDefRule{Re: "[a-z]+", Do: PopMatch(CodeIdentifier)},
+					&RegexDefRule{Re: "#[^\n]*", Do: PopMatch(CodeComment)},
+					&RegexDefRule{Re: " ", Do: PopMatch(TextWhiteSpace)},
+					&RegexDefRule{Re: "\n", Do: PopMatch(TextNewLine)},
+					&RegexDefRule{Re: "=", Do: PopMatch(CodeOperatorAssignment)},
+				}},
+			}
+		},
+	}
+	l, err := NewLexerEngine(def, "a = #c\nb", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for !l.NextLexeme().IsA(Stop) {
+	}
+	expect := []Lexeme{
+		{},
+		{CodeIdentifier, "a"},
+		{CodeIdentifier, "a"},
+		{CodeOperatorAssignment, "="},
+		{CodeOperatorAssignment, "="},
+		{CodeOperatorAssignment, "="},
+		{CodeOperatorAssignment, "="},
+	}
+	if len(lasts) != len(expect) {
+		t.Fatalf("got %d last lexemes, expected %d", len(lasts), len(expect))
+	}
+	for i := range expect {
+		if lasts[i] != expect[i] {
+			t.Errorf("got last lexeme %s at rule %d, expected %s", lasts[i], i, expect[i])
+		}
+	}
+}
+
 func TestLexerEnginePushPop(t *testing.T) {
 	def := &LexerDef{
 		Name: "TestLexerEnginePushPop",
@@ -208,3 +279,461 @@ func TestLexerEnginePushPop(t *testing.T) {
 		t.Errorf("got score %d, expected %d", lexer.Score(), 5)
 	}
 }
+
+func TestLexerEngineModeOnlyRule(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestLexerEngineModeOnlyRule",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					&RegexDefRule{Re: "[a-z]", Do: All(PopMatch(CodeIdentifier), PushMode("number"))},
+				}},
+				{Name: "number", Rules: []LexerDefRule{
+					&RegexDefRule{Re: "[0-9]+", Do: All(func(l *LexerEngine, match []int) bool {
+						l.PopLexeme(CodeNumberInteger, match[1])
+						return true
+					}, PopMode())},
+					&RegexDefRule{Re: "", Do: PopMode()}, // return to root without lexeme
+				}},
+			}
+		},
+	}
+	lexer, err := NewLexerEngine(def, "a12bc3", nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{CodeIdentifier, "a"},
+		{CodeNumberInteger, "12"},
+		{CodeIdentifier, "b"},
+		{CodeIdentifier, "c"},
+		{CodeNumberInteger, "3"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+}
+
+func TestLexerEngineProgress(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestLexerEngineProgress",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					&RegexDefRule{Re: "[a-z]+", Do: PopMatch(CodeIdentifier)},
+					&RegexDefRule{Re: "[0-9]+", Do: PopMatch(nil)},
+					&RegexDefRule{Re: "x*", Do: PopMatch(CodeIdentifier)}, // matches the empty string
+				}},
+			}
+		},
+	}
+	lexer, err := NewLexerEngine(def, "ab.", nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{CodeIdentifier, "ab"},
+		{StopError, "no progress after 1000 rules (LexerDef='TestLexerEngineProgress', Mode='root', Rule=2)"},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+	if lexer.RemainingText() != "." {
+		t.Errorf("got %q, expected %q", lexer.RemainingText(), ".")
+	}
+
+	lexer, err = NewLexerEngine(def, "ab12", nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	lexemes = []Lexeme{
+		{CodeIdentifier, "ab"},
+		{StopError, "lexeme with undefined LexemeType"},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+	if lexer.RemainingText() != "12" {
+		t.Errorf("got %q, expected %q", lexer.RemainingText(), "12")
+	}
+}
+
+func TestLexerEngineRecovery(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestLexerEngineRecovery",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					&RegexDefRule{Re: "[a-z]+", Do: All(PopMatch(CodeIdentifier), ScoreAdd(3))},
+					&RegexDefRule{Re: `\(`, Do: All(PopMatch(CodeDelimiter), PushMode("paren"))},
+					&RegexDefRule{Re: " ", Do: PopMatch(TextWhiteSpace)},
+				}},
+				{Name: "paren", Rules: []LexerDefRule{
+					&RegexDefRule{Re: "[0-9]+", Do: PopMatch(CodeNumber)},
+					&RegexDefRule{Re: `\)`, Do: All(PopMatch(CodeDelimiter), PopMode())},
+				}},
+			}
+		},
+		Recovery: RecoverRune | RecoverNewLine,
+	}
+	lexer, err := NewLexerEngine(def, "a(1é\nb) c", nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{CodeIdentifier, "a"},
+		{CodeDelimiter, "("},
+		{CodeNumber, "1"},
+		{TextInvalid, "é"},
+		{TextNewLine, "\n"},
+		{CodeIdentifier, "b"},
+		{TextInvalid, ")"},
+		{TextWhiteSpace, " "},
+		{CodeIdentifier, "c"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+	if lexer.Invalids() != 2 {
+		t.Errorf("got %d invalids, expected %d", lexer.Invalids(), 2)
+	}
+	if lexer.Score() != 7 {
+		t.Errorf("got score %d, expected %d", lexer.Score(), 7)
+	}
+
+	def = &LexerDef{
+		Name:     "TestLexerEngineRecoveryWord",
+		InitFunc: def.InitFunc,
+		Recovery: RecoverWord,
+	}
+	lexer, err = NewLexerEngine(def, "a 1b2?>c\nd", []string{"?>"}, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	lexemes = []Lexeme{
+		{CodeIdentifier, "a"},
+		{TextWhiteSpace, " "},
+		{TextInvalid, "1b2"},
+		{StopLexer, "?>"},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+
+	lexer, err = NewLexerEngine(def, "a\nb", nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	lexemes = []Lexeme{
+		{CodeIdentifier, "a"},
+		{TextInvalid, "\n"},
+		{CodeIdentifier, "b"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+
+	// after an error, the mode is reset at the next newline matched by a rule
+	def = &LexerDef{
+		Name: "TestLexerEngineRecoveryString",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					WhiteSpaceRule, NewLineRule,
+					&RegexDefRule{Re: "[a-z]+", Do: PopMatch(CodeIdentifier)},
+					&RegexDefRule{Re: `"`, Do: All(PopMatch(CodeString), PushMode("string"))},
+				}},
+				{Name: "string", Rules: []LexerDefRule{
+					NewLineRule,
+					&RegexDefRule{Re: "[a-z ]+", Do: PopMatch(CodeString)},
+					&RegexDefRule{Re: `"`, Do: All(PopMatch(CodeString), PopMode())},
+				}},
+			}
+		},
+		Recovery: RecoverRune | RecoverNewLine,
+	}
+	lexer, err = NewLexerEngine(def, "a \"b é\nc \"d\"\n\"e\nf\"", nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	lexemes = []Lexeme{
+		{CodeIdentifier, "a"},
+		{TextWhiteSpace, " "},
+		{CodeString, `"`},
+		{CodeString, "b "},
+		{TextInvalid, "é"},
+		{TextNewLine, "\n"}, // unterminated string, back to the root mode
+		{CodeIdentifier, "c"},
+		{TextWhiteSpace, " "},
+		{CodeString, `"`},
+		{CodeString, "d"},
+		{CodeString, `"`},
+		{TextNewLine, "\n"},
+		{CodeString, `"`},
+		{CodeString, "e"},
+		{TextNewLine, "\n"}, // no error since the last reset, the string goes on
+		{CodeString, "f"},
+		{CodeString, `"`},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		lexeme := lexer.NextLexeme()
+		if lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+}
+
+func TestLexerEnginePosition(t *testing.T) {
+	def := &LexerDef{
+		Name: "TestLexerEnginePosition",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					WhiteSpaceRule, NewLineRule,
+					&RegexDefRule{Re: `([a-zé]+)(=)([0-9]+)`, Do: PopMatch(CodeIdentifier, CodeOperator, CodeNumber)},
+				}},
+			}
+		},
+	}
+	lexer, err := NewLexerEngine(def, "a=1\n  été=22 stop b", []string{"stop"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var _ Positioner = lexer
+	tests := []struct {
+		lexeme Lexeme
+		pos    Position
+	}{
+		{Lexeme{CodeIdentifier, "a"}, Position{0, 1, 1}},
+		{Lexeme{CodeOperator, "="}, Position{1, 1, 2}},
+		{Lexeme{CodeNumber, "1"}, Position{2, 1, 3}},
+		{Lexeme{TextNewLine, "\n"}, Position{3, 1, 4}},
+		{Lexeme{TextWhiteSpace, "  "}, Position{4, 2, 1}},
+		{Lexeme{CodeIdentifier, "été"}, Position{6, 2, 3}},
+		{Lexeme{CodeOperator, "="}, Position{11, 2, 6}},
+		{Lexeme{CodeNumber, "22"}, Position{12, 2, 7}},
+		{Lexeme{TextWhiteSpace, " "}, Position{14, 2, 9}},
+		{Lexeme{StopLexer, "stop"}, Position{15, 2, 10}},
+		{Lexeme{StopLexer, "stop"}, Position{15, 2, 10}},
+	}
+	for _, test := range tests {
+		lexeme := lexer.NextLexeme()
+		if lexeme != test.lexeme {
+			t.Errorf("got %s, expected %s", lexeme, test.lexeme)
+		}
+		if pos := lexer.Position(); pos != test.pos {
+			t.Errorf("got position %+v, expected %+v for %s", pos, test.pos, lexeme)
+		}
+	}
+
+	// the positions are those of the consumed input when a rule skips text,
+	// and the lexemes queued ahead keep their position
+	skipDef := &LexerDef{
+		Name: "TestLexerEnginePositionSkip",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					NewLineRule,
+					&FuncDefRule{ExecFunc: func(l *LexerEngine) bool {
+						if l.str[0] != '#' {
+							return false
+						}
+						l.str = l.str[1:]
+						return true
+					}},
+					&RegexDefRule{Re: `[a-zé]+`, Do: func(l *LexerEngine, match []int) bool {
+						for i := 0; i < match[1]; {
+							_, n := utf8.DecodeRuneInString(l.str)
+							l.PopLexeme(CodeIdentifier, n)
+							i += n
+						}
+						return true
+					}},
+				}},
+			}
+		},
+	}
+	text := "#ab\n##é#c"
+	tests = []struct {
+		lexeme Lexeme
+		pos    Position
+	}{
+		{Lexeme{CodeIdentifier, "a"}, Position{1, 1, 2}},
+		{Lexeme{CodeIdentifier, "b"}, Position{2, 1, 3}},
+		{Lexeme{TextNewLine, "\n"}, Position{3, 1, 4}},
+		{Lexeme{CodeIdentifier, "é"}, Position{6, 2, 3}},
+		{Lexeme{CodeIdentifier, "c"}, Position{9, 2, 5}},
+		{Lexeme{StopEndOfString, ""}, Position{10, 2, 6}},
+	}
+	for _, chunkSize := range []int{0, 1} {
+		if chunkSize == 0 {
+			lexer, err = NewLexerEngine(skipDef, text, nil, nil)
+		} else {
+			lexer, err = NewReaderLexerEngine(skipDef, strings.NewReader(text), chunkSize, nil, nil)
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, test := range tests {
+			lexeme := lexer.NextLexeme()
+			if lexeme != test.lexeme {
+				t.Errorf("got %s, expected %s", lexeme, test.lexeme)
+			}
+			if pos := lexer.Position(); pos != test.pos {
+				t.Errorf("chunk size %d: got position %+v, expected %+v for %s", chunkSize, pos, test.pos, lexeme)
+			}
+		}
+	}
+
+	// the positions are kept when the consumed text is released
+	text = strings.Repeat("a=1\n  été=22 ", 200)
+	lexer, err = NewReaderLexerEngine(def, strings.NewReader(text), 7, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for offset := 0; ; {
+		lexeme := lexer.NextLexeme()
+		if pos := lexer.Position(); pos != StartPosition.Advance(text[:offset]) {
+			t.Fatalf("got position %+v, expected %+v for %s", pos, StartPosition.Advance(text[:offset]), lexeme)
+		}
+		if lexeme.IsA(Stop) {
+			break
+		}
+		offset += len(lexeme.Str)
+	}
+}
+
+func TestLexerEngineDelegate(t *testing.T) {
+	inner := &LexerDef{
+		Name: "TestLexerEngineDelegateInner",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					WhiteSpaceRule,
+					&RegexDefRule{Re: "[0-9]+", Do: All(PopMatch(CodeNumber), ScoreAdd(3))},
+				}},
+			}
+		},
+	}
+	RegisterLexer(&LexerInfo{
+		Names: []string{"TestLexerEngineDelegateInner"},
+		NewLexer: func(text string, stopMarkers ...string) (Lexer, error) {
+			return NewLexerEngine(inner, text, stopMarkers, nil)
+		},
+		NewReaderLexer: func(r io.Reader, stopMarkers ...string) (Lexer, error) {
+			return NewReaderLexerEngine(inner, r, 2, stopMarkers, nil)
+		},
+	})
+	outer := &LexerDef{
+		Name: "TestLexerEngineDelegateOuter",
+		InitFunc: func(d *LexerDef) {
+			d.Modes = []*LexerDefMode{
+				{Name: "root", Rules: []LexerDefRule{
+					WhiteSpaceRule,
+					&RegexDefRule{Re: "[a-z]+", Do: All(PopMatch(TextWord), ScoreAdd(1))},
+					&RegexDefRule{Re: `\[num\]`, Do: All(PopMatch(CodeDelimiter), Using("TestLexerEngineDelegateInner", "[/num]"))},
+					&RegexDefRule{Re: `\[/num\]`, Do: PopMatch(CodeDelimiter)},
+					&RegexDefRule{Re: `\[bad\]`, Do: Using("xxx")},
+				}},
+			}
+		},
+	}
+	text := "ab [num]12 34[/num] cd [num] 5 x"
+	lexemes := []Lexeme{
+		{TextWord, "ab"},
+		{TextWhiteSpace, " "},
+		{CodeDelimiter, "[num]"},
+		{CodeNumber, "12"},
+		{TextWhiteSpace, " "},
+		{CodeNumber, "34"},
+		{CodeDelimiter, "[/num]"},
+		{TextWhiteSpace, " "},
+		{TextWord, "cd"},
+		{TextWhiteSpace, " "},
+		{CodeDelimiter, "[num]"},
+		{TextWhiteSpace, " "},
+		{CodeNumber, "5"},
+		{TextWhiteSpace, " "},
+		{TextWord, "x"}, // inner lexer stopped, the outer lexer resumes
+		{StopEndOfString, ""},
+	}
+	lexer, err := NewLexerEngine(outer, text, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	readerLexer, err := NewReaderLexerEngine(outer, strings.NewReader(text), 3, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, l := range []*LexerEngine{lexer, readerLexer} {
+		offset := 0
+		for _, expect := range lexemes {
+			if lexeme := l.NextLexeme(); lexeme != expect {
+				t.Errorf("got %s, expected %s", lexeme, expect)
+			}
+			// the positions continue after the delegated text
+			if pos := l.Position(); pos != StartPosition.Advance(text[:offset]) {
+				t.Errorf("got position %+v, expected %+v for %s", pos, StartPosition.Advance(text[:offset]), expect)
+			}
+			offset += len(expect.Str)
+		}
+		if l.Score() != 3+6+3 { // outer words, first and second inner lexer
+			t.Errorf("got score %d, expected %d", l.Score(), 12)
+		}
+	}
+	// the delegated text stays visible to the lookbehinds
+	if lexer.text != text {
+		t.Errorf("got text %q, expected %q", lexer.text, text)
+	}
+
+	// the stop markers of the outer lexer also stop the inner lexer
+	lexer, err = NewLexerEngine(outer, "[num]1 END 2", []string{"END"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexemes = []Lexeme{
+		{CodeDelimiter, "[num]"},
+		{CodeNumber, "1"},
+		{TextWhiteSpace, " "},
+		{StopLexer, "END"},
+	}
+	for _, expect := range lexemes {
+		if lexeme := lexer.NextLexeme(); lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+	if lexer.RemainingText() != " 2" {
+		t.Errorf("got %q, expected %q", lexer.RemainingText(), " 2")
+	}
+
+	lexer, err = NewLexerEngine(outer, "[bad]", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := Lexeme{StopError, "unknown lexer 'xxx' (LexerDef='TestLexerEngineDelegateOuter', Mode='root', Rule=4)"}
+	if lexeme := lexer.NextLexeme(); lexeme != expect {
+		t.Errorf("got %s, expected %s", lexeme, expect)
+	}
+}
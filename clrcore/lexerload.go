@@ -0,0 +1,314 @@
+package clrcore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// lexerDesc is a lexer description file.
+type lexerDesc struct {
+	Names        []string          `json:"names"`
+	MimeTypes    []string          `json:"mimetypes"`
+	FileNames    []string          `json:"filenames"`
+	Interpreters []string          `json:"interpreters"`
+	Modes        []json.RawMessage `json:"modes"`
+	Recovery     []string          `json:"recovery"`
+}
+
+// recoveries are the Recovery flags by name in the lexer description files.
+var recoveries = map[string]Recovery{
+	"rune":    RecoverRune,
+	"word":    RecoverWord,
+	"newline": RecoverNewLine,
+}
+
+// modeDesc is a mode of a lexer description file.
+type modeDesc struct {
+	Name  string            `json:"name"`
+	Rules []json.RawMessage `json:"rules"`
+}
+
+// ruleDesc is a rule of a lexer description file.
+type ruleDesc struct {
+	Regex     *string   `json:"regex"`
+	Type      string    `json:"type"`
+	Types     []string  `json:"types"`
+	Pop       int       `json:"pop"`
+	Push      modeNames `json:"push"`
+	Score     int       `json:"score"`
+	Engine    string    `json:"engine"`
+	StepLimit int       `json:"steplimit"`
+	Include   string    `json:"include"`
+}
+
+// modeNames is a list of mode names, decoded from a name or a list of names.
+type modeNames []string
+
+func (m *modeNames) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*m = modeNames{name}
+		return nil
+	}
+	if err := json.Unmarshal(data, (*[]string)(m)); err != nil {
+		return errors.New("push is not a mode name or a list of mode names")
+	}
+	return nil
+}
+
+// LoadLexer reads the lexer description file with ParseLexer, and registers
+// the lexer with RegisterLexer.
+func LoadLexer(fileName string) (*LexerInfo, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParseLexer(data, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLexer(info); err != nil {
+		return nil, fmt.Errorf("%s (File=%q)", err, fileName)
+	}
+	RegisterLexer(info)
+	return info, nil
+}
+
+// ParseLexer return the lexer described by data, read from the named file. The
+// description is in JSON, or in YAML when the file name extension is .yaml or
+// .yml. It is an object with the fields
+//
+//	names         names of the lexer, the first is also the LexerDef name
+//	mimetypes     mime types of the language
+//	filenames     file name patterns of the language
+//	interpreters  interpreter name patterns of the #! lines of the language
+//	modes         modes of the LexerDef, the first is the entry point
+//	recovery      list of Recovery flags of the LexerDef: rune, word or newline
+//
+// A mode is an object with a name and a list of rules. A rule is an object with
+// the fields
+//
+//	regex      regex matched at the start of the remaining text (see RegexDefRule)
+//	type       lexeme type name of the whole match (see LexemeTypeByName)
+//	types      lexeme type names of the groups of the match (see PopMatch)
+//	pop        number of modes popped from the mode stack
+//	push       name, or list of names, of the modes pushed on the mode stack
+//	score      value added to the score
+//	engine     regex engine: auto (default), re2 or backtrack
+//	steplimit  maximum number of steps of a backtrack engine match
+//
+// or an object with only an include field, the name of the mode whose rules are
+// included in place of the rule (see IncludeRule). The modes are popped before
+// the modes are pushed. A rule with an empty regex must change the mode. For
+// example:
+//
+//	names: [ini, cfg]
+//	filenames: ["*.ini", "*.cfg"]
+//	modes:
+//	  - name: root
+//	    rules:
+//	      - include: space
+//	      - regex: '(\[)([^\]\n]*)(\])'
+//	        types: [Text.Punctuation, Code.Identifier.Namespace, Text.Punctuation]
+//	      - regex: '[^=\s]+'
+//	        type: Code.Identifier.Variable
+//	        push: value
+//	  - name: value
+//	    rules:
+//	      - include: space
+//	      - regex: '=[^\n]*'
+//	        type: Code.String
+//	        pop: 1
+//	  - name: space
+//	    rules:
+//	      - regex: '\s+'
+//	        type: Text.WhiteSpace
+//
+// The validation errors report the file, mode and rule index of the error.
+func ParseLexer(data []byte, fileName string) (*LexerInfo, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext == ".yaml" || ext == ".yml" {
+		v, err := parseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s (File=%q)", err, fileName)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("%s (File=%q)", err, fileName)
+		}
+	}
+	var desc lexerDesc
+	if err := decodeDesc(data, &desc); err != nil {
+		return nil, fmt.Errorf("%s (File=%q)", err, fileName)
+	}
+	if len(desc.Names) == 0 {
+		return nil, fmt.Errorf("lexer has no names defined (File=%q)", fileName)
+	}
+	if len(desc.Modes) == 0 {
+		return nil, fmt.Errorf("lexer has no modes (File=%q)", fileName)
+	}
+	modes := make([]modeDesc, len(desc.Modes))
+	names := make(map[string]bool)
+	for i, raw := range desc.Modes {
+		m := &modes[i]
+		if err := decodeDesc(raw, m); err != nil {
+			return nil, fmt.Errorf("%s (File=%q, Mode=%d)", err, fileName, i)
+		}
+		switch {
+		case m.Name == "":
+			return nil, fmt.Errorf("mode has no name (File=%q, Mode=%d)", fileName, i)
+		case names[m.Name]:
+			return nil, fmt.Errorf("duplicate mode (File=%q, Mode=%q)", fileName, m.Name)
+		case len(m.Rules) == 0:
+			return nil, fmt.Errorf("mode has no rules (File=%q, Mode=%q)", fileName, m.Name)
+		}
+		names[m.Name] = true
+	}
+	def := &LexerDef{Name: desc.Names[0]}
+	for _, name := range desc.Recovery {
+		r, ok := recoveries[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown recovery '%s' (File=%q)", name, fileName)
+		}
+		def.Recovery |= r
+	}
+	for _, m := range modes {
+		mode := &LexerDefMode{Name: m.Name}
+		for i, raw := range m.Rules {
+			rule, err := newDescRule(raw, names)
+			if err != nil {
+				return nil, fmt.Errorf("%s (File=%q, Mode=%q, Rule=%d)", err, fileName, m.Name, i)
+			}
+			mode.Rules = append(mode.Rules, rule)
+		}
+		def.Modes = append(def.Modes, mode)
+	}
+	def.InitFunc = func(d *LexerDef) {}
+	if err := def.Init(); err != nil {
+		return nil, fmt.Errorf("%s (File=%q)", err, fileName)
+	}
+	return &LexerInfo{
+		Names:        desc.Names,
+		MimeTypes:    desc.MimeTypes,
+		FileNames:    desc.FileNames,
+		Interpreters: desc.Interpreters,
+		NewLexer: func(text string, stopMarkers ...string) (Lexer, error) {
+			l, err := NewLexerEngine(def, text, stopMarkers, nil)
+			if err != nil {
+				return nil, err
+			}
+			return l, nil
+		},
+		NewReaderLexer: func(r io.Reader, stopMarkers ...string) (Lexer, error) {
+			l, err := NewReaderLexerEngine(def, r, 0, stopMarkers, nil)
+			if err != nil {
+				return nil, err
+			}
+			return l, nil
+		},
+	}, nil
+}
+
+// decodeDesc decodes the JSON data into v, rejecting the unknown fields.
+func decodeDesc(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// newDescRule return the rule described by the JSON data. modes are the names
+// of the modes of the lexer.
+func newDescRule(data []byte, modes map[string]bool) (LexerDefRule, error) {
+	var r ruleDesc
+	if err := decodeDesc(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Include != "" {
+		if r.Regex != nil || r.Type != "" || r.Types != nil || r.Pop != 0 || r.Push != nil || r.Score != 0 || r.Engine != "" || r.StepLimit != 0 {
+			return nil, errors.New("include rule with other fields")
+		}
+		if !modes[r.Include] {
+			return nil, fmt.Errorf("include of unknown mode '%s'", r.Include)
+		}
+		return &IncludeRule{Mode: r.Include}, nil
+	}
+	rule := &RegexDefRule{StepLimit: r.StepLimit}
+	switch {
+	case r.Regex == nil:
+		return nil, errors.New("rule has no regex")
+	case r.Type != "" && len(r.Types) > 0:
+		return nil, errors.New("rule has a type and types")
+	case *r.Regex == "" && (r.Type != "" || len(r.Types) > 0):
+		return nil, errors.New("rule with an empty regex has a type")
+	case *r.Regex == "" && r.Pop == 0 && len(r.Push) == 0:
+		return nil, errors.New("rule with an empty regex doesn't change the mode")
+	case *r.Regex != "" && r.Type == "" && len(r.Types) == 0:
+		return nil, errors.New("rule has no type")
+	case r.Pop < 0:
+		return nil, fmt.Errorf("invalid pop %d", r.Pop)
+	}
+	rule.Re = *r.Regex
+	switch r.Engine {
+	case "", "auto":
+		rule.Engine = AutoEngine
+	case "re2":
+		rule.Engine = RE2Engine
+	case "backtrack":
+		rule.Engine = BacktrackEngine
+	default:
+		return nil, fmt.Errorf("unknown regex engine '%s'", r.Engine)
+	}
+	if err := rule.Init(); err != nil {
+		return nil, err
+	}
+	var do []RegexDefRuleFunc
+	if r.Type != "" {
+		t := LexemeTypeByName(r.Type)
+		if t == nil {
+			return nil, fmt.Errorf("unknown lexeme type '%s'", r.Type)
+		}
+		do = append(do, PopMatchAs(t))
+	}
+	if len(r.Types) > 0 {
+		types := make([]*LexemeType, len(r.Types))
+		for i, name := range r.Types {
+			if types[i] = LexemeTypeByName(name); types[i] == nil {
+				return nil, fmt.Errorf("unknown lexeme type '%s'", name)
+			}
+		}
+		if n := rule.numSubexp(); len(types) != n {
+			return nil, fmt.Errorf("rule has %d types for %d groups", len(types), n)
+		}
+		do = append(do, PopMatch(types...))
+	}
+	for i := 0; i < r.Pop; i++ {
+		do = append(do, PopMode())
+	}
+	for _, name := range r.Push {
+		if !modes[name] {
+			return nil, fmt.Errorf("push of unknown mode '%s'", name)
+		}
+		do = append(do, PushMode(name))
+	}
+	if r.Score != 0 {
+		do = append(do, ScoreAdd(r.Score))
+	}
+	rule.Do = All(do...)
+	if len(do) == 1 {
+		rule.Do = do[0]
+	}
+	return rule, nil
+}
+
+// numSubexp return the number of capture groups of the initialized rule.
+func (r *RegexDefRule) numSubexp() int {
+	if r.bt != nil {
+		return r.bt.NumSubexp()
+	}
+	return r.cp.NumSubexp()
+}
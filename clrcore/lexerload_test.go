@@ -0,0 +1,212 @@
+package clrcore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const iniLexerYAML = `# INI files
+names: [test-ini, test-cfg]
+mimetypes: [text/x-test-ini]
+filenames: ["*.test-ini"]
+modes:
+  - name: root
+    rules:
+      - include: space
+      - regex: '(\[)([^\]\n]*)(\])'
+        types: [Text.Punctuation, Code.Identifier.Namespace, Text.Punctuation]
+        score: 2
+      - regex: '[^=\s]+'
+        type: Code.Identifier.Variable
+        push: value
+  - name: value
+    rules:
+      - include: space
+      - regex: '=(?=")'
+        type: Text.Operator
+        engine: backtrack
+        push: [string]
+      - regex: '=[^\n]*'
+        type: Code.String
+        pop: 1
+  - name: string
+    rules:
+      - regex: '"[^"]*"'
+        type: Code.String
+      - regex: ''
+        pop: 2
+  - name: space
+    rules:
+      - regex: '\s+'
+        type: Text.WhiteSpace
+`
+
+func TestLoadLexer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clrcore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "ini.yaml")
+	if err = ioutil.WriteFile(fileName, []byte(iniLexerYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := LoadLexer(fileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if LexerByName("test-cfg") != info || len(LexersByFileName("a.test-ini")) != 1 || len(LexersByMimeType("text/x-test-ini")) != 1 {
+		t.Error("lexer is not registered")
+	}
+	if _, err := LoadLexer(fileName); err == nil || err.Error() != `lexer name "test-ini" already registered (File="`+fileName+`")` {
+		t.Errorf("unexpected error: %v", err)
+	}
+	lexer, err := info.NewLexer("[sec]\na = 1\nb=\"x\"\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{TextPunctuation, "["},
+		{CodeIdentifierNamespace, "sec"},
+		{TextPunctuation, "]"},
+		{TextWhiteSpace, "\n"},
+		{CodeIdentifierVariable, "a"},
+		{TextWhiteSpace, " "},
+		{CodeString, "= 1"},
+		{TextWhiteSpace, "\n"},
+		{CodeIdentifierVariable, "b"},
+		{TextOperator, "="},
+		{CodeString, `"x"`},
+		{TextWhiteSpace, "\n"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		if lexeme := lexer.NextLexeme(); lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+	if lexer.Score() != 2 {
+		t.Errorf("got score %d, expected 2", lexer.Score())
+	}
+	lexer, err = NewLexerFromReader(info, strings.NewReader("[a]"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lexeme := lexer.NextLexeme(); lexeme != (Lexeme{TextPunctuation, "["}) {
+		t.Errorf("got %s, expected %s", lexeme, Lexeme{TextPunctuation, "["})
+	}
+	if _, err := LoadLexer(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("unexpected nil error")
+	}
+}
+
+func TestParseLexerJSON(t *testing.T) {
+	info, err := ParseLexer([]byte(`{
+		"names": ["test-json"],
+		"modes": [{"name": "root", "rules": [
+			{"regex": "[a-z]+", "type": "Code.Identifier"},
+			{"regex": "(\\d+)(;)?", "types": ["Code.Number", "Text.Punctuation"], "engine": "re2"}
+		]}]
+	}`), "test.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if LexerByName("test-json") != nil {
+		t.Error("unexpected registered lexer")
+	}
+	lexer, err := info.NewLexer("ab12;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{CodeIdentifier, "ab"},
+		{CodeNumber, "12"},
+		{TextPunctuation, ";"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		if lexeme := lexer.NextLexeme(); lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+}
+
+func TestParseLexerRecovery(t *testing.T) {
+	info, err := ParseLexer([]byte(`{
+		"names": ["test-recovery"],
+		"recovery": ["word", "newline"],
+		"modes": [{"name": "root", "rules": [
+			{"regex": "[a-z]+", "type": "Code.Identifier"},
+			{"regex": " ", "type": "Text.WhiteSpace"}
+		]}]
+	}`), "test.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexer, err := info.NewLexer("ab 1c2 d\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{CodeIdentifier, "ab"},
+		{TextWhiteSpace, " "},
+		{TextInvalid, "1c2"},
+		{TextWhiteSpace, " "},
+		{CodeIdentifier, "d"},
+		{TextNewLine, "\n"},
+		{StopEndOfString, ""},
+	}
+	for _, expect := range lexemes {
+		if lexeme := lexer.NextLexeme(); lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+}
+
+func TestParseLexerErrors(t *testing.T) {
+	mode := func(rules string) string {
+		return `{"names": ["a"], "modes": [{"name": "root", "rules": [{"regex": "a", "type": "Text"}, ` + rules + `]}, {"name": "b", "rules": [{"regex": "b", "type": "Text"}]}]}`
+	}
+	tests := []struct {
+		desc   string
+		expect string
+	}{
+		{desc: `{"names": ["a"], "modes": []`, expect: `unexpected EOF (File="test.json")`},
+		{desc: `{"names": ["a"], "mode": []}`, expect: `json: unknown field "mode" (File="test.json")`},
+		{desc: `{"names": ["a"], "recovery": ["line"], "modes": [{"name": "root", "rules": [{"regex": "a", "type": "Text"}]}]}`, expect: `unknown recovery 'line' (File="test.json")`},
+		{desc: `{"modes": []}`, expect: `lexer has no names defined (File="test.json")`},
+		{desc: `{"names": ["a"]}`, expect: `lexer has no modes (File="test.json")`},
+		{desc: `{"names": ["a"], "modes": [{"rules": []}]}`, expect: `mode has no name (File="test.json", Mode=0)`},
+		{desc: `{"names": ["a"], "modes": [{"name": "root"}]}`, expect: `mode has no rules (File="test.json", Mode="root")`},
+		{desc: `{"names": ["a"], "modes": [{"name": "root", "rules": [{"include": "root"}]}, {"name": "root", "rules": []}]}`, expect: `duplicate mode (File="test.json", Mode="root")`},
+		{desc: mode(`{"regex": "b", "typ": "Text"}`), expect: `json: unknown field "typ" (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"include": "b", "score": 1}`), expect: `include rule with other fields (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"include": "c"}`), expect: `include of unknown mode 'c' (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"type": "Text"}`), expect: `rule has no regex (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "b", "type": "Text", "types": ["Text"]}`), expect: `rule has a type and types (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "", "type": "Text", "push": "b"}`), expect: `rule with an empty regex has a type (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": ""}`), expect: `rule with an empty regex doesn't change the mode (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "b"}`), expect: `rule has no type (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "b", "type": "Text", "pop": -1}`), expect: `invalid pop -1 (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "b", "type": "Text", "engine": "pcre"}`), expect: `unknown regex engine 'pcre' (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "(?=b)", "type": "Text", "engine": "re2"}`), expect: "error parsing regexp: invalid or unsupported Perl syntax: `(?=` (File=\"test.json\", Mode=\"root\", Rule=1)"},
+		{desc: mode(`{"regex": "b", "type": "Code.Unknown"}`), expect: `unknown lexeme type 'Code.Unknown' (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "(b)", "types": ["Code.Unknown"]}`), expect: `unknown lexeme type 'Code.Unknown' (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "(b)(c)", "types": ["Text"]}`), expect: `rule has 1 types for 2 groups (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "b", "type": "Text", "push": ["b", "c"]}`), expect: `push of unknown mode 'c' (File="test.json", Mode="root", Rule=1)`},
+		{desc: mode(`{"regex": "b", "type": "Text", "push": 1}`), expect: `push is not a mode name or a list of mode names (File="test.json", Mode="root", Rule=1)`},
+		{desc: `{"names": ["a"], "modes": [{"name": "root", "rules": [{"include": "b"}]}, {"name": "b", "rules": [{"include": "root"}]}]}`,
+			expect: `recursive include of mode 'root' (LexerDef="a", Mode="b", Rule=0) (File="test.json")`},
+	}
+	for _, test := range tests {
+		if _, err := ParseLexer([]byte(test.desc), "test.json"); err == nil || err.Error() != test.expect {
+			t.Errorf("got error %v, expected %s", err, test.expect)
+		}
+	}
+	if _, err := ParseLexer([]byte("names: [a]\nmodes: 'x\n"), "test.yml"); err == nil || err.Error() != `yaml line 2: unterminated quoted scalar (File="test.yml")` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
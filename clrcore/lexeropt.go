@@ -0,0 +1,304 @@
+package clrcore
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// byteSet is a set of byte values.
+type byteSet [4]uint64
+
+// add adds b to the set.
+func (s *byteSet) add(b byte) {
+	s[b>>6] |= 1 << (b & 63)
+}
+
+// addRange adds the bytes from lo to hi included to the set.
+func (s *byteSet) addRange(lo, hi byte) {
+	for b := int(lo); b <= int(hi); b++ {
+		s.add(byte(b))
+	}
+}
+
+// has return true if b is in the set.
+func (s *byteSet) has(b byte) bool {
+	return s[b>>6]&(1<<(b&63)) != 0
+}
+
+// union adds the bytes of o to the set.
+func (s *byteSet) union(o byteSet) {
+	for i := range s {
+		s[i] |= o[i]
+	}
+}
+
+// addRunes adds the leading bytes of the UTF-8 encoding of the runes from lo to
+// hi included. An invalid UTF-8 byte is matched as utf8.RuneError by the regexp
+// package, so that all non ASCII bytes are added when the range contains it.
+func (s *byteSet) addRunes(lo, hi rune) {
+	if lo < utf8.RuneSelf {
+		h := hi
+		if h >= utf8.RuneSelf {
+			h = utf8.RuneSelf - 1
+		}
+		s.addRange(byte(lo), byte(h))
+		lo = utf8.RuneSelf
+	}
+	if hi < lo {
+		return
+	}
+	if lo <= utf8.RuneError && utf8.RuneError <= hi {
+		s.addRange(utf8.RuneSelf, 0xFF)
+		return
+	}
+	if hi > unicode.MaxRune {
+		hi = unicode.MaxRune
+	}
+	s.addRange(leadingByte(lo), leadingByte(hi))
+}
+
+// leadingByte return the first byte of the UTF-8 encoding of the non ASCII rune r.
+// The leading byte increases with the rune value.
+func leadingByte(r rune) byte {
+	switch {
+	case r < 0x800:
+		return 0xC0 | byte(r>>6)
+	case r < 0x10000:
+		return 0xE0 | byte(r>>12)
+	}
+	return 0xF0 | byte(r>>18)
+}
+
+// firstBytes return the set of bytes a match of re may start with, and true if
+// re may match the empty string. Empty width assertions are assumed to succeed.
+func firstBytes(re *syntax.Regexp) (set byteSet, nullable bool) {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return set, false
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText,
+		syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return set, true
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 {
+			return set, true
+		}
+		r := re.Rune[0]
+		set.addRunes(r, r)
+		if re.Flags&syntax.FoldCase != 0 {
+			for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+				set.addRunes(f, f)
+			}
+		}
+		return set, false
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			set.addRunes(re.Rune[i], re.Rune[i+1])
+		}
+		return set, false
+	case syntax.OpAnyChar:
+		set.addRange(0, 0xFF)
+		return set, false
+	case syntax.OpAnyCharNotNL:
+		set.addRange(0, '\n'-1)
+		set.addRange('\n'+1, 0xFF)
+		return set, false
+	case syntax.OpCapture, syntax.OpPlus:
+		return firstBytes(re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest:
+		set, _ = firstBytes(re.Sub[0])
+		return set, true
+	case syntax.OpRepeat:
+		set, nullable = firstBytes(re.Sub[0])
+		return set, nullable || re.Min == 0
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			s, n := firstBytes(sub)
+			set.union(s)
+			if !n {
+				return set, false
+			}
+		}
+		return set, true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			s, n := firstBytes(sub)
+			set.union(s)
+			nullable = nullable || n
+		}
+		return set, nullable
+	}
+	// unknown operation: any byte
+	set.addRange(0, 0xFF)
+	return set, true
+}
+
+// boundedRegexp return true if the length of the matches of re is bounded.
+func boundedRegexp(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return false
+	case syntax.OpRepeat:
+		if re.Max < 0 {
+			return false
+		}
+	}
+	for _, sub := range re.Sub {
+		if !boundedRegexp(sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleStep is a rule tried by GetLexemes. It is a rule of the mode, or a group
+// of adjacent regex rules of the mode merged into one regexp.
+type ruleStep struct {
+	idx  int          // Index of the (first) rule in the mode.
+	rule LexerDefRule // Rule to execute.
+}
+
+// optimize builds the rule steps of the mode. When enabled, a table gives for
+// each byte value the steps of the rules that may match a text starting with
+// this byte. The adjacent regex rules of a step list with a bounded match length
+// are merged into one regexp alternation. Merging the other rules is slower
+// because the alternation can rarely be matched by the one-pass matcher of the
+// regexp package.
+func (m *LexerDefMode) optimize(enabled bool) {
+	m.steps = make([]ruleStep, len(m.Rules))
+	for i, r := range m.Rules {
+		m.steps[i] = ruleStep{idx: i, rule: r}
+	}
+	m.dispatch = nil
+	if !enabled {
+		return
+	}
+	m.dispatch = new([256][]ruleStep)
+	cache := make(map[string][]ruleStep)
+	var key []byte
+	for b := 0; b < 256; b++ {
+		var idx []int
+		key = key[:0]
+		for i, r := range m.Rules {
+			if rr, ok := r.(*RegexDefRule); ok && !rr.nullable && !rr.first.has(byte(b)) {
+				continue
+			}
+			idx = append(idx, i)
+			key = strconv.AppendInt(append(key, ','), int64(i), 10)
+		}
+		steps, ok := cache[string(key)]
+		if !ok {
+			steps = m.mergeRules(idx)
+			cache[string(key)] = steps
+		}
+		m.dispatch[b] = steps
+	}
+}
+
+// mergeRules return the steps of the rules with the given indexes, where the
+// runs of adjacent regex rules are merged.
+func (m *LexerDefMode) mergeRules(idx []int) []ruleStep {
+	steps := make([]ruleStep, 0, len(idx))
+	for i := 0; i < len(idx); {
+		j := i
+		for j < len(idx) {
+			if r, ok := m.Rules[idx[j]].(*RegexDefRule); !ok || !r.bounded {
+				break
+			}
+			j++
+		}
+		if j-i > 1 {
+			if g := newRegexGroupRule(m.Rules, idx[i:j]); g != nil {
+				steps = append(steps, ruleStep{idx: idx[i], rule: g})
+				i = j
+				continue
+			}
+		}
+		if j == i {
+			j++
+		}
+		for ; i < j; i++ {
+			steps = append(steps, ruleStep{idx: idx[i], rule: m.Rules[idx[i]]})
+		}
+	}
+	return steps
+}
+
+// regexGroupRule is a sequence of regex rules merged into the alternation of
+// their regexps, each enclosed in a capture group. The leftmost-first semantic
+// of the alternation selects the first rule that would match if the rules were
+// tried in sequence.
+type regexGroupRule struct {
+	idx   []int           // index of the rules in the mode
+	rules []*RegexDefRule // merged rules
+	group []int           // index of the capture group of each rule
+	cp    *regexp.Regexp  // compiled alternation
+}
+
+// newRegexGroupRule return the merged regex rules with the given indexes, or
+// nil if the merged regexp doesn't compile.
+func newRegexGroupRule(rules []LexerDefRule, idx []int) *regexGroupRule {
+	g := &regexGroupRule{idx: idx}
+	var buf bytes.Buffer
+	buf.WriteString(`\A(?:`)
+	group := 1
+	for i, ri := range idx {
+		r := rules[ri].(*RegexDefRule)
+		if i > 0 {
+			buf.WriteByte('|')
+		}
+		fmt.Fprintf(&buf, `(%s)`, r.Re)
+		g.rules = append(g.rules, r)
+		g.group = append(g.group, group)
+		group += 1 + r.cp.NumSubexp()
+	}
+	buf.WriteByte(')')
+	var err error
+	if g.cp, err = regexp.Compile(buf.String()); err != nil {
+		return nil
+	}
+	return g
+}
+
+// Init initializes the regex group rule.
+func (g *regexGroupRule) Init() error {
+	return nil
+}
+
+// Exec executes the action of the first matching rule of the group. When the
+// action return false, the following rules of the group are tried in sequence.
+func (g *regexGroupRule) Exec(l *LexerEngine) bool {
+	match := g.cp.FindStringSubmatchIndex(l.str)
+	// when reading from an io.Reader, the match may continue in the next chunk
+	for match != nil && match[1] == len(l.str) && l.readChunk() {
+		match = g.cp.FindStringSubmatchIndex(l.str)
+	}
+	if l.err != nil {
+		return true
+	}
+	if match == nil {
+		return false
+	}
+	for i, r := range g.rules {
+		beg := 2 * g.group[i]
+		if match[beg] < 0 {
+			continue
+		}
+		l.ruleIdx = g.idx[i]
+		if r.Do(l, match[beg:beg+2*(1+r.cp.NumSubexp())]) || l.err != nil {
+			return true
+		}
+		for i++; i < len(g.rules); i++ {
+			l.ruleIdx = g.idx[i]
+			if g.rules[i].Exec(l) {
+				return true
+			}
+		}
+		break
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package clrcore
+
+import (
+	"regexp/syntax"
+	"testing"
+)
+
+func TestFirstBytes(t *testing.T) {
+	tests := []struct {
+		re       string
+		in, out  string
+		nullable bool
+	}{
+		{re: `abc`, in: "a", out: "bA"},
+		{re: `(?i)abc`, in: "aA", out: "b"},
+		{re: `[0-9]+|x`, in: "09x", out: "a/:"},
+		{re: `a?b*c`, in: "abc", out: "d"},
+		{re: `a?b*`, in: "ab", out: "c", nullable: true},
+		{re: `^\bfoo$`, in: "f", out: "o"},
+		{re: `.`, in: "a\xff", out: "\n"},
+		{re: `é`, in: "\xc3", out: "e\xa9"},
+		{re: `\pL`, in: "a\xc3\xe4\xf0", out: "0_"},
+		{re: `[^a]`, in: "b\x80\xff", out: "a"},
+		{re: `(?:ab){0,2}c`, in: "ac", out: "b", nullable: false},
+	}
+	for _, test := range tests {
+		re, err := syntax.Parse(test.re, syntax.Perl)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		set, nullable := firstBytes(re)
+		if nullable != test.nullable {
+			t.Errorf("got nullable %t, expected %t for %q", nullable, test.nullable, test.re)
+		}
+		for i := 0; i < len(test.in); i++ {
+			if !set.has(test.in[i]) {
+				t.Errorf("byte %q not in first bytes of %q", test.in[i], test.re)
+			}
+		}
+		for i := 0; i < len(test.out); i++ {
+			if set.has(test.out[i]) {
+				t.Errorf("byte %q in first bytes of %q", test.out[i], test.re)
+			}
+		}
+	}
+}
+
+func TestBoundedRegexp(t *testing.T) {
+	tests := []struct {
+		re      string
+		bounded bool
+	}{
+		{re: `abc|d`, bounded: true},
+		{re: `a?b{2,3}`, bounded: true},
+		{re: `a+`},
+		{re: `(?:ab)*`},
+		{re: `a{2,}`},
+	}
+	for _, test := range tests {
+		re, err := syntax.Parse(test.re, syntax.Perl)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if bounded := boundedRegexp(re); bounded != test.bounded {
+			t.Errorf("got bounded %t, expected %t for %q", bounded, test.bounded, test.re)
+		}
+	}
+}
+
+func TestLexerDefOptimize(t *testing.T) {
+	newDef := func(noOptimize bool) *LexerDef {
+		return &LexerDef{
+			Name:       "TestLexerDefOptimize",
+			NoOptimize: noOptimize,
+			InitFunc: func(d *LexerDef) {
+				d.Modes = []*LexerDefMode{
+					{Name: "root", Rules: []LexerDefRule{
+						WhiteSpaceRule,
+						&RegexDefRule{Re: `(a)(b)`, Do: PopMatch(CodeIdentifierKeyword, CodeIdentifierClass)},
+						// skipped when not followed by a digit
+						&RegexDefRule{Re: `a`, Do: func(l *LexerEngine, match []int) bool {
+							if len(l.str) < 2 || l.str[1] < '0' || l.str[1] > '9' {
+								return false
+							}
+							l.PopLexeme(CodeIdentifierVariable, match[1])
+							return true
+						}},
+						&RegexDefRule{Re: `[a-c]`, Do: PopMatch(CodeIdentifier)},
+						&RegexDefRule{Re: `[0-9]+`, Do: PopMatch(CodeNumberInteger)},
+						&FuncDefRule{ExecFunc: func(l *LexerEngine) bool {
+							if l.str[0] != '!' {
+								return false
+							}
+							l.PopLexeme(CodeOperatorLogical, 1)
+							return true
+						}},
+						&RegexDefRule{Re: `[+-]`, Do: PopMatch(CodeOperator)},
+					}},
+				}
+			},
+		}
+	}
+	def := newDef(false)
+	if _, err := NewLexerEngine(def, "", nil, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	root := def.Modes[0]
+	if n := len(root.dispatch['a']); n != 2 {
+		t.Errorf("got %d steps for 'a', expected 2", n)
+	}
+	if _, ok := root.dispatch['a'][0].rule.(*regexGroupRule); !ok {
+		t.Errorf("got %T, expected merged rules", root.dispatch['a'][0].rule)
+	}
+	if n := len(root.dispatch['!']); n != 1 {
+		t.Errorf("got %d steps for '!', expected 1", n)
+	}
+	if n := len(root.dispatch['x']); n != 1 {
+		t.Errorf("got %d steps for 'x', expected 1", n)
+	}
+	text := "ab a1 a b12 !+x"
+	expect := []Lexeme{
+		{CodeIdentifierKeyword, "a"},
+		{CodeIdentifierClass, "b"},
+		{TextWhiteSpace, " "},
+		{CodeIdentifierVariable, "a"},
+		{CodeNumberInteger, "1"},
+		{TextWhiteSpace, " "},
+		{CodeIdentifier, "a"},
+		{TextWhiteSpace, " "},
+		{CodeIdentifier, "b"},
+		{CodeNumberInteger, "12"},
+		{TextWhiteSpace, " "},
+		{CodeOperatorLogical, "!"},
+		{CodeOperator, "+"},
+		{StopLexer, ""},
+	}
+	for _, def := range []*LexerDef{newDef(true), def} {
+		l, err := NewLexerEngine(def, text, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, e := range expect {
+			if lexeme := l.NextLexeme(); lexeme != e {
+				t.Errorf("NoOptimize=%t: got %s, expected %s", def.NoOptimize, lexeme, e)
+			}
+		}
+		if l.RemainingText() != "x" {
+			t.Errorf("NoOptimize=%t: got remaining text %q, expected %q", def.NoOptimize, l.RemainingText(), "x")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package clrcore
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultChunkSize is the default number of bytes read at once by a
+// LexerEngine reading its input from an io.Reader.
+const DefaultChunkSize = 32 * 1024
+
+// lookbehindContextSize is the maximum number of bytes preceding the remaining
+// text kept for the lookbehind assertions when reading from an io.Reader.
+const lookbehindContextSize = 1024
+
+// A ReaderLexer is a Lexer reading its input text from an io.Reader.
+type ReaderLexer interface {
+	Lexer
+	// RemainingReader return a reader of the remaining text to parse, including
+	// the input not yet read. RemainingText only return the buffered part.
+	RemainingReader() io.Reader
+}
+
+// NewReaderLexerEngine returns a LexerEngine that will use the LexerDef to parse
+// the text read from r by chunks of chunkSize bytes, or DefaultChunkSize when
+// chunkSize is <= 0. The engine keeps at least chunkSize bytes ahead of the
+// parsed text buffered, and reads more when a regex match reaches the end of
+// the buffer, so that lexemes may straddle chunk boundaries.
+func NewReaderLexerEngine(def *LexerDef, r io.Reader, chunkSize int, stopMarkers []string, extend interface{}) (*LexerEngine, error) {
+	l, err := NewLexerEngine(def, "", stopMarkers, extend)
+	if err != nil {
+		return nil, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	l.src = r
+	l.chunkSize = chunkSize
+	return l, nil
+}
+
+// NewLexerFromReader return a lexer of the given kind parsing the text read
+// from r. When info has no NewReaderLexer function, the whole text is read
+// before instantiating the lexer with NewLexer.
+func NewLexerFromReader(info *LexerInfo, r io.Reader, stopMarkers ...string) (Lexer, error) {
+	if info.NewReaderLexer != nil {
+		return info.NewReaderLexer(r, stopMarkers...)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return info.NewLexer(string(data), stopMarkers...)
+}
+
+// RemainingReader return a reader of the remaining text to parse, including
+// the input not yet read.
+func (l *LexerEngine) RemainingReader() io.Reader {
+	rem := strings.NewReader(l.str + string(l.pending))
+	if l.src == nil {
+		return rem
+	}
+	return io.MultiReader(rem, l.src)
+}
+
+// fill reads the input until at least chunkSize bytes are buffered or the end
+// of input is reached.
+func (l *LexerEngine) fill() {
+	for l.src != nil && len(l.str) < l.chunkSize {
+		l.readChunk()
+	}
+}
+
+// readChunk appends the next chunk of input to the remaining text, and return
+// false when nothing could be appended. The src field is set to nil at the end
+// of input. A read error sets l.err.
+func (l *LexerEngine) readChunk() bool {
+	if l.src == nil {
+		return false
+	}
+	if l.rbuf == nil {
+		l.rbuf = make([]byte, 0, l.chunkSize+utf8.UTFMax)
+	}
+	buf := append(l.rbuf[:0], l.pending...)
+	// read at least one byte to complete a pending rune
+	size := l.chunkSize
+	if size <= len(buf) {
+		size = len(buf) + 1
+	}
+	for len(buf) < size {
+		n, err := l.src.Read(buf[len(buf):size])
+		buf = buf[:len(buf)+n]
+		if err != nil {
+			l.src = nil
+			if err != io.EOF {
+				l.err = err
+			}
+			break
+		}
+	}
+	// hold back the bytes of an incomplete trailing rune
+	end := len(buf)
+	if l.src != nil {
+		for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(buf[i]) {
+				if !utf8.FullRune(buf[i:]) {
+					end = i
+				}
+				break
+			}
+		}
+	}
+	l.pending = append(l.pending[:0], buf[end:]...)
+	if end == 0 {
+		return l.src != nil
+	}
+	// the consumed text is released by building a new string, except for the
+	// lookbehind context, once the position of the remaining text is known
+	l.position()
+	ctx := l.text[:len(l.text)-len(l.str)]
+	if len(ctx) > lookbehindContextSize {
+		i := len(ctx) - lookbehindContextSize
+		for i < len(ctx) && !utf8.RuneStart(ctx[i]) {
+			i++
+		}
+		ctx = ctx[i:]
+		l.base += i
+	}
+	l.text = ctx + l.str + string(buf[:end])
+	l.str = l.text[len(ctx):]
+	return true
+}
@@ -0,0 +1,95 @@
+package clrcore
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var readerTestDef = &LexerDef{
+	Name: "TestReaderLexerEngine",
+	InitFunc: func(d *LexerDef) {
+		d.Modes = []*LexerDefMode{
+			{Name: "root", Rules: []LexerDefRule{
+				WhiteSpaceRule, NewLineRule,
+				&RegexDefRule{Re: `[\pL]+`, Do: PopMatch(CodeIdentifier)},
+				&RegexDefRule{Re: `/\*(?s:.*?)(?:\*/|\z)`, Do: PopMatch(CodeComment)},
+				&RegexDefRule{Re: `[0-9]+`, Do: PopMatch(CodeNumber)},
+			}},
+		}
+	},
+}
+
+func TestReaderLexerEngine(t *testing.T) {
+	text := "abc défghi /* a long\ncomment */ 12345\nxyz ! rest of text"
+	lexer, err := NewLexerEngine(readerTestDef, text, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var expect []Lexeme
+	for {
+		lexeme := lexer.NextLexeme()
+		expect = append(expect, lexeme)
+		if lexeme.IsA(Stop) {
+			break
+		}
+	}
+	for _, chunkSize := range []int{1, 2, 3, 7, 100} {
+		r := iotest.OneByteReader(strings.NewReader(text))
+		lexer, err := NewReaderLexerEngine(readerTestDef, r, chunkSize, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var _ ReaderLexer = lexer
+		for _, e := range expect {
+			if lexeme := lexer.NextLexeme(); lexeme != e {
+				t.Errorf("got %s, expected %s with chunk size %d", lexeme, e, chunkSize)
+			}
+		}
+		rem, err := ioutil.ReadAll(lexer.RemainingReader())
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if string(rem) != "! rest of text" {
+			t.Errorf("got remaining %q, expected %q with chunk size %d", rem, "! rest of text", chunkSize)
+		}
+	}
+}
+
+func TestReaderLexerEngineError(t *testing.T) {
+	r := iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("abc def")))
+	lexer, err := NewReaderLexerEngine(readerTestDef, r, 1, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lexemes := []Lexeme{
+		{StopError, iotest.ErrTimeout.Error()},
+		{StopError, iotest.ErrTimeout.Error()},
+	}
+	for _, expect := range lexemes {
+		if lexeme := lexer.NextLexeme(); lexeme != expect {
+			t.Errorf("got %s, expected %s", lexeme, expect)
+		}
+	}
+}
+
+func TestNewLexerFromReader(t *testing.T) {
+	info := &LexerInfo{
+		Names: []string{"TestNewLexerFromReader"},
+		NewLexer: func(text string, stopMarkers ...string) (Lexer, error) {
+			return NewLexerEngine(readerTestDef, text, stopMarkers, nil)
+		},
+	}
+	lexer, err := NewLexerFromReader(info, strings.NewReader("abc"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lexeme := lexer.NextLexeme(); lexeme != (Lexeme{CodeIdentifier, "abc"}) {
+		t.Errorf("got %s, expected %s", lexeme, Lexeme{CodeIdentifier, "abc"})
+	}
+	if _, err = NewLexerFromReader(info, iotest.ErrReader(errors.New("test"))); err == nil {
+		t.Error("unexpected nil error")
+	}
+}
@@ -0,0 +1,409 @@
+// Package lexertest checks lexers against golden files.
+//
+// The input texts of a lexer are the testdata/<lang>/*.input files of the
+// package of the test, where <lang> is the first name of the lexer. The
+// lexemes of an input text are compared to the .expected file of the same
+// name, which lists one lexeme per line as its type and its quoted text.
+//
+//	Code.Identifier.Keyword "package"
+//	Text.WhiteSpace " "
+//	Code.Identifier.Namespace "main"
+//
+// The .expected files are written instead of compared when the test is run
+// with the -update flag.
+//
+//	go test ./clrlexers/golang -update
+//
+// The concatenation of the texts of the lexemes must always be the input text.
+//
+// Fuzz runs the lexers on arbitrary texts and checks the invariants of the
+// lexers with CheckInvariants. It is used by a fuzz target of the test.
+//
+//	func FuzzLexer(f *testing.F) {
+//		lexertest.Fuzz(f, LexerInfo)
+//	}
+//
+// The fuzzing is started with the -fuzz flag of go test.
+//
+//	go test ./clrlexers/golang -run '^$' -fuzz FuzzLexer -fuzztime 1m
+//
+// CheckReader and CheckNoOptimize check that a lexer gives the same lexemes
+// when it reads its text from an io.Reader, or when its LexerDef is not
+// optimized. Benchmark measures the speed of a LexerDef with and without
+// optimization.
+package lexertest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+var update = flag.Bool("update", false, "write the .expected files of the lexer golden tests")
+
+// Run checks the lexer with the input files of testdata/<lang>, where lang is
+// the first name of the lexer. Each input file is checked by a subtest.
+func Run(t *testing.T, info *clrcore.LexerInfo) {
+	t.Helper()
+	RunDir(t, info, filepath.Join("testdata", info.Names[0]))
+}
+
+// RunDir checks the lexer with the input files of dir. Each input file is
+// checked by a subtest.
+func RunDir(t *testing.T, info *clrcore.LexerInfo, dir string) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no .input files in %s", dir)
+	}
+	for _, file := range files {
+		file := file
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".input"), func(t *testing.T) {
+			if err := Check(info, file, *update); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Check lexes the input file with the lexer and compares its lexemes to the
+// .expected file of the same name, or writes the .expected file when update is
+// true. It return an error when the lexer fails, when the lexemes don't
+// concatenate to the input text, or when they differ from the expected ones.
+func Check(info *clrcore.LexerInfo, inputFile string, update bool) error {
+	data, err := ioutil.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	text := string(data)
+	lexemes, err := Lex(info, text)
+	if err != nil {
+		return fmt.Errorf("%s: %s", inputFile, err)
+	}
+	if err := CheckText(lexemes, text); err != nil {
+		return fmt.Errorf("%s: %s", inputFile, err)
+	}
+	got := Format(lexemes)
+	expectedFile := strings.TrimSuffix(inputFile, ".input") + ".expected"
+	if update {
+		return ioutil.WriteFile(expectedFile, []byte(got), 0644)
+	}
+	want, err := ioutil.ReadFile(expectedFile)
+	if err != nil {
+		return fmt.Errorf("%s (run the test with -update to write it)", err)
+	}
+	return compare(expectedFile, got, string(want))
+}
+
+// Lex return the lexemes of the text, up to the stop lexeme. It return an
+// error when the lexer stops before the end of the text.
+func Lex(info *clrcore.LexerInfo, text string) ([]clrcore.Lexeme, error) {
+	l, err := info.NewLexer(text)
+	if err != nil {
+		return nil, err
+	}
+	var lexemes []clrcore.Lexeme
+	for {
+		lexeme := l.NextLexeme()
+		if !lexeme.IsA(clrcore.Stop) {
+			lexemes = append(lexemes, lexeme)
+			continue
+		}
+		switch lexeme.Type {
+		case clrcore.StopEndOfString:
+			return lexemes, nil
+		case clrcore.StopError:
+			return lexemes, errors.New(lexeme.Str)
+		}
+		return lexemes, fmt.Errorf("lexer stopped at %s", clrcore.StartPosition.Advance(text[:len(text)-len(l.RemainingText())]))
+	}
+}
+
+// LexAll return all the lexemes of the text, up to and including the stop
+// lexeme, and the lexer, whose score is then known. The test fails when the
+// lexer can't be instantiated.
+func LexAll(tb testing.TB, info *clrcore.LexerInfo, text string) ([]clrcore.Lexeme, clrcore.Lexer) {
+	tb.Helper()
+	l, err := info.NewLexer(text)
+	if err != nil {
+		tb.Fatalf("unexpected error: %s", err)
+	}
+	return lexAll(l), l
+}
+
+// ExpectLexemes checks that the lexemes of the text, up to and including the
+// stop lexeme, are the expected ones, and return the lexer. The lexemes of the
+// skipped types and their subtypes are ignored.
+func ExpectLexemes(tb testing.TB, info *clrcore.LexerInfo, text string, expect []clrcore.Lexeme, skip ...*clrcore.LexemeType) clrcore.Lexer {
+	tb.Helper()
+	all, l := LexAll(tb, info, text)
+	var got []clrcore.Lexeme
+lexemes:
+	for _, lexeme := range all {
+		for _, t := range skip {
+			if lexeme.IsA(t) {
+				continue lexemes
+			}
+		}
+		got = append(got, lexeme)
+	}
+	if len(got) != len(expect) {
+		tb.Fatalf("got %d lexemes, expected %d: %v", len(got), len(expect), got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			tb.Errorf("%d. got %s, expected %s", i, got[i], expect[i])
+		}
+	}
+	return l
+}
+
+// CheckReader return an error when the lexemes of the text read by the lexer
+// one byte at a time from an io.Reader differ from those of the text. See
+// clrcore.NewLexerFromReader.
+func CheckReader(info *clrcore.LexerInfo, text string) error {
+	l, err := info.NewLexer(text)
+	if err != nil {
+		return err
+	}
+	expect := lexAll(l)
+	if l, err = clrcore.NewLexerFromReader(info, iotest.OneByteReader(strings.NewReader(text))); err != nil {
+		return err
+	}
+	return compareLexemes("reader", lexAll(l), expect)
+}
+
+// LexDef return all the lexemes of the text parsed with def, up to and
+// including the stop lexeme.
+func LexDef(def *clrcore.LexerDef, text string) ([]clrcore.Lexeme, error) {
+	l, err := clrcore.NewLexerEngine(def, text, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return lexAll(l), nil
+}
+
+// NoOptimize return a LexerDef with the same modes and recovery as def, but
+// whose rules are tried in sequence. The modes of def must be defined by its
+// InitFunc.
+func NoOptimize(def *clrcore.LexerDef) *clrcore.LexerDef {
+	return &clrcore.LexerDef{Name: def.Name, InitFunc: def.InitFunc, Recovery: def.Recovery, NoOptimize: true}
+}
+
+// CheckNoOptimize return an error when the lexemes of the text parsed with
+// def differ from those parsed with NoOptimize(def).
+func CheckNoOptimize(def *clrcore.LexerDef, text string) error {
+	if def.InitFunc == nil {
+		return fmt.Errorf("LexerDef '%s' has no InitFunc", def.Name)
+	}
+	expect, err := LexDef(NoOptimize(def), text)
+	if err != nil {
+		return err
+	}
+	got, err := LexDef(def, text)
+	if err != nil {
+		return err
+	}
+	return compareLexemes("optimized", got, expect)
+}
+
+// InputText return the concatenation of the testdata/<lang>/*.input files.
+func InputText(lang string) (string, error) {
+	files, err := filepath.Glob(filepath.Join("testdata", lang, "*.input"))
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no .input files in %s", filepath.Join("testdata", lang))
+	}
+	var b strings.Builder
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		b.Write(data)
+	}
+	return b.String(), nil
+}
+
+// Benchmark measures the lexing of the text with def, in the Optimized and
+// NoOptimize sub-benchmarks.
+func Benchmark(b *testing.B, def *clrcore.LexerDef, text string) {
+	for _, def := range []*clrcore.LexerDef{def, NoOptimize(def)} {
+		name := "Optimized"
+		if def.NoOptimize {
+			name = "NoOptimize"
+		}
+		def := def
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				if _, err := LexDef(def, text); err != nil {
+					b.Fatalf("unexpected error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// lexAll return the lexemes of l, up to and including the stop lexeme.
+func lexAll(l clrcore.Lexer) []clrcore.Lexeme {
+	var lexemes []clrcore.Lexeme
+	for {
+		lexeme := l.NextLexeme()
+		lexemes = append(lexemes, lexeme)
+		if lexeme.IsA(clrcore.Stop) {
+			return lexemes
+		}
+	}
+}
+
+// compareLexemes return an error reporting the first lexeme of got that differs
+// from the expected ones. The kind names the lexing of got.
+func compareLexemes(kind string, got, expect []clrcore.Lexeme) error {
+	for i := range expect {
+		if i == len(got) {
+			return fmt.Errorf("%s: got %d lexemes, expected %d", kind, len(got), len(expect))
+		}
+		if got[i] != expect[i] {
+			return fmt.Errorf("%s: lexeme %d: got %s, expected %s", kind, i, got[i], expect[i])
+		}
+	}
+	if len(got) != len(expect) {
+		return fmt.Errorf("%s: got %d lexemes, expected %d", kind, len(got), len(expect))
+	}
+	return nil
+}
+
+// Fuzz runs CheckInvariants with each lexer on the texts of the fuzz target f.
+// The input files of testdata/<lang> of the lexers are added to its seed corpus.
+func Fuzz(f *testing.F, infos ...*clrcore.LexerInfo) {
+	f.Helper()
+	for _, info := range infos {
+		files, _ := filepath.Glob(filepath.Join("testdata", info.Names[0], "*.input"))
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(string(data))
+		}
+	}
+	f.Add("")
+	f.Fuzz(func(t *testing.T, text string) {
+		for _, info := range infos {
+			if err := CheckInvariants(info, text); err != nil {
+				t.Errorf("lexer '%s': %s", info.Names[0], err)
+			}
+		}
+	})
+}
+
+// CheckInvariants lexes the text with the lexer and return an error when one
+// of the invariants of the lexers is violated:
+//   - the lexer stops after at most one lexeme per byte of the text,
+//   - the texts of the lexemes followed by the remaining text is the text,
+//   - the lexemes have a type,
+//   - the lexemes have a text, except the stop lexemes,
+//   - the lexers implementing clrcore.Positioner return the position of the
+//     lexemes in the text.
+//
+// A StopError lexeme is not an error, as long as the invariants hold.
+func CheckInvariants(info *clrcore.LexerInfo, text string) error {
+	l, err := info.NewLexer(text)
+	if err != nil {
+		return err
+	}
+	positioner, _ := l.(clrcore.Positioner)
+	pos, offset := clrcore.StartPosition, 0
+	var lexemes []clrcore.Lexeme
+	for {
+		if len(lexemes) > len(text) {
+			return fmt.Errorf("lexer not stopped after %d lexemes", len(lexemes))
+		}
+		lexeme := l.NextLexeme()
+		if lexeme.IsNil() {
+			return fmt.Errorf("lexeme %d %q has no type", len(lexemes), lexeme.Str)
+		}
+		if lexeme.IsA(clrcore.Stop) {
+			if lexeme.Type == clrcore.StopLexer {
+				lexemes = append(lexemes, lexeme)
+			}
+			break
+		}
+		if lexeme.IsEmpty() {
+			return fmt.Errorf("lexeme %d of type %s is empty", len(lexemes), lexeme.Type)
+		}
+		// a lexeme differing from the text is reported by CheckText
+		if positioner != nil && strings.HasPrefix(text[offset:], lexeme.Str) {
+			if got := positioner.Position(); got != pos {
+				return fmt.Errorf("lexeme %d %s at %s, expected %s", len(lexemes), lexeme, got, pos)
+			}
+			pos, offset = pos.Advance(lexeme.Str), offset+len(lexeme.Str)
+		}
+		lexemes = append(lexemes, lexeme)
+	}
+	return CheckText(append(lexemes, clrcore.Lexeme{Type: clrcore.Text, Str: l.RemainingText()}), text)
+}
+
+// CheckText return an error when the concatenation of the texts of the
+// lexemes is not text.
+func CheckText(lexemes []clrcore.Lexeme, text string) error {
+	var b strings.Builder
+	for _, lexeme := range lexemes {
+		b.WriteString(lexeme.Str)
+	}
+	got := b.String()
+	if got == text {
+		return nil
+	}
+	i := 0
+	for i < len(got) && i < len(text) && got[i] == text[i] {
+		i++
+	}
+	return fmt.Errorf("lexemes differ from the input text at %s", clrcore.StartPosition.Advance(text[:i]))
+}
+
+// Format return the lexemes in the format of the .expected files, one lexeme
+// per line as its type and its quoted text.
+func Format(lexemes []clrcore.Lexeme) string {
+	var b strings.Builder
+	for _, lexeme := range lexemes {
+		fmt.Fprintf(&b, "%s %q\n", lexeme.Type, lexeme.Str)
+	}
+	return b.String()
+}
+
+// compare return an error reporting the first line of got that differs from
+// the expected lines of the file.
+func compare(expectedFile, got, want string) error {
+	if got == want {
+		return nil
+	}
+	gotLines := strings.SplitAfter(got, "\n")
+	wantLines := strings.SplitAfter(want, "\n")
+	i := 0
+	for i < len(gotLines) && i < len(wantLines) && gotLines[i] == wantLines[i] {
+		i++
+	}
+	return fmt.Errorf("%s:%d: got %s, expected %s", expectedFile, i+1, line(gotLines, i), line(wantLines, i))
+}
+
+// line return the line i of lines, or <end> when there is none.
+func line(lines []string, i int) string {
+	if i >= len(lines) || lines[i] == "" {
+		return "<end>"
+	}
+	return strings.TrimSuffix(lines[i], "\n")
+}
@@ -0,0 +1,293 @@
+package lexertest
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+var wordsDef = &clrcore.LexerDef{
+	Name: "words",
+	InitFunc: func(d *clrcore.LexerDef) {
+		d.Modes = []*clrcore.LexerDefMode{
+			{Name: "root", Rules: []clrcore.LexerDefRule{
+				&clrcore.RegexDefRule{Re: `\w+`, Do: clrcore.PopMatch(clrcore.TextWord)},
+				&clrcore.RegexDefRule{Re: `\s+`, Do: clrcore.PopMatch(clrcore.TextWhiteSpace)},
+			}},
+		}
+	},
+}
+
+var wordsInfo = &clrcore.LexerInfo{
+	Names: []string{"words"},
+	NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+		return clrcore.NewLexerEngine(wordsDef, text, stopMarkers, nil)
+	},
+}
+
+func TestRun(t *testing.T) {
+	Run(t, wordsInfo)
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lexertest")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	inputFile := filepath.Join(dir, "a.input")
+	expectedFile := filepath.Join(dir, "a.expected")
+	if err := ioutil.WriteFile(inputFile, []byte("a b"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := Check(wordsInfo, inputFile, false); err == nil || !strings.Contains(err.Error(), "-update") {
+		t.Errorf("got error %v, expected missing .expected file error", err)
+	}
+	if err := Check(wordsInfo, inputFile, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := ioutil.ReadFile(expectedFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expect := "Text.Word \"a\"\nText.WhiteSpace \" \"\nText.Word \"b\"\n"; string(data) != expect {
+		t.Errorf("got .expected file %q, expected %q", data, expect)
+	}
+	if err := Check(wordsInfo, inputFile, false); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(expectedFile, []byte("Text.Word \"a\"\nText.Word \" \"\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := expectedFile + `:2: got Text.WhiteSpace " ", expected Text.Word " "`
+	if err := Check(wordsInfo, inputFile, false); err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+	if err := ioutil.WriteFile(expectedFile, []byte("Text.Word \"a\"\nText.WhiteSpace \" \"\nText.Word \"b\"\nText.Word \"c\"\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect = expectedFile + `:4: got <end>, expected Text.Word "c"`
+	if err := Check(wordsInfo, inputFile, false); err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+	// no rule matches the text
+	if err := ioutil.WriteFile(inputFile, []byte("a\n b!"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect = inputFile + ": lexer stopped at 2:3"
+	if err := Check(wordsInfo, inputFile, true); err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+}
+
+func TestCheckText(t *testing.T) {
+	lexemes := []clrcore.Lexeme{{Type: clrcore.TextWord, Str: "ab"}, {Type: clrcore.TextNewLine, Str: "\n"}, {Type: clrcore.TextWord, Str: "cd"}}
+	if err := CheckText(lexemes, "ab\ncd"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	expect := "lexemes differ from the input text at 2:2"
+	if err := CheckText(lexemes, "ab\ncxd"); err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+	expect = "lexemes differ from the input text at 2:3"
+	if err := CheckText(lexemes, "ab\ncd\n"); err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+}
+
+// trickyDef has rules failing on some texts.
+var trickyDef = &clrcore.LexerDef{
+	Name: "tricky",
+	InitFunc: func(d *clrcore.LexerDef) {
+		d.Modes = []*clrcore.LexerDefMode{
+			{Name: "root", Rules: []clrcore.LexerDefRule{
+				&clrcore.RegexDefRule{Re: `\(`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("paren"))},
+				&clrcore.RegexDefRule{Re: `\)`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+				&clrcore.RegexDefRule{Re: `a(b(c))`, Do: clrcore.PopMatch(clrcore.TextWord, clrcore.TextWord)},
+				&clrcore.RegexDefRule{Re: `x*`, Do: clrcore.PopMatch(clrcore.TextWord)},
+			}},
+			{Name: "paren", Rules: []clrcore.LexerDefRule{
+				&clrcore.RegexDefRule{Re: `\)`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+				&clrcore.IncludeRule{Mode: "root"},
+			}},
+		}
+	},
+}
+
+var trickyInfo = &clrcore.LexerInfo{
+	Names: []string{"tricky"},
+	NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+		return clrcore.NewLexerEngine(trickyDef, text, stopMarkers, nil)
+	},
+}
+
+// sliceLexer returns its lexemes, then a StopEndOfString lexeme, or its last
+// lexeme forever when loop is true.
+type sliceLexer struct {
+	lexemes []clrcore.Lexeme
+	loop    bool
+}
+
+func (l *sliceLexer) NextLexeme() clrcore.Lexeme {
+	if len(l.lexemes) == 0 {
+		return clrcore.Lexeme{Type: clrcore.StopEndOfString}
+	}
+	lexeme := l.lexemes[0]
+	if len(l.lexemes) > 1 || !l.loop {
+		l.lexemes = l.lexemes[1:]
+	}
+	return lexeme
+}
+
+func (l *sliceLexer) RemainingText() string { return "" }
+
+func (l *sliceLexer) Score() int { return 0 }
+
+// startLexer is a sliceLexer locating all its lexemes at the start of the text.
+type startLexer struct {
+	sliceLexer
+}
+
+func (l *startLexer) Position() clrcore.Position { return clrcore.StartPosition }
+
+func sliceInfo(loop bool, lexemes ...clrcore.Lexeme) *clrcore.LexerInfo {
+	return &clrcore.LexerInfo{
+		Names: []string{"slice"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return &sliceLexer{lexemes: lexemes, loop: loop}, nil
+		},
+	}
+}
+
+func TestCheckInvariants(t *testing.T) {
+	for _, text := range []string{"", "a b", "a b!", "(a (b))"} {
+		if err := CheckInvariants(wordsInfo, text); err != nil {
+			t.Errorf("text %q: unexpected error: %s", text, err)
+		}
+	}
+	for _, text := range []string{"", "()", "())", "(abc", "x(y"} {
+		if err := CheckInvariants(trickyInfo, text); err != nil {
+			t.Errorf("text %q: unexpected error: %s", text, err)
+		}
+	}
+	word := clrcore.Lexeme{Type: clrcore.TextWord, Str: "ab"}
+	startInfo := &clrcore.LexerInfo{
+		Names: []string{"start"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return &startLexer{sliceLexer{lexemes: []clrcore.Lexeme{{Type: clrcore.TextWord, Str: "a"}, {Type: clrcore.TextWord, Str: "b"}}}}, nil
+		},
+	}
+	tests := []struct {
+		info   *clrcore.LexerInfo
+		expect string
+	}{
+		{sliceInfo(false, word), ""},
+		{sliceInfo(false, word, word), "lexemes differ from the input text at 1:3"},
+		{sliceInfo(false, clrcore.Lexeme{Str: "ab"}), `lexeme 0 "ab" has no type`},
+		{sliceInfo(false, clrcore.Lexeme{Type: clrcore.TextWord}, word), "lexeme 0 of type Text.Word is empty"},
+		{sliceInfo(true, clrcore.Lexeme{Type: clrcore.TextWord, Str: "a"}), "lexer not stopped after 3 lexemes"},
+		{startInfo, `lexeme 1 [Text.Word] "b" at 1:1, expected 1:2`},
+	}
+	for i, test := range tests {
+		err := CheckInvariants(test.info, "ab")
+		if test.expect == "" {
+			if err != nil {
+				t.Errorf("test %d: unexpected error: %s", i, err)
+			}
+		} else if err == nil || err.Error() != test.expect {
+			t.Errorf("test %d: got error %v, expected %q", i, err, test.expect)
+		}
+	}
+}
+
+func FuzzCheckInvariants(f *testing.F) {
+	f.Add("a(b(c)x)ab)y")
+	Fuzz(f, wordsInfo, trickyInfo)
+}
+
+func TestExpectLexemes(t *testing.T) {
+	l := ExpectLexemes(t, wordsInfo, "a b", []clrcore.Lexeme{
+		{Type: clrcore.TextWord, Str: "a"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.TextWord, Str: "b"},
+		{Type: clrcore.StopEndOfString},
+	})
+	if l.RemainingText() != "" {
+		t.Errorf("got remaining text %q, expected none", l.RemainingText())
+	}
+	ExpectLexemes(t, wordsInfo, "a b\tc", []clrcore.Lexeme{
+		{Type: clrcore.TextWord, Str: "a"},
+		{Type: clrcore.TextWord, Str: "b"},
+		{Type: clrcore.TextWord, Str: "c"},
+	}, clrcore.TextWhiteSpace, clrcore.Stop)
+}
+
+func TestCheckReader(t *testing.T) {
+	text := strings.Repeat("ab cd\nef ", 100)
+	if err := CheckReader(wordsInfo, text); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	info := &clrcore.LexerInfo{
+		Names:    wordsInfo.Names,
+		NewLexer: wordsInfo.NewLexer,
+		NewReaderLexer: func(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewReaderLexerEngine(wordsDef, r, 3, stopMarkers, nil)
+		},
+	}
+	if err := CheckReader(info, text); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	info.NewReaderLexer = func(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+		return &sliceLexer{lexemes: []clrcore.Lexeme{{Type: clrcore.TextWord, Str: "ab"}, {Type: clrcore.TextWord, Str: " "}}}, nil
+	}
+	expect := `reader: lexeme 1: got [Text.Word] " ", expected [Text.WhiteSpace] " "`
+	if err := CheckReader(info, text); err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+	info.NewReaderLexer = func(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+		return &sliceLexer{lexemes: []clrcore.Lexeme{{Type: clrcore.TextWord, Str: "ab"}}}, nil
+	}
+	expect = `reader: lexeme 1: got [Stop.EndofString] "", expected [Text.WhiteSpace] " "`
+	if err := CheckReader(info, text); err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+}
+
+func TestCheckNoOptimize(t *testing.T) {
+	for _, def := range []*clrcore.LexerDef{wordsDef, trickyDef} {
+		for _, text := range []string{"", "ab cd", "(a (b))", "x(y"} {
+			if err := CheckNoOptimize(def, text); err != nil {
+				t.Errorf("'%s' %q: unexpected error: %s", def.Name, text, err)
+			}
+		}
+	}
+	if noOpt := NoOptimize(trickyDef); !noOpt.NoOptimize || noOpt.Recovery != trickyDef.Recovery || noOpt.Name != trickyDef.Name {
+		t.Errorf("got %+v, expected a copy of '%s' with NoOptimize", noOpt, trickyDef.Name)
+	}
+	expect := "LexerDef 'modes' has no InitFunc"
+	if err := CheckNoOptimize(&clrcore.LexerDef{Name: "modes"}, "a"); err == nil || err.Error() != expect {
+		t.Errorf("got error %v, expected %q", err, expect)
+	}
+}
+
+func TestInputText(t *testing.T) {
+	expect, err := ioutil.ReadFile(filepath.Join("testdata", "words", "simple.input"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if text, err := InputText("words"); err != nil || text != string(expect) {
+		t.Errorf("got %q, %v, expected %q", text, err, expect)
+	}
+	if _, err := InputText("missing"); err == nil {
+		t.Error("unexpected nil error for missing input files")
+	}
+}
+
+func BenchmarkWords(b *testing.B) {
+	Benchmark(b, wordsDef, strings.Repeat("ab cd\nef ", 1000))
+}
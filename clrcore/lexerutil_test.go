@@ -107,6 +107,32 @@ func TestTripleDoubleQuotedString(t *testing.T) {
 	}
 }
 
+func TestTripleSingleQuotedString(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Lexeme
+		rem string
+	}{
+		{in: `'''abc'''`, out: Lexeme{CodeStringMultiline, `'''abc'''`}},
+		{in: `'''ab ' cd '' '''`, out: Lexeme{CodeStringMultiline, `'''ab ' cd '' '''`}},
+		{in: `'''ab ' cd '' ''''`, out: Lexeme{CodeStringMultiline, `'''ab ' cd '' '''`}, rem: `'`},
+		{in: `'''''a`, out: Lexeme{CodeStringMultiline, `'''''a`}},
+		{in: `''''''`, out: Lexeme{CodeStringMultiline, `''''''`}},
+		{in: "'''a\nb''' c", out: Lexeme{CodeStringMultiline, "'''a\nb'''"}, rem: " c"},
+		{in: `'''ab"""'''`, out: Lexeme{CodeStringMultiline, `'''ab"""'''`}},
+	}
+	for _, test := range tests {
+		l := Lexeme{Str: test.in}
+		out := l.PopTripleSingleQuotedString()
+		if out != test.out {
+			t.Errorf("got lexeme %q, expected %q for %+v", out, test.out, test)
+		}
+		if l.Str != test.rem {
+			t.Errorf("got remain %q, expected %q for %+v", l.Str, test.rem, test)
+		}
+	}
+}
+
 func TestPopOneCharLineComment(t *testing.T) {
 	tests := []struct {
 		in  string
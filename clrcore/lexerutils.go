@@ -82,6 +82,24 @@ func (l *Lexeme) PopTripleDoubleQuotedString() (lexeme Lexeme) {
 	return l.PopLexeme(CodeStringMultiline, end)
 }
 
+// PopTripleSingleQuotedString extracts the triple single quoted string from the
+// front of the target lexeme, and return it.
+// A triple single quoted string is terminated by ''' or the end of the target string.
+// It requires that the target string is at least 3 char long and start with '''.
+func (l *Lexeme) PopTripleSingleQuotedString() (lexeme Lexeme) {
+	end := len(l.Str)
+	for i := 5; i < len(l.Str); i += 3 {
+		if l.Str[i] == '\'' {
+			if l.Str[i-1] == '\'' && l.Str[i-2] == '\'' {
+				end = i + 1
+				break
+			}
+			i -= 2
+		}
+	}
+	return l.PopLexeme(CodeStringMultiline, end)
+}
+
 // PopOneCharLineComment extracts a comment ending at \n (not included) from the
 // front of the target lexeme, and return it.
 // It requires that the target string is at least 1 char long.
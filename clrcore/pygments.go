@@ -0,0 +1,277 @@
+package clrcore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	pygmentsToType = make(map[string]*LexemeType) // Pygments token name to lexeme type
+	typeToPygments = make(map[*LexemeType]string) // lexeme type to Pygments token name
+)
+
+// RegisterPygmentsToken associates the Pygments token name (e.g. "Keyword.Type")
+// with the lexeme type t. The first name registered for t is used to
+// retrieve the style of t in Pygments styles.
+func RegisterPygmentsToken(name string, t *LexemeType) {
+	name = normalizePygmentsName(name)
+	if _, ok := pygmentsToType[name]; !ok {
+		pygmentsToType[name] = t
+	}
+	if _, ok := typeToPygments[t]; !ok {
+		typeToPygments[t] = name
+	}
+}
+
+// PygmentsTokenType return the lexeme type associated to the Pygments token
+// name (e.g. "Keyword.Type" or "Token.Keyword.Type"). A name without lexeme
+// type is resolved through its parent token. Return nil if none is found.
+func PygmentsTokenType(name string) *LexemeType {
+	for name = normalizePygmentsName(name); name != ""; name = pygmentsParent(name) {
+		if t, ok := pygmentsToType[name]; ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// PygmentsTokenName return the Pygments token name associated to t or to its
+// closest parent, without the "Token." prefix. Return an empty string for Token.
+func PygmentsTokenName(t *LexemeType) string {
+	for ; t != nil; t = t.Parent {
+		if name, ok := typeToPygments[t]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// normalizePygmentsName return the name without the "Token." prefix and with
+// the Pygments aliases expanded. Token is the empty string.
+func normalizePygmentsName(name string) string {
+	if name == "Token" {
+		return ""
+	}
+	name = strings.TrimPrefix(name, "Token.")
+	for _, alias := range [...]struct{ short, long string }{
+		{"Whitespace", "Text.Whitespace"},
+		{"String", "Literal.String"},
+		{"Number", "Literal.Number"},
+	} {
+		if name == alias.short || strings.HasPrefix(name, alias.short+".") {
+			return alias.long + name[len(alias.short):]
+		}
+	}
+	return name
+}
+
+// pygmentsParent return the name of the parent token, or "" for Token.
+func pygmentsParent(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+func init() {
+	// The first name of a lexeme type is used to retrieve its style.
+	for _, e := range [...]struct {
+		name string
+		t    *LexemeType
+	}{
+		{"Text", Text},
+		{"Text.Whitespace", TextWhiteSpace},
+		{"Text.Whitespace", TextNewLine},
+		{"Error", TextInvalid},
+		{"Name", CodeIdentifier},
+		{"Name.Variable", CodeIdentifierVariable},
+		{"Name.Function", CodeIdentifierFunction},
+		{"Name.Function", CodeIdentifierMethod},
+		{"Name.Class", CodeIdentifierClass},
+		{"Name.Namespace", CodeIdentifierNamespace},
+		{"Keyword", CodeIdentifierKeyword},
+		{"Keyword.Type", CodeIdentifierType},
+		{"Keyword.Constant", CodeIdentifierLiteral},
+		{"Operator.Word", CodeIdentifierOperator},
+		{"Literal", Code},
+		{"Literal.String", CodeString},
+		{"Literal.String.Single", CodeStringSingle},
+		{"Literal.String.Double", CodeStringDouble},
+		{"Literal.String.Backtick", CodeStringRaw},
+		{"Literal.String.Doc", CodeStringMultiline},
+		{"Literal.String.Char", CodeStringSingle},
+		{"Literal.String.Heredoc", CodeStringMultiline},
+		{"Literal.String.Regex", CodeStringRegex},
+		{"Literal.Number", CodeNumber},
+		{"Literal.Number.Integer", CodeNumberInteger},
+		{"Literal.Number.Hex", CodeNumberHexadecimal},
+		{"Literal.Number.Oct", CodeNumberOctal},
+		{"Literal.Number.Bin", CodeNumberBinary},
+		{"Literal.Number.Float", CodeNumberDecimal},
+		{"Comment", CodeComment},
+		{"Comment.Preproc", CodePreprocessor},
+		{"Comment.PreprocFile", CodePreprocessorFile},
+		{"Operator", CodeOperator},
+		{"Punctuation", CodePunctuation},
+		{"Punctuation", CodeDelimiter},
+		{"Name.Builtin", CodeIdentifierFunction},
+		{"Name.Builtin.Pseudo", CodeIdentifierVariable},
+		{"Name.Constant", CodeIdentifierLiteral},
+		{"Name.Decorator", CodeIdentifierFunction},
+		{"Name.Exception", CodeIdentifierClass},
+		{"Name.Attribute", CodeIdentifierVariable},
+		{"Name.Property", CodeIdentifierVariable},
+		{"Keyword.Declaration", CodeIdentifierKeyword},
+		{"Keyword.Namespace", CodeIdentifierKeyword},
+		{"Keyword.Pseudo", CodeIdentifierKeyword},
+		{"Keyword.Reserved", CodeIdentifierKeyword},
+		// The Text types come last so that their Pygments names resolve
+		// to the Code types.
+		{"Punctuation", TextPunctuation},
+		{"Operator", TextOperator},
+		{"Literal.Number", TextNumber},
+	} {
+		RegisterPygmentsToken(e.name, e.t)
+	}
+	// Code has no Pygments equivalent and gets the style of Token.
+	typeToPygments[Code] = ""
+}
+
+var (
+	pygmentsEntryRe      = regexp.MustCompile(`(?m)^[ \t]*([A-Z]\w*(?:\.[A-Z]\w*)*)[ \t]*:[ \t]*("[^"\n]*"|'[^'\n]*')`)
+	pygmentsBackgroundRe = regexp.MustCompile(`(?m)^[ \t]*background_color[ \t]*=[ \t]*("[^"\n]*"|'[^'\n]*')`)
+)
+
+// NewStyleFromPygments return a Style initialized with a Pygments style definition.
+// The text contains the entries of the Pygments styles dictionary, one per line,
+// and optionally the background_color attribute. The background color applies
+// to Token.
+//
+//	background_color = '#272822'
+//	Token:          '#f8f8f2',
+//	Comment:        'italic #75715e',
+//	Keyword.Type:   'nobold #66d9ef bg:#000000',
+//
+// The supported attributes are bold, nobold, italic, noitalic, underline,
+// nounderline, noinherit, roman, sans, mono, #RGB or #RRGGBB for the text color,
+// bg:#RRGGBB for the background color and border:#RRGGBB for the border color.
+// An empty bg: or border: unsets the color. The font attributes (roman, sans,
+// mono) are ignored. A token inherits the style of its parent
+// token unless noinherit is specified.
+func NewStyleFromPygments(text string) (Style, error) {
+	type spec struct {
+		attrs string
+		line  int
+	}
+	specs := make(map[string]spec)
+	for _, m := range pygmentsEntryRe.FindAllStringSubmatchIndex(text, -1) {
+		name := normalizePygmentsName(text[m[2]:m[3]])
+		specs[name] = spec{attrs: text[m[4]+1 : m[5]-1], line: strings.Count(text[:m[0]], "\n") + 1}
+	}
+	var background string
+	var backgroundLine int
+	if m := pygmentsBackgroundRe.FindStringSubmatchIndex(text); m != nil {
+		background = text[m[2]+1 : m[3]-1]
+		backgroundLine = strings.Count(text[:m[0]], "\n") + 1
+	}
+	resolved := make(map[string]TypeStyle)
+	var resolve func(name string) (TypeStyle, error)
+	resolve = func(name string) (TypeStyle, error) {
+		if s, ok := resolved[name]; ok {
+			return s, nil
+		}
+		var s, parent TypeStyle
+		spec := specs[name]
+		for _, attr := range strings.Fields(spec.attrs) {
+			if err := applyPygmentsAttr(&s, attr); err != nil {
+				return TypeStyle{}, fmt.Errorf("%s in line %d", err, spec.line)
+			}
+		}
+		if name == "" && background != "" {
+			if err := applyPygmentsAttr(&parent, "bg:"+background); err != nil {
+				return TypeStyle{}, fmt.Errorf("%s in line %d", err, backgroundLine)
+			}
+		}
+		if name != "" && !strings.Contains(" "+spec.attrs+" ", " noinherit ") {
+			var err error
+			if parent, err = resolve(pygmentsParent(name)); err != nil {
+				return TypeStyle{}, err
+			}
+		}
+		s = s.Inherit(parent)
+		resolved[name] = s
+		return s, nil
+	}
+	index := make(map[*LexemeType]TypeStyle)
+	for t, name := range typeToPygments {
+		s, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		index[t] = s
+	}
+	// the styles defined for unknown token names are checked too
+	for name := range specs {
+		if _, err := resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return newStyleFromIndex(index), nil
+}
+
+// applyPygmentsAttr applies the Pygments style attribute to s.
+func applyPygmentsAttr(s *TypeStyle, attr string) error {
+	switch attr {
+	case "bold", "nobold", "italic", "noitalic", "underline", "nounderline":
+		s.set(attr)
+	case "noinherit", "roman", "sans", "mono":
+		// font attributes are not supported and noinherit is handled by the caller
+	case "bg:":
+		s.setColor(backColorFlag, false, 0)
+	case "border:":
+		s.setColor(borderColorFlag, false, 0)
+	default:
+		flag := textColorFlag
+		color := attr
+		switch {
+		case strings.HasPrefix(attr, "bg:"):
+			flag, color = backColorFlag, attr[3:]
+		case strings.HasPrefix(attr, "border:"):
+			flag, color = borderColorFlag, attr[7:]
+		case !strings.HasPrefix(attr, "#"):
+			return fmt.Errorf("invalid style attribute '%s'", attr)
+		}
+		rgb, err := parsePygmentsColor(color)
+		if err != nil {
+			return err
+		}
+		s.setColor(flag, true, rgb)
+	}
+	return nil
+}
+
+// parsePygmentsColor parses a color in the format #RGB or #RRGGBB and
+// return it as 0xRRGGBB.
+func parsePygmentsColor(str string) (uint32, error) {
+	var v [6]uint32
+	if (len(str) != 4 && len(str) != 7) || str[0] != '#' {
+		return 0, fmt.Errorf("invalid color '%s'", str)
+	}
+	for i := 1; i < len(str); i++ {
+		c := str[i]
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c|0x20 >= 'a' && c|0x20 <= 'f':
+			c = c | 0x20 - 'a' + 10
+		default:
+			return 0, fmt.Errorf("invalid color '%s'", str)
+		}
+		v[i-1] = uint32(c)
+	}
+	if len(str) == 4 {
+		return v[0]*0x110000 | v[1]*0x1100 | v[2]*0x11, nil
+	}
+	return v[0]<<20 | v[1]<<16 | v[2]<<12 | v[3]<<8 | v[4]<<4 | v[5], nil
+}
@@ -0,0 +1,108 @@
+package clrcore
+
+import "testing"
+
+func TestPygmentsTokenType(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *LexemeType
+	}{
+		{in: "Keyword", out: CodeIdentifierKeyword},
+		{in: "Token.Keyword.Type", out: CodeIdentifierType},
+		{in: "String.Double", out: CodeStringDouble},
+		{in: "Literal.String.Escape", out: CodeString},
+		{in: "Number.Integer.Long", out: CodeNumberInteger},
+		{in: "Whitespace", out: TextWhiteSpace},
+		{in: "Operator", out: CodeOperator},
+		{in: "Punctuation", out: CodePunctuation},
+		{in: "Number", out: CodeNumber},
+		{in: "Literal.Number", out: CodeNumber},
+		{in: "Generic.Deleted", out: nil},
+		{in: "Token", out: nil},
+	}
+	for _, test := range tests {
+		if out := PygmentsTokenType(test.in); out != test.out {
+			t.Errorf("got %v, expected %v for '%s'", out, test.out, test.in)
+		}
+	}
+}
+
+func TestPygmentsTokenName(t *testing.T) {
+	tests := []struct {
+		in  *LexemeType
+		out string
+	}{
+		{in: CodeIdentifierKeyword, out: "Keyword"},
+		{in: CodeStringDouble, out: "Literal.String.Double"},
+		{in: CodeOperatorLogical, out: "Operator"},
+		{in: TextPunctuationSeparator, out: "Punctuation"},
+		{in: TextOperator, out: "Operator"},
+		{in: TextNumber, out: "Literal.Number"},
+		{in: Code, out: ""},
+		{in: StopError, out: ""},
+	}
+	for _, test := range tests {
+		if out := PygmentsTokenName(test.in); out != test.out {
+			t.Errorf("got '%s', expected '%s' for %s", out, test.out, test.in.Name)
+		}
+	}
+}
+
+func TestNewStyleFromPygments(t *testing.T) {
+	style, err := NewStyleFromPygments(`
+    background_color = "#272822"
+    styles = {
+        Token:                     '#f8f8f2',
+        Comment:                   'italic #75715e',
+        Keyword:                   'bold #66d9ef',
+        Keyword.Type:              'nobold',
+        Token.Literal.String:      '#e6db74 bg:',
+        String.Double:             'noinherit #abc',
+        Number:                    'underline border:#000000 #ae81ff',
+    }
+`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	index := style.Index()
+	tests := []struct {
+		t   *LexemeType
+		out string
+	}{
+		{t: Text, out: "text#F8F8F2 back#272822"},
+		{t: Code, out: "text#F8F8F2 back#272822"},
+		{t: CodeComment, out: "italic text#75715E back#272822"},
+		{t: CodeIdentifierKeyword, out: "bold text#66D9EF back#272822"},
+		{t: CodeIdentifierType, out: "text#66D9EF back#272822"},
+		{t: CodeString, out: "text#E6DB74"},
+		{t: CodeStringSingle, out: "text#E6DB74"},
+		{t: CodeStringDouble, out: "text#AABBCC"},
+		{t: CodeNumberHexadecimal, out: "underline text#AE81FF back#272822 border#000000"},
+		{t: CodeIdentifierMethod, out: "text#F8F8F2 back#272822"},
+	}
+	for _, test := range tests {
+		if out := index.TypeStyle(test.t).String(); out != test.out {
+			t.Errorf("got '%s', expected '%s' for %s", out, test.out, test.t.Name)
+		}
+	}
+}
+
+func TestNewStyleFromPygmentsErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{in: "Token: 'blink'", err: "invalid style attribute 'blink' in line 1"},
+		{in: "\nComment: '#12345'", err: "invalid color '#12345' in line 2"},
+		{in: "Generic: 'bg:#zzz'", err: "invalid color '#zzz' in line 1"},
+		{in: "background_color = 'white'", err: "invalid color 'white' in line 1"},
+	}
+	for _, test := range tests {
+		_, err := NewStyleFromPygments(test.in)
+		if err == nil {
+			t.Errorf("expected error '%s'", test.err)
+		} else if err.Error() != test.err {
+			t.Errorf("got error '%s', expected '%s'", err, test.err)
+		}
+	}
+}
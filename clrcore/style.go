@@ -1,107 +1,237 @@
 package clrcore
 
 import (
-	"bytes"
 	"fmt"
 	"strings"
 )
 
-// TypeStyle is an encoded style for a lexeme type.
-type TypeStyle uint64
+// TypeStyle is the style of a lexeme type. A type style may define an
+// attribute as set, unset (e.g. "nobold"), or leave it undefined so that
+// it is inherited from the parent lexeme type style.
+type TypeStyle struct {
+	flags   styleFlags // attributes set
+	defined styleFlags // attributes set or unset
+	text    uint32     // text color as 0xRRGGBB
+	back    uint32     // background color as 0xRRGGBB
+	border  uint32     // border color as 0xRRGGBB
+}
+
+type styleFlags uint16
 
 const (
 	// TextColorFlag is set when a text color is defined.
-	textColorFlag TypeStyle = 1 << iota
+	textColorFlag styleFlags = 1 << iota
 	// BackColorFlag is set when a background color is defined.
 	backColorFlag
 	// ItalicFlag is set when the text is italic.
 	italicFlag
 	// BoldFlag is set when the text is bold.
 	boldFlag
+	// UnderlineFlag is set when the text is underlined.
+	underlineFlag
+	// StrikethroughFlag is set when the text is struck through.
+	strikethroughFlag
+	// DimFlag is set when the text is dimmed.
+	dimFlag
+	// BorderColorFlag is set when a border color is defined.
+	borderColorFlag
 )
 
+// styleFlagNames are the style attribute names of the flags in String order.
+var styleFlagNames = [...]struct {
+	flag styleFlags
+	name string
+}{
+	{italicFlag, "italic"},
+	{boldFlag, "bold"},
+	{underlineFlag, "underline"},
+	{strikethroughFlag, "strikethrough"},
+	{dimFlag, "dim"},
+}
+
 // MakeStyle return a Style set with the given value: "italic" sets the italic
-// flag, "bold" sets the Bold flag, "text#RRGGBB" sets the text color,
-// and "back#RRGGBB" sets the bacground color. RR, GG, BB are the color values
-// for red (RR), green (GG) and blue (BB) in hexadecimal.
+// flag, "bold" sets the Bold flag, "underline", "strikethrough" and "dim" set
+// the corresponding flags, "text#RRGGBB" sets the text color,
+// "back#RRGGBB" sets the bacground color and "border#RRGGBB" sets the border
+// color. RR, GG, BB are the color values for red (RR), green (GG) and blue (BB)
+// in hexadecimal. The attribute names prefixed with "no" (e.g. "nobold",
+// "noback") unset the attribute instead of inheriting it.
 // Return an error if the style attribute is not rcognized.
 //
 //   MakeStyle() // default style
 //   MakeStyle("bold", "italic") // style is bold and italic with default color
 //   MakeStyle("text#123456") // style is text in color #123456
+//   MakeStyle("noitalic") // style is not italic whatever the parent style
 func MakeStyle(style ...string) (s TypeStyle, err error) {
 	for _, str := range style {
-		switch str {
-		case "bold":
-			s |= boldFlag
-		case "italic":
-			s |= italicFlag
-		default:
-			var red, green, blue TypeStyle
-			if n, err := fmt.Sscanf(str, "text#%2x%2x%2x", &red, &green, &blue); err == nil && n == 3 {
-				s &= ^TypeStyle(0xFFFFFF0000)
-				s |= textColorFlag | red<<16 | green<<24 | blue<<32
-			} else if n, err := fmt.Sscanf(str, "back#%2x%2x%2x", &red, &green, &blue); err == nil && n == 3 {
-				s &= ^TypeStyle(0xFFFFFF0000000000)
-				s |= backColorFlag | red<<40 | green<<48 | blue<<56
-			} else {
-				return 0, fmt.Errorf("invalid style attribute '%s'", str)
-			}
+		if !s.set(str) {
+			return TypeStyle{}, fmt.Errorf("invalid style attribute '%s'", str)
 		}
 	}
 	return
 }
 
+// set sets the style attribute str, and return false if str is invalid.
+func (s *TypeStyle) set(str string) bool {
+	for _, f := range styleFlagNames {
+		switch str {
+		case f.name:
+			s.flags |= f.flag
+			s.defined |= f.flag
+			return true
+		case "no" + f.name:
+			s.flags &^= f.flag
+			s.defined |= f.flag
+			return true
+		}
+	}
+	switch str {
+	case "notext":
+		s.setColor(textColorFlag, false, 0)
+		return true
+	case "noback":
+		s.setColor(backColorFlag, false, 0)
+		return true
+	case "noborder":
+		s.setColor(borderColorFlag, false, 0)
+		return true
+	}
+	var red, green, blue uint32
+	if n, err := fmt.Sscanf(str, "text#%2x%2x%2x", &red, &green, &blue); err == nil && n == 3 {
+		s.setColor(textColorFlag, true, red<<16|green<<8|blue)
+	} else if n, err := fmt.Sscanf(str, "back#%2x%2x%2x", &red, &green, &blue); err == nil && n == 3 {
+		s.setColor(backColorFlag, true, red<<16|green<<8|blue)
+	} else if n, err := fmt.Sscanf(str, "border#%2x%2x%2x", &red, &green, &blue); err == nil && n == 3 {
+		s.setColor(borderColorFlag, true, red<<16|green<<8|blue)
+	} else {
+		return false
+	}
+	return true
+}
+
+// setColor sets or unsets the color with the given flag.
+func (s *TypeStyle) setColor(flag styleFlags, set bool, rgb uint32) {
+	s.defined |= flag
+	if set {
+		s.flags |= flag
+	} else {
+		s.flags &^= flag
+		rgb = 0
+	}
+	switch flag {
+	case textColorFlag:
+		s.text = rgb
+	case backColorFlag:
+		s.back = rgb
+	case borderColorFlag:
+		s.border = rgb
+	}
+}
+
+// Inherit return the type style s where the attributes it doesn't define are
+// those of parent. The returned type style defines only the attributes that are
+// set.
+func (s TypeStyle) Inherit(parent TypeStyle) TypeStyle {
+	inherited := parent.flags &^ s.defined
+	r := TypeStyle{flags: s.flags | inherited, text: s.text, back: s.back, border: s.border}
+	r.defined = r.flags
+	if inherited&textColorFlag != 0 {
+		r.text = parent.text
+	}
+	if inherited&backColorFlag != 0 {
+		r.back = parent.back
+	}
+	if inherited&borderColorFlag != 0 {
+		r.border = parent.border
+	}
+	return r
+}
+
+// IsZero return true if the type style is the default style.
+func (s TypeStyle) IsZero() bool {
+	return s == TypeStyle{}
+}
+
 // Bold return true if the type style is bold.
 func (s TypeStyle) Bold() bool {
-	return s&boldFlag != 0
+	return s.flags&boldFlag != 0
 }
 
 // Italic return true if the type style is italic.
 func (s TypeStyle) Italic() bool {
-	return s&italicFlag != 0
+	return s.flags&italicFlag != 0
+}
+
+// Underline return true if the type style is underlined.
+func (s TypeStyle) Underline() bool {
+	return s.flags&underlineFlag != 0
+}
+
+// Strikethrough return true if the type style is struck through.
+func (s TypeStyle) Strikethrough() bool {
+	return s.flags&strikethroughFlag != 0
+}
+
+// Dim return true if the type style is dimmed.
+func (s TypeStyle) Dim() bool {
+	return s.flags&dimFlag != 0
 }
 
 // HasTextColor return true if the type style has a text color defined.
 func (s TypeStyle) HasTextColor() bool {
-	return s&textColorFlag != 0
+	return s.flags&textColorFlag != 0
 }
 
 // TextColor return the text color.
 func (s TypeStyle) TextColor() (red byte, green byte, blue byte) {
-	return byte(s >> 16), byte(s >> 24), byte(s >> 32)
+	return byte(s.text >> 16), byte(s.text >> 8), byte(s.text)
 }
 
 // HasBackColor return true if the type style has a back color defined.
 func (s TypeStyle) HasBackColor() bool {
-	return s&backColorFlag != 0
+	return s.flags&backColorFlag != 0
 }
 
 // BackColor return true if the type style has a back color defined.
 func (s TypeStyle) BackColor() (red byte, green byte, blue byte) {
-	return byte(s >> 40), byte(s >> 48), byte(s >> 56)
+	return byte(s.back >> 16), byte(s.back >> 8), byte(s.back)
+}
+
+// HasBorderColor return true if the type style has a border color defined.
+func (s TypeStyle) HasBorderColor() bool {
+	return s.flags&borderColorFlag != 0
+}
+
+// BorderColor return the border color.
+func (s TypeStyle) BorderColor() (red byte, green byte, blue byte) {
+	return byte(s.border >> 16), byte(s.border >> 8), byte(s.border)
 }
 
 func (s TypeStyle) String() string {
-	if uint16(s) == 0 {
-		return ""
-	}
-	var buf bytes.Buffer
-	if s.Italic() {
-		buf.WriteString("italic ")
-	}
-	if s.Bold() {
-		buf.WriteString("bold ")
-	}
-	if s.HasTextColor() {
-		r, g, b := s.TextColor()
-		fmt.Fprintf(&buf, "text#%02X%02X%02X ", r, g, b)
+	var fields []string
+	for _, f := range styleFlagNames {
+		if s.flags&f.flag != 0 {
+			fields = append(fields, f.name)
+		} else if s.defined&f.flag != 0 {
+			fields = append(fields, "no"+f.name)
+		}
 	}
-	if s.HasBackColor() {
-		r, g, b := s.BackColor()
-		fmt.Fprintf(&buf, "back#%02X%02X%02X ", r, g, b)
+	for _, c := range [...]struct {
+		flag styleFlags
+		name string
+		rgb  uint32
+	}{
+		{textColorFlag, "text", s.text},
+		{backColorFlag, "back", s.back},
+		{borderColorFlag, "border", s.border},
+	} {
+		if s.flags&c.flag != 0 {
+			fields = append(fields, fmt.Sprintf("%s#%06X", c.name, c.rgb))
+		} else if s.defined&c.flag != 0 {
+			fields = append(fields, "no"+c.name)
+		}
 	}
-	return buf.String()[:buf.Len()-1]
+	return strings.Join(fields, " ")
 }
 
 // Style defines a formatting style
@@ -112,7 +242,8 @@ type forAllTypesFunc func(*LexemeType, TypeStyle, forAllTypesFunc)
 // NewStyle return a Style initialized with the text style definition.
 // Each non empty line specify the style for a lexeme type and all it's subtypes.
 // and are followed by the style specification which will apply by default
-// to all the  type's children.
+// to all the  type's children. The attributes not defined for a type are
+// inherited from its parent type, and may be unset with the "no" prefix.
 // The Stop lexeme types can't have a style defined.
 func NewStyle(text string) (Style, error) {
 	index := make(map[*LexemeType]TypeStyle)
@@ -134,6 +265,27 @@ func NewStyle(text string) (Style, error) {
 		}
 		index[t] = s
 	}
+	// resolve the inherited attributes
+	var inherit func(t *LexemeType, parent TypeStyle)
+	inherit = func(t *LexemeType, parent TypeStyle) {
+		if s, ok := index[t]; ok {
+			parent = s.Inherit(parent)
+			index[t] = parent
+		}
+		for _, c := range t.Children {
+			inherit(c, parent)
+		}
+	}
+	for _, t := range LexemeClassTypes() {
+		inherit(t, TypeStyle{})
+	}
+	return newStyleFromIndex(index), nil
+}
+
+// newStyleFromIndex return the style where each lexeme type has the type style
+// of the index, or the one of its closest parent in the index. The type styles
+// of the index must be resolved.
+func newStyleFromIndex(index map[*LexemeType]TypeStyle) Style {
 	// invert type style index
 	style := make(map[TypeStyle][]*LexemeType)
 	forAllTypesInClass := func(t *LexemeType, s TypeStyle, f forAllTypesFunc) {
@@ -149,7 +301,33 @@ func NewStyle(text string) (Style, error) {
 		if t == Stop {
 			continue
 		}
-		forAllTypesInClass(t, 0, forAllTypesInClass)
+		forAllTypesInClass(t, TypeStyle{}, forAllTypesInClass)
+	}
+	return style
+}
+
+// StyleIndex maps lexeme types to their type style.
+type StyleIndex map[*LexemeType]TypeStyle
+
+// Index return the style indexed by lexeme type.
+func (s Style) Index() StyleIndex {
+	index := make(StyleIndex)
+	for typeStyle, lexemeTypes := range s {
+		for _, t := range lexemeTypes {
+			index[t] = typeStyle
+		}
+	}
+	return index
+}
+
+// TypeStyle return the type style of t. When t is not in the index, the
+// type style of its closest parent in the index is returned. Return the
+// default type style if none is found.
+func (i StyleIndex) TypeStyle(t *LexemeType) TypeStyle {
+	for ; t != nil; t = t.Parent {
+		if s, ok := i[t]; ok {
+			return s
+		}
 	}
-	return style, nil
+	return TypeStyle{}
 }
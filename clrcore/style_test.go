@@ -20,6 +20,10 @@ func TestMakeStyle(t *testing.T) {
 		{in: []string{"back#789ABC", "bold", "italic"}, out: "italic bold back#789ABC"},
 		{in: []string{"#123"}, err: "invalid style attribute '#123'"},
 		{in: []string{"italic", "bold", "#1234"}, err: "invalid style attribute '#1234'"},
+		{in: []string{"underline", "strikethrough", "dim"}, out: "underline strikethrough dim"},
+		{in: []string{"border#00FF00", "nobold", "noitalic"}, out: "noitalic nobold border#00FF00"},
+		{in: []string{"back#123456", "noback", "notext", "noborder"}, out: "notext noback noborder"},
+		{in: []string{"nounderline", "underline"}, out: "underline"},
 	}
 	for _, test := range tests {
 		style, err := MakeStyle(test.in...)
@@ -83,10 +87,33 @@ func TestTypeStyle(t *testing.T) {
 	}
 }
 
+func TestTypeStyleInherit(t *testing.T) {
+	tests := []struct {
+		style, parent []string
+		out           string
+	}{
+		{style: []string{}, parent: []string{}, out: ""},
+		{style: []string{"bold"}, parent: []string{"italic", "text#123456"}, out: "italic bold text#123456"},
+		{style: []string{"nobold", "underline"}, parent: []string{"bold", "dim"}, out: "underline dim"},
+		{style: []string{"text#ABCDEF", "noback"}, parent: []string{"text#123456", "back#789ABC"}, out: "text#ABCDEF"},
+		{style: []string{"strikethrough"}, parent: []string{"border#010203", "back#040506"}, out: "strikethrough back#040506 border#010203"},
+		{style: []string{"noborder", "noitalic"}, parent: []string{"border#010203"}, out: ""},
+	}
+	for _, test := range tests {
+		style, _ := MakeStyle(test.style...)
+		parent, _ := MakeStyle(test.parent...)
+		if out := style.Inherit(parent); out.String() != test.out {
+			t.Errorf("got '%s', expected '%s' for '%s' inheriting '%s'", out, test.out, style, parent)
+		} else if expect, _ := MakeStyle(strings.Fields(test.out)...); out != expect {
+			t.Errorf("got %#v, expected %#v", out, expect)
+		}
+	}
+}
+
 func TestNewStyleFromText(t *testing.T) {
-	colorStyle, _ := MakeStyle("text#123456")
+	colorStyle, _ := MakeStyle("italic", "text#123456")
 	italicStyle, _ := MakeStyle("italic")
-	boldStyle, _ := MakeStyle("bold")
+	boldStyle, _ := MakeStyle("italic", "bold")
 	dfltStyle, _ := MakeStyle()
 
 	textStyle := `
@@ -119,10 +146,11 @@ func TestNewStyleFromText(t *testing.T) {
 		expectTypes = []*LexemeType{Text, TextWhiteSpace, TextNewLine, TextInvalid, TextPunctuation,
 			TextPunctuationSeparator, TextPunctuationDelimiter, TextOperator, TextWord, TextNumber,
 			TextOther, Code, CodeString, CodeStringSingle, CodeStringDouble, CodeStringRaw,
-			CodeStringUnicode, CodeStringMultiline, CodeNumber, CodeNumberInteger,
+			CodeStringUnicode, CodeStringMultiline, CodeStringRegex, CodeNumber, CodeNumberInteger,
 			CodeNumberHexadecimal, CodeNumberOctal, CodeNumberBinary, CodeNumberDecimal,
 			CodeComment, CodeOperator, CodeOperatorAssignment, CodeOperatorArithmetic,
-			CodeOperatorLogical, CodeOperatorBinary, CodePunctuation, CodeDelimiter}
+			CodeOperatorLogical, CodeOperatorBinary, CodePunctuation, CodeDelimiter, CodePreprocessor,
+			CodePreprocessorFile}
 		if !reflect.DeepEqual(gotTypes, expectTypes) {
 			t.Errorf("got default types %v, expect %+v", gotTypes, expectTypes)
 		}
@@ -146,3 +174,36 @@ func TestNewStyleFromText(t *testing.T) {
 	}
 
 }
+
+func TestStyleIndex(t *testing.T) {
+	style, err := NewStyle(`
+	Code.Identifier italic
+	Code.Identifier.Variable noitalic bold
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	italicStyle, _ := MakeStyle("italic")
+	boldStyle, _ := MakeStyle("bold")
+	index := style.Index()
+	tests := []struct {
+		in  *LexemeType
+		out TypeStyle
+	}{
+		{in: CodeIdentifier, out: italicStyle},
+		{in: CodeIdentifierVariable, out: boldStyle},
+		{in: CodeIdentifierType, out: italicStyle},
+		{in: CodeString, out: TypeStyle{}},
+		{in: nil, out: TypeStyle{}},
+	}
+	for _, test := range tests {
+		if out := index.TypeStyle(test.in); out != test.out {
+			t.Errorf("got style '%s', expected '%s' for %s", out, test.out, test.in)
+		}
+	}
+	// types missing from the index inherit the style of their parent
+	delete(index, CodeIdentifierType)
+	if out := index.TypeStyle(CodeIdentifierType); out != italicStyle {
+		t.Errorf("got style '%s', expected '%s'", out, italicStyle)
+	}
+}
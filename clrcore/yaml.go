@@ -0,0 +1,432 @@
+package clrcore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// yamlParser parses the subset of YAML used by the lexer description files:
+// block mappings and sequences, flow mappings and sequences on one line, plain
+// scalars on one line, single and double quoted scalars on one line, literal and
+// folded block scalars, and comments. Anchors, aliases, tags and multiple
+// documents are not supported.
+type yamlParser struct {
+	lines []string
+	n     int // index of the current line
+}
+
+// parseYAML return the value of the YAML document data. Its mappings are
+// map[string]interface{}, its sequences are []interface{}, and its scalars are
+// string, int64, float64, bool or nil.
+func parseYAML(data []byte) (interface{}, error) {
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	p := &yamlParser{lines: strings.Split(text, "\n")}
+	if p.next() == 0 && stripYAMLComment(p.lines[p.n]) == "---" {
+		p.n++
+	}
+	v, err := p.parseNode(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.next() >= 0 {
+		return nil, p.errorf("unexpected indentation or content")
+	}
+	return v, nil
+}
+
+// errorf return an error located at the current line.
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("yaml line %d: %s", p.n+1, fmt.Sprintf(format, args...))
+}
+
+// next skips the blank and comment lines, and return the indentation of the
+// current line, or -1 at the end of the document.
+func (p *yamlParser) next() int {
+	for ; p.n < len(p.lines); p.n++ {
+		line := p.lines[p.n]
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text[0] == '#' || strings.TrimSpace(text) == "" {
+			continue
+		}
+		return len(line) - len(text)
+	}
+	return -1
+}
+
+// parseNode return the node starting at the current line when it is indented
+// by at least minIndent spaces, or nil.
+func (p *yamlParser) parseNode(minIndent int) (interface{}, error) {
+	ind := p.next()
+	if ind < minIndent {
+		return nil, nil
+	}
+	text := p.lines[p.n][ind:]
+	if text[0] == '\t' {
+		return nil, p.errorf("tab in indentation")
+	}
+	if isYAMLSeqItem(text) {
+		return p.parseSeq(ind)
+	}
+	if _, _, ok, err := splitYAMLMapping(text); err != nil {
+		return nil, p.errorf("%v", err)
+	} else if ok {
+		return p.parseMap(ind)
+	}
+	if text[0] == '|' || text[0] == '>' {
+		return p.parseBlockScalar(text, minIndent-1)
+	}
+	v, err := p.parseInline(text)
+	p.n++
+	return v, err
+}
+
+// isYAMLSeqItem return true if text is a block sequence item.
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseSeq return the block sequence whose items are indented by ind spaces.
+func (p *yamlParser) parseSeq(ind int) ([]interface{}, error) {
+	list := []interface{}{}
+	for p.next() == ind && isYAMLSeqItem(p.lines[p.n][ind:]) {
+		// the item is parsed as if the dash was a space, so that the nodes
+		// following the dash on the line are indented as the next lines
+		line := p.lines[p.n]
+		p.lines[p.n] = line[:ind] + " " + line[ind+1:]
+		item, err := p.parseNode(ind + 1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// parseMap return the block mapping whose keys are indented by ind spaces.
+func (p *yamlParser) parseMap(ind int) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for p.next() == ind {
+		key, rest, ok, err := splitYAMLMapping(p.lines[p.n][ind:])
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if !ok {
+			break
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key '%s'", key)
+		}
+		var v interface{}
+		switch {
+		case rest == "" || rest[0] == '#':
+			p.n++
+			// a sequence may have the indentation of its key
+			if p.next() == ind && isYAMLSeqItem(p.lines[p.n][ind:]) {
+				v, err = p.parseSeq(ind)
+			} else {
+				v, err = p.parseNode(ind + 1)
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			v, err = p.parseBlockScalar(rest, ind)
+		default:
+			v, err = p.parseInline(rest)
+			p.n++
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// splitYAMLMapping return the key and the value text of the mapping entry text,
+// and false if text is not a mapping entry.
+func splitYAMLMapping(text string) (key, rest string, ok bool, err error) {
+	switch text[0] {
+	case '[', '{', '|', '>', '#':
+		return "", "", false, nil
+	case '"', '\'':
+		var end int
+		if key, end, err = parseYAMLQuoted(text); err != nil {
+			return "", "", false, err
+		}
+		rest = strings.TrimLeft(text[end:], " ")
+		if rest == ":" || strings.HasPrefix(rest, ": ") {
+			return key, strings.TrimSpace(rest[1:]), true, nil
+		}
+		return "", "", false, nil
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '#' && i > 0 && text[i-1] == ' ' {
+			break
+		}
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimRight(text[:i], " "), strings.TrimSpace(text[i+1:]), true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// parseInline return the value of the scalar or flow collection text.
+func (p *yamlParser) parseInline(text string) (interface{}, error) {
+	var v interface{}
+	var end int
+	var err error
+	switch text[0] {
+	case '"', '\'':
+		v, end, err = parseYAMLQuoted(text)
+	case '[', '{':
+		f := &yamlFlow{s: text}
+		v, err = f.value()
+		end = f.i
+	case '&', '*', '!':
+		return nil, p.errorf("anchors, aliases and tags are not supported")
+	case '|', '>':
+		return nil, p.errorf("unexpected block scalar")
+	default:
+		return plainYAMLScalar(stripYAMLComment(text)), nil
+	}
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	if rest := strings.TrimSpace(text[end:]); rest != "" && rest[0] != '#' {
+		return nil, p.errorf("unexpected '%s'", rest)
+	}
+	return v, nil
+}
+
+// parseBlockScalar return the literal (|) or folded (>) block scalar of the
+// header, whose lines are indented by more than parent spaces.
+func (p *yamlParser) parseBlockScalar(header string, parent int) (string, error) {
+	header = stripYAMLComment(header)
+	style, chomp := header[0], header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", p.errorf("unsupported block scalar header '%s'", header)
+	}
+	p.n++
+	var lines []string
+	indent := -1
+	for ; p.n < len(p.lines); p.n++ {
+		line := p.lines[p.n]
+		text := strings.TrimLeft(line, " ")
+		ind := len(line) - len(text)
+		if text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if indent < 0 {
+			if ind <= parent {
+				break
+			}
+			indent = ind
+		}
+		if ind < indent {
+			break
+		}
+		lines = append(lines, line[indent:])
+	}
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	var b strings.Builder
+	for i, line := range lines[:end] {
+		switch {
+		case i == 0:
+		case style == '|' || line == "":
+			b.WriteByte('\n')
+		case lines[i-1] != "":
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+	}
+	if end > 0 {
+		switch chomp {
+		case "":
+			b.WriteByte('\n')
+		case "+":
+			b.WriteString(strings.Repeat("\n", len(lines)-end+1))
+		}
+	}
+	return b.String(), nil
+}
+
+// stripYAMLComment return text without its trailing comment and spaces.
+func stripYAMLComment(text string) string {
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text)
+}
+
+// plainYAMLScalar return the value of the plain scalar s.
+func plainYAMLScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if strings.Trim(s, "+-.0123456789eE") == "" && strings.ContainsAny(s, "0123456789") {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// parseYAMLQuoted return the value of the single or double quoted scalar at the
+// start of s, and the index of its end.
+func parseYAMLQuoted(s string) (string, int, error) {
+	var b strings.Builder
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == q && q == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == q:
+			return b.String(), i + 1, nil
+		case c == '\\' && q == '"':
+			if i+1 == len(s) {
+				return "", 0, errors.New("unterminated escape sequence")
+			}
+			i++
+			if r, ok := yamlEscapes[s[i]]; ok {
+				b.WriteRune(r)
+				continue
+			}
+			n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+			if n == 0 || i+n >= len(s) {
+				return "", 0, fmt.Errorf("invalid escape sequence '\\%c'", s[i])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", 0, fmt.Errorf("invalid escape sequence '\\%s'", s[i:i+1+n])
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quoted scalar")
+}
+
+// yamlEscapes are the runes of the one character escape sequences of the double
+// quoted scalars.
+var yamlEscapes = map[byte]rune{
+	'0': 0, 'a': '\a', 'b': '\b', 't': '\t', '\t': '\t', 'n': '\n', 'v': '\v', 'f': '\f',
+	'r': '\r', 'e': 0x1b, ' ': ' ', '"': '"', '/': '/', '\\': '\\', 'N': 0x85,
+	'_': 0xa0,
+}
+
+// yamlFlow parses a flow collection.
+type yamlFlow struct {
+	s string
+	i int
+}
+
+func (f *yamlFlow) skipSpaces() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+// value return the value at the current position.
+func (f *yamlFlow) value() (interface{}, error) {
+	f.skipSpaces()
+	if f.i == len(f.s) {
+		return nil, errors.New("unterminated flow collection")
+	}
+	switch f.s[f.i] {
+	case '[':
+		f.i++
+		list := []interface{}{}
+		for {
+			if f.skipSpaces(); f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return list, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.i++
+		m := make(map[string]interface{})
+		for {
+			if f.skipSpaces(); f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return m, nil
+			}
+			k, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprint(k)
+			}
+			if f.skipSpaces(); f.i == len(f.s) || f.s[f.i] != ':' {
+				return nil, fmt.Errorf("missing ':' after key '%s'", key)
+			}
+			f.i++
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := m[key]; dup {
+				return nil, fmt.Errorf("duplicate key '%s'", key)
+			}
+			m[key] = v
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		s, end, err := parseYAMLQuoted(f.s[f.i:])
+		f.i += end
+		return s, err
+	case ',', ']', '}':
+		return nil, fmt.Errorf("unexpected '%c'", f.s[f.i])
+	}
+	// plain scalar ending at an indicator
+	start := f.i
+	for ; f.i < len(f.s); f.i++ {
+		c := f.s[f.i]
+		if c == ',' || c == ']' || c == '}' || (c == ':' && (f.i+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.i+1]) >= 0)) {
+			break
+		}
+	}
+	return plainYAMLScalar(strings.TrimSpace(f.s[start:f.i])), nil
+}
+
+// separator skips the ',' following a value, or stops before the end rune.
+func (f *yamlFlow) separator(end byte) error {
+	f.skipSpaces()
+	switch {
+	case f.i == len(f.s):
+		return errors.New("unterminated flow collection")
+	case f.s[f.i] == ',':
+		f.i++
+	case f.s[f.i] != end:
+		return fmt.Errorf("unexpected '%c' in flow collection", f.s[f.i])
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package clrcore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		yaml   string
+		expect interface{}
+	}{
+		{yaml: "", expect: nil},
+		{yaml: "--- # document\na: 1\n", expect: map[string]interface{}{"a": int64(1)}},
+		{yaml: "a: x # comment\nb: 'it''s # not a comment'\nc: \"\\t\\u00e9\\\\\"\n", expect: map[string]interface{}{
+			"a": "x", "b": "it's # not a comment", "c": "\té\\",
+		}},
+		{yaml: "n: ~\nt: true\nf: false\nx: -1.5e3\ns: 1.2.3\nu: http://x\n", expect: map[string]interface{}{
+			"n": nil, "t": true, "f": false, "x": -1500.0, "s": "1.2.3", "u": "http://x",
+		}},
+		{yaml: "- a\n-   b\n- - c\n  - d\n-\n  e\n", expect: []interface{}{"a", "b", []interface{}{"c", "d"}, "e"}},
+		{yaml: "list:\n- a: 1\n  b: [x, 'y', {k: v, \"q\": [1]}]\n\n  # comment\n  c:\n    d: e\n- {}\n", expect: map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{
+					"a": int64(1),
+					"b": []interface{}{"x", "y", map[string]interface{}{"k": "v", "q": []interface{}{int64(1)}}},
+					"c": map[string]interface{}{"d": "e"},
+				},
+				map[string]interface{}{},
+			},
+		}},
+		{yaml: "a: |\n  x\n   y\n\n  z\n\nb: >-\n  x\n  y\n\n  z\nc: |+\n  x\n\n\n\"d\": |-\n  x\n", expect: map[string]interface{}{
+			"a": "x\n y\n\nz\n", "b": "x y\nz", "c": "x\n\n\n", "d": "x",
+		}},
+		{yaml: "- |\n  a\\s+\n- '[a-z]+'\n", expect: []interface{}{"a\\s+\n", "[a-z]+"}},
+	}
+	for _, test := range tests {
+		v, err := parseYAML([]byte(test.yaml))
+		if err != nil {
+			t.Errorf("unexpected error: %s for\n%s", err, test.yaml)
+			continue
+		}
+		if !reflect.DeepEqual(v, test.expect) {
+			t.Errorf("got %#v, expected %#v for\n%s", v, test.expect, test.yaml)
+		}
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		yaml   string
+		expect string
+	}{
+		{yaml: "a: 1\n  b: 2\n", expect: "yaml line 2: unexpected indentation or content"},
+		{yaml: "a: 1\na: 2\n", expect: "yaml line 2: duplicate key 'a'"},
+		{yaml: "a: 'x\n", expect: "yaml line 1: unterminated quoted scalar"},
+		{yaml: "a: \"\\q\"\n", expect: "yaml line 1: invalid escape sequence '\\q'"},
+		{yaml: "a: [1, 2\n", expect: "yaml line 1: unterminated flow collection"},
+		{yaml: "a: {b 1}\n", expect: "yaml line 1: missing ':' after key 'b 1'"},
+		{yaml: "a: *ref\n", expect: "yaml line 1: anchors, aliases and tags are not supported"},
+		{yaml: "a: 'x' y\n", expect: "yaml line 1: unexpected 'y'"},
+		{yaml: "a: |2\n  x\n", expect: "yaml line 1: unsupported block scalar header '|2'"},
+		{yaml: "- a\nb: 1\n", expect: "yaml line 2: unexpected indentation or content"},
+		{yaml: "\t- a\n", expect: "yaml line 1: tab in indentation"},
+	}
+	for _, test := range tests {
+		_, err := parseYAML([]byte(test.yaml))
+		if err == nil || !strings.Contains(err.Error(), test.expect) {
+			t.Errorf("got error %v, expected %s for\n%s", err, test.expect, test.yaml)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package clrfmt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+// ColorMode is the color encoding used by the ANSI formatter.
+type ColorMode int
+
+const (
+	// AutoColor detects the color mode from the environment variables
+	// NO_COLOR, COLORTERM and TERM.
+	AutoColor ColorMode = iota
+	// NoColor outputs the text without escape sequences.
+	NoColor
+	// Color16 uses the 8 standard and 8 bright terminal colors.
+	Color16
+	// Color256 uses the xterm 256 color palette.
+	Color256
+	// TrueColor uses 24 bit RGB colors.
+	TrueColor
+)
+
+// ANSIOptions are the ANSI formatting options.
+type ANSIOptions struct {
+	Mode ColorMode // Color mode, detected from the environment when AutoColor.
+	// ResetAtNewLine resets the attributes before each new line and restores
+	// them after, so that each line can be displayed independently (e.g. less -R).
+	ResetAtNewLine bool
+}
+
+// DetectColorMode return the color mode supported by the terminal according
+// to the environment variables NO_COLOR, COLORTERM and TERM.
+func DetectColorMode() ColorMode {
+	return detectColorMode(os.Getenv)
+}
+
+func detectColorMode(getenv func(string) string) ColorMode {
+	if getenv("NO_COLOR") != "" {
+		return NoColor
+	}
+	switch getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return TrueColor
+	}
+	term := getenv("TERM")
+	switch {
+	case term == "" || term == "dumb":
+		return NoColor
+	case strings.Contains(term, "256color"):
+		return Color256
+	}
+	return Color16
+}
+
+// ANSI writes the text formatted with ANSI escape sequences according to
+// style, and return the number of bytes written. When the lexer stops,
+// whatever the reason, the remaining text is written out unformatted.
+// The options may be nil.
+func ANSI(w io.Writer, info *clrcore.LexerInfo, text string, style clrcore.Style, opts *ANSIOptions) (score int, n int, err error) {
+	if info == nil {
+		return 0, 0, errors.New("LexerInfo is nil")
+	}
+	lexer, err := info.NewLexer(text)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ansiFormat(w, lexer, style, opts)
+}
+
+// ANSIFromReader is like ANSI, but the text is read from r and the output is
+// written as it goes.
+func ANSIFromReader(w io.Writer, info *clrcore.LexerInfo, r io.Reader, style clrcore.Style, opts *ANSIOptions) (score int, n int, err error) {
+	if info == nil {
+		return 0, 0, errors.New("LexerInfo is nil")
+	}
+	lexer, err := clrcore.NewLexerFromReader(info, r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ansiFormat(w, lexer, style, opts)
+}
+
+// ansiFormat writes the lexemes of lexer formatted with ANSI escape sequences.
+func ansiFormat(w io.Writer, lexer clrcore.Lexer, style clrcore.Style, opts *ANSIOptions) (score int, n int, err error) {
+	if opts == nil {
+		opts = &ANSIOptions{}
+	}
+	mode := opts.Mode
+	if mode == AutoColor {
+		mode = DetectColorMode()
+	}
+	a := &ansiWriter{w: w, resetAtNewLine: opts.ResetAtNewLine}
+	index := style.Index()
+	seqs := make(map[clrcore.TypeStyle]string)
+	score, err = formatLexemes(lexer,
+		func(lexeme clrcore.Lexeme) error {
+			typeStyle := index.TypeStyle(lexeme.Type)
+			seq, ok := seqs[typeStyle]
+			if !ok {
+				seq = sgrSequence(typeStyle, mode)
+				seqs[typeStyle] = seq
+			}
+			a.writeText(seq, lexeme.Str)
+			return a.err
+		},
+		func(remainingText string) error {
+			a.writeText("", remainingText)
+			return a.err
+		},
+		func() error {
+			a.setSGR("")
+			return a.flush()
+		})
+	if err != nil {
+		a.flush()
+		return 0, a.n, err
+	}
+	return score, a.n, nil
+}
+
+// ansiReset is the SGR sequence resetting all attributes.
+const ansiReset = "\x1b[0m"
+
+// ansiWriter writes text with SGR sequences. The output is buffered and written
+// out by chunks.
+type ansiWriter struct {
+	w              io.Writer
+	buf            bytes.Buffer
+	n              int // number of bytes written to w
+	err            error
+	sgr            string // SGR sequence in effect
+	resetAtNewLine bool
+}
+
+// setSGR sets the SGR sequence in effect.
+func (a *ansiWriter) setSGR(seq string) {
+	if seq == a.sgr {
+		return
+	}
+	if a.sgr != "" {
+		a.buf.WriteString(ansiReset)
+	}
+	a.buf.WriteString(seq)
+	a.sgr = seq
+}
+
+// writeText writes str with the SGR sequence seq.
+func (a *ansiWriter) writeText(seq string, str string) {
+	if !a.resetAtNewLine {
+		if str != "" {
+			a.setSGR(seq)
+			a.buf.WriteString(str)
+		}
+	} else {
+		for len(str) > 0 {
+			i := strings.IndexByte(str, '\n')
+			if i < 0 {
+				a.setSGR(seq)
+				a.buf.WriteString(str)
+				break
+			}
+			if i > 0 {
+				a.setSGR(seq)
+				a.buf.WriteString(str[:i])
+			}
+			a.setSGR("")
+			a.buf.WriteByte('\n')
+			str = str[i+1:]
+		}
+	}
+	if a.buf.Len() >= flushSize {
+		a.flush()
+	}
+}
+
+// flush writes the buffered output to w, and return the first error encountered.
+func (a *ansiWriter) flush() error {
+	if a.err == nil && a.buf.Len() > 0 {
+		var n int
+		n, a.err = a.w.Write(a.buf.Bytes())
+		a.n += n
+	}
+	a.buf.Reset()
+	return a.err
+}
+
+// sgrSequence return the SGR sequence setting the type style s in the color
+// mode, or an empty string if there is nothing to set.
+func sgrSequence(s clrcore.TypeStyle, mode ColorMode) string {
+	if s.IsZero() || mode == NoColor {
+		return ""
+	}
+	var params []string
+	if s.Bold() {
+		params = append(params, "1")
+	}
+	if s.Dim() {
+		params = append(params, "2")
+	}
+	if s.Italic() {
+		params = append(params, "3")
+	}
+	if s.Underline() {
+		params = append(params, "4")
+	}
+	if s.Strikethrough() {
+		params = append(params, "9")
+	}
+	if s.HasBorderColor() {
+		// the framed attribute has no color
+		params = append(params, "51")
+	}
+	if s.HasTextColor() {
+		r, g, b := s.TextColor()
+		params = append(params, colorParam(mode, false, r, g, b))
+	}
+	if s.HasBackColor() {
+		r, g, b := s.BackColor()
+		params = append(params, colorParam(mode, true, r, g, b))
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// colorParam return the SGR parameter setting the text color, or the
+// background color when back is true, in the given color mode.
+func colorParam(mode ColorMode, back bool, r, g, b byte) string {
+	switch mode {
+	case TrueColor:
+		if back {
+			return fmt.Sprintf("48;2;%d;%d;%d", r, g, b)
+		}
+		return fmt.Sprintf("38;2;%d;%d;%d", r, g, b)
+	case Color256:
+		if back {
+			return fmt.Sprintf("48;5;%d", nearestColor256(r, g, b))
+		}
+		return fmt.Sprintf("38;5;%d", nearestColor256(r, g, b))
+	}
+	idx := nearestColor16(r, g, b)
+	base := 30
+	if back {
+		base = 40
+	}
+	if idx >= 8 {
+		base += 60
+		idx -= 8
+	}
+	return strconv.Itoa(base + idx)
+}
+
+// ansi16Palette is the xterm RGB value of the 16 standard terminal colors.
+var ansi16Palette = [16][3]byte{
+	{0x00, 0x00, 0x00}, {0xcd, 0x00, 0x00}, {0x00, 0xcd, 0x00}, {0xcd, 0xcd, 0x00},
+	{0x00, 0x00, 0xee}, {0xcd, 0x00, 0xcd}, {0x00, 0xcd, 0xcd}, {0xe5, 0xe5, 0xe5},
+	{0x7f, 0x7f, 0x7f}, {0xff, 0x00, 0x00}, {0x00, 0xff, 0x00}, {0xff, 0xff, 0x00},
+	{0x5c, 0x5c, 0xff}, {0xff, 0x00, 0xff}, {0x00, 0xff, 0xff}, {0xff, 0xff, 0xff},
+}
+
+// colorDist return the squared euclidean distance between two colors.
+func colorDist(r1, g1, b1, r2, g2, b2 byte) int {
+	dr, dg, db := int(r1)-int(r2), int(g1)-int(g2), int(b1)-int(b2)
+	return dr*dr + dg*dg + db*db
+}
+
+// nearestColor16 return the index of the nearest color in ansi16Palette.
+func nearestColor16(r, g, b byte) int {
+	best, bestDist := 0, -1
+	for i, c := range ansi16Palette {
+		if d := colorDist(r, g, b, c[0], c[1], c[2]); bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// cubeLevels are the intensity levels of the xterm 6x6x6 color cube.
+var cubeLevels = [6]byte{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+
+// nearestCubeLevel return the index of the nearest level in cubeLevels.
+func nearestCubeLevel(v byte) int {
+	for i := 0; i < 5; i++ {
+		if int(v) < (int(cubeLevels[i])+int(cubeLevels[i+1]))/2 {
+			return i
+		}
+	}
+	return 5
+}
+
+// nearestColor256 return the index of the nearest color in the xterm 256 color
+// palette. Only the color cube (16-231) and the gray ramp (232-255) are considered
+// because the first 16 colors are often redefined by terminal themes.
+func nearestColor256(r, g, b byte) int {
+	ri, gi, bi := nearestCubeLevel(r), nearestCubeLevel(g), nearestCubeLevel(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := colorDist(r, g, b, cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+	// gray ramp levels are 8, 18, ..., 238
+	avg := (int(r) + int(g) + int(b)) / 3
+	grayIdx := (avg - 3) / 10
+	if grayIdx < 0 {
+		grayIdx = 0
+	} else if grayIdx > 23 {
+		grayIdx = 23
+	}
+	level := byte(8 + 10*grayIdx)
+	if colorDist(r, g, b, level, level, level) < cubeDist {
+		return 232 + grayIdx
+	}
+	return cube
+}
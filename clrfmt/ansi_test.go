@@ -0,0 +1,184 @@
+package clrfmt
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+func TestDetectColorMode(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		mode ColorMode
+	}{
+		{env: map[string]string{}, mode: NoColor},
+		{env: map[string]string{"TERM": "dumb"}, mode: NoColor},
+		{env: map[string]string{"TERM": "xterm"}, mode: Color16},
+		{env: map[string]string{"TERM": "xterm-256color"}, mode: Color256},
+		{env: map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor"}, mode: TrueColor},
+		{env: map[string]string{"TERM": "xterm", "COLORTERM": "24bit"}, mode: TrueColor},
+		{env: map[string]string{"TERM": "xterm", "COLORTERM": "24bit", "NO_COLOR": "1"}, mode: NoColor},
+	}
+	for i, test := range tests {
+		mode := detectColorMode(func(key string) string { return test.env[key] })
+		if mode != test.mode {
+			t.Errorf("%d. got mode %d, expected %d", i, mode, test.mode)
+		}
+	}
+}
+
+func TestNearestColor(t *testing.T) {
+	tests := []struct {
+		r, g, b       byte
+		idx16, idx256 int
+	}{
+		{0x00, 0x00, 0x00, 0, 16},
+		{0xff, 0xff, 0xff, 15, 231},
+		{0xff, 0x00, 0x00, 9, 196},
+		{0xcd, 0x00, 0x00, 1, 160},
+		{0x80, 0x80, 0x80, 8, 244},
+		{0x87, 0xaf, 0xd7, 8, 110},
+	}
+	for _, test := range tests {
+		if idx := nearestColor16(test.r, test.g, test.b); idx != test.idx16 {
+			t.Errorf("got 16 color index %d, expected %d for #%02x%02x%02x", idx, test.idx16, test.r, test.g, test.b)
+		}
+		if idx := nearestColor256(test.r, test.g, test.b); idx != test.idx256 {
+			t.Errorf("got 256 color index %d, expected %d for #%02x%02x%02x", idx, test.idx256, test.r, test.g, test.b)
+		}
+	}
+}
+
+func TestSGRSequence(t *testing.T) {
+	tests := []struct {
+		in  []string
+		out string
+	}{
+		{in: []string{}, out: ""},
+		{in: []string{"nobold"}, out: ""},
+		{in: []string{"bold", "dim", "italic"}, out: "\x1b[1;2;3m"},
+		{in: []string{"underline", "strikethrough"}, out: "\x1b[4;9m"},
+		{in: []string{"border#FF0000", "text#FF0000"}, out: "\x1b[51;38;2;255;0;0m"},
+	}
+	for _, test := range tests {
+		s, err := clrcore.MakeStyle(test.in...)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if out := sgrSequence(s, TrueColor); out != test.out {
+			t.Errorf("got %q, expected %q for %v", out, test.out, test.in)
+		}
+	}
+}
+
+func TestANSI(t *testing.T) {
+	def := &clrcore.LexerDef{
+		Name: "TestANSI",
+		InitFunc: func(d *clrcore.LexerDef) {
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: []clrcore.LexerDefRule{
+					clrcore.WhiteSpaceRule, clrcore.NewLineRule,
+					&clrcore.RegexDefRule{Re: "[a-z]+", Do: clrcore.PopMatch(clrcore.CodeIdentifierVariable)},
+					&clrcore.RegexDefRule{Re: "[A-Z]", Do: clrcore.PopMatch(clrcore.CodeIdentifierType)},
+					&clrcore.RegexDefRule{Re: `"[^"]*"`, Do: clrcore.PopMatch(clrcore.CodeStringDouble)},
+				}},
+			}
+		},
+	}
+	lexerInfo := &clrcore.LexerInfo{
+		Names: []string{"test"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		},
+	}
+	style, err := clrcore.NewStyle(`
+	Code.Identifier text#FF0000 bold
+	Code.Identifier.Variable italic notext nobold
+	Code.String text#00FF00 back#000000
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tests := []struct {
+		in     string
+		opts   *ANSIOptions
+		expect string
+	}{
+		{
+			in:     "a AB\"x\ny\" 1",
+			opts:   &ANSIOptions{Mode: NoColor},
+			expect: "a AB\"x\ny\" 1",
+		},
+		{
+			in:     "a AB\"x\ny\" 1",
+			opts:   &ANSIOptions{Mode: Color16},
+			expect: "\x1b[3ma\x1b[0m \x1b[1;91mAB\x1b[0m\x1b[92;40m\"x\ny\"\x1b[0m 1",
+		},
+		{
+			in:     "a AB\"x\ny\" 1",
+			opts:   &ANSIOptions{Mode: Color256, ResetAtNewLine: true},
+			expect: "\x1b[3ma\x1b[0m \x1b[1;38;5;196mAB\x1b[0m\x1b[38;5;46;48;5;16m\"x\x1b[0m\n\x1b[38;5;46;48;5;16my\"\x1b[0m 1",
+		},
+		{
+			in:     "A\n\nB",
+			opts:   &ANSIOptions{Mode: TrueColor, ResetAtNewLine: true},
+			expect: "\x1b[1;38;2;255;0;0mA\x1b[0m\n\n\x1b[1;38;2;255;0;0mB\x1b[0m",
+		},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		_, n, err := ANSI(&buf, lexerInfo, test.in, style, test.opts)
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+			continue
+		}
+		if n != buf.Len() {
+			t.Errorf("%d. got n %d, expected %d", i, n, buf.Len())
+		}
+		if buf.String() != test.expect {
+			t.Errorf("%d. got:\n%q\nexpected:\n%q", i, buf.String(), test.expect)
+		}
+	}
+	if _, _, err := ANSI(&bytes.Buffer{}, nil, "", style, nil); err == nil {
+		t.Error("unexpected nil error")
+	}
+}
+
+func TestANSIFromReader(t *testing.T) {
+	def := &clrcore.LexerDef{
+		Name: "TestANSIFromReader",
+		InitFunc: func(d *clrcore.LexerDef) {
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: []clrcore.LexerDefRule{
+					clrcore.WhiteSpaceRule, clrcore.NewLineRule,
+					&clrcore.RegexDefRule{Re: "[a-z]+", Do: clrcore.PopMatch(clrcore.CodeIdentifier)},
+				}},
+			}
+		},
+	}
+	lexerInfo := &clrcore.LexerInfo{
+		Names: []string{"test"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		},
+		NewReaderLexer: func(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewReaderLexerEngine(def, r, 2, stopMarkers, nil)
+		},
+	}
+	style, err := clrcore.NewStyle("Code.Identifier bold")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var buf bytes.Buffer
+	_, _, err = ANSIFromReader(&buf, lexerInfo, strings.NewReader("abc de\nf 12 g"), style, &ANSIOptions{Mode: Color16})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := "\x1b[1mabc\x1b[0m \x1b[1mde\x1b[0m\n\x1b[1mf\x1b[0m 12 g"
+	if buf.String() != expect {
+		t.Errorf("got %q, expected %q", buf.String(), expect)
+	}
+}
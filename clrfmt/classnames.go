@@ -0,0 +1,195 @@
+package clrfmt
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+// ClassNaming is the strategy used to name the CSS class of the lexeme types.
+type ClassNaming int
+
+const (
+	// ShortClassNames are the generated names a, b, ..., z, aa, ab, ... in the
+	// lexeme type registration order. They are the shortest, but they change
+	// when lexeme types are added.
+	ShortClassNames ClassNaming = iota
+	// PygmentsClassNames are the Pygments short names (e.g. k, kt, s2, c) of
+	// the Pygments token associated to the lexeme type, so that Pygments style
+	// sheets may be used. Text and Code have no class. Lexeme types associated
+	// to the same Pygments token have the same class name.
+	PygmentsClassNames
+	// FullClassNames are the lexeme type names where '.' is replaced with '-'
+	// (e.g. Code-String-Double).
+	FullClassNames
+)
+
+// ClassNames specifies the CSS class names of the lexeme types. The HTML and
+// CSS outputs agree when they are generated with the same ClassNames.
+type ClassNames struct {
+	Naming ClassNaming // Class naming strategy.
+	Prefix string      // Prefix of the class names (e.g. "clrz-").
+}
+
+// ClassName return the class name of t, or an empty string if t has no class.
+func (c ClassNames) ClassName(t *clrcore.LexemeType) string {
+	var name string
+	switch c.Naming {
+	case PygmentsClassNames:
+		name = pygmentsClassName(clrcore.PygmentsTokenName(t))
+	case FullClassNames:
+		name = strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+				return r
+			}
+			if r == '.' {
+				return '-'
+			}
+			return '_'
+		}, t.Name)
+	default:
+		name = shortClassNames()[t]
+	}
+	if name == "" {
+		return ""
+	}
+	return c.Prefix + name
+}
+
+var (
+	typeClassNameMap         map[*clrcore.LexemeType]string
+	classNameToLexemeTypeMap map[string]*clrcore.LexemeType
+	classNamesOnce           sync.Once
+)
+
+// shortClassNames return the short class names of the lexeme types. They are
+// generated on first use so that the lexeme types of all packages are
+// registered.
+func shortClassNames() map[*clrcore.LexemeType]string {
+	classNamesOnce.Do(func() {
+		typeClassNameMap = make(map[*clrcore.LexemeType]string)
+		classNameToLexemeTypeMap = make(map[string]*clrcore.LexemeType)
+		for i, t := range clrcore.LexemeTypes() {
+			if t.Class() == clrcore.Stop {
+				continue
+			}
+			className := classNameFromIdx(i)
+			typeClassNameMap[t] = className
+			classNameToLexemeTypeMap[className] = t
+		}
+	})
+	return typeClassNameMap
+}
+
+// generate class names: a - z,aa - az,ba - bz,ca - cz, ...
+func classNameFromIdx(idx int) string {
+	var buf [8]byte
+	strIdx := len(buf) - 1
+	buf[strIdx] = byte('a' + (idx % 26))
+	for idx /= 26; idx > 0; idx /= 26 {
+		idx--
+		strIdx--
+		buf[strIdx] = byte('a' + (idx % 26))
+	}
+	return string(buf[strIdx:])
+}
+
+// pygmentsClassName return the Pygments short name of the token name. A token
+// without short name gets the short name of its closest parent.
+func pygmentsClassName(token string) string {
+	for token != "" {
+		if name, ok := pygmentsShortNames[token]; ok {
+			return name
+		}
+		i := strings.LastIndexByte(token, '.')
+		if i < 0 {
+			break
+		}
+		token = token[:i]
+	}
+	return ""
+}
+
+// pygmentsShortNames are the Pygments short names of the standard tokens.
+var pygmentsShortNames = map[string]string{
+	"Text":                        "",
+	"Text.Whitespace":             "w",
+	"Escape":                      "esc",
+	"Error":                       "err",
+	"Other":                       "x",
+	"Keyword":                     "k",
+	"Keyword.Constant":            "kc",
+	"Keyword.Declaration":         "kd",
+	"Keyword.Namespace":           "kn",
+	"Keyword.Pseudo":              "kp",
+	"Keyword.Reserved":            "kr",
+	"Keyword.Type":                "kt",
+	"Name":                        "n",
+	"Name.Attribute":              "na",
+	"Name.Builtin":                "nb",
+	"Name.Builtin.Pseudo":         "bp",
+	"Name.Class":                  "nc",
+	"Name.Constant":               "no",
+	"Name.Decorator":              "nd",
+	"Name.Entity":                 "ni",
+	"Name.Exception":              "ne",
+	"Name.Function":               "nf",
+	"Name.Function.Magic":         "fm",
+	"Name.Property":               "py",
+	"Name.Label":                  "nl",
+	"Name.Namespace":              "nn",
+	"Name.Other":                  "nx",
+	"Name.Tag":                    "nt",
+	"Name.Variable":               "nv",
+	"Name.Variable.Class":         "vc",
+	"Name.Variable.Global":        "vg",
+	"Name.Variable.Instance":      "vi",
+	"Name.Variable.Magic":         "vm",
+	"Literal":                     "l",
+	"Literal.Date":                "ld",
+	"Literal.String":              "s",
+	"Literal.String.Affix":        "sa",
+	"Literal.String.Backtick":     "sb",
+	"Literal.String.Char":         "sc",
+	"Literal.String.Delimiter":    "dl",
+	"Literal.String.Doc":          "sd",
+	"Literal.String.Double":       "s2",
+	"Literal.String.Escape":       "se",
+	"Literal.String.Heredoc":      "sh",
+	"Literal.String.Interpol":     "si",
+	"Literal.String.Other":        "sx",
+	"Literal.String.Regex":        "sr",
+	"Literal.String.Single":       "s1",
+	"Literal.String.Symbol":       "ss",
+	"Literal.Number":              "m",
+	"Literal.Number.Bin":          "mb",
+	"Literal.Number.Float":        "mf",
+	"Literal.Number.Hex":          "mh",
+	"Literal.Number.Integer":      "mi",
+	"Literal.Number.Integer.Long": "il",
+	"Literal.Number.Oct":          "mo",
+	"Operator":                    "o",
+	"Operator.Word":               "ow",
+	"Punctuation":                 "p",
+	"Punctuation.Marker":          "pm",
+	"Comment":                     "c",
+	"Comment.Hashbang":            "ch",
+	"Comment.Multiline":           "cm",
+	"Comment.Preproc":             "cp",
+	"Comment.PreprocFile":         "cpf",
+	"Comment.Single":              "c1",
+	"Comment.Special":             "cs",
+	"Generic":                     "g",
+	"Generic.Deleted":             "gd",
+	"Generic.Emph":                "ge",
+	"Generic.Error":               "gr",
+	"Generic.Heading":             "gh",
+	"Generic.Inserted":            "gi",
+	"Generic.Output":              "go",
+	"Generic.Prompt":              "gp",
+	"Generic.Strong":              "gs",
+	"Generic.Subheading":          "gu",
+	"Generic.Traceback":           "gt",
+}
@@ -0,0 +1,100 @@
+package clrfmt
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+func TestClassNames(t *testing.T) {
+	tests := []struct {
+		classNames ClassNames
+		in         *clrcore.LexemeType
+		out        string
+	}{
+		{classNames: ClassNames{}, in: clrcore.CodeIdentifierKeyword, out: "x"},
+		{classNames: ClassNames{Prefix: "clrz-"}, in: clrcore.CodeIdentifier, out: "clrz-q"},
+		{classNames: ClassNames{Naming: PygmentsClassNames}, in: clrcore.CodeIdentifierKeyword, out: "k"},
+		{classNames: ClassNames{Naming: PygmentsClassNames}, in: clrcore.CodeIdentifierType, out: "kt"},
+		{classNames: ClassNames{Naming: PygmentsClassNames}, in: clrcore.CodeStringDouble, out: "s2"},
+		{classNames: ClassNames{Naming: PygmentsClassNames}, in: clrcore.CodeOperatorLogical, out: "o"},
+		{classNames: ClassNames{Naming: PygmentsClassNames}, in: clrcore.CodeComment, out: "c"},
+		{classNames: ClassNames{Naming: PygmentsClassNames, Prefix: "hl-"}, in: clrcore.CodeNumberHexadecimal, out: "hl-mh"},
+		{classNames: ClassNames{Naming: PygmentsClassNames, Prefix: "hl-"}, in: clrcore.Text, out: ""},
+		{classNames: ClassNames{Naming: FullClassNames}, in: clrcore.CodeStringDouble, out: "Code-String-Double"},
+		{classNames: ClassNames{Naming: FullClassNames, Prefix: "clrz-"}, in: clrcore.Code, out: "clrz-Code"},
+	}
+	for _, test := range tests {
+		if out := test.classNames.ClassName(test.in); out != test.out {
+			t.Errorf("got '%s', expected '%s' for %s with %+v", out, test.out, test.in.Name, test.classNames)
+		}
+	}
+}
+
+func TestClassNamesAgree(t *testing.T) {
+	def := &clrcore.LexerDef{
+		Name: "TestClassNamesAgree",
+		InitFunc: func(d *clrcore.LexerDef) {
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: []clrcore.LexerDefRule{
+					clrcore.WhiteSpaceRule,
+					&clrcore.RegexDefRule{Re: "[0-9]+", Do: clrcore.PopMatch(clrcore.CodeNumberInteger)},
+					&clrcore.RegexDefRule{Re: "if", Do: clrcore.PopMatch(clrcore.CodeIdentifierKeyword)},
+					&clrcore.RegexDefRule{Re: "[a-z]+", Do: clrcore.PopMatch(clrcore.CodeIdentifierVariable)},
+				}},
+			}
+		},
+	}
+	lexerInfo := &clrcore.LexerInfo{
+		Names: []string{"test"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		},
+	}
+	style, err := clrcore.NewStyle(`
+	Code.Identifier text#FF0000
+	Code.Identifier.Keyword bold
+	Code.Number text#00FF00
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	classRe := regexp.MustCompile(`class="([^"]*)"`)
+	selectorRe := regexp.MustCompile(`(?m)^\.([\w-]+)`)
+	for _, classNames := range []ClassNames{
+		{},
+		{Naming: PygmentsClassNames},
+		{Naming: FullClassNames, Prefix: "clrz-"},
+	} {
+		var html, css bytes.Buffer
+		_, _, err := HTMLWithOptions(&html, lexerInfo, "if abc 12 de", &HTMLOptions{ClassNames: classNames})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := CSSWithOptions(&css, style, &CSSOptions{ClassNames: classNames}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		selectors := make(map[string]bool)
+		for _, m := range selectorRe.FindAllStringSubmatch(css.String(), -1) {
+			if selectors[m[1]] {
+				t.Errorf("duplicate selector .%s with %+v", m[1], classNames)
+			}
+			selectors[m[1]] = true
+		}
+		classes := classRe.FindAllStringSubmatch(html.String(), -1)
+		if len(classes) == 0 {
+			t.Errorf("no class in %s", html.String())
+		}
+		for _, m := range classes {
+			if !selectors[m[1]] {
+				t.Errorf("class %s of %s not in CSS with %+v:\n%s", m[1], html.String(), classNames, css.String())
+			}
+		}
+		if !strings.Contains(css.String(), "{color: #00ff00}") {
+			t.Errorf("missing number style in CSS with %+v:\n%s", classNames, css.String())
+		}
+	}
+}
@@ -6,17 +6,68 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/chmike/clrz/clrcore"
 )
 
+// LineNumbers specifies how line numbers are output in HTML.
+type LineNumbers int
+
+const (
+	// NoLineNumbers outputs no line numbers.
+	NoLineNumbers LineNumbers = iota
+	// InlineLineNumbers outputs line numbers at the start of each line in a
+	// span of class "clrz-ln".
+	InlineLineNumbers
+	// TableLineNumbers outputs a table with the line numbers in the first
+	// column and the formatted text in the second column.
+	TableLineNumbers
+)
+
+// HTMLOptions are the HTML formatting options. The zero value outputs only
+// the lexeme spans.
+type HTMLOptions struct {
+	PreCode        bool        // Wrap the formatted text in <pre><code> elements.
+	LineNumbers    LineNumbers // Line numbers output mode.
+	BaseLineNumber int         // Number of the first line, 1 when 0.
+	HighlightLines [][2]int    // Inclusive ranges of line numbers, as displayed, to highlight.
+	TabWidth       int         // When > 0, tabs are expanded with spaces up to the next tab stop.
+	// InlineStyle, when not nil, is used to write the style of each lexeme in a
+	// style attribute instead of a CSS class name, so that no style sheet is required.
+	// Adjacent lexemes with the same style are then merged in one span.
+	InlineStyle clrcore.Style
+	ClassNames  ClassNames // Class names of the lexeme types, as given to CSSWithOptions.
+	// NestedClasses sets the class names of the lexeme type and all its ancestors
+	// in the class attribute of the spans (e.g. class="p q r"), as expected by
+	// the CSS generated with NestedClasses.
+	NestedClasses bool
+}
+
+// Class names of the HTML elements added by the formatting options.
+// They contain a '-' so that they can't collide with lexeme type class names.
+const (
+	LineNumberClass    = "clrz-ln"    // inline line number span
+	HighlightLineClass = "clrz-hl"    // highlighted line span
+	TableClass         = "clrz-table" // table with line numbers
+	LineNumbersClass   = "clrz-lnt"   // table cell containing the line numbers
+	CodeClass          = "clrz-code"  // table cell containing the formatted text
+)
+
 // HTML writes the text formatted in HTML, and return the number of bytes written.
 // When the lexer stops, whatever the reason, the remaining text is written out unformatted.
-// TODO 1. add formatting options: susbstitute chars (e.g. \n -> <br>), table with line numbers,
-// add highlighted section of text. Use io.Writer equivalent ?
-// TODO 2. escape < and > characters.
+// It is equivalent to HTMLWithOptions with nil options.
 func HTML(w io.Writer, info *clrcore.LexerInfo, text string) (score int, n int, err error) {
+	return HTMLWithOptions(w, info, text, nil)
+}
+
+// HTMLWithOptions writes the text formatted in HTML with the given options, and
+// return the number of bytes written. The characters <, > and & are escaped.
+// When the lexer stops, whatever the reason, the remaining text is written out
+// escaped but unformatted. The options may be nil.
+func HTMLWithOptions(w io.Writer, info *clrcore.LexerInfo, text string, opts *HTMLOptions) (score int, n int, err error) {
 	if info == nil {
 		return 0, 0, errors.New("LexerInfo is nil")
 	}
@@ -24,44 +75,404 @@ func HTML(w io.Writer, info *clrcore.LexerInfo, text string) (score int, n int,
 	if err != nil {
 		return 0, 0, err
 	}
-	var buf bytes.Buffer
-	var bytesWritten int
+	return htmlFormat(w, lexer, strings.Count(text, "\n")+1, opts)
+}
+
+// HTMLFromReader is like HTMLWithOptions, but the text is read from r and the
+// output is written as it goes. With TableLineNumbers, the output is written once
+// the text has been read since the line numbers must be known. With
+// InlineLineNumbers, the line numbers are not padded to the same width since
+// the number of lines is unknown when they are written.
+func HTMLFromReader(w io.Writer, info *clrcore.LexerInfo, r io.Reader, opts *HTMLOptions) (score int, n int, err error) {
+	if info == nil {
+		return 0, 0, errors.New("LexerInfo is nil")
+	}
+	lexer, err := clrcore.NewLexerFromReader(info, r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return htmlFormat(w, lexer, 0, opts)
+}
+
+// htmlFormat writes the lexemes of lexer formatted in HTML. maxLines is the
+// expected number of lines used to align the inline line numbers.
+func htmlFormat(w io.Writer, lexer clrcore.Lexer, maxLines int, opts *HTMLOptions) (score int, n int, err error) {
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+	h := newHTMLWriter(w, opts, maxLines)
+	h.begin()
+	var index clrcore.StyleIndex
+	var attrs map[clrcore.TypeStyle]string
+	if opts.InlineStyle != nil {
+		index = opts.InlineStyle.Index()
+		attrs = make(map[clrcore.TypeStyle]string)
+	}
+	classAttrs := make(map[*clrcore.LexemeType]string)
+	score, err = formatLexemes(lexer,
+		func(lexeme clrcore.Lexeme) error {
+			if index != nil {
+				typeStyle := index.TypeStyle(lexeme.Type)
+				attr, ok := attrs[typeStyle]
+				if !ok {
+					attr = inlineStyleAttr(typeStyle)
+					attrs[typeStyle] = attr
+				}
+				h.writeText(attr, lexeme.Str)
+				return h.err
+			}
+			attr, ok := classAttrs[lexeme.Type]
+			if !ok {
+				if className := classAttr(lexeme.Type, opts); className != "" {
+					attr = `class="` + className + `"`
+				}
+				classAttrs[lexeme.Type] = attr
+			}
+			h.writeText(attr, lexeme.Str)
+			return h.err
+		},
+		func(remainingText string) error {
+			h.writeText("", remainingText)
+			return h.err
+		},
+		func() error {
+			h.end()
+			return h.flush()
+		})
+	if err != nil {
+		h.flush()
+		return 0, h.n, err
+	}
+	return score, h.n, nil
+}
+
+// formatLexemes calls format with every lexeme output by lexer until a stop
+// lexeme is reached, then calls remain with the remaining text, and finally
+// calls end. When lexer is a ReaderLexer, remain is called with each chunk of
+// the remaining input.
+// Return the lexer score, or the first error encountered.
+func formatLexemes(lexer clrcore.Lexer, format func(clrcore.Lexeme) error, remain func(string) error, end func() error) (int, error) {
 	for {
 		lexeme := lexer.NextLexeme()
 		if lexeme.Type == nil {
-			return 0, bytesWritten, errors.New("lexeme with undefined LexemeType")
+			return 0, errors.New("lexeme with undefined LexemeType")
 		}
 		if lexeme.IsA(clrcore.Stop) {
-			n, err := w.Write([]byte(lexer.RemainingText()))
-			return lexer.Score(), bytesWritten + n, err
+			if err := remainingText(lexer, remain); err != nil {
+				return 0, err
+			}
+			if err := end(); err != nil {
+				return 0, err
+			}
+			return lexer.Score(), nil
 		}
-		className := typeClassNameMap[lexeme.Type]
-		if className == "" {
-			return 0, bytesWritten, fmt.Errorf("unknown LexemeType %s", lexeme.Type)
+		if err := format(lexeme); err != nil {
+			return 0, err
 		}
-		buf.Reset()
-		_, err := fmt.Fprintf(&buf, "<scan class=%q>", className)
-		if err != nil {
-			return 0, bytesWritten, err
+	}
+}
+
+// remainingText calls remain with the remaining text of lexer.
+func remainingText(lexer clrcore.Lexer, remain func(string) error) error {
+	readerLexer, ok := lexer.(clrcore.ReaderLexer)
+	if !ok {
+		return remain(lexer.RemainingText())
+	}
+	r := readerLexer.RemainingReader()
+	buf := make([]byte, flushSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := remain(string(buf[:n])); err != nil {
+				return err
+			}
 		}
-		n, err = w.Write(buf.Bytes())
-		bytesWritten += n
-		if err != nil {
-			return 0, bytesWritten, err
+		if err == io.EOF {
+			return nil
 		}
-		n, err = w.Write([]byte(lexeme.Str))
-		bytesWritten += n
 		if err != nil {
-			return 0, bytesWritten, err
+			return err
 		}
-		n, err = w.Write([]byte("</span>"))
-		bytesWritten += n
-		if err != nil {
-			return 0, bytesWritten, err
+	}
+}
+
+// flushSize is the size of buffered output above which it is written out.
+const flushSize = 4096
+
+// htmlWriter writes escaped text split in lines decorated according to the
+// HTML options. The output is buffered and written out by chunks.
+type htmlWriter struct {
+	w      io.Writer
+	opts   *HTMLOptions
+	buf    bytes.Buffer // buffered output
+	code   bytes.Buffer // formatted text when line numbers are in a table
+	out    *bytes.Buffer
+	n      int // number of bytes written to w
+	err    error
+	line   int    // current line number
+	lines  int    // number of lines output
+	width  int    // width of line numbers
+	col    int    // column, in runes, in current line
+	inLine bool   // true when the current line has been started
+	hlLine bool   // true when the current line is highlighted
+	span   string // attributes of the open lexeme span, if any
+}
+
+func newHTMLWriter(w io.Writer, opts *HTMLOptions, maxLines int) *htmlWriter {
+	h := &htmlWriter{w: w, opts: opts, line: opts.BaseLineNumber}
+	if h.line == 0 {
+		h.line = 1
+	}
+	h.width = len(strconv.Itoa(h.line + maxLines - 1))
+	h.out = &h.buf
+	if opts.LineNumbers == TableLineNumbers {
+		h.out = &h.code
+	}
+	return h
+}
+
+// begin writes the opening elements.
+func (h *htmlWriter) begin() {
+	if h.opts.PreCode && h.opts.LineNumbers != TableLineNumbers {
+		h.out.WriteString("<pre><code>")
+	}
+}
+
+// end closes the current line and writes the closing elements.
+func (h *htmlWriter) end() {
+	h.closeSpan()
+	if h.inLine {
+		h.endLine()
+	}
+	if h.opts.LineNumbers != TableLineNumbers {
+		if h.opts.PreCode {
+			h.out.WriteString("</code></pre>")
+		}
+		return
+	}
+	// line numbers are now known
+	h.width = len(strconv.Itoa(h.line - 1))
+	fmt.Fprintf(&h.buf, `<table class=%q><tr><td class=%q><pre>`, TableClass, LineNumbersClass)
+	for i := 0; i < h.lines; i++ {
+		if i != 0 {
+			h.buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&h.buf, "%*d", h.width, h.line-h.lines+i)
+	}
+	fmt.Fprintf(&h.buf, `</pre></td><td class=%q><pre><code>`, CodeClass)
+	h.buf.Write(h.code.Bytes())
+	h.buf.WriteString("</code></pre></td></tr></table>")
+}
+
+// isHighlighted return true if the line must be highlighted.
+func (h *htmlWriter) isHighlighted(line int) bool {
+	for _, r := range h.opts.HighlightLines {
+		if line >= r[0] && line <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *htmlWriter) startLine() {
+	h.inLine = true
+	h.col = 0
+	if h.hlLine = h.isHighlighted(h.line); h.hlLine {
+		fmt.Fprintf(h.out, "<span class=%q>", HighlightLineClass)
+	}
+	if h.opts.LineNumbers == InlineLineNumbers {
+		fmt.Fprintf(h.out, "<span class=%q>%*d </span>", LineNumberClass, h.width, h.line)
+	}
+}
+
+func (h *htmlWriter) endLine() {
+	if h.hlLine {
+		h.out.WriteString("</span>")
+	}
+	h.inLine = false
+	h.line++
+	h.lines++
+}
+
+// writeText writes str escaped in a span with the given attributes, or
+// outside of a span if attr is empty. The span is closed at each new line so
+// that lines can be decorated. In inline style mode, the open span is extended
+// when attr is the same.
+func (h *htmlWriter) writeText(attr string, str string) {
+	if h.span != "" && (h.opts.InlineStyle == nil || h.span != attr) {
+		h.closeSpan()
+	}
+	for len(str) > 0 {
+		seg := str
+		i := strings.IndexByte(str, '\n')
+		if i >= 0 {
+			seg = str[:i]
+		}
+		if !h.inLine {
+			h.startLine()
+		}
+		if seg != "" {
+			if attr != "" && h.span == "" {
+				h.out.WriteString("<span ")
+				h.out.WriteString(attr)
+				h.out.WriteByte('>')
+				h.span = attr
+			}
+			h.writeEscaped(seg)
+		}
+		if i < 0 {
+			break
+		}
+		h.closeSpan()
+		h.endLine()
+		h.out.WriteByte('\n')
+		str = str[i+1:]
+	}
+	if h.opts.InlineStyle == nil {
+		h.closeSpan()
+	}
+	if h.buf.Len() >= flushSize {
+		h.flush()
+	}
+}
+
+// closeSpan closes the open lexeme span, if any.
+func (h *htmlWriter) closeSpan() {
+	if h.span != "" {
+		h.out.WriteString("</span>")
+		h.span = ""
+	}
+}
+
+// writeEscaped writes str with the characters <, > and & escaped, and the
+// tabs expanded if requested. The other bytes are copied unchanged, including
+// invalid UTF-8 and the bytes of a rune split between lexemes.
+func (h *htmlWriter) writeEscaped(str string) {
+	beg := 0
+	for i := 0; i < len(str); i++ {
+		var esc string
+		switch str[i] {
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '&':
+			esc = "&amp;"
+		case '\t':
+			if h.opts.TabWidth <= 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		h.writeRun(str[beg:i])
+		beg = i + 1
+		if esc == "" {
+			n := h.opts.TabWidth - h.col%h.opts.TabWidth
+			h.out.WriteString(strings.Repeat(" ", n))
+			h.col += n
+			continue
+		}
+		h.out.WriteString(esc)
+		h.col++
+	}
+	h.writeRun(str[beg:])
+}
+
+// writeRun writes str unchanged and advances the column by its number of
+// rune starts.
+func (h *htmlWriter) writeRun(str string) {
+	h.out.WriteString(str)
+	for i := 0; i < len(str); i++ {
+		if utf8.RuneStart(str[i]) {
+			h.col++
 		}
 	}
 }
 
+// inlineStyleAttr return the style attribute of s, or an empty string if s
+// is the default type style.
+func inlineStyleAttr(s clrcore.TypeStyle) string {
+	if s.IsZero() {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`style="`)
+	if s.HasTextColor() {
+		r, g, b := s.TextColor()
+		fmt.Fprintf(&buf, "color:#%02x%02x%02x;", r, g, b)
+	}
+	if s.HasBackColor() {
+		r, g, b := s.BackColor()
+		fmt.Fprintf(&buf, "background-color:#%02x%02x%02x;", r, g, b)
+	}
+	if s.Bold() {
+		buf.WriteString("font-weight:bold;")
+	}
+	if s.Italic() {
+		buf.WriteString("font-style:italic;")
+	}
+	if decoration := textDecoration(s); decoration != "" {
+		fmt.Fprintf(&buf, "text-decoration:%s;", decoration)
+	}
+	if s.Dim() {
+		buf.WriteString("opacity:0.5;")
+	}
+	if s.HasBorderColor() {
+		r, g, b := s.BorderColor()
+		fmt.Fprintf(&buf, "border:1px solid #%02x%02x%02x;", r, g, b)
+	}
+	if buf.Len() == len(`style="`) {
+		return ""
+	}
+	buf.Truncate(buf.Len() - 1)
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// classAttr return the value of the class attribute of a lexeme of type t.
+func classAttr(t *clrcore.LexemeType, opts *HTMLOptions) string {
+	if !opts.NestedClasses {
+		return opts.ClassNames.ClassName(t)
+	}
+	var classNames []string
+	for ; t != nil; t = t.Parent {
+		className := opts.ClassNames.ClassName(t)
+		if className != "" && (len(classNames) == 0 || classNames[len(classNames)-1] != className) {
+			classNames = append(classNames, className)
+		}
+	}
+	for i, j := 0, len(classNames)-1; i < j; i, j = i+1, j-1 {
+		classNames[i], classNames[j] = classNames[j], classNames[i]
+	}
+	return strings.Join(classNames, " ")
+}
+
+// textDecoration return the CSS text-decoration value of s, or an empty string
+// if s has no text decoration.
+func textDecoration(s clrcore.TypeStyle) string {
+	switch {
+	case s.Underline() && s.Strikethrough():
+		return "underline line-through"
+	case s.Underline():
+		return "underline"
+	case s.Strikethrough():
+		return "line-through"
+	}
+	return ""
+}
+
+// flush writes the buffered output to w, and return the first error encountered.
+func (h *htmlWriter) flush() error {
+	if h.err == nil && h.buf.Len() > 0 {
+		var n int
+		n, h.err = h.w.Write(h.buf.Bytes())
+		h.n += n
+	}
+	h.buf.Reset()
+	return h.err
+}
+
 type classEntry struct {
 	className, typeName string
 }
@@ -70,8 +481,36 @@ type styleEntry struct {
 	classes []classEntry
 }
 
-// CSS return the CSS encoded style.
+// CSSOptions are the CSS generation options.
+type CSSOptions struct {
+	// Selectors are the selectors of the ancestor elements, each one producing
+	// a rule selector (e.g. "pre" produces "pre .x").
+	Selectors  []string
+	ClassNames ClassNames // Class names of the lexeme types, as given to HTMLWithOptions.
+	// NestedClasses outputs a rule only for the lexeme types whose style differs
+	// from the one of their parent type, in the lexeme type hierarchy order.
+	// The rule of a type then only declares the differences, and the styles are
+	// inherited through the CSS cascade. It must be used with the HTML output
+	// generated with NestedClasses.
+	NestedClasses bool
+}
+
+// CSS return the CSS encoded style. The prefixes are the selectors of the
+// ancestor elements. It is equivalent to CSSWithOptions with the prefixes as
+// Selectors.
 func CSS(w io.Writer, style clrcore.Style, prefix ...string) (int, error) {
+	return CSSWithOptions(w, style, &CSSOptions{Selectors: prefix})
+}
+
+// CSSWithOptions writes the CSS encoded style with the given options, and return
+// the number of bytes written. The options may be nil. When lexeme types with
+// different styles have the same class name, the style of the first one in
+// the lexeme type hierarchy order is used.
+func CSSWithOptions(w io.Writer, style clrcore.Style, opts *CSSOptions) (int, error) {
+	if opts == nil {
+		opts = &CSSOptions{}
+	}
+	prefix := opts.Selectors
 	// build the css style selector format strings
 	var selectorFmt, lastSelectorFmt string
 	if len(prefix) == 0 {
@@ -81,37 +520,21 @@ func CSS(w io.Writer, style clrcore.Style, prefix ...string) (int, error) {
 		selectorFmt = strings.Join(prefix, " .%-2[1]s, ") + " .%-2[1]s, /* %[3]*[2]s */\n"
 		lastSelectorFmt = strings.Join(prefix, " .%-2[1]s, ") + " .%-2[1]s  /* %[3]*[2]s */ {%[4]s} \n"
 	}
+	classTypes := selectClassTypes(opts.ClassNames)
+	if opts.NestedClasses {
+		return nestedCSS(w, style, classTypes, opts.ClassNames, lastSelectorFmt)
+	}
 	// build the list of styles and classe names
-	const maxStyleStrLen = 20 + 19 + 27 + 33
 	var maxTypeNameLength int
-	buf := bytes.NewBuffer(make([]byte, 0, maxStyleStrLen))
 	styles := make([]styleEntry, len(style))
 	styleIdx := 0
 	for typeStyle, lexemeTypes := range style {
-		var styleStr string
-		if typeStyle != 0 {
-			buf.Reset()
-			if typeStyle.Italic() {
-				buf.WriteString("font-style: italic; ")
-			}
-			if typeStyle.Bold() {
-				buf.WriteString("font-weight: bold; ")
-			}
-			if typeStyle.HasTextColor() {
-				r, g, b := typeStyle.TextColor()
-				fmt.Fprintf(buf, "font-color: #%02x%02x%02x; ", r, g, b)
-			}
-			if typeStyle.HasBackColor() {
-				r, g, b := typeStyle.BackColor()
-				fmt.Fprintf(buf, "background-color: #%02x%02x%02x; ", r, g, b)
-			}
-			styleStr = buf.String()[:buf.Len()-2]
-		}
+		styleStr := cssDeclarations(typeStyle, clrcore.TypeStyle{})
 		styles[styleIdx].style = styleStr
 		classes := make([]classEntry, len(lexemeTypes))
 		classIdx := 0
 		for _, t := range lexemeTypes {
-			if className, ok := typeClassNameMap[t]; ok {
+			if className := opts.ClassNames.ClassName(t); className != "" && classTypes[className] == t {
 				if len(t.Name) > maxTypeNameLength {
 					maxTypeNameLength = len(t.Name)
 				}
@@ -152,29 +575,130 @@ func CSS(w io.Writer, style clrcore.Style, prefix ...string) (int, error) {
 	return bytesWritten, nil
 }
 
-var typeClassNameMap = map[*clrcore.LexemeType]string{}
-var classNameToLexemeTypeMap = map[string]*clrcore.LexemeType{}
+// selectClassTypes return the lexeme type of each class name. When lexeme
+// types have the same class name, the first one in the lexeme type hierarchy
+// order is selected.
+func selectClassTypes(classNames ClassNames) map[string]*clrcore.LexemeType {
+	classTypes := make(map[string]*clrcore.LexemeType)
+	var selectTypes func(t *clrcore.LexemeType)
+	selectTypes = func(t *clrcore.LexemeType) {
+		if className := classNames.ClassName(t); className != "" && classTypes[className] == nil {
+			classTypes[className] = t
+		}
+		for _, c := range t.Children {
+			selectTypes(c)
+		}
+	}
+	for _, t := range clrcore.LexemeClassTypes() {
+		if t != clrcore.Stop {
+			selectTypes(t)
+		}
+	}
+	return classTypes
+}
 
-// generate class names: a - z,aa - az,ba - bz,ca - cz, ...
-func classNameFromIdx(idx int) string {
-	var buf [8]byte
-	strIdx := len(buf) - 1
-	buf[strIdx] = byte('a' + (idx % 26))
-	for idx /= 26; idx > 0; idx /= 26 {
-		idx--
-		strIdx--
-		buf[strIdx] = byte('a' + (idx % 26))
+// nestedCSS writes a rule for each lexeme type whose style differs from the
+// one of its closest ancestor having a class, and return the number of bytes
+// written. The rules are written in the lexeme type hierarchy order so that
+// the rules of the children have precedence.
+func nestedCSS(w io.Writer, style clrcore.Style, classTypes map[string]*clrcore.LexemeType, classNames ClassNames, ruleFmt string) (int, error) {
+	type rule struct {
+		className, typeName, style string
 	}
-	return string(buf[strIdx:])
+	var rules []rule
+	var maxTypeNameLength int
+	index := style.Index()
+	var addRules func(t *clrcore.LexemeType, parent clrcore.TypeStyle)
+	addRules = func(t *clrcore.LexemeType, parent clrcore.TypeStyle) {
+		if className := classNames.ClassName(t); className != "" && classTypes[className] == t {
+			typeStyle := index.TypeStyle(t)
+			if typeStyle != parent {
+				rules = append(rules, rule{className: className, typeName: t.Name, style: cssDeclarations(typeStyle, parent)})
+				if len(t.Name) > maxTypeNameLength {
+					maxTypeNameLength = len(t.Name)
+				}
+			}
+			parent = typeStyle
+		}
+		for _, c := range t.Children {
+			addRules(c, parent)
+		}
+	}
+	for _, t := range clrcore.LexemeClassTypes() {
+		if t != clrcore.Stop {
+			addRules(t, clrcore.TypeStyle{})
+		}
+	}
+	var bytesWritten int
+	for _, r := range rules {
+		n, err := fmt.Fprintf(w, ruleFmt, r.className, r.typeName, maxTypeNameLength, r.style)
+		bytesWritten += n
+		if err != nil {
+			return bytesWritten, err
+		}
+	}
+	return bytesWritten, nil
 }
 
-func init() {
-	for i, t := range clrcore.LexemeTypes() {
-		if t.Class() == clrcore.Stop {
-			continue
+// cssDeclarations return the CSS declarations of the attributes of s that
+// differ from those of parent. The attributes of parent that s doesn't have
+// are reset.
+func cssDeclarations(s, parent clrcore.TypeStyle) string {
+	var decls []string
+	if s.Italic() != parent.Italic() {
+		if s.Italic() {
+			decls = append(decls, "font-style: italic")
+		} else {
+			decls = append(decls, "font-style: normal")
 		}
-		className := classNameFromIdx(i)
-		typeClassNameMap[t] = className
-		classNameToLexemeTypeMap[className] = t
 	}
+	if s.Bold() != parent.Bold() {
+		if s.Bold() {
+			decls = append(decls, "font-weight: bold")
+		} else {
+			decls = append(decls, "font-weight: normal")
+		}
+	}
+	if color, parentColor := cssColor(s.HasTextColor, s.TextColor), cssColor(parent.HasTextColor, parent.TextColor); color != parentColor {
+		if color == "" {
+			color = "inherit"
+		}
+		decls = append(decls, "color: "+color)
+	}
+	if color, parentColor := cssColor(s.HasBackColor, s.BackColor), cssColor(parent.HasBackColor, parent.BackColor); color != parentColor {
+		if color == "" {
+			color = "transparent"
+		}
+		decls = append(decls, "background-color: "+color)
+	}
+	if decoration := textDecoration(s); decoration != textDecoration(parent) {
+		if decoration == "" {
+			decoration = "none"
+		}
+		decls = append(decls, "text-decoration: "+decoration)
+	}
+	if s.Dim() != parent.Dim() {
+		if s.Dim() {
+			decls = append(decls, "opacity: 0.5")
+		} else {
+			decls = append(decls, "opacity: 1")
+		}
+	}
+	if color, parentColor := cssColor(s.HasBorderColor, s.BorderColor), cssColor(parent.HasBorderColor, parent.BorderColor); color != parentColor {
+		if color == "" {
+			decls = append(decls, "border: none")
+		} else {
+			decls = append(decls, "border: 1px solid "+color)
+		}
+	}
+	return strings.Join(decls, "; ")
+}
+
+// cssColor return the color as #rrggbb, or an empty string if it is not defined.
+func cssColor(has func() bool, color func() (byte, byte, byte)) string {
+	if !has() {
+		return ""
+	}
+	r, g, b := color()
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
 }
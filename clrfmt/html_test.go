@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/chmike/clrz/clrcore"
 )
@@ -48,18 +50,159 @@ func TestHTML(t *testing.T) {
 	if n != len(buf.String()) {
 		t.Errorf("get n %d, expected %d", n, len(buf.String()))
 	}
-	expect := `<scan class="q">AB</span><scan class="at">{</span><scan class="f"> </span><scan class="at">(</span><scan class="u">a</span><scan class="f"> </span><scan class="u">b</span><scan class="at">(</span><scan class="u">c</span><scan class="f"> </span><scan class="u">d</span><scan class="at">)</span><scan class="at">)</span><scan class="f"> </span><scan class="at">}</span><scan class="f"> </span><scan class="q">CD</span>`
+	expect := `<span class="q">AB</span><span class="at">{</span><span class="f"> </span><span class="at">(</span><span class="u">a</span><span class="f"> </span><span class="u">b</span><span class="at">(</span><span class="u">c</span><span class="f"> </span><span class="u">d</span><span class="at">)</span><span class="at">)</span><span class="f"> </span><span class="at">}</span><span class="f"> </span><span class="q">CD</span>`
 	if buf.String() != expect {
 		t.Errorf("got:\n%s\n, expect:\n%s", buf.String(), expect)
 	}
 }
 
+func TestHTMLWithOptions(t *testing.T) {
+	def := &clrcore.LexerDef{
+		Name: "TestHTMLWithOptions",
+		InitFunc: func(d *clrcore.LexerDef) {
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: []clrcore.LexerDefRule{
+					clrcore.WhiteSpaceRule, clrcore.NewLineRule,
+					&clrcore.RegexDefRule{Re: "[a-z]+", Do: clrcore.PopMatch(clrcore.CodeIdentifier)},
+					&clrcore.RegexDefRule{Re: "[<>&]", Do: clrcore.PopMatch(clrcore.CodeOperator)},
+				}},
+			}
+		},
+	}
+	lexerInfo := &clrcore.LexerInfo{
+		Names: []string{"test"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		},
+	}
+	tests := []struct {
+		in     string
+		opts   *HTMLOptions
+		expect string
+	}{
+		{
+			in:     "a<b&c>d",
+			expect: `<span class="q">a</span><span class="an">&lt;</span><span class="q">b</span><span class="an">&amp;</span><span class="q">c</span><span class="an">&gt;</span><span class="q">d</span>`,
+		},
+		{
+			in:     "a\n\nb\n",
+			opts:   &HTMLOptions{PreCode: true},
+			expect: "<pre><code><span class=\"q\">a</span>\n\n<span class=\"q\">b</span>\n</code></pre>",
+		},
+		{
+			in:     "a 1&",
+			opts:   &HTMLOptions{PreCode: true},
+			expect: "<pre><code><span class=\"q\">a</span><span class=\"f\"> </span>1&amp;</code></pre>",
+		},
+		{
+			in:   "a\nb\nc",
+			opts: &HTMLOptions{LineNumbers: InlineLineNumbers, BaseLineNumber: 9, HighlightLines: [][2]int{{10, 10}}},
+			expect: "<span class=\"clrz-ln\"> 9 </span><span class=\"q\">a</span>\n" +
+				"<span class=\"clrz-hl\"><span class=\"clrz-ln\">10 </span><span class=\"q\">b</span></span>\n" +
+				"<span class=\"clrz-ln\">11 </span><span class=\"q\">c</span>",
+		},
+		{
+			in:   "a\n\nb\n",
+			opts: &HTMLOptions{LineNumbers: TableLineNumbers, HighlightLines: [][2]int{{2, 3}}},
+			expect: "<table class=\"clrz-table\"><tr><td class=\"clrz-lnt\"><pre>1\n2\n3</pre></td>" +
+				"<td class=\"clrz-code\"><pre><code><span class=\"q\">a</span>\n<span class=\"clrz-hl\"></span>\n" +
+				"<span class=\"clrz-hl\"><span class=\"q\">b</span></span>\n</code></pre></td></tr></table>",
+		},
+		{
+			in:     "\ta\tbc\td",
+			opts:   &HTMLOptions{TabWidth: 4},
+			expect: `<span class="f">    </span><span class="q">a</span><span class="f">   </span><span class="q">bc</span><span class="f">  </span><span class="q">d</span>`,
+		},
+		{
+			// invalid UTF-8 is copied unchanged
+			in:     "a \xff<b\xe2\x82",
+			expect: "<span class=\"q\">a</span><span class=\"f\"> </span>\xff&lt;b\xe2\x82",
+		},
+		{
+			in:     "a\xff\xe2\x82\tb",
+			opts:   &HTMLOptions{TabWidth: 4},
+			expect: "<span class=\"q\">a</span>\xff\xe2\x82 b",
+		},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		_, n, err := HTMLWithOptions(&buf, lexerInfo, test.in, test.opts)
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+			continue
+		}
+		if n != buf.Len() {
+			t.Errorf("%d. got n %d, expected %d", i, n, buf.Len())
+		}
+		if buf.String() != test.expect {
+			t.Errorf("%d. got:\n%s\nexpected:\n%s", i, buf.String(), test.expect)
+		}
+	}
+	dw := &DummyWriter{w: &bytes.Buffer{}, max: 10}
+	if _, _, err := HTMLWithOptions(dw, lexerInfo, "a b", &HTMLOptions{PreCode: true}); err == nil {
+		t.Error("unexpected nil error")
+	}
+}
+
+func TestHTMLInlineStyle(t *testing.T) {
+	def := &clrcore.LexerDef{
+		Name: "TestHTMLInlineStyle",
+		InitFunc: func(d *clrcore.LexerDef) {
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: []clrcore.LexerDefRule{
+					clrcore.WhiteSpaceRule, clrcore.NewLineRule,
+					&clrcore.RegexDefRule{Re: "[a-z]+", Do: clrcore.PopMatch(clrcore.CodeIdentifierVariable)},
+					&clrcore.RegexDefRule{Re: "[A-Z]", Do: clrcore.PopMatch(clrcore.CodeIdentifierType)},
+					&clrcore.RegexDefRule{Re: "[0-9]+", Do: clrcore.PopMatch(clrcore.CodeNumberInteger)},
+					&clrcore.RegexDefRule{Re: "[<>]", Do: clrcore.PopMatch(clrcore.CodeOperator)},
+				}},
+			}
+		},
+	}
+	lexerInfo := &clrcore.LexerInfo{
+		Names: []string{"test"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		},
+	}
+	style, err := clrcore.NewStyle(`
+	Code.Identifier text#FF0000 bold
+	Code.Identifier.Variable italic back#000055 notext nobold
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var buf bytes.Buffer
+	_, n, err := HTMLWithOptions(&buf, lexerInfo, "a<B12C\nD 3", &HTMLOptions{InlineStyle: style})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != buf.Len() {
+		t.Errorf("got n %d, expected %d", n, buf.Len())
+	}
+	expect := `<span style="background-color:#000055;font-style:italic">a</span>&lt;` +
+		`<span style="color:#ff0000;font-weight:bold">B</span>12<span style="color:#ff0000;font-weight:bold">C</span>` + "\n" +
+		`<span style="color:#ff0000;font-weight:bold">D</span> 3`
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+	// adjacent lexemes with the same style are merged
+	buf.Reset()
+	if _, _, err = HTMLWithOptions(&buf, lexerInfo, "B\nCD", &HTMLOptions{InlineStyle: style}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect = `<span style="color:#ff0000;font-weight:bold">B</span>` + "\n" + `<span style="color:#ff0000;font-weight:bold">CD</span>`
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+}
+
 func TestCSS1(t *testing.T) {
 	style, err := clrcore.NewStyle(`
 	Code.Identifier text#FF0000
 	Code.Comment text#00FF00
-	Code.Identifier.Variable italic
-	Code.Identifier.Keyword bold
+	Code.Identifier.Variable italic notext
+	Code.Identifier.Keyword bold notext
 	`)
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
@@ -88,6 +231,9 @@ func TestCSS1(t *testing.T) {
 <code> .ar, <code><pre> .ar, /*       Code.Operator.Binary */
 <code> .as, <code><pre> .as, /*           Code.Punctuation */
 <code> .at, <code><pre> .at, /*             Code.Delimiter */
+<code> .au, <code><pre> .au, /*          Code.Preprocessor */
+<code> .av, <code><pre> .av, /*     Code.Preprocessor.File */
+<code> .aw, <code><pre> .aw, /*          Code.String.Regex */
 <code> .e , <code><pre> .e , /*                       Text */
 <code> .f , <code><pre> .f , /*            Text.WhiteSpace */
 <code> .g , <code><pre> .g , /*               Text.NewLine */
@@ -100,7 +246,7 @@ func TestCSS1(t *testing.T) {
 <code> .n , <code><pre> .n , /*                Text.Number */
 <code> .o , <code><pre> .o , /*                 Text.Other */
 <code> .p , <code><pre> .p   /*                       Code */ {} 
-<code> .am, <code><pre> .am  /*               Code.Comment */ {font-color: #00ff00} 
+<code> .am, <code><pre> .am  /*               Code.Comment */ {color: #00ff00} 
 <code> .q , <code><pre> .q , /*            Code.Identifier */
 <code> .s , <code><pre> .s , /*   Code.Identifier.Function */
 <code> .t , <code><pre> .t , /*     Code.Identifier.Method */
@@ -108,7 +254,7 @@ func TestCSS1(t *testing.T) {
 <code> .v , <code><pre> .v , /*      Code.Identifier.Class */
 <code> .w , <code><pre> .w , /*  Code.Identifier.Namespace */
 <code> .y , <code><pre> .y , /*    Code.Identifier.Literal */
-<code> .z , <code><pre> .z   /*   Code.Identifier.Operator */ {font-color: #ff0000} 
+<code> .z , <code><pre> .z   /*   Code.Identifier.Operator */ {color: #ff0000} 
 <code> .r , <code><pre> .r   /*   Code.Identifier.Variable */ {font-style: italic} 
 <code> .x , <code><pre> .x   /*    Code.Identifier.Keyword */ {font-weight: bold} 
 `
@@ -142,8 +288,8 @@ func TestCSS2(t *testing.T) {
 	style, err := clrcore.NewStyle(`
 	Code.Identifier text#FF0000 back#000055
 	Code.Comment text#00FF00
-	Code.Identifier.Variable italic
-	Code.Identifier.Keyword bold
+	Code.Identifier.Variable italic notext noback
+	Code.Identifier.Keyword bold notext noback
 	`)
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
@@ -172,6 +318,9 @@ func TestCSS2(t *testing.T) {
 .ar, /*       Code.Operator.Binary */
 .as, /*           Code.Punctuation */
 .at, /*             Code.Delimiter */
+.au, /*          Code.Preprocessor */
+.av, /*     Code.Preprocessor.File */
+.aw, /*          Code.String.Regex */
 .e , /*                       Text */
 .f , /*            Text.WhiteSpace */
 .g , /*               Text.NewLine */
@@ -184,7 +333,7 @@ func TestCSS2(t *testing.T) {
 .n , /*                Text.Number */
 .o , /*                 Text.Other */
 .p   /*                       Code */ {}
-.am  /*               Code.Comment */ {font-color: #00ff00}
+.am  /*               Code.Comment */ {color: #00ff00}
 .q , /*            Code.Identifier */
 .s , /*   Code.Identifier.Function */
 .t , /*     Code.Identifier.Method */
@@ -192,7 +341,7 @@ func TestCSS2(t *testing.T) {
 .v , /*      Code.Identifier.Class */
 .w , /*  Code.Identifier.Namespace */
 .y , /*    Code.Identifier.Literal */
-.z   /*   Code.Identifier.Operator */ {font-color: #ff0000; background-color: #000055}
+.z   /*   Code.Identifier.Operator */ {color: #ff0000; background-color: #000055}
 .r   /*   Code.Identifier.Variable */ {font-style: italic}
 .x   /*    Code.Identifier.Keyword */ {font-weight: bold}
 `
@@ -241,3 +390,174 @@ func TestClassNameFromIdx(t *testing.T) {
 		}
 	}
 }
+
+func TestHTMLFromReader(t *testing.T) {
+	def := &clrcore.LexerDef{
+		Name: "TestHTMLFromReader",
+		InitFunc: func(d *clrcore.LexerDef) {
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: []clrcore.LexerDefRule{
+					clrcore.WhiteSpaceRule, clrcore.NewLineRule,
+					&clrcore.RegexDefRule{Re: `[\pL]+`, Do: clrcore.PopMatch(clrcore.CodeIdentifier)},
+					&clrcore.RegexDefRule{Re: "[<>&]", Do: clrcore.PopMatch(clrcore.CodeOperator)},
+				}},
+			}
+		},
+	}
+	lexerInfo := &clrcore.LexerInfo{
+		Names: []string{"test"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		},
+		NewReaderLexer: func(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewReaderLexerEngine(def, r, 3, stopMarkers, nil)
+		},
+	}
+	text := strings.Repeat("abc<défghi\nxy & z\n", 300) + "1 < é\ttail"
+	opts := &HTMLOptions{PreCode: true, HighlightLines: [][2]int{{2, 3}}, TabWidth: 4}
+	var expect bytes.Buffer
+	expectScore, _, err := HTMLWithOptions(&expect, lexerInfo, text, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var buf bytes.Buffer
+	w := &DummyWriter{w: &buf, max: 1 << 30}
+	score, n, err := HTMLFromReader(w, lexerInfo, iotest.HalfReader(strings.NewReader(text)), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if score != expectScore {
+		t.Errorf("got score %d, expected %d", score, expectScore)
+	}
+	if n != buf.Len() {
+		t.Errorf("got n %d, expected %d", n, buf.Len())
+	}
+	if buf.String() != expect.String() {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect.String())
+	}
+	// the lexer reading the whole text is used as fallback
+	lexerInfo.NewReaderLexer = nil
+	buf.Reset()
+	if _, _, err = HTMLFromReader(&buf, lexerInfo, strings.NewReader(text), opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if buf.String() != expect.String() {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect.String())
+	}
+	// the table line numbers are aligned as with the whole text
+	text = strings.Repeat("a\n", 10) + "b"
+	opts = &HTMLOptions{LineNumbers: TableLineNumbers}
+	expect.Reset()
+	if _, _, err = HTMLWithOptions(&expect, lexerInfo, text, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(expect.String(), "<pre> 1\n 2\n") {
+		t.Errorf("line numbers not padded in:\n%s", expect.String())
+	}
+	buf.Reset()
+	if _, _, err = HTMLFromReader(&buf, lexerInfo, strings.NewReader(text), opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if buf.String() != expect.String() {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect.String())
+	}
+}
+
+func TestStyleAttributes(t *testing.T) {
+	tests := []struct {
+		in          []string
+		inline, css string
+	}{
+		{in: []string{}, inline: "", css: ""},
+		{in: []string{"nobold", "noback"}, inline: "", css: ""},
+		{in: []string{"underline"}, inline: `style="text-decoration:underline"`, css: "text-decoration: underline"},
+		{in: []string{"strikethrough", "underline"}, inline: `style="text-decoration:underline line-through"`,
+			css: "text-decoration: underline line-through"},
+		{in: []string{"dim", "strikethrough"}, inline: `style="text-decoration:line-through;opacity:0.5"`,
+			css: "text-decoration: line-through; opacity: 0.5"},
+		{in: []string{"bold", "border#102030"}, inline: `style="font-weight:bold;border:1px solid #102030"`,
+			css: "font-weight: bold; border: 1px solid #102030"},
+	}
+	for _, test := range tests {
+		s, err := clrcore.MakeStyle(test.in...)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if inline := inlineStyleAttr(s); inline != test.inline {
+			t.Errorf("got inline style %q, expected %q for %v", inline, test.inline, test.in)
+		}
+		var buf bytes.Buffer
+		style := clrcore.Style{s: []*clrcore.LexemeType{clrcore.CodeComment}}
+		if _, err := CSS(&buf, style); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if css := buf.String(); !strings.HasSuffix(css, "{"+test.css+"}\n") {
+			t.Errorf("got css %q, expected style {%s} for %v", css, test.css, test.in)
+		}
+	}
+}
+
+func TestNestedClasses(t *testing.T) {
+	def := &clrcore.LexerDef{
+		Name: "TestNestedClasses",
+		InitFunc: func(d *clrcore.LexerDef) {
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: []clrcore.LexerDefRule{
+					clrcore.WhiteSpaceRule,
+					&clrcore.RegexDefRule{Re: `"[^"]*"`, Do: clrcore.PopMatch(clrcore.CodeStringDouble)},
+					&clrcore.RegexDefRule{Re: "[a-z]+", Do: clrcore.PopMatch(clrcore.CodeIdentifier)},
+				}},
+			}
+		},
+	}
+	lexerInfo := &clrcore.LexerInfo{
+		Names: []string{"test"},
+		NewLexer: func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+			return clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		},
+	}
+	var buf bytes.Buffer
+	opts := &HTMLOptions{NestedClasses: true, ClassNames: ClassNames{Naming: FullClassNames}}
+	if _, _, err := HTMLWithOptions(&buf, lexerInfo, `a "b"`, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := `<span class="Code Code-Identifier">a</span><span class="Text Text-WhiteSpace"> </span>` +
+		`<span class="Code Code-String Code-String-Double">"b"</span>`
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+
+	buf.Reset()
+	opts.ClassNames.Naming = PygmentsClassNames
+	if _, _, err := HTMLWithOptions(&buf, lexerInfo, `a "b"`, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect = `<span class="n">a</span><span class="w"> </span><span class="s s2">"b"</span>`
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+
+	style, err := clrcore.NewStyle(`
+	Code text#000000
+	Code.String text#FF0000 italic
+	Code.String.Double noitalic bold
+	Code.String.Raw back#FFFFFF
+	Code.Comment notext underline
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	buf.Reset()
+	if _, err = CSSWithOptions(&buf, style, &CSSOptions{NestedClasses: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect = `.p   /*               Code */ {color: #000000}
+.aa  /*        Code.String */ {font-style: italic; color: #ff0000}
+.ac  /* Code.String.Double */ {font-style: normal; font-weight: bold}
+.ad  /*    Code.String.Raw */ {background-color: #ffffff}
+.am  /*       Code.Comment */ {color: inherit; text-decoration: underline}
+`
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+}
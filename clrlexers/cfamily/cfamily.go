@@ -0,0 +1,568 @@
+// Package cfamily provides lexers for the C, C++ and Objective-C programming
+// languages, which share the same modes. They are registered under the names
+// "c", "cpp" and "objective-c" when the package is imported.
+//
+// The lexers add to their score the constructs specific to their language, so
+// that the header files, matched by the three lexers, are lexed with the right
+// one. The C lexer, registered first, is selected when the scores are equal.
+package cfamily
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+// CLexerInfo is the registered C lexer information.
+var CLexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"c"},
+	MimeTypes:      []string{"text/x-csrc", "text/x-chdr"},
+	FileNames:      []string{"*.c", "*.h"},
+	AnalyseText:    analyseText,
+	NewLexer:       newLexer(cLexerDef),
+	NewReaderLexer: newReaderLexer(cLexerDef),
+}
+
+// CppLexerInfo is the registered C++ lexer information.
+var CppLexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"cpp", "c++", "cxx"},
+	MimeTypes:      []string{"text/x-c++src", "text/x-c++hdr"},
+	FileNames:      []string{"*.cpp", "*.hpp", "*.cc", "*.hh", "*.cxx", "*.hxx", "*.c++", "*.h++", "*.h"},
+	AnalyseText:    analyseCppText,
+	NewLexer:       newLexer(cppLexerDef),
+	NewReaderLexer: newReaderLexer(cppLexerDef),
+}
+
+// ObjCLexerInfo is the registered Objective-C lexer information.
+var ObjCLexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"objective-c", "objectivec", "obj-c", "objc"},
+	MimeTypes:      []string{"text/x-objective-c", "text/x-objective-c++"},
+	FileNames:      []string{"*.m", "*.mm", "*.h"},
+	AnalyseText:    analyseObjCText,
+	NewLexer:       newLexer(objcLexerDef),
+	NewReaderLexer: newReaderLexer(objcLexerDef),
+}
+
+func init() {
+	clrcore.RegisterLexer(CLexerInfo)
+	clrcore.RegisterLexer(CppLexerInfo)
+	clrcore.RegisterLexer(ObjCLexerInfo)
+}
+
+var (
+	includeRe     = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*include[ \t]*[<"]`)
+	macroRe       = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*(?:define|ifdef|ifndef)[ \t]+[\pL_]`)
+	mainRe        = regexp.MustCompile(`(?m)^(?:int|void)[ \t]+main[ \t]*\(`)
+	cppIncludeRe  = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*include[ \t]*<[a-z_]+>`)
+	cppScopeRe    = regexp.MustCompile(`\bstd::`)
+	cppDeclRe     = regexp.MustCompile(`(?m)^[ \t]*(?:namespace[ \t]+[\pL_]|using[ \t]+namespace[ \t]|template[ \t]*<)`)
+	objcImportRe  = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*import[ \t]*[<"]`)
+	objcKeywordRe = regexp.MustCompile(`(?m)^[ \t]*@(?:interface|implementation|protocol|end)\b`)
+)
+
+// analyseText return the likelihood that text is C source code by looking for
+// include directives, macro definitions and a main function. The C++ and
+// Objective-C lexers add the constructs specific to their language.
+func analyseText(text string) float64 {
+	var c float64
+	if includeRe.MatchString(text) {
+		c += 0.1
+	}
+	if macroRe.MatchString(text) {
+		c += 0.1
+	}
+	if mainRe.MatchString(text) {
+		c += 0.2
+	}
+	return c
+}
+
+// analyseCppText return the likelihood that text is C++ source code.
+func analyseCppText(text string) float64 {
+	c := analyseText(text)
+	if cppIncludeRe.MatchString(text) {
+		c += 0.2
+	}
+	if cppScopeRe.MatchString(text) {
+		c += 0.2
+	}
+	if cppDeclRe.MatchString(text) {
+		c += 0.3
+	}
+	return c
+}
+
+// analyseObjCText return the likelihood that text is Objective-C source code.
+func analyseObjCText(text string) float64 {
+	c := analyseText(text)
+	if objcImportRe.MatchString(text) {
+		c += 0.3
+	}
+	if objcKeywordRe.MatchString(text) {
+		c += 0.6
+	}
+	return c
+}
+
+func newLexer(def *clrcore.LexerDef) func(string, ...string) (clrcore.Lexer, error) {
+	return func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+		l, err := clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+}
+
+func newReaderLexer(def *clrcore.LexerDef) func(io.Reader, ...string) (clrcore.Lexer, error) {
+	return func(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+		l, err := clrcore.NewReaderLexerEngine(def, r, 0, stopMarkers, nil)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+}
+
+// wordSet return the set of the words separated by spaces in the lists.
+func wordSet(lists ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, words := range lists {
+		for _, word := range strings.Fields(words) {
+			set[word] = true
+		}
+	}
+	return set
+}
+
+const (
+	cKeywords = `_Alignas _Alignof _Atomic _Generic _Noreturn _Pragma _Static_assert
+		_Thread_local __asm__ __attribute__ __declspec __extension__ __inline
+		__restrict __volatile__ alignas alignof asm auto break case const constexpr
+		continue default do else enum extern for goto if inline register restrict
+		return sizeof static static_assert struct switch thread_local typedef typeof
+		typeof_unqual union volatile while`
+	cTypes = `_BitInt _Bool _Complex _Decimal128 _Decimal32 _Decimal64 _Imaginary FILE
+		bool char char16_t char32_t char8_t double float int int16_t int32_t int64_t
+		int8_t intmax_t intptr_t long ptrdiff_t short signed size_t ssize_t uint16_t
+		uint32_t uint64_t uint8_t uintmax_t uintptr_t unsigned va_list void wchar_t`
+	cConstants  = `NULL false nullptr true`
+	cppKeywords = `catch class co_await co_return co_yield concept const_cast consteval constinit
+		decltype delete dynamic_cast explicit export final friend import module mutable
+		namespace new noexcept operator override private protected public
+		reinterpret_cast requires static_cast template throw try typeid typename using
+		virtual`
+	cppOperators = `and and_eq bitand bitor compl not not_eq or or_eq xor xor_eq`
+	objcKeywords = `__autoreleasing __block __bridge __bridge_retained __bridge_transfer
+		__kindof __strong __unsafe_unretained __weak _Nonnull _Null_unspecified
+		_Nullable bycopy byref in inout oneway out`
+	objcTypes     = `BOOL CGFloat Class IMP NSInteger NSUInteger SEL id instancetype`
+	objcConstants = `NO Nil YES nil`
+	// objcAtKeywords are the keywords following @.
+	objcAtKeywords = `autoreleasepool available catch class compatibility_alias defs
+		dynamic encode end finally implementation import interface optional package
+		private property protected protocol public required selector synchronized
+		synthesize throw try`
+)
+
+// A language holds the words and the features of a language of the C family.
+type language struct {
+	keywords      map[string]bool
+	wordOperators map[string]bool
+	types         map[string]bool
+	constants     map[string]bool
+	variables     map[string]bool
+	declKeywords  string // keywords followed by a declared name
+	cpp           bool   // raw strings, literal suffixes, templates and C++ scoring
+	objc          bool   // @ keywords and literals
+	attributes    bool   // [[...]] attributes
+	templateArgs  bool   // template arguments and Objective-C generics
+}
+
+var (
+	cLanguage = &language{
+		keywords:     wordSet(cKeywords),
+		types:        wordSet(cTypes),
+		constants:    wordSet(cConstants),
+		declKeywords: `struct|union|enum`,
+		attributes:   true,
+	}
+	cppLanguage = &language{
+		keywords:      wordSet(cKeywords, cppKeywords),
+		wordOperators: wordSet(cppOperators),
+		types:         wordSet(cTypes),
+		constants:     wordSet(cConstants),
+		variables:     wordSet(`this`),
+		declKeywords:  `struct|union|enum|class|namespace`,
+		cpp:           true,
+		attributes:    true,
+		templateArgs:  true,
+	}
+	objcLanguage = &language{
+		keywords:     wordSet(cKeywords, objcKeywords),
+		types:        wordSet(cTypes, objcTypes),
+		constants:    wordSet(cConstants, objcConstants),
+		variables:    wordSet(`self super _cmd`),
+		declKeywords: `struct|union|enum`,
+		objc:         true,
+		templateArgs: true,
+	}
+)
+
+// popIdentifier classifies the matched identifier as keyword, predefined
+// identifier, namespace, function call or plain identifier. An identifier
+// followed by template arguments is a type, or a function when called, and the
+// arguments are lexed in the template-args mode.
+func (g *language) popIdentifier(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()
+	word := text[:match[1]]
+	rest := text[match[1]:]
+	t := clrcore.CodeIdentifier
+	switch {
+	case g.wordOperators[word]:
+		t = clrcore.CodeIdentifierOperator
+	case g.keywords[word]:
+		t = clrcore.CodeIdentifierKeyword
+	case g.types[word]:
+		t = clrcore.CodeIdentifierType
+	case g.constants[word]:
+		t = clrcore.CodeIdentifierLiteral
+	case g.variables[word]:
+		t = clrcore.CodeIdentifierVariable
+	case strings.HasPrefix(rest, "::"):
+		t = clrcore.CodeIdentifierNamespace
+	}
+	if g.templateArgs && word != "operator" && strings.HasPrefix(rest, "<") {
+		if end := templateArgsEnd(rest[1:]); end >= 0 {
+			if t == clrcore.CodeIdentifier {
+				t = clrcore.CodeIdentifierType
+				if isCall(rest[1+end+1:]) {
+					t = clrcore.CodeIdentifierFunction
+				}
+			}
+			l.PopLexeme(t, match[1])
+			l.PopLexeme(clrcore.CodeDelimiter, 1)
+			l.PushMode("template-args")
+			return true
+		}
+	}
+	if t == clrcore.CodeIdentifier && isCall(rest) {
+		t = clrcore.CodeIdentifierFunction
+	}
+	l.PopLexeme(t, match[1])
+	return true
+}
+
+// popDecl classifies the name following a struct, union, enum, class or
+// namespace keyword as a class or a namespace. Only the keyword is output when
+// the name is a keyword, as in enum class.
+func (g *language) popDecl(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()
+	keyword, name := text[match[2]:match[3]], text[match[6]:match[7]]
+	if g.keywords[name] || g.types[name] {
+		l.PopLexeme(clrcore.CodeIdentifierKeyword, match[3])
+		return true
+	}
+	t := clrcore.CodeIdentifierClass
+	switch keyword {
+	case "namespace":
+		t = clrcore.CodeIdentifierNamespace
+		clrcore.ScoreAdd(10)(l, match)
+	case "class":
+		clrcore.ScoreAdd(1)(l, match)
+	}
+	return clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, t)(l, match)
+}
+
+// maxTemplateArgs is the maximum length of the template arguments recognized
+// by templateArgsEnd.
+const maxTemplateArgs = 256
+
+// templateArgsEnd return the index of the > closing the template arguments at
+// the start of str, or -1 if str doesn't start with template arguments. The
+// arguments may only contain identifiers, numbers, white spaces, nested
+// template arguments and parenthesis, and the characters :,*&[]. of the types.
+func templateArgsEnd(str string) int {
+	var angles, parens int
+	for i := 0; i < len(str) && i < maxTemplateArgs; i++ {
+		c := str[i]
+		switch {
+		case c == '>':
+			if angles == 0 {
+				if parens != 0 {
+					return -1
+				}
+				return i
+			}
+			angles--
+		case c == '<':
+			angles++
+		case c == '(':
+			parens++
+		case c == ')':
+			if parens == 0 {
+				return -1
+			}
+			parens--
+		case c == '&':
+			if i+1 < len(str) && str[i+1] == '&' {
+				return -1
+			}
+		case c == '_', c == ' ', c == '\t', c == ':', c == ',', c == '*', c == '[', c == ']', c == '.',
+			c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= utf8.RuneSelf:
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// isCall return true if str starts with an opening parenthesis, optionally
+// preceded by white spaces.
+func isCall(str string) bool {
+	for len(str) > 0 {
+		r, n := utf8.DecodeRuneInString(str)
+		if r == '(' {
+			return true
+		}
+		if r == '\n' || !unicode.IsSpace(r) {
+			return false
+		}
+		str = str[n:]
+	}
+	return false
+}
+
+// maxRawDelimiter is the maximum length of the delimiter of a raw string.
+const maxRawDelimiter = 16
+
+// popRawString pops a C++ raw string R"delim(...)delim" starting at its double
+// quote, followed by its optional literal suffix. An unterminated raw string
+// ends at the end of the text. It return a nil lexeme if the delimiter is
+// invalid.
+func popRawString(l *clrcore.Lexeme) clrcore.Lexeme {
+	str := l.Str
+	i := 1
+	for i < len(str) && str[i] != '(' {
+		if i > maxRawDelimiter || strings.IndexByte(" )\\\t\v\f\r\n\"", str[i]) >= 0 {
+			return clrcore.Lexeme{}
+		}
+		i++
+	}
+	if i == len(str) {
+		return l.PopLexeme(clrcore.CodeStringRaw, len(str))
+	}
+	end := strings.Index(str[i+1:], ")"+str[1:i]+`"`)
+	if end < 0 {
+		return l.PopLexeme(clrcore.CodeStringRaw, len(str))
+	}
+	end += 2*i + 2
+	for end < len(str) && isIdentByte(str[end]) {
+		end++
+	}
+	return l.PopLexeme(clrcore.CodeStringRaw, end)
+}
+
+// popRawStringRule pops a raw string and adds 1 to the score, or doesn't match
+// when the delimiter is invalid.
+func popRawStringRule(l *clrcore.LexerEngine, match []int) bool {
+	if !clrcore.PopWith(popRawString)(l, match) {
+		return false
+	}
+	return clrcore.ScoreAdd(1)(l, match)
+}
+
+// isIdentByte return true if c is an ASCII letter, digit or underscore.
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Regular expressions of the C family lexemes.
+const (
+	identRe     = `[_\pL][_\pL\p{Nd}]*`
+	digitsRe    = `[0-9](?:'?[0-9])*`
+	hexDigitsRe = `[0-9a-fA-F](?:'?[0-9a-fA-F])*`
+	expRe       = `[eE][+-]?` + digitsRe
+	// suffixRe is the suffix of the numbers, like u, LL, f or a user-defined
+	// literal suffix.
+	suffixRe   = `(?:[_\pL][_\pL\p{Nd}]*)?`
+	hexFloatRe = `0[xX](?:` + hexDigitsRe + `(?:\.(?:` + hexDigitsRe + `)?)?|\.` + hexDigitsRe + `)[pP][+-]?` + digitsRe + suffixRe
+	floatRe    = `(?:` + digitsRe + `\.(?:` + digitsRe + `)?(?:` + expRe + `)?|` + digitsRe + expRe + `|\.` + digitsRe + `(?:` + expRe + `)?)` + suffixRe
+	hexIntRe   = `0[xX]` + hexDigitsRe + suffixRe
+	binIntRe   = `0[bB][01](?:'?[01])*` + suffixRe
+	octIntRe   = `0(?:'?[0-7])+` + suffixRe
+	intRe      = `(?:0|[1-9](?:'?[0-9])*)` + suffixRe
+	prefixRe   = `(?:u8|u|U|L)?`
+	stringRe   = prefixRe + `"(?:[^"\\\n]|\\(?s:.))*"?`
+	charRe     = prefixRe + `'(?:[^'\\\n]|\\(?s:.))*'?`
+	// directiveRe is the start of a preprocessor directive, with its name.
+	directiveRe = `#[ \t]*`
+	pathRe      = `<[^>\n]*>|"[^"\n]*"`
+)
+
+var (
+	whiteSpaceRule   = clrcore.WhiteSpaceRule
+	newLineRule      = clrcore.NewLineRule
+	continuationRule = &clrcore.RegexDefRule{Re: `\\\r?\n`, Do: clrcore.PopMatch(clrcore.TextWhiteSpace)}
+	commentRules     = []clrcore.LexerDefRule{
+		&clrcore.RegexDefRule{Re: `//[^\n]*`, Do: clrcore.PopMatch(clrcore.CodeComment)},
+		&clrcore.RegexDefRule{Re: `/\*(?s:.*?)(?:\*/|\z)`, Do: clrcore.PopMatch(clrcore.CodeComment)},
+	}
+)
+
+// directiveRules return the rules of the preprocessor directives. The rest of
+// a directive is lexed in the directive mode.
+func (g *language) directiveRules() []clrcore.LexerDefRule {
+	var rules []clrcore.LexerDefRule
+	if g.cpp {
+		// standard C++ headers have no extension
+		rules = append(rules, &clrcore.RegexDefRule{Re: `(` + directiveRe + `include)([ \t]*)(<[_a-zA-Z0-9/]+>)`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodePreprocessor, clrcore.TextWhiteSpace, clrcore.CodePreprocessorFile),
+				clrcore.PushMode("directive"), clrcore.ScoreAdd(2))})
+	}
+	if g.objc {
+		rules = append(rules, &clrcore.RegexDefRule{Re: `(` + directiveRe + `import)([ \t]*)(` + pathRe + `)`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodePreprocessor, clrcore.TextWhiteSpace, clrcore.CodePreprocessorFile),
+				clrcore.PushMode("directive"), clrcore.ScoreAdd(2))})
+	}
+	return append(rules,
+		&clrcore.RegexDefRule{Re: `(` + directiveRe + `(?:include|include_next|import))([ \t]*)(` + pathRe + `)`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodePreprocessor, clrcore.TextWhiteSpace, clrcore.CodePreprocessorFile),
+				clrcore.PushMode("directive"), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: directiveRe + `(?:error|warning)\b(?:[^\\\n]|\\(?s:.))*`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodePreprocessor), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: directiveRe + `[a-zA-Z_]*`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodePreprocessor), clrcore.PushMode("directive"), clrcore.ScoreAdd(1))},
+	)
+}
+
+// tokenRules return the rules of the tokens of the language.
+func (g *language) tokenRules() []clrcore.LexerDefRule {
+	var rules []clrcore.LexerDefRule
+	suffix := ""
+	scope := clrcore.PopMatch(clrcore.CodeOperator)
+	if g.cpp {
+		suffix = suffixRe
+		scope = clrcore.All(scope, clrcore.ScoreAdd(1))
+		rules = append(rules,
+			&clrcore.RegexDefRule{Re: prefixRe + `R(")`, Do: popRawStringRule},
+			&clrcore.RegexDefRule{Re: `(template)([ \t]*)(<)`,
+				Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeDelimiter),
+					clrcore.PushMode("template-args"), clrcore.ScoreAdd(10))},
+		)
+	}
+	if g.objc {
+		rules = append(rules,
+			&clrcore.RegexDefRule{Re: `@"(?:[^"\\\n]|\\(?s:.))*"?`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringDouble), clrcore.ScoreAdd(1))},
+			&clrcore.RegexDefRule{Re: `(@(?:interface|implementation|protocol))([ \t]+)(` + identRe + `)`,
+				Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierClass), clrcore.ScoreAdd(10))},
+			&clrcore.RegexDefRule{Re: `(@import)([ \t]+)(` + identRe + `(?:\.` + identRe + `)*)`,
+				Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierNamespace), clrcore.ScoreAdd(1))},
+			&clrcore.RegexDefRule{Re: `@(?:` + strings.Join(strings.Fields(objcAtKeywords), "|") + `)\b`,
+				Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword), clrcore.ScoreAdd(1))},
+			// @ starts the literals of numbers, arrays, dictionaries and boxed expressions
+			&clrcore.RegexDefRule{Re: `@`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		)
+	}
+	if g.attributes {
+		rules = append(rules, &clrcore.RegexDefRule{Re: `\[\[`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("attribute"))})
+	}
+	return append(rules,
+		&clrcore.RegexDefRule{Re: `(` + g.declKeywords + `)([ \t]+)(` + identRe + `)`, Do: g.popDecl},
+		&clrcore.RegexDefRule{Re: stringRe + suffix, Do: clrcore.PopMatch(clrcore.CodeStringDouble)},
+		&clrcore.RegexDefRule{Re: charRe + suffix, Do: clrcore.PopMatch(clrcore.CodeStringSingle)},
+		&clrcore.RegexDefRule{Re: identRe, Do: g.popIdentifier},
+		&clrcore.RegexDefRule{Re: hexFloatRe, Do: clrcore.PopMatch(clrcore.CodeNumberDecimal)},
+		&clrcore.RegexDefRule{Re: floatRe, Do: clrcore.PopMatch(clrcore.CodeNumberDecimal)},
+		&clrcore.RegexDefRule{Re: hexIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberHexadecimal)},
+		&clrcore.RegexDefRule{Re: binIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberBinary)},
+		&clrcore.RegexDefRule{Re: octIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberOctal)},
+		&clrcore.RegexDefRule{Re: intRe, Do: clrcore.PopMatch(clrcore.CodeNumberInteger)},
+		&clrcore.RegexDefRule{Re: `->\*?|\.\*|<=>`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `::`, Do: scope},
+		&clrcore.RegexDefRule{Re: `<<=|>>=|[-+*/%&|^]=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+		&clrcore.RegexDefRule{Re: `&&|\|\||==|!=|<=|>=`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `<<|>>|[&|^~]`, Do: clrcore.PopMatch(clrcore.CodeOperatorBinary)},
+		&clrcore.RegexDefRule{Re: `\+\+|--|[-+*/%]`, Do: clrcore.PopMatch(clrcore.CodeOperatorArithmetic)},
+		&clrcore.RegexDefRule{Re: `!`, Do: clrcore.PopMatch(clrcore.CodeOperatorLogical)},
+		&clrcore.RegexDefRule{Re: `[<>?]`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+		&clrcore.RegexDefRule{Re: `\.\.\.|[.,;:]`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+		clrcore.DelimiterRule,
+	)
+}
+
+// rules return the concatenation of the rule lists.
+func rules(lists ...[]clrcore.LexerDefRule) []clrcore.LexerDefRule {
+	var res []clrcore.LexerDefRule
+	for _, list := range lists {
+		res = append(res, list...)
+	}
+	return res
+}
+
+// newLexerDef return the definition of the lexer of the language. The modes
+// are the same for all the languages.
+func newLexerDef(name string, g *language) *clrcore.LexerDef {
+	return &clrcore.LexerDef{
+		Name:     name,
+		Recovery: clrcore.RecoverRune,
+		InitFunc: func(d *clrcore.LexerDef) {
+			codeRules := rules(
+				[]clrcore.LexerDefRule{whiteSpaceRule, newLineRule, continuationRule},
+				commentRules,
+				g.directiveRules(),
+				g.tokenRules(),
+			)
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: codeRules},
+				// directive is the rest of a preprocessor directive, ended by a
+				// newline that is not preceded by a backslash.
+				{Name: "directive", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `\r?\n`, Do: clrcore.All(clrcore.PopMatch(clrcore.TextNewLine), clrcore.PopMode())},
+						continuationRule, whiteSpaceRule,
+						&clrcore.RegexDefRule{Re: `##?|defined\b`, Do: clrcore.PopMatch(clrcore.CodePreprocessor)},
+					},
+					commentRules,
+					g.tokenRules(),
+				)},
+				// template-args are the template arguments, ended by a >.
+				{Name: "template-args", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `>`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+					},
+					codeRules,
+				)},
+				// attribute is the list of attributes between [[ and ]], whose
+				// arguments are lexed in the attribute-args mode.
+				{Name: "attribute", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `\]\]`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+						&clrcore.RegexDefRule{Re: `\(`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("attribute-args"))},
+						&clrcore.RegexDefRule{Re: `using\b`, Do: clrcore.PopMatch(clrcore.CodeIdentifierKeyword)},
+						&clrcore.RegexDefRule{Re: identRe + `(?:::` + identRe + `)*`, Do: clrcore.PopMatch(clrcore.CodeIdentifierFunction)},
+					},
+					codeRules,
+				)},
+				{Name: "attribute-args", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `\(`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("attribute-args"))},
+						&clrcore.RegexDefRule{Re: `\)`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+					},
+					codeRules,
+				)},
+			}
+		},
+	}
+}
+
+var (
+	cLexerDef    = newLexerDef("c", cLanguage)
+	cppLexerDef  = newLexerDef("cpp", cppLanguage)
+	objcLexerDef = newLexerDef("objective-c", objcLanguage)
+)
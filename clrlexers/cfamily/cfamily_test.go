@@ -0,0 +1,358 @@
+package cfamily
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+	"github.com/chmike/clrz/clrcore/lexertest"
+)
+
+// checkLexemes checks that the lexemes of text, without the white spaces and
+// the stop lexeme, are the expected ones.
+func checkLexemes(t *testing.T, info *clrcore.LexerInfo, text string, expect []clrcore.Lexeme) {
+	t.Helper()
+	lexertest.ExpectLexemes(t, info, text, expect, clrcore.TextWhiteSpace, clrcore.Stop)
+}
+
+func TestRegistered(t *testing.T) {
+	tests := []struct {
+		info      *clrcore.LexerInfo
+		names     []string
+		mimeType  string
+		fileNames []string
+	}{
+		{info: CLexerInfo, names: []string{"c"}, mimeType: "text/x-csrc", fileNames: []string{"main.c"}},
+		{info: CppLexerInfo, names: []string{"cpp", "c++"}, mimeType: "text/x-c++src", fileNames: []string{"main.cpp", "main.hpp"}},
+		{info: ObjCLexerInfo, names: []string{"objective-c", "objc"}, mimeType: "text/x-objective-c", fileNames: []string{"main.m", "main.mm"}},
+	}
+	for _, test := range tests {
+		for _, name := range test.names {
+			if clrcore.LexerByName(name) != test.info {
+				t.Errorf("lexer not registered with name %q", name)
+			}
+		}
+		if l := clrcore.LexersByMimeType(test.mimeType); len(l) != 1 || l[0] != test.info {
+			t.Errorf("lexer not registered with mime type %q", test.mimeType)
+		}
+		for _, fileName := range test.fileNames {
+			if l := clrcore.LexersByFileName(fileName); len(l) != 1 || l[0] != test.info {
+				t.Errorf("lexer not registered with file name %q", fileName)
+			}
+		}
+	}
+	if l := clrcore.LexersByFileName("list.h"); len(l) != 3 {
+		t.Errorf("got %d lexers for %q, expected 3", len(l), "list.h")
+	}
+}
+
+func TestGolden(t *testing.T) {
+	for _, info := range []*clrcore.LexerInfo{CLexerInfo, CppLexerInfo, ObjCLexerInfo} {
+		lexertest.Run(t, info)
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	lexertest.Fuzz(f, CLexerInfo, CppLexerInfo, ObjCLexerInfo)
+}
+
+func TestPreprocessor(t *testing.T) {
+	text := "# include <a/b.h> // c\n#define F(x) #x ## \\\n  defined\n#error don't\nx"
+	checkLexemes(t, CLexerInfo, text, []clrcore.Lexeme{
+		{Type: clrcore.CodePreprocessor, Str: "# include"},
+		{Type: clrcore.CodePreprocessorFile, Str: "<a/b.h>"},
+		{Type: clrcore.CodeComment, Str: "// c"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodePreprocessor, Str: "#define"},
+		{Type: clrcore.CodeIdentifierFunction, Str: "F"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.CodePreprocessor, Str: "#"},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.CodePreprocessor, Str: "##"},
+		{Type: clrcore.CodePreprocessor, Str: "defined"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodePreprocessor, Str: "#error don't"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+	})
+}
+
+func TestRawString(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{in: `R"(a)"`, out: `R"(a)"`},
+		{in: `R"x()" )")x"_s;`, out: `R"x()" )")x"_s`},
+		{in: "u8R\"(a\nb)\" c", out: "u8R\"(a\nb)\""},
+		{in: `LR"abc(unterminated`, out: `LR"abc(unterminated`},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, CppLexerInfo, test.in)
+		if got[0] != (clrcore.Lexeme{Type: clrcore.CodeStringRaw, Str: test.out}) {
+			t.Errorf("got %s, expected %s for %q", got[0], test.out, test.in)
+		}
+	}
+	// the delimiter may not contain a space, and the C lexer has no raw strings
+	for _, test := range []struct {
+		info *clrcore.LexerInfo
+		in   string
+	}{
+		{info: CppLexerInfo, in: `R"a b(x)a b"`},
+		{info: CppLexerInfo, in: `R"12345678901234567(x)12345678901234567"`},
+		{info: CLexerInfo, in: `R"(x)"`},
+	} {
+		got, _ := lexertest.LexAll(t, test.info, test.in)
+		if got[0] != (clrcore.Lexeme{Type: clrcore.CodeIdentifier, Str: "R"}) {
+			t.Errorf("got %s, expected identifier R for %q", got[0], test.in)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *clrcore.LexemeType
+	}{
+		{in: "0", out: clrcore.CodeNumberInteger},
+		{in: "1'000'000", out: clrcore.CodeNumberInteger},
+		{in: "42ULL", out: clrcore.CodeNumberInteger},
+		{in: "12_km", out: clrcore.CodeNumberInteger},
+		{in: "0x7fff'ffffL", out: clrcore.CodeNumberHexadecimal},
+		{in: "0777", out: clrcore.CodeNumberOctal},
+		{in: "0b1010'0101u", out: clrcore.CodeNumberBinary},
+		{in: "1.", out: clrcore.CodeNumberDecimal},
+		{in: ".5e-3f", out: clrcore.CodeNumberDecimal},
+		{in: "1e10L", out: clrcore.CodeNumberDecimal},
+		{in: "0x1.8p+3", out: clrcore.CodeNumberDecimal},
+		{in: "2.5_deg", out: clrcore.CodeNumberDecimal},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, CppLexerInfo, test.in)
+		if got[0] != (clrcore.Lexeme{Type: test.out, Str: test.in}) || !got[1].IsA(clrcore.Stop) {
+			t.Errorf("got %v, expected %s for %q", got, test.out, test.in)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		info *clrcore.LexerInfo
+		in   string
+		out  clrcore.Lexeme
+	}{
+		{info: CLexerInfo, in: `"a\"b"`, out: clrcore.Lexeme{Type: clrcore.CodeStringDouble, Str: `"a\"b"`}},
+		{info: CLexerInfo, in: `L'\''`, out: clrcore.Lexeme{Type: clrcore.CodeStringSingle, Str: `L'\''`}},
+		{info: CLexerInfo, in: `"%"PRId64`, out: clrcore.Lexeme{Type: clrcore.CodeStringDouble, Str: `"%"`}},
+		{info: CppLexerInfo, in: `u8"a"sv`, out: clrcore.Lexeme{Type: clrcore.CodeStringDouble, Str: `u8"a"sv`}},
+		{info: CppLexerInfo, in: `'c'_ch`, out: clrcore.Lexeme{Type: clrcore.CodeStringSingle, Str: `'c'_ch`}},
+		{info: ObjCLexerInfo, in: `@"a\"b"`, out: clrcore.Lexeme{Type: clrcore.CodeStringDouble, Str: `@"a\"b"`}},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, test.info, test.in)
+		if got[0] != test.out {
+			t.Errorf("got %s, expected %s for %q", got[0], test.out, test.in)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	text := "template<class T> std::vector<std::pair<int, T>> v = make<T>(a < b, c > d);"
+	checkLexemes(t, CppLexerInfo, text, []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifierKeyword, Str: "template"},
+		{Type: clrcore.CodeDelimiter, Str: "<"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "class"},
+		{Type: clrcore.CodeIdentifierClass, Str: "T"},
+		{Type: clrcore.CodeDelimiter, Str: ">"},
+		{Type: clrcore.CodeIdentifierNamespace, Str: "std"},
+		{Type: clrcore.CodeOperator, Str: "::"},
+		{Type: clrcore.CodeIdentifierType, Str: "vector"},
+		{Type: clrcore.CodeDelimiter, Str: "<"},
+		{Type: clrcore.CodeIdentifierNamespace, Str: "std"},
+		{Type: clrcore.CodeOperator, Str: "::"},
+		{Type: clrcore.CodeIdentifierType, Str: "pair"},
+		{Type: clrcore.CodeDelimiter, Str: "<"},
+		{Type: clrcore.CodeIdentifierType, Str: "int"},
+		{Type: clrcore.CodePunctuation, Str: ","},
+		{Type: clrcore.CodeIdentifier, Str: "T"},
+		{Type: clrcore.CodeDelimiter, Str: ">"},
+		{Type: clrcore.CodeDelimiter, Str: ">"},
+		{Type: clrcore.CodeIdentifier, Str: "v"},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.CodeIdentifierFunction, Str: "make"},
+		{Type: clrcore.CodeDelimiter, Str: "<"},
+		{Type: clrcore.CodeIdentifier, Str: "T"},
+		{Type: clrcore.CodeDelimiter, Str: ">"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeIdentifier, Str: "a"},
+		{Type: clrcore.CodeOperator, Str: "<"},
+		{Type: clrcore.CodeIdentifier, Str: "b"},
+		{Type: clrcore.CodePunctuation, Str: ","},
+		{Type: clrcore.CodeIdentifier, Str: "c"},
+		{Type: clrcore.CodeOperator, Str: ">"},
+		{Type: clrcore.CodeIdentifier, Str: "d"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.CodePunctuation, Str: ";"},
+	})
+}
+
+func TestTemplateArgsEnd(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int
+	}{
+		{in: "int>", out: 3},
+		{in: "std::pair<int, T*>> v", out: 18},
+		{in: "void(int&)>", out: 10},
+		{in: "b && c>d", out: -1},
+		{in: "n; i++) {}", out: -1},
+		{in: "b) > c", out: -1},
+		{in: "b - c>", out: -1},
+		{in: "int", out: -1},
+	}
+	for _, test := range tests {
+		if out := templateArgsEnd(test.in); out != test.out {
+			t.Errorf("got %d, expected %d for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	text := "[[gnu::always_inline, deprecated(\"x\")]] struct S s;"
+	expect := []clrcore.Lexeme{
+		{Type: clrcore.CodeDelimiter, Str: "[["},
+		{Type: clrcore.CodeIdentifierFunction, Str: "gnu::always_inline"},
+		{Type: clrcore.CodePunctuation, Str: ","},
+		{Type: clrcore.CodeIdentifierFunction, Str: "deprecated"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeStringDouble, Str: "\"x\""},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.CodeDelimiter, Str: "]]"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "struct"},
+		{Type: clrcore.CodeIdentifierClass, Str: "S"},
+		{Type: clrcore.CodeIdentifier, Str: "s"},
+		{Type: clrcore.CodePunctuation, Str: ";"},
+	}
+	checkLexemes(t, CLexerInfo, text, expect)
+	checkLexemes(t, CppLexerInfo, text, expect)
+	// [[ is a nested message in Objective-C
+	checkLexemes(t, ObjCLexerInfo, "[[A new] init]", []clrcore.Lexeme{
+		{Type: clrcore.CodeDelimiter, Str: "["},
+		{Type: clrcore.CodeDelimiter, Str: "["},
+		{Type: clrcore.CodeIdentifier, Str: "A"},
+		{Type: clrcore.CodeIdentifier, Str: "new"},
+		{Type: clrcore.CodeDelimiter, Str: "]"},
+		{Type: clrcore.CodeIdentifier, Str: "init"},
+		{Type: clrcore.CodeDelimiter, Str: "]"},
+	})
+}
+
+func TestObjC(t *testing.T) {
+	text := "@interface A : NSObject\n@property id<P> p;\n@end\nx = @[@1, @YES];"
+	checkLexemes(t, ObjCLexerInfo, text, []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifierKeyword, Str: "@interface"},
+		{Type: clrcore.CodeIdentifierClass, Str: "A"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeIdentifier, Str: "NSObject"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "@property"},
+		{Type: clrcore.CodeIdentifierType, Str: "id"},
+		{Type: clrcore.CodeDelimiter, Str: "<"},
+		{Type: clrcore.CodeIdentifier, Str: "P"},
+		{Type: clrcore.CodeDelimiter, Str: ">"},
+		{Type: clrcore.CodeIdentifier, Str: "p"},
+		{Type: clrcore.CodePunctuation, Str: ";"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "@end"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.CodeOperator, Str: "@"},
+		{Type: clrcore.CodeDelimiter, Str: "["},
+		{Type: clrcore.CodeOperator, Str: "@"},
+		{Type: clrcore.CodeNumberInteger, Str: "1"},
+		{Type: clrcore.CodePunctuation, Str: ","},
+		{Type: clrcore.CodeOperator, Str: "@"},
+		{Type: clrcore.CodeIdentifierLiteral, Str: "YES"},
+		{Type: clrcore.CodeDelimiter, Str: "]"},
+		{Type: clrcore.CodePunctuation, Str: ";"},
+	})
+}
+
+func TestScore(t *testing.T) {
+	headers := []struct {
+		text string
+		info *clrcore.LexerInfo
+	}{
+		{text: "#include <stdio.h>\nstruct list { struct list *next; };\nint len(struct list *l);\n", info: CLexerInfo},
+		{text: "#include <string>\nnamespace app {\nclass Name { std::string s; };\n}\n", info: CppLexerInfo},
+		{text: "#import <Foundation/Foundation.h>\n@interface Name : NSObject\n@end\n", info: ObjCLexerInfo},
+	}
+	infos := []*clrcore.LexerInfo{CLexerInfo, CppLexerInfo, ObjCLexerInfo}
+	for _, header := range headers {
+		if info := clrcore.LexerByScore(header.text, infos); info != header.info {
+			t.Errorf("got lexer '%s', expected '%s' for %q", info.Names[0], header.info.Names[0], header.text)
+		}
+		candidates := clrcore.DetectLexer("name.h", "", header.text)
+		if len(candidates) == 0 || candidates[0].Info != header.info {
+			t.Errorf("lexer '%s' not detected for %q", header.info.Names[0], header.text)
+		}
+	}
+}
+
+func TestAnalyseText(t *testing.T) {
+	tests := []struct {
+		analyse func(string) float64
+		in      string
+		out     float64
+	}{
+		{analyse: analyseText, in: "#include <stdio.h>\n\nint main(void)\n{\n}\n", out: 0.3},
+		{analyse: analyseText, in: "#ifndef A_H\n#define A_H\n#endif\n", out: 0.1},
+		{analyse: analyseText, in: "import os\n", out: 0},
+		{analyse: analyseCppText, in: "#include <vector>\nusing namespace std;\n", out: 0.6},
+		{analyse: analyseCppText, in: "#include <stdio.h>\n", out: 0.1},
+		{analyse: analyseCppText, in: "std::string s;\n", out: 0.2},
+		{analyse: analyseObjCText, in: "#import \"A.h\"\n@implementation A\n@end\n", out: 0.9},
+		{analyse: analyseObjCText, in: "#include <stdio.h>\n", out: 0.1},
+	}
+	for _, test := range tests {
+		if out := test.analyse(test.in); out < test.out-1e-9 || out > test.out+1e-9 {
+			t.Errorf("got %f, expected %f for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestReaderLexer(t *testing.T) {
+	text := strings.Repeat("#define A(x) \\\n  x\n/* a\n comment */ auto s = R\"d(raw\n)d\" + std::vector<int>{1'0};\n", 2000)
+	if err := lexertest.CheckReader(CppLexerInfo, text); err != nil {
+		t.Error(err)
+	}
+}
+
+// benchText return the input texts of the golden tests of the lexer.
+func benchText(tb testing.TB, def *clrcore.LexerDef) string {
+	text, err := lexertest.InputText(def.Name)
+	if err != nil {
+		tb.Fatalf("unexpected error: %s", err)
+	}
+	return text
+}
+
+func TestNoOptimize(t *testing.T) {
+	for _, def := range []*clrcore.LexerDef{cLexerDef, cppLexerDef, objcLexerDef} {
+		if err := lexertest.CheckNoOptimize(def, benchText(t, def)); err != nil {
+			t.Errorf("'%s': %s", def.Name, err)
+		}
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	for _, def := range []*clrcore.LexerDef{cLexerDef, cppLexerDef, objcLexerDef} {
+		def := def
+		text := benchText(b, def)
+		b.Run(def.Name, func(b *testing.B) {
+			lexertest.Benchmark(b, def, text)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Package golang provides a lexer for the Go programming language.
+// It is registered under the names "go" and "golang" when the package is imported.
+package golang
+
+import (
+	"io"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+// LexerInfo is the registered Go lexer information.
+var LexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"go", "golang"},
+	MimeTypes:      []string{"text/x-go", "application/x-go"},
+	FileNames:      []string{"*.go"},
+	AnalyseText:    analyseText,
+	NewLexer:       newLexer,
+	NewReaderLexer: newReaderLexer,
+}
+
+func init() {
+	clrcore.RegisterLexer(LexerInfo)
+}
+
+var (
+	packageClauseRe = regexp.MustCompile(`(?m)^package\s+[\pL_][\pL\pN_]*\s*(?://.*)?$`)
+	importDeclRe    = regexp.MustCompile(`(?m)^import\s+(?:\(|(?:[\pL_.][\pL\pN_]*\s+)?")`)
+	funcDeclRe      = regexp.MustCompile(`(?m)^func\s+(?:\([^)]*\)\s*)?[\pL_][\pL\pN_]*\s*[\[(]`)
+)
+
+// analyseText return the likelihood that text is Go source code by looking
+// for a package clause, import declarations and function declarations.
+func analyseText(text string) float64 {
+	var c float64
+	if packageClauseRe.MatchString(text) {
+		c += 0.5
+	}
+	if importDeclRe.MatchString(text) {
+		c += 0.2
+	}
+	if funcDeclRe.MatchString(text) {
+		c += 0.2
+	}
+	return c
+}
+
+func newLexer(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+	l, err := clrcore.NewLexerEngine(lexerDef, text, stopMarkers, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func newReaderLexer(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+	l, err := clrcore.NewReaderLexerEngine(lexerDef, r, 0, stopMarkers, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+var keywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true,
+	"defer": true, "else": true, "fallthrough": true, "for": true, "func": true, "go": true,
+	"goto": true, "if": true, "import": true, "interface": true, "map": true, "package": true,
+	"range": true, "return": true, "select": true, "struct": true, "switch": true, "type": true,
+	"var": true,
+}
+
+var predeclaredTypes = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true,
+	"complex128": true, "error": true, "float32": true, "float64": true, "int": true,
+	"int8": true, "int16": true, "int32": true, "int64": true, "rune": true, "string": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+}
+
+var predeclaredConstants = map[string]bool{
+	"true": true, "false": true, "iota": true, "nil": true,
+}
+
+var predeclaredFunctions = map[string]bool{
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true, "min": true,
+	"new": true, "panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
+
+// popIdentifier classifies the matched identifier as keyword, predeclared
+// identifier, function call or plain identifier.
+func popIdentifier(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()
+	word := text[:match[1]]
+	t := clrcore.CodeIdentifier
+	switch {
+	case keywords[word]:
+		t = clrcore.CodeIdentifierKeyword
+	case predeclaredTypes[word]:
+		t = clrcore.CodeIdentifierType
+	case predeclaredConstants[word]:
+		t = clrcore.CodeIdentifierLiteral
+	case predeclaredFunctions[word], isCall(text[match[1]:]):
+		t = clrcore.CodeIdentifierFunction
+	}
+	l.PopLexeme(t, match[1])
+	return true
+}
+
+// isCall return true if str starts with an opening parenthesis, optionally
+// preceded by white spaces.
+func isCall(str string) bool {
+	for len(str) > 0 {
+		r, n := utf8.DecodeRuneInString(str)
+		if r == '(' {
+			return true
+		}
+		if r == '\n' || !unicode.IsSpace(r) {
+			return false
+		}
+		str = str[n:]
+	}
+	return false
+}
+
+// Regular expressions of the Go lexemes.
+const (
+	identRe     = `[_\pL][_\pL\p{Nd}]*`
+	decDigitsRe = `[0-9](?:_?[0-9])*`
+	hexDigitsRe = `[0-9a-fA-F](?:_?[0-9a-fA-F])*`
+	decExpRe    = `[eE][+-]?` + decDigitsRe
+	hexFloatRe  = `0[xX](?:_?` + hexDigitsRe + `(?:\.(?:` + hexDigitsRe + `)?)?|\.` + hexDigitsRe + `)[pP][+-]?` + decDigitsRe + `i?`
+	decFloatRe  = `(?:` + decDigitsRe + `\.(?:` + decDigitsRe + `)?(?:` + decExpRe + `)?|` + decDigitsRe + decExpRe + `|\.` + decDigitsRe + `(?:` + decExpRe + `)?)i?`
+	hexIntRe    = `0[xX](?:_?[0-9a-fA-F])+i?`
+	octIntRe    = `0[oO](?:_?[0-7])+i?|0(?:_?[0-7])+`
+	binIntRe    = `0[bB](?:_?[01])+i?`
+	decImagRe   = `[0-9](?:_?[0-9])*i`
+	decIntRe    = `0|[1-9](?:_?[0-9])*`
+	runeRe      = `'(?:[^'\\\n]|\\(?:[abfnrtv\\'"]|[0-7]{3}|x[0-9a-fA-F]{2}|u[0-9a-fA-F]{4}|U[0-9a-fA-F]{8}))'`
+)
+
+var (
+	whiteSpaceRule = clrcore.WhiteSpaceRule
+	newLineRule    = clrcore.NewLineRule
+	commentRules   = []clrcore.LexerDefRule{
+		&clrcore.RegexDefRule{Re: `//[^\n]*`, Do: clrcore.PopMatch(clrcore.CodeComment)},
+		&clrcore.RegexDefRule{Re: `/\*(?s:.*?)(?:\*/|\z)`, Do: clrcore.PopMatch(clrcore.CodeComment)},
+	}
+	// tokenRules are the rules of all modes.
+	tokenRules = []clrcore.LexerDefRule{
+		&clrcore.RegexDefRule{Re: `(package)([ \t]+)(` + identRe + `)`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierNamespace), clrcore.ScoreAdd(10))},
+		&clrcore.RegexDefRule{Re: `(type)([ \t]+)(` + identRe + `)`,
+			Do: clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierType)},
+		&clrcore.RegexDefRule{Re: `(func)([ \t]+)(` + identRe + `)`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierFunction), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: `(func)([ \t]*)(\()`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeDelimiter), clrcore.PushMode("receiver"))},
+		&clrcore.RegexDefRule{Re: identRe, Do: popIdentifier},
+		&clrcore.RegexDefRule{Re: hexFloatRe, Do: clrcore.PopMatch(clrcore.CodeNumberDecimal)},
+		&clrcore.RegexDefRule{Re: decFloatRe, Do: clrcore.PopMatch(clrcore.CodeNumberDecimal)},
+		&clrcore.RegexDefRule{Re: hexIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberHexadecimal)},
+		&clrcore.RegexDefRule{Re: decImagRe, Do: clrcore.PopMatch(clrcore.CodeNumberInteger)},
+		&clrcore.RegexDefRule{Re: octIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberOctal)},
+		&clrcore.RegexDefRule{Re: binIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberBinary)},
+		&clrcore.RegexDefRule{Re: decIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberInteger)},
+		&clrcore.RegexDefRule{Re: `"(?:[^"\\\n]|\\.)*"?`, Do: clrcore.PopMatch(clrcore.CodeStringDouble)},
+		&clrcore.RegexDefRule{Re: "`[^`]*`?", Do: clrcore.PopMatch(clrcore.CodeStringRaw)},
+		&clrcore.RegexDefRule{Re: runeRe, Do: clrcore.PopMatch(clrcore.CodeStringSingle)},
+		&clrcore.RegexDefRule{Re: `:=`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeOperatorAssignment), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: `<<=|>>=|&\^=|[-+*/%&|^]=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+		&clrcore.RegexDefRule{Re: `&&|\|\||==|!=|<=|>=|<-`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `<<|>>|&\^|[&|^~]`, Do: clrcore.PopMatch(clrcore.CodeOperatorBinary)},
+		&clrcore.RegexDefRule{Re: `\+\+|--|[-+*/%]`, Do: clrcore.PopMatch(clrcore.CodeOperatorArithmetic)},
+		&clrcore.RegexDefRule{Re: `!`, Do: clrcore.PopMatch(clrcore.CodeOperatorLogical)},
+		&clrcore.RegexDefRule{Re: `[<>]`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+		&clrcore.RegexDefRule{Re: `\.\.\.|[.,;:]`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+		clrcore.DelimiterRule,
+	}
+)
+
+// rules return the concatenation of the rule lists.
+func rules(lists ...[]clrcore.LexerDefRule) []clrcore.LexerDefRule {
+	var res []clrcore.LexerDefRule
+	for _, list := range lists {
+		res = append(res, list...)
+	}
+	return res
+}
+
+var lexerDef = &clrcore.LexerDef{
+	Name:     "go",
+	Recovery: clrcore.RecoverRune,
+	InitFunc: func(d *clrcore.LexerDef) {
+		d.Modes = []*clrcore.LexerDefMode{
+			{Name: "root", Rules: rules(
+				[]clrcore.LexerDefRule{whiteSpaceRule, newLineRule},
+				commentRules,
+				tokenRules,
+			)},
+			// receiver is the parameter list following func. It is a method receiver
+			// when followed by an identifier and (.
+			{Name: "receiver", Rules: rules(
+				[]clrcore.LexerDefRule{
+					&clrcore.RegexDefRule{Re: `\)`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter),
+						clrcore.PopMode(), clrcore.PushMode("method"))},
+					whiteSpaceRule, newLineRule,
+				},
+				commentRules,
+				tokenRules,
+			)},
+			{Name: "method", Rules: []clrcore.LexerDefRule{
+				&clrcore.RegexDefRule{Re: `([ \t]*)(` + identRe + `)([ \t]*)(\()`,
+					Do: clrcore.All(clrcore.PopMatch(clrcore.TextWhiteSpace, clrcore.CodeIdentifierMethod,
+						clrcore.TextWhiteSpace, clrcore.CodeDelimiter), clrcore.PopMode(), clrcore.ScoreAdd(1))},
+				&clrcore.RegexDefRule{Re: ``, Do: clrcore.PopMode()},
+			}},
+		}
+	},
+}
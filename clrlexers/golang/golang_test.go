@@ -0,0 +1,253 @@
+package golang
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+	"github.com/chmike/clrz/clrcore/lexertest"
+)
+
+func TestRegistered(t *testing.T) {
+	for _, name := range []string{"go", "golang"} {
+		if clrcore.LexerByName(name) != LexerInfo {
+			t.Errorf("lexer not registered with name %q", name)
+		}
+	}
+	if l := clrcore.LexersByMimeType("text/x-go"); len(l) != 1 || l[0] != LexerInfo {
+		t.Errorf("lexer not registered with mime type %q", "text/x-go")
+	}
+	if l := clrcore.LexersByFileName("main.go"); len(l) != 1 || l[0] != LexerInfo {
+		t.Errorf("lexer not registered with file name %q", "*.go")
+	}
+}
+
+func TestGolden(t *testing.T) {
+	lexertest.Run(t, LexerInfo)
+}
+
+func FuzzLexer(f *testing.F) {
+	lexertest.Fuzz(f, LexerInfo)
+}
+
+func TestLexemes(t *testing.T) {
+	text := "package main\n\n// Hello\nfunc (r *T) Name(x int) bool {\n\treturn len(r.s) != 0 && true\n}\n"
+	expect := []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifierKeyword, Str: "package"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierNamespace, Str: "main"},
+		{Type: clrcore.TextNewLine, Str: "\n\n"},
+		{Type: clrcore.CodeComment, Str: "// Hello"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "func"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeIdentifier, Str: "r"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeOperatorArithmetic, Str: "*"},
+		{Type: clrcore.CodeIdentifier, Str: "T"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierMethod, Str: "Name"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierType, Str: "int"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierType, Str: "bool"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.TextWhiteSpace, Str: "\t"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "return"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierFunction, Str: "len"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeIdentifier, Str: "r"},
+		{Type: clrcore.CodePunctuation, Str: "."},
+		{Type: clrcore.CodeIdentifier, Str: "s"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeOperator, Str: "!="},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeNumberInteger, Str: "0"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeOperator, Str: "&&"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierLiteral, Str: "true"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.StopEndOfString, Str: ""},
+	}
+	got, l := lexertest.LexAll(t, LexerInfo, text)
+	if len(got) != len(expect) {
+		t.Fatalf("got %d lexemes, expected %d: %v", len(got), len(expect), got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("%d. got %s, expected %s", i, got[i], expect[i])
+		}
+	}
+	if l.Score() < 10 {
+		t.Errorf("got score %d, expected at least %d", l.Score(), 10)
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *clrcore.LexemeType
+	}{
+		{"42", clrcore.CodeNumberInteger},
+		{"4_2", clrcore.CodeNumberInteger},
+		{"0", clrcore.CodeNumberInteger},
+		{"0600", clrcore.CodeNumberOctal},
+		{"0_600", clrcore.CodeNumberOctal},
+		{"0o600", clrcore.CodeNumberOctal},
+		{"0O600", clrcore.CodeNumberOctal},
+		{"0b1011", clrcore.CodeNumberBinary},
+		{"0B_1_0", clrcore.CodeNumberBinary},
+		{"0xBadFace", clrcore.CodeNumberHexadecimal},
+		{"0x_67_7a_2f", clrcore.CodeNumberHexadecimal},
+		{"170141183460469231731687303715884105727", clrcore.CodeNumberInteger},
+		{"0.", clrcore.CodeNumberDecimal},
+		{"72.40", clrcore.CodeNumberDecimal},
+		{"072.40", clrcore.CodeNumberDecimal},
+		{"2.71828", clrcore.CodeNumberDecimal},
+		{"1.e+0", clrcore.CodeNumberDecimal},
+		{"6.67428e-11", clrcore.CodeNumberDecimal},
+		{"1E6", clrcore.CodeNumberDecimal},
+		{".25", clrcore.CodeNumberDecimal},
+		{".12345E+5", clrcore.CodeNumberDecimal},
+		{"1_5.", clrcore.CodeNumberDecimal},
+		{"0.15e+0_2", clrcore.CodeNumberDecimal},
+		{"0x1p-2", clrcore.CodeNumberDecimal},
+		{"0x2.p10", clrcore.CodeNumberDecimal},
+		{"0x1.Fp+0", clrcore.CodeNumberDecimal},
+		{"0X.8p-0", clrcore.CodeNumberDecimal},
+		{"0X_1FFFP-16", clrcore.CodeNumberDecimal},
+		{"0i", clrcore.CodeNumberInteger},
+		{"0123i", clrcore.CodeNumberInteger},
+		{"0o123i", clrcore.CodeNumberOctal},
+		{"0xabci", clrcore.CodeNumberHexadecimal},
+		{"2.71828i", clrcore.CodeNumberDecimal},
+		{"1.e+0i", clrcore.CodeNumberDecimal},
+		{"0x1p-2i", clrcore.CodeNumberDecimal},
+		{"'a'", clrcore.CodeStringSingle},
+		{"'ä'", clrcore.CodeStringSingle},
+		{`'\t'`, clrcore.CodeStringSingle},
+		{`'\000'`, clrcore.CodeStringSingle},
+		{`'\x07'`, clrcore.CodeStringSingle},
+		{`'ዤ'`, clrcore.CodeStringSingle},
+		{`'\U00101234'`, clrcore.CodeStringSingle},
+		{`"abc"`, clrcore.CodeStringDouble},
+		{`"a\"b\\"`, clrcore.CodeStringDouble},
+		{"`a\\b\n\"c`", clrcore.CodeStringRaw},
+		{"/* a\n b */", clrcore.CodeComment},
+		{"// a b", clrcore.CodeComment},
+		{"byte", clrcore.CodeIdentifierType},
+		{"uintptr", clrcore.CodeIdentifierType},
+		{"iota", clrcore.CodeIdentifierLiteral},
+		{"nil", clrcore.CodeIdentifierLiteral},
+		{"append", clrcore.CodeIdentifierFunction},
+		{"recover", clrcore.CodeIdentifierFunction},
+		{"fallthrough", clrcore.CodeIdentifierKeyword},
+		{"αβ", clrcore.CodeIdentifier},
+		{"x٣", clrcore.CodeIdentifier},
+		{"&^=", clrcore.CodeOperatorAssignment},
+		{"<-", clrcore.CodeOperator},
+		{"&^", clrcore.CodeOperatorBinary},
+		{"...", clrcore.CodePunctuation},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, LexerInfo, test.in)
+		if len(got) != 2 || got[0] != (clrcore.Lexeme{Type: test.out, Str: test.in}) || got[1].Type != clrcore.StopEndOfString {
+			t.Errorf("got %v, expected [%s] %q", got, test.out, test.in)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	goInfo := clrcore.LexerByScore("// Package x\npackage x\n", []*clrcore.LexerInfo{LexerInfo})
+	if goInfo != LexerInfo {
+		t.Errorf("Go lexer not selected by score")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	text := "x := a#b\n"
+	expect := []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeOperatorAssignment, Str: ":="},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifier, Str: "a"},
+		{Type: clrcore.TextInvalid, Str: "#"},
+		{Type: clrcore.CodeIdentifier, Str: "b"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.StopEndOfString, Str: ""},
+	}
+	got, l := lexertest.LexAll(t, LexerInfo, text)
+	if len(got) != len(expect) {
+		t.Fatalf("got %d lexemes, expected %d: %v", len(got), len(expect), got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("%d. got %s, expected %s", i, got[i], expect[i])
+		}
+	}
+	if l.Score() != 0 {
+		t.Errorf("got score %d, expected %d", l.Score(), 0)
+	}
+}
+
+func TestAnalyseText(t *testing.T) {
+	tests := []struct {
+		in  string
+		out float64
+	}{
+		{in: "package main\n\nimport \"fmt\"\n\nfunc main() {}\n", out: 0.9},
+		{in: "package x // comment\nimport (\n)\n", out: 0.7},
+		{in: "// Package x\npackage x\n\nfunc (r *T) F[T any]() {}\n", out: 0.7},
+		{in: "import os\n\ndef f():\n    pass\n", out: 0},
+		{in: "package com.example;\n", out: 0},
+	}
+	for _, test := range tests {
+		if out := analyseText(test.in); out < test.out-1e-9 || out > test.out+1e-9 {
+			t.Errorf("got %f, expected %f for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestReaderLexer(t *testing.T) {
+	text := strings.Repeat("package main\n\n/* comment\n*/\nfunc (r *T) Name(x int) { s := `a\nb` + \"c\"; return 0x1p-2 }\n", 2000)
+	if err := lexertest.CheckReader(LexerInfo, text); err != nil {
+		t.Error(err)
+	}
+}
+
+// benchText return the source of the Go lexer and its tests.
+func benchText(tb testing.TB) string {
+	var text []byte
+	for _, name := range []string{"golang.go", "golang_test.go"} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			tb.Fatalf("unexpected error: %s", err)
+		}
+		text = append(text, data...)
+	}
+	return string(text)
+}
+
+func TestNoOptimize(t *testing.T) {
+	if err := lexertest.CheckNoOptimize(lexerDef, benchText(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	lexertest.Benchmark(b, lexerDef, benchText(b))
+}
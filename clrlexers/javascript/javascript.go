@@ -0,0 +1,864 @@
+// Package javascript provides lexers for the JavaScript and TypeScript
+// programming languages, and for their JSX variants, which share the same
+// modes. They are registered under the names "javascript", "typescript", "jsx"
+// and "tsx" when the package is imported.
+//
+// A / starts a regular expression, and a < starts a JSX element, when the
+// previous significant lexeme can't end an operand. The TypeScript lexers lex
+// the type annotations in the type modes, and add to their score the constructs
+// specific to TypeScript. The JSX lexers add to their score the JSX elements.
+package javascript
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+// JavaScriptLexerInfo is the registered JavaScript lexer information.
+var JavaScriptLexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"javascript", "js"},
+	MimeTypes:      []string{"application/javascript", "text/javascript", "application/x-javascript", "text/x-javascript"},
+	FileNames:      []string{"*.js", "*.mjs", "*.cjs"},
+	Interpreters:   []string{"node", "nodejs"},
+	AnalyseText:    analyseText,
+	NewLexer:       newLexer(jsLexerDef),
+	NewReaderLexer: newReaderLexer(jsLexerDef),
+}
+
+// TypeScriptLexerInfo is the registered TypeScript lexer information.
+var TypeScriptLexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"typescript", "ts"},
+	MimeTypes:      []string{"application/typescript", "text/typescript", "application/x-typescript", "text/x-typescript"},
+	FileNames:      []string{"*.ts", "*.mts", "*.cts"},
+	Interpreters:   []string{"deno", "ts-node"},
+	AnalyseText:    analyseTSText,
+	NewLexer:       newLexer(tsLexerDef),
+	NewReaderLexer: newReaderLexer(tsLexerDef),
+}
+
+// JSXLexerInfo is the registered JSX lexer information.
+var JSXLexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"jsx", "react"},
+	MimeTypes:      []string{"text/jsx"},
+	FileNames:      []string{"*.jsx"},
+	AnalyseText:    analyseJSXText,
+	NewLexer:       newLexer(jsxLexerDef),
+	NewReaderLexer: newReaderLexer(jsxLexerDef),
+}
+
+// TSXLexerInfo is the registered TSX lexer information.
+var TSXLexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"tsx"},
+	MimeTypes:      []string{"text/tsx"},
+	FileNames:      []string{"*.tsx"},
+	AnalyseText:    analyseTSXText,
+	NewLexer:       newLexer(tsxLexerDef),
+	NewReaderLexer: newReaderLexer(tsxLexerDef),
+}
+
+func init() {
+	clrcore.RegisterLexer(JavaScriptLexerInfo)
+	clrcore.RegisterLexer(TypeScriptLexerInfo)
+	clrcore.RegisterLexer(JSXLexerInfo)
+	clrcore.RegisterLexer(TSXLexerInfo)
+}
+
+var (
+	importRe   = regexp.MustCompile(`(?m)^[ \t]*(?:import[ \t]+(?:[\pL_$][\pL\pN_$]*|\{[^}\n]*\}|\*[ \t]+as[ \t]+[\pL_$][\pL\pN_$]*)[ \t]*(?:,[^\n]*)?from[ \t]*['"]|(?:const|let|var)[ \t]+[^\n=]+=[ \t]*require[ \t]*\()`)
+	exportRe   = regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+(?:default|const|let|function|class|async)\b|module\.exports[ \t]*=)`)
+	functionRe = regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+(?:default[ \t]+)?)?(?:(?:async[ \t]+)?function\*?[ \t]+[\pL_$][\pL\pN_$]*[ \t]*\(|(?:const|let)[ \t]+[\pL_$][\pL\pN_$]*[ \t]*=[ \t]*(?:async[ \t]*)?\([^)\n]*\)[ \t]*=>)`)
+	tsDeclRe   = regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+)?(?:interface[ \t]+[\pL_$][\pL\pN_$]*[ \t<{]|type[ \t]+[\pL_$][\pL\pN_$]*[ \t<]*=|enum[ \t]+[\pL_$][\pL\pN_$]*[ \t]*\{)`)
+	tsTypeRe   = regexp.MustCompile(`[\pL\pN_$)?][ \t]*:[ \t]*(?:string|number|boolean|void|any|unknown|never)\b`)
+	jsxRe      = regexp.MustCompile(`(?:return|=>|=)[ \t]*\(?[ \t\n]*<(?:[\pL_$][\pL\pN_$.]*(?:[ \t\n/]|>)|>)`)
+)
+
+// analyseText return the likelihood that text is JavaScript source code by
+// looking for import statements or require calls, exports and function
+// definitions. The #! line is checked with the Interpreters of the lexer. The
+// TypeScript and JSX lexers add the constructs specific to their language.
+func analyseText(text string) float64 {
+	var c float64
+	if importRe.MatchString(text) {
+		c += 0.2
+	}
+	if exportRe.MatchString(text) {
+		c += 0.1
+	}
+	if functionRe.MatchString(text) {
+		c += 0.2
+	}
+	return c
+}
+
+// analyseTSText return the likelihood that text is TypeScript source code.
+func analyseTSText(text string) float64 {
+	c := analyseText(text)
+	if tsDeclRe.MatchString(text) {
+		c += 0.3
+	}
+	if tsTypeRe.MatchString(text) {
+		c += 0.2
+	}
+	return c
+}
+
+// analyseJSXText return the likelihood that text is JSX source code.
+func analyseJSXText(text string) float64 {
+	c := analyseText(text)
+	if jsxRe.MatchString(text) {
+		c += 0.3
+	}
+	return c
+}
+
+// analyseTSXText return the likelihood that text is TSX source code.
+func analyseTSXText(text string) float64 {
+	c := analyseTSText(text)
+	if jsxRe.MatchString(text) {
+		c += 0.3
+	}
+	return c
+}
+
+func newLexer(def *clrcore.LexerDef) func(string, ...string) (clrcore.Lexer, error) {
+	return func(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+		l, err := clrcore.NewLexerEngine(def, text, stopMarkers, nil)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+}
+
+func newReaderLexer(def *clrcore.LexerDef) func(io.Reader, ...string) (clrcore.Lexer, error) {
+	return func(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+		l, err := clrcore.NewReaderLexerEngine(def, r, 0, stopMarkers, nil)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+}
+
+// wordSet return the set of the words separated by spaces in the lists.
+func wordSet(lists ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, words := range lists {
+		for _, word := range strings.Fields(words) {
+			set[word] = true
+		}
+	}
+	return set
+}
+
+const (
+	jsKeywords = `as async await break case catch class const continue debugger default do
+		else export extends finally for function if import let of return static switch
+		throw try var while with yield`
+	jsOperators = `delete in instanceof new typeof void`
+	jsConstants = `Infinity NaN false null true undefined`
+	jsVariables = `arguments console document globalThis super this window`
+	jsClasses   = `AggregateError Array ArrayBuffer Atomics BigInt BigInt64Array BigUint64Array
+		Boolean DataView Date Error EvalError FinalizationRegistry Float32Array
+		Float64Array Function Int16Array Int32Array Int8Array Intl JSON Map Math Number
+		Object Promise Proxy RangeError ReferenceError Reflect RegExp Set SharedArrayBuffer
+		String Symbol SyntaxError TypeError URIError Uint16Array Uint32Array Uint8Array
+		Uint8ClampedArray WeakMap WeakRef WeakSet`
+	tsKeywords = `abstract accessor asserts declare enum implements infer interface is keyof
+		module namespace override private protected public readonly satisfies type unique`
+	tsTypes = `any bigint boolean never number object string symbol unknown`
+	// typeKeywords are the keywords of the type expressions.
+	typeKeywords = `abstract asserts const extends in infer is keyof new readonly typeof unique`
+	// blockKeywords are the keywords followed by a block, and not by an object.
+	blockKeywords = `class do else finally static try`
+)
+
+// A language holds the words and the features of a language of the
+// JavaScript family.
+type language struct {
+	keywords      map[string]bool
+	wordOperators map[string]bool
+	types         map[string]bool
+	constants     map[string]bool
+	variables     map[string]bool
+	classes       map[string]bool
+	declKeywords  string // keywords followed by a declared name
+	ts            bool   // type annotations, type arguments and TypeScript scoring
+	jsx           bool   // JSX elements
+}
+
+var (
+	jsLanguage = &language{
+		keywords:      wordSet(jsKeywords),
+		wordOperators: wordSet(jsOperators),
+		constants:     wordSet(jsConstants),
+		variables:     wordSet(jsVariables),
+		classes:       wordSet(jsClasses),
+		declKeywords:  `class`,
+	}
+	tsLanguage = &language{
+		keywords:      wordSet(jsKeywords, tsKeywords),
+		wordOperators: wordSet(jsOperators),
+		types:         wordSet(tsTypes),
+		constants:     wordSet(jsConstants),
+		variables:     wordSet(jsVariables),
+		classes:       wordSet(jsClasses),
+		declKeywords:  `class|interface|enum|namespace|module|type`,
+		ts:            true,
+	}
+	jsxLanguage = &language{
+		keywords:      jsLanguage.keywords,
+		wordOperators: jsLanguage.wordOperators,
+		constants:     jsLanguage.constants,
+		variables:     jsLanguage.variables,
+		classes:       jsLanguage.classes,
+		declKeywords:  jsLanguage.declKeywords,
+		jsx:           true,
+	}
+	tsxLanguage = &language{
+		keywords:      tsLanguage.keywords,
+		wordOperators: tsLanguage.wordOperators,
+		types:         tsLanguage.types,
+		constants:     tsLanguage.constants,
+		variables:     tsLanguage.variables,
+		classes:       tsLanguage.classes,
+		declKeywords:  tsLanguage.declKeywords,
+		ts:            true,
+		jsx:           true,
+	}
+	typeKeywordSet  = wordSet(typeKeywords)
+	blockKeywordSet = wordSet(blockKeywords)
+)
+
+// operandExpected return true when the last significant lexeme can't end an
+// operand, so that a / starts a regular expression, a < starts a JSX element
+// and a { starts an object. It is the case at the start of the text, after an
+// operator other than ++ and --, a punctuation, an opening delimiter, a closing
+// brace and a keyword.
+func operandExpected(l *clrcore.LexerEngine) bool {
+	last := l.LastLexeme()
+	switch {
+	case last.IsNil():
+		return true
+	case last.IsA(clrcore.CodeOperator):
+		return last.Str != "++" && last.Str != "--"
+	case last.IsA(clrcore.CodeDelimiter):
+		return last.Str != ")" && last.Str != "]" && last.Str != ">" && last.Str != "/>"
+	case last.IsA(clrcore.CodePunctuation), last.IsA(clrcore.CodeIdentifierKeyword),
+		last.IsA(clrcore.CodeIdentifierOperator), last.IsA(clrcore.TextInvalid):
+		return true
+	}
+	return false
+}
+
+// popIdentifier classifies the matched identifier as keyword, predefined
+// identifier, class, function or plain identifier. A property name, following
+// a dot, is never a keyword. In TypeScript, an identifier followed by type
+// arguments is a type, or a function when called, and the arguments are lexed
+// in the type-args mode.
+func (g *language) popIdentifier(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()
+	word := text[:match[1]]
+	rest := text[match[1]:]
+	last := l.LastLexeme()
+	t := clrcore.CodeIdentifier
+	switch {
+	case last.Str == "." || last.Str == "?.":
+	case g.wordOperators[word]:
+		t = clrcore.CodeIdentifierOperator
+	case g.keywords[word]:
+		t = clrcore.CodeIdentifierKeyword
+	case g.types[word]:
+		t = clrcore.CodeIdentifierType
+	case g.constants[word]:
+		t = clrcore.CodeIdentifierLiteral
+	case g.variables[word]:
+		t = clrcore.CodeIdentifierVariable
+	case g.classes[word]:
+		t = clrcore.CodeIdentifierClass
+	case last.Str == "new" || last.Str == "extends" || last.Str == "implements" || last.Str == "instanceof":
+		t = clrcore.CodeIdentifierClass
+	}
+	if t == clrcore.CodeIdentifierKeyword {
+		l.PopLexeme(t, match[1])
+		switch {
+		case word == "case", word == "default" && strings.HasPrefix(strings.TrimLeft(rest, " \t"), ":"):
+			// the colon ending the case clause is not a type annotation
+			l.PushMode("conditional")
+		case g.ts && (word == "as" || word == "satisfies"):
+			l.PushMode("type")
+		}
+		return true
+	}
+	if g.ts && strings.HasPrefix(rest, "<") {
+		if end := typeArgsEnd(rest[1:]); end >= 0 {
+			if t == clrcore.CodeIdentifier {
+				t = clrcore.CodeIdentifierType
+				if isCall(rest[1+end+1:]) {
+					t = clrcore.CodeIdentifierFunction
+				}
+			}
+			l.PopLexeme(t, match[1])
+			l.PopLexeme(clrcore.CodeDelimiter, 1)
+			l.PushMode("type-args")
+			return true
+		}
+	}
+	if t == clrcore.CodeIdentifier && (isCall(rest) || strings.HasPrefix(rest, "`")) {
+		t = clrcore.CodeIdentifierFunction
+	}
+	l.PopLexeme(t, match[1])
+	return true
+}
+
+// popDecl classifies the name following a class, interface, enum, namespace,
+// module or type keyword as a class, a namespace or a type. The TypeScript
+// declarations add 10 to the score, and the type parameters following the name
+// are lexed in the type-args mode. The type of a type alias is lexed in the
+// type-alias mode.
+func (g *language) popDecl(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()
+	keyword, name := text[match[2]:match[3]], text[match[6]:match[7]]
+	if g.keywords[name] || g.constants[name] || g.variables[name] {
+		l.PopLexeme(clrcore.CodeIdentifierKeyword, match[3])
+		return true
+	}
+	t := clrcore.CodeIdentifierClass
+	switch keyword {
+	case "namespace", "module":
+		t = clrcore.CodeIdentifierNamespace
+	case "type":
+		t = clrcore.CodeIdentifierType
+	}
+	if keyword != "class" {
+		clrcore.ScoreAdd(10)(l, match)
+	}
+	clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, t)(l, match)
+	if keyword == "type" {
+		l.PushMode("type-alias")
+	}
+	if rest := l.RemainingText(); g.ts && strings.HasPrefix(rest, "<") && typeArgsEnd(rest[1:]) >= 0 {
+		l.PopLexeme(clrcore.CodeDelimiter, 1)
+		l.PushMode("type-args")
+	}
+	return true
+}
+
+// popImport pops an import or export keyword. The specifiers of an import
+// statement, and of an export statement followed by a brace or a star, are
+// lexed in the import mode. A property name, following a dot, is an identifier
+// or a function when called.
+func popImport(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()
+	rest := strings.TrimLeft(text[match[1]:], " \t")
+	if last := l.LastLexeme(); last.Str == "." || last.Str == "?." {
+		t := clrcore.CodeIdentifier
+		if isCall(text[match[1]:]) {
+			t = clrcore.CodeIdentifierFunction
+		}
+		l.PopLexeme(t, match[1])
+		return true
+	}
+	l.PopLexeme(clrcore.CodeIdentifierKeyword, match[1])
+	if text[:match[1]] == "import" && rest != "" && rest[0] != '(' && rest[0] != '.' ||
+		strings.HasPrefix(rest, "{") || strings.HasPrefix(rest, "*") {
+		l.PushMode("import")
+	}
+	return true
+}
+
+// popRegex pops a regular expression literal and adds 1 to the score, or
+// doesn't match when the / is a division.
+func popRegex(l *clrcore.LexerEngine, match []int) bool {
+	if !operandExpected(l) {
+		return false
+	}
+	l.PopLexeme(clrcore.CodeStringRegex, match[1])
+	return clrcore.ScoreAdd(1)(l, match)
+}
+
+// popBrace pops an opening brace, and lexes its content in the object mode
+// when an operand is expected, or in the block mode otherwise.
+func popBrace(l *clrcore.LexerEngine, match []int) bool {
+	last := l.LastLexeme()
+	mode := "block"
+	if operandExpected(l) && last.Str != "=>" && !(last.IsA(clrcore.CodeIdentifierKeyword) && blockKeywordSet[last.Str]) {
+		mode = "object"
+	}
+	l.PopLexeme(clrcore.CodeDelimiter, 1)
+	l.PushMode(mode)
+	return true
+}
+
+// popQuestion pops a question mark. It is an optional marker when followed
+// by a closing delimiter, a comma, a semicolon, an assignment or, in
+// TypeScript, a type annotation lexed in the type mode. Otherwise, it starts a
+// conditional expression whose first operand is lexed in the conditional mode.
+func (g *language) popQuestion(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()[1:]
+	rest := strings.TrimLeft(text, " \t")
+	l.PopLexeme(clrcore.CodeOperator, 1)
+	switch {
+	case rest == "":
+	case rest[0] == ':':
+		if g.ts {
+			if n := len(text) - len(rest); n > 0 {
+				l.PopLexeme(clrcore.TextWhiteSpace, n)
+			}
+			l.PopLexeme(clrcore.CodePunctuation, 1)
+			l.PushMode("type")
+		}
+	case strings.IndexByte(")]},;", rest[0]) >= 0, rest[0] == '=' && !strings.HasPrefix(rest, "=="):
+	default:
+		l.PushMode("conditional")
+	}
+	return true
+}
+
+// popJSXElement pops the < starting a JSX element and its tag name, whose
+// attributes are lexed in the jsx-tag mode, or the <> starting a fragment,
+// whose children are lexed in the jsx-children mode, and adds 1 to the score.
+// In an expression, the rule doesn't match when an operand is not expected, or when the < starts
+// the type parameters of a generic arrow function in TSX.
+func popJSXElement(inExpr bool) clrcore.RegexDefRuleFunc {
+	return func(l *clrcore.LexerEngine, match []int) bool {
+		if inExpr && !operandExpected(l) {
+			return false
+		}
+		text := l.RemainingText()
+		if match[8] >= 0 {
+			l.PopLexeme(clrcore.CodeDelimiter, match[9])
+			l.PushMode("jsx-children")
+			return clrcore.ScoreAdd(1)(l, match)
+		}
+		rest := strings.TrimLeft(text[match[1]:], " \t")
+		if inExpr && (strings.HasPrefix(rest, ",") || strings.HasPrefix(rest, "extends ")) {
+			return false
+		}
+		clrcore.PopMatch(clrcore.CodeDelimiter, clrcore.TextWhiteSpace, tagType(text[match[6]:match[7]]), clrcore.CodeDelimiter)(l, match)
+		l.PushMode("jsx-tag")
+		return clrcore.ScoreAdd(1)(l, match)
+	}
+}
+
+// popJSXClose pops the closing tag of a JSX element or fragment, ending its
+// children, and adds 1 to the score.
+func popJSXClose(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()
+	t := clrcore.CodeIdentifierKeyword
+	if match[6] >= 0 {
+		t = tagType(text[match[6]:match[7]])
+	}
+	clrcore.PopMatch(clrcore.CodeDelimiter, clrcore.TextWhiteSpace, t, clrcore.TextWhiteSpace, clrcore.CodeDelimiter)(l, match)
+	l.PopMode()
+	return clrcore.ScoreAdd(1)(l, match)
+}
+
+// tagType return the lexeme type of a JSX tag name, a keyword for an intrinsic
+// element starting with a lower case letter, and a class for a component.
+func tagType(name string) *clrcore.LexemeType {
+	if r, _ := utf8.DecodeRuneInString(name); unicode.IsLower(r) && !strings.Contains(name, ".") {
+		return clrcore.CodeIdentifierKeyword
+	}
+	return clrcore.CodeIdentifierClass
+}
+
+// typeEnded return true when the last significant lexeme ends a type, so that
+// the type mode ends with a brace, a newline or an arrow. An arrow following a
+// closing parenthesis is the arrow of a function type.
+func typeEnded(l *clrcore.LexerEngine) bool {
+	last := l.LastLexeme()
+	switch {
+	case last.IsA(clrcore.CodeOperator), last.IsA(clrcore.CodePunctuation):
+		return false
+	case last.IsA(clrcore.CodeDelimiter):
+		return last.Str == ">" || last.Str == "]" || last.Str == "}"
+	case last.IsA(clrcore.CodeIdentifierKeyword):
+		return last.Str == "const"
+	}
+	return true
+}
+
+// popTypeEnd pops the mode when the type ended, or doesn't match otherwise.
+func popTypeEnd(l *clrcore.LexerEngine, match []int) bool {
+	if !typeEnded(l) {
+		return false
+	}
+	l.PopMode()
+	return true
+}
+
+// popTypeIdentifier classifies the matched identifier of a type as type
+// keyword, literal, type or, in an object type or a parameter list when names
+// is true, as property or parameter name followed by a colon. The type
+// arguments following the type are lexed in the type-args mode.
+func popTypeIdentifier(names bool) clrcore.RegexDefRuleFunc {
+	return func(l *clrcore.LexerEngine, match []int) bool {
+		text := l.RemainingText()
+		word := text[:match[1]]
+		rest := strings.TrimLeft(text[match[1]:], " \t")
+		t := clrcore.CodeIdentifierType
+		switch {
+		case typeKeywordSet[word]:
+			t = clrcore.CodeIdentifierKeyword
+		case word == "this":
+			t = clrcore.CodeIdentifierVariable
+		case word == "true" || word == "false" || word == "null" || word == "undefined":
+			t = clrcore.CodeIdentifierLiteral
+		case names && (strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, "?:") || strings.HasPrefix(rest, "?,") ||
+			strings.HasPrefix(rest, "?)") || strings.HasPrefix(rest, "?;")):
+			t = clrcore.CodeIdentifier
+		case names && isCall(rest):
+			t = clrcore.CodeIdentifierFunction
+		}
+		l.PopLexeme(t, match[1])
+		if strings.HasPrefix(text[match[1]:], "<") && typeArgsEnd(text[match[1]+1:]) >= 0 {
+			l.PopLexeme(clrcore.CodeDelimiter, 1)
+			l.PushMode("type-args")
+		}
+		return true
+	}
+}
+
+// maxTypeArgs is the maximum length of the type arguments recognized by
+// typeArgsEnd.
+const maxTypeArgs = 256
+
+// typeArgsEnd return the index of the > closing the type arguments at the
+// start of str, or -1 if str doesn't start with type arguments. The arguments
+// may only contain identifiers, numbers, white spaces, nested type arguments,
+// brackets and parenthesis, and the characters ,.|&?=$ of the types.
+func typeArgsEnd(str string) int {
+	var angles, parens int
+	for i := 0; i < len(str) && i < maxTypeArgs; i++ {
+		c := str[i]
+		switch {
+		case c == '>':
+			if angles == 0 {
+				if parens != 0 {
+					return -1
+				}
+				return i
+			}
+			angles--
+		case c == '<':
+			angles++
+		case c == '(' || c == '[':
+			parens++
+		case c == ')' || c == ']':
+			if parens == 0 {
+				return -1
+			}
+			parens--
+		case c == '&' || c == '|':
+			if i+1 < len(str) && str[i+1] == c {
+				return -1
+			}
+		case c == '=':
+			// default type
+			if i+1 < len(str) && (str[i+1] == '=' || str[i+1] == '>') {
+				return -1
+			}
+		case c == '_', c == '$', c == ' ', c == '\t', c == ',', c == '.', c == '?',
+			c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= utf8.RuneSelf:
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// isCall return true if str starts with an opening parenthesis, optionally
+// preceded by white spaces.
+func isCall(str string) bool {
+	for len(str) > 0 {
+		r, n := utf8.DecodeRuneInString(str)
+		if r == '(' {
+			return true
+		}
+		if r == '\n' || !unicode.IsSpace(r) {
+			return false
+		}
+		str = str[n:]
+	}
+	return false
+}
+
+// Regular expressions of the JavaScript family lexemes.
+const (
+	identRe   = `[\pL_$][\pL\p{Nd}_$]*`
+	digitsRe  = `[0-9](?:_?[0-9])*`
+	expRe     = `[eE][+-]?` + digitsRe
+	floatRe   = `(?:` + digitsRe + `\.(?:` + digitsRe + `)?(?:` + expRe + `)?|` + digitsRe + expRe + `|\.` + digitsRe + `(?:` + expRe + `)?)`
+	hexIntRe  = `0[xX][0-9a-fA-F](?:_?[0-9a-fA-F])*n?`
+	octIntRe  = `0[oO][0-7](?:_?[0-7])*n?|0[0-7]+`
+	binIntRe  = `0[bB][01](?:_?[01])*n?`
+	intRe     = `(?:0|[1-9](?:_?[0-9])*)n?`
+	stringRe  = `"(?:[^"\\\n]|\\(?s:.))*"?`
+	charRe    = `'(?:[^'\\\n]|\\(?s:.))*'?`
+	regexRe   = `/(?:[^/\\\[\n]|\\.|\[(?:[^\]\\\n]|\\.)*\])+/[a-z]*`
+	jsxNameRe = `[\pL_$][\pL\p{Nd}_$-]*(?:[.:][\pL_$][\pL\p{Nd}_$-]*)*`
+	// jsxOpenRe is the start of a JSX element with its tag name, or of a
+	// fragment.
+	jsxOpenRe = `(<)(?:([ \t]*)(` + jsxNameRe + `)|(>))`
+)
+
+var (
+	whiteSpaceRule = clrcore.WhiteSpaceRule
+	newLineRule    = clrcore.NewLineRule
+	commentRules   = []clrcore.LexerDefRule{
+		&clrcore.RegexDefRule{Re: `//[^\n]*`, Do: clrcore.PopMatch(clrcore.CodeComment)},
+		&clrcore.RegexDefRule{Re: `/\*(?s:.*?)(?:\*/|\z)`, Do: clrcore.PopMatch(clrcore.CodeComment)},
+	}
+	literalRules = []clrcore.LexerDefRule{
+		&clrcore.RegexDefRule{Re: stringRe, Do: clrcore.PopMatch(clrcore.CodeStringDouble)},
+		&clrcore.RegexDefRule{Re: charRe, Do: clrcore.PopMatch(clrcore.CodeStringSingle)},
+		&clrcore.RegexDefRule{Re: "`", Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringRaw), clrcore.PushMode("template"))},
+		&clrcore.RegexDefRule{Re: floatRe, Do: clrcore.PopMatch(clrcore.CodeNumberDecimal)},
+		&clrcore.RegexDefRule{Re: hexIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberHexadecimal)},
+		&clrcore.RegexDefRule{Re: binIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberBinary)},
+		&clrcore.RegexDefRule{Re: octIntRe, Do: clrcore.PopMatch(clrcore.CodeNumberOctal)},
+		&clrcore.RegexDefRule{Re: intRe, Do: clrcore.PopMatch(clrcore.CodeNumberInteger)},
+	}
+	// closeBraceRule ends the mode of the content of braces.
+	closeBraceRule = &clrcore.RegexDefRule{Re: `\}`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())}
+)
+
+// tokenRules return the rules of the tokens of the language.
+func (g *language) tokenRules() []clrcore.LexerDefRule {
+	var rules []clrcore.LexerDefRule
+	if g.jsx {
+		rules = append(rules, &clrcore.RegexDefRule{Re: jsxOpenRe, Do: popJSXElement(true)})
+	}
+	if g.ts {
+		// type parameters of a generic arrow function, or a type assertion
+		rules = append(rules, &clrcore.RegexDefRule{Re: `<`, Do: func(l *clrcore.LexerEngine, match []int) bool {
+			if !operandExpected(l) || typeArgsEnd(l.RemainingText()[1:]) < 0 {
+				return false
+			}
+			l.PopLexeme(clrcore.CodeDelimiter, 1)
+			l.PushMode("type-args")
+			return clrcore.ScoreAdd(1)(l, match)
+		}})
+	}
+	return append(rules,
+		&clrcore.RegexDefRule{Re: `(` + g.declKeywords + `)([ \t]+)(` + identRe + `)`, Do: g.popDecl},
+		&clrcore.RegexDefRule{Re: `(?:import|export)\b`, Do: popImport},
+		&clrcore.RegexDefRule{Re: `@` + identRe + `(?:\.` + identRe + `)*`, Do: clrcore.PopMatch(clrcore.CodeIdentifierFunction)},
+		&clrcore.RegexDefRule{Re: `#` + identRe, Do: clrcore.PopMatch(clrcore.CodeIdentifierVariable)},
+		&clrcore.RegexDefRule{Re: identRe, Do: g.popIdentifier},
+		&clrcore.RegexDefRule{Re: regexRe, Do: popRegex},
+	)
+}
+
+// operatorRules are the rules of the operators and the punctuations, following
+// the token rules.
+func (g *language) operatorRules() []clrcore.LexerDefRule {
+	return []clrcore.LexerDefRule{
+		&clrcore.RegexDefRule{Re: `\{`, Do: popBrace},
+		&clrcore.RegexDefRule{Re: `=>`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeOperator), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: `>>>=|<<=|>>=|\*\*=|&&=|\|\|=|\?\?=|[-+*/%&|^]=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+		&clrcore.RegexDefRule{Re: `===|!==`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeOperator), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: `&&|\|\||\?\?|==|!=|<=|>=|\?\.`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `>>>|<<|>>|[&|^~]`, Do: clrcore.PopMatch(clrcore.CodeOperatorBinary)},
+		&clrcore.RegexDefRule{Re: `\*\*|\+\+|--|[-+*/%]`, Do: clrcore.PopMatch(clrcore.CodeOperatorArithmetic)},
+		&clrcore.RegexDefRule{Re: `!`, Do: clrcore.PopMatch(clrcore.CodeOperatorLogical)},
+		&clrcore.RegexDefRule{Re: `\?`, Do: g.popQuestion},
+		&clrcore.RegexDefRule{Re: `[<>]`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+		&clrcore.RegexDefRule{Re: `\.\.\.|[.,;]`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+	}
+}
+
+// colonRule return the rule of a colon outside of an object and of a
+// conditional expression. In TypeScript, it starts a type annotation lexed in
+// the type mode.
+func (g *language) colonRule() clrcore.LexerDefRule {
+	if g.ts {
+		return &clrcore.RegexDefRule{Re: `:`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodePunctuation), clrcore.PushMode("type"), clrcore.ScoreAdd(1))}
+	}
+	return &clrcore.RegexDefRule{Re: `:`, Do: clrcore.PopMatch(clrcore.CodePunctuation)}
+}
+
+// typeRules are the rules of the type expressions, preceded by the rules of
+// the type mode. Parameter and property names are recognized when names is
+// true.
+func typeRules(names bool) []clrcore.LexerDefRule {
+	return rules(
+		[]clrcore.LexerDefRule{whiteSpaceRule},
+		commentRules,
+		[]clrcore.LexerDefRule{
+			&clrcore.RegexDefRule{Re: `[(\[]`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("type-group"))},
+			&clrcore.RegexDefRule{Re: `<`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("type-args"))},
+			&clrcore.RegexDefRule{Re: `=>`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+			&clrcore.RegexDefRule{Re: `[|&?]`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+			&clrcore.RegexDefRule{Re: `\.\.\.|[.:]`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+			&clrcore.RegexDefRule{Re: identRe, Do: popTypeIdentifier(names)},
+		},
+		literalRules,
+	)
+}
+
+// rules return the concatenation of the rule lists.
+func rules(lists ...[]clrcore.LexerDefRule) []clrcore.LexerDefRule {
+	var res []clrcore.LexerDefRule
+	for _, list := range lists {
+		res = append(res, list...)
+	}
+	return res
+}
+
+// newLexerDef return the definition of the lexer of the language. The modes
+// are the same for all the languages.
+func newLexerDef(name string, g *language) *clrcore.LexerDef {
+	return &clrcore.LexerDef{
+		Name:     name,
+		Recovery: clrcore.RecoverRune,
+		InitFunc: func(d *clrcore.LexerDef) {
+			tokenRules := rules(
+				[]clrcore.LexerDefRule{whiteSpaceRule, newLineRule},
+				commentRules,
+				g.tokenRules(),
+				literalRules,
+				g.operatorRules(),
+			)
+			codeRules := rules(tokenRules, []clrcore.LexerDefRule{g.colonRule(), clrcore.DelimiterRule})
+			d.Modes = []*clrcore.LexerDefMode{
+				{Name: "root", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `\A#![^\n]*`, Do: clrcore.PopMatch(clrcore.CodeComment), Engine: clrcore.BacktrackEngine},
+					},
+					codeRules,
+				)},
+				// block is the content of the braces of a statement, ended by a
+				// closing brace.
+				{Name: "block", Rules: rules([]clrcore.LexerDefRule{closeBraceRule}, codeRules)},
+				// object is the content of the braces of an object, or of a
+				// destructuring pattern, whose colons are not type annotations.
+				{Name: "object", Rules: rules(
+					[]clrcore.LexerDefRule{
+						closeBraceRule,
+						&clrcore.RegexDefRule{Re: `:`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+					},
+					codeRules,
+				)},
+				// conditional is the operand of a conditional expression, or the
+				// expression of a case clause, ended by a colon. It is also ended
+				// by a semicolon when the colon is missing.
+				{Name: "conditional", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `[:;]`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodePunctuation), clrcore.PopMode())},
+					},
+					codeRules,
+				)},
+				// import is the list of the specifiers of an import or export
+				// statement, ended by the module name or a semicolon.
+				{Name: "import", Rules: rules(
+					[]clrcore.LexerDefRule{whiteSpaceRule, newLineRule},
+					commentRules,
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: stringRe, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringDouble), clrcore.PopMode())},
+						&clrcore.RegexDefRule{Re: charRe, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringSingle), clrcore.PopMode())},
+						&clrcore.RegexDefRule{Re: `;`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodePunctuation), clrcore.PopMode())},
+						&clrcore.RegexDefRule{Re: `(?:as|default|from|type|typeof)\b`, Do: clrcore.PopMatch(clrcore.CodeIdentifierKeyword)},
+						&clrcore.RegexDefRule{Re: identRe, Do: clrcore.PopMatch(clrcore.CodeIdentifier)},
+						&clrcore.RegexDefRule{Re: `[{}]`, Do: clrcore.PopMatch(clrcore.CodeDelimiter)},
+						&clrcore.RegexDefRule{Re: `,`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+						&clrcore.RegexDefRule{Re: `\*`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+						&clrcore.RegexDefRule{Re: ``, Do: clrcore.PopMode()},
+					},
+				)},
+				// template is the text of a template literal, ended by a
+				// backquote. The substitutions are lexed in the template-expr
+				// mode.
+				{Name: "template", Rules: []clrcore.LexerDefRule{
+					&clrcore.RegexDefRule{Re: "`", Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringRaw), clrcore.PopMode())},
+					&clrcore.RegexDefRule{Re: `\$\{`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("template-expr"))},
+					&clrcore.RegexDefRule{Re: "(?:[^`\\\\$]|\\\\(?s:.))+|\\$", Do: clrcore.PopMatch(clrcore.CodeStringRaw)},
+				}},
+				{Name: "template-expr", Rules: rules([]clrcore.LexerDefRule{closeBraceRule}, codeRules)},
+				// jsx-tag is the list of the attributes of a JSX element, ended
+				// by /> or by a > followed by the children of the element.
+				{Name: "jsx-tag", Rules: rules(
+					[]clrcore.LexerDefRule{whiteSpaceRule, newLineRule},
+					commentRules,
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `/>`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode(), clrcore.ScoreAdd(1))},
+						&clrcore.RegexDefRule{Re: `>`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode(), clrcore.PushMode("jsx-children"))},
+						&clrcore.RegexDefRule{Re: `\{`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("jsx-expr"))},
+						&clrcore.RegexDefRule{Re: `=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+						&clrcore.RegexDefRule{Re: `"[^"]*"?`, Do: clrcore.PopMatch(clrcore.CodeStringDouble)},
+						&clrcore.RegexDefRule{Re: `'[^']*'?`, Do: clrcore.PopMatch(clrcore.CodeStringSingle)},
+						&clrcore.RegexDefRule{Re: jsxNameRe, Do: clrcore.PopMatch(clrcore.CodeIdentifierVariable)},
+					},
+				)},
+				// jsx-children is the text and the children of a JSX element,
+				// ended by its closing tag.
+				{Name: "jsx-children", Rules: []clrcore.LexerDefRule{
+					&clrcore.RegexDefRule{Re: `(</)([ \t]*)(` + jsxNameRe + `)?([ \t]*)(>)`, Do: popJSXClose},
+					&clrcore.RegexDefRule{Re: jsxOpenRe, Do: popJSXElement(false)},
+					&clrcore.RegexDefRule{Re: `\{`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("jsx-expr"))},
+					whiteSpaceRule, newLineRule,
+					&clrcore.RegexDefRule{Re: `[^<{\n]+`, Do: clrcore.PopMatch(clrcore.Text)},
+				}},
+				// jsx-expr is an expression between braces in a JSX element.
+				{Name: "jsx-expr", Rules: rules([]clrcore.LexerDefRule{closeBraceRule}, codeRules)},
+				// type is a type annotation, ended by a token that can't follow
+				// a type, or by a brace, a newline or an arrow following a
+				// complete type.
+				{Name: "type", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `\{|\r?\n|=>`, Do: popTypeEnd},
+						&clrcore.RegexDefRule{Re: `\{`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("type-group"))},
+						newLineRule,
+					},
+					typeRules(false),
+					[]clrcore.LexerDefRule{&clrcore.RegexDefRule{Re: ``, Do: clrcore.PopMode()}},
+				)},
+				// type-alias is the type parameters of a type alias, followed by
+				// its type.
+				{Name: "type-alias", Rules: []clrcore.LexerDefRule{
+					whiteSpaceRule,
+					&clrcore.RegexDefRule{Re: `=`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeOperatorAssignment), clrcore.PopMode(), clrcore.PushMode("type"))},
+					&clrcore.RegexDefRule{Re: ``, Do: clrcore.PopMode()},
+				}},
+				// type-args is a list of type arguments or parameters, ended by a >.
+				{Name: "type-args", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `>`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+						&clrcore.RegexDefRule{Re: `\{`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("type-group"))},
+						&clrcore.RegexDefRule{Re: `,`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+						&clrcore.RegexDefRule{Re: `=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+						newLineRule,
+					},
+					typeRules(false),
+				)},
+				// type-group is the content of the parenthesis, brackets and
+				// braces of a type, like a parameter list, a tuple or an object
+				// type.
+				{Name: "type-group", Rules: rules(
+					[]clrcore.LexerDefRule{
+						&clrcore.RegexDefRule{Re: `[)\]}]`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+						&clrcore.RegexDefRule{Re: `\{`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("type-group"))},
+						&clrcore.RegexDefRule{Re: `[,;]`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+						&clrcore.RegexDefRule{Re: `[-+]`, Do: clrcore.PopMatch(clrcore.CodeOperatorArithmetic)},
+						newLineRule,
+					},
+					typeRules(true),
+				)},
+			}
+		},
+	}
+}
+
+var (
+	jsLexerDef  = newLexerDef("javascript", jsLanguage)
+	tsLexerDef  = newLexerDef("typescript", tsLanguage)
+	jsxLexerDef = newLexerDef("jsx", jsxLanguage)
+	tsxLexerDef = newLexerDef("tsx", tsxLanguage)
+)
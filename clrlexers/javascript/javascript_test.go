@@ -0,0 +1,347 @@
+package javascript
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+	"github.com/chmike/clrz/clrcore/lexertest"
+)
+
+// checkLexemes checks that the lexemes of text, without the white spaces and
+// the stop lexeme, are the expected ones.
+func checkLexemes(t *testing.T, info *clrcore.LexerInfo, text string, expect []clrcore.Lexeme) {
+	t.Helper()
+	lexertest.ExpectLexemes(t, info, text, expect, clrcore.TextWhiteSpace, clrcore.Stop)
+}
+
+var infos = []*clrcore.LexerInfo{JavaScriptLexerInfo, TypeScriptLexerInfo, JSXLexerInfo, TSXLexerInfo}
+
+func TestRegistered(t *testing.T) {
+	tests := []struct {
+		info      *clrcore.LexerInfo
+		names     []string
+		mimeType  string
+		fileNames []string
+	}{
+		{info: JavaScriptLexerInfo, names: []string{"javascript", "js"}, mimeType: "text/javascript", fileNames: []string{"main.js", "main.mjs"}},
+		{info: TypeScriptLexerInfo, names: []string{"typescript", "ts"}, mimeType: "application/typescript", fileNames: []string{"main.ts", "main.mts"}},
+		{info: JSXLexerInfo, names: []string{"jsx"}, mimeType: "text/jsx", fileNames: []string{"app.jsx"}},
+		{info: TSXLexerInfo, names: []string{"tsx"}, mimeType: "text/tsx", fileNames: []string{"app.tsx"}},
+	}
+	for _, test := range tests {
+		for _, name := range test.names {
+			if clrcore.LexerByName(name) != test.info {
+				t.Errorf("lexer not registered with name %q", name)
+			}
+		}
+		if l := clrcore.LexersByMimeType(test.mimeType); len(l) != 1 || l[0] != test.info {
+			t.Errorf("lexer not registered with mime type %q", test.mimeType)
+		}
+		for _, fileName := range test.fileNames {
+			if l := clrcore.LexersByFileName(fileName); len(l) != 1 || l[0] != test.info {
+				t.Errorf("lexer not registered with file name %q", fileName)
+			}
+		}
+	}
+}
+
+func TestGolden(t *testing.T) {
+	for _, info := range infos {
+		lexertest.Run(t, info)
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	lexertest.Fuzz(f, infos...)
+}
+
+func TestRegex(t *testing.T) {
+	tests := []struct {
+		in    string
+		regex string // the expected regular expression, or "" for a division
+	}{
+		{in: "x = /a\\/b[/]/g", regex: "/a\\/b[/]/g"},
+		{in: "f(/a/)", regex: "/a/"},
+		{in: "return /a/.test(s)", regex: "/a/"},
+		{in: "a && /b/", regex: "/b/"},
+		{in: "typeof /a/", regex: "/a/"},
+		{in: "} /a/", regex: "/a/"},
+		{in: "/a/", regex: "/a/"},
+		{in: "a / b / c", regex: ""},
+		{in: "f(a) / b / c", regex: ""},
+		{in: "a[0] / b / c", regex: ""},
+		{in: "i++ / b / c", regex: ""},
+		{in: "1 / b / c", regex: ""},
+		{in: "this / b / c", regex: ""},
+		{in: "x.return / b / c", regex: ""},
+		{in: "x = / b", regex: ""},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, JavaScriptLexerInfo, test.in)
+		regex := ""
+		for _, lexeme := range got {
+			if lexeme.IsA(clrcore.CodeStringRegex) {
+				regex = lexeme.Str
+			}
+		}
+		if regex != test.regex {
+			t.Errorf("got regex %q, expected %q for %q", regex, test.regex, test.in)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *clrcore.LexemeType
+	}{
+		{in: "0", out: clrcore.CodeNumberInteger},
+		{in: "1_000_000", out: clrcore.CodeNumberInteger},
+		{in: "123n", out: clrcore.CodeNumberInteger},
+		{in: "0xFF_FFn", out: clrcore.CodeNumberHexadecimal},
+		{in: "0o7_7", out: clrcore.CodeNumberOctal},
+		{in: "0777", out: clrcore.CodeNumberOctal},
+		{in: "0b1010_0101n", out: clrcore.CodeNumberBinary},
+		{in: "1.", out: clrcore.CodeNumberDecimal},
+		{in: ".5e-3", out: clrcore.CodeNumberDecimal},
+		{in: "1_0.0_1e1_0", out: clrcore.CodeNumberDecimal},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, JavaScriptLexerInfo, test.in)
+		if got[0] != (clrcore.Lexeme{Type: test.out, Str: test.in}) || !got[1].IsA(clrcore.Stop) {
+			t.Errorf("got %v, expected %s for %q", got, test.out, test.in)
+		}
+	}
+}
+
+func TestTemplateLiteral(t *testing.T) {
+	text := "`a${ {b: `c${d}`}.b }\\${e}$`"
+	checkLexemes(t, JavaScriptLexerInfo, text, []clrcore.Lexeme{
+		{Type: clrcore.CodeStringRaw, Str: "`"},
+		{Type: clrcore.CodeStringRaw, Str: "a"},
+		{Type: clrcore.CodeDelimiter, Str: "${"},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodeIdentifier, Str: "b"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeStringRaw, Str: "`"},
+		{Type: clrcore.CodeStringRaw, Str: "c"},
+		{Type: clrcore.CodeDelimiter, Str: "${"},
+		{Type: clrcore.CodeIdentifier, Str: "d"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeStringRaw, Str: "`"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodePunctuation, Str: "."},
+		{Type: clrcore.CodeIdentifier, Str: "b"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeStringRaw, Str: "\\${e}"},
+		{Type: clrcore.CodeStringRaw, Str: "$"},
+		{Type: clrcore.CodeStringRaw, Str: "`"},
+	})
+}
+
+func TestJSX(t *testing.T) {
+	text := "x = <a.B c=\"d\" {...e}>f {g}<br/></a.B>; y = a < b"
+	expect := []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.CodeDelimiter, Str: "<"},
+		{Type: clrcore.CodeIdentifierClass, Str: "a.B"},
+		{Type: clrcore.CodeIdentifierVariable, Str: "c"},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.CodeStringDouble, Str: "\"d\""},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodePunctuation, Str: "..."},
+		{Type: clrcore.CodeIdentifier, Str: "e"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeDelimiter, Str: ">"},
+		{Type: clrcore.Text, Str: "f "},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodeIdentifier, Str: "g"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeDelimiter, Str: "<"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "br"},
+		{Type: clrcore.CodeDelimiter, Str: "/>"},
+		{Type: clrcore.CodeDelimiter, Str: "</"},
+		{Type: clrcore.CodeIdentifierClass, Str: "a.B"},
+		{Type: clrcore.CodeDelimiter, Str: ">"},
+		{Type: clrcore.CodePunctuation, Str: ";"},
+		{Type: clrcore.CodeIdentifier, Str: "y"},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.CodeIdentifier, Str: "a"},
+		{Type: clrcore.CodeOperator, Str: "<"},
+		{Type: clrcore.CodeIdentifier, Str: "b"},
+	}
+	checkLexemes(t, JSXLexerInfo, text, expect)
+	checkLexemes(t, TSXLexerInfo, text, expect)
+	// the JavaScript lexer has no JSX elements
+	checkLexemes(t, JavaScriptLexerInfo, "<a>", []clrcore.Lexeme{
+		{Type: clrcore.CodeOperator, Str: "<"},
+		{Type: clrcore.CodeIdentifier, Str: "a"},
+		{Type: clrcore.CodeOperator, Str: ">"},
+	})
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	text := "function f(a: A<B>, b?: { c: C }): D | null {\n" +
+		"  let x: E = a as F, y = b ? g : h\n" +
+		"  return x\n" +
+		"}"
+	checkLexemes(t, TypeScriptLexerInfo, text, []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifierKeyword, Str: "function"},
+		{Type: clrcore.CodeIdentifierFunction, Str: "f"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeIdentifier, Str: "a"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeIdentifierType, Str: "A"},
+		{Type: clrcore.CodeDelimiter, Str: "<"},
+		{Type: clrcore.CodeIdentifierType, Str: "B"},
+		{Type: clrcore.CodeDelimiter, Str: ">"},
+		{Type: clrcore.CodePunctuation, Str: ","},
+		{Type: clrcore.CodeIdentifier, Str: "b"},
+		{Type: clrcore.CodeOperator, Str: "?"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodeIdentifier, Str: "c"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeIdentifierType, Str: "C"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeIdentifierType, Str: "D"},
+		{Type: clrcore.CodeOperator, Str: "|"},
+		{Type: clrcore.CodeIdentifierLiteral, Str: "null"},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "let"},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeIdentifierType, Str: "E"},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.CodeIdentifier, Str: "a"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "as"},
+		{Type: clrcore.CodeIdentifierType, Str: "F"},
+		{Type: clrcore.CodePunctuation, Str: ","},
+		{Type: clrcore.CodeIdentifier, Str: "y"},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.CodeIdentifier, Str: "b"},
+		{Type: clrcore.CodeOperator, Str: "?"},
+		{Type: clrcore.CodeIdentifier, Str: "g"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeIdentifier, Str: "h"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "return"},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+	})
+}
+
+func TestTypeArgsEnd(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int
+	}{
+		{in: "T>", out: 1},
+		{in: "Map<K, V[]>>()", out: 11},
+		{in: "A | B, C = D>", out: 12},
+		{in: "T,>(x) => x", out: 2},
+		{in: "b && c>d", out: -1},
+		{in: "b || c>d", out: -1},
+		{in: "b == c>d", out: -1},
+		{in: "b) > c", out: -1},
+		{in: "n; i++) {}", out: -1},
+		{in: "T", out: -1},
+	}
+	for _, test := range tests {
+		if out := typeArgsEnd(test.in); out != test.out {
+			t.Errorf("got %d, expected %d for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestDecorators(t *testing.T) {
+	checkLexemes(t, TypeScriptLexerInfo, "@a.b(1) class C {}", []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifierFunction, Str: "@a.b"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeNumberInteger, Str: "1"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "class"},
+		{Type: clrcore.CodeIdentifierClass, Str: "C"},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+	})
+}
+
+func TestScore(t *testing.T) {
+	texts := []struct {
+		text string
+		info *clrcore.LexerInfo
+	}{
+		{text: "const f = (a) => a === b ? a : c;\nconst re = /^a+$/;\n", info: JavaScriptLexerInfo},
+		{text: "interface A { b: string }\nlet c: A = d as A;\n", info: TypeScriptLexerInfo},
+		{text: "const a = <b>{c}</b>;\n", info: JSXLexerInfo},
+		{text: "const a = (b: string) => <c>{b}</c>;\n", info: TSXLexerInfo},
+	}
+	for _, text := range texts {
+		if info := clrcore.LexerByScore(text.text, infos); info != text.info {
+			t.Errorf("got lexer '%s', expected '%s' for %q", info.Names[0], text.info.Names[0], text.text)
+		}
+	}
+}
+
+func TestAnalyseText(t *testing.T) {
+	tests := []struct {
+		analyse func(string) float64
+		in      string
+		out     float64
+	}{
+		{analyse: analyseText, in: "import { a } from \"b\";\nexport default function f() {}\n", out: 0.5},
+		{analyse: analyseText, in: "const fs = require(\"fs\");\nmodule.exports = f;\n", out: 0.3},
+		{analyse: analyseText, in: "const f = (a, b) => a + b;\n", out: 0.2},
+		{analyse: analyseText, in: "import os\n", out: 0},
+		{analyse: analyseTSText, in: "export interface A {\n  b: string;\n}\n", out: 0.5},
+		{analyse: analyseTSText, in: "type A = B | C;\n", out: 0.3},
+		{analyse: analyseJSXText, in: "return (\n  <div>\n);\n", out: 0.3},
+		{analyse: analyseTSXText, in: "let a: number = 1;\nconst b = <B/>;\n", out: 0.5},
+	}
+	for _, test := range tests {
+		if out := test.analyse(test.in); out < test.out-1e-9 || out > test.out+1e-9 {
+			t.Errorf("got %f, expected %f for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestReaderLexer(t *testing.T) {
+	text := strings.Repeat("/* a\n comment */ let s: Map<string, number> = `a${b / 2}` + /c\\/d/g;\nx = <a b=\"c\">{d}</a>;\n", 2000)
+	if err := lexertest.CheckReader(TSXLexerInfo, text); err != nil {
+		t.Error(err)
+	}
+}
+
+// benchText return the input texts of the golden tests of the lexer.
+func benchText(tb testing.TB, def *clrcore.LexerDef) string {
+	text, err := lexertest.InputText(def.Name)
+	if err != nil {
+		tb.Fatalf("unexpected error: %s", err)
+	}
+	return text
+}
+
+func TestNoOptimize(t *testing.T) {
+	for _, def := range []*clrcore.LexerDef{jsLexerDef, tsLexerDef, jsxLexerDef, tsxLexerDef} {
+		if err := lexertest.CheckNoOptimize(def, benchText(t, def)); err != nil {
+			t.Errorf("'%s': %s", def.Name, err)
+		}
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	for _, def := range []*clrcore.LexerDef{jsLexerDef, tsLexerDef, jsxLexerDef, tsxLexerDef} {
+		def := def
+		text := benchText(b, def)
+		b.Run(def.Name, func(b *testing.B) {
+			lexertest.Benchmark(b, def, text)
+		})
+	}
+}
@@ -0,0 +1,397 @@
+// Package python provides a lexer for the Python programming language, in its
+// versions 2 and 3. It is registered under the names "python", "py", "python3",
+// "py3", "python2" and "py2" when the package is imported.
+package python
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+// LexerInfo is the registered Python lexer information.
+var LexerInfo = &clrcore.LexerInfo{
+	Names:          []string{"python", "py", "python3", "py3", "python2", "py2"},
+	MimeTypes:      []string{"text/x-python", "application/x-python", "text/x-python3", "application/x-python3"},
+	FileNames:      []string{"*.py", "*.pyw", "*.pyi"},
+	Interpreters:   interpreters,
+	AnalyseText:    analyseText,
+	NewLexer:       newLexer,
+	NewReaderLexer: newReaderLexer,
+}
+
+func init() {
+	clrcore.RegisterLexer(LexerInfo)
+}
+
+// interpreters are the name patterns of the Python interpreters of #! lines.
+var interpreters = []string{"python*", "pypy*"}
+
+var (
+	importRe = regexp.MustCompile(`(?m)^(?:from[ \t]+\.*[\pL_][\pL\pN_.]*[ \t]+import[ \t]+[^\n;]+|import[ \t]+[\pL_][\pL\pN_.]*(?:[ \t]*,[ \t]*[\pL_][\pL\pN_.]*)*(?:[ \t]+as[ \t]+[\pL_][\pL\pN_]*)?)[ \t]*(?:#.*)?$`)
+	defRe    = regexp.MustCompile(`(?m)^[ \t]*(?:async[ \t]+)?def[ \t]+[\pL_][\pL\pN_]*[ \t]*\([^\n]*\)[ \t]*(?:->[^\n]*)?:`)
+	classRe  = regexp.MustCompile(`(?m)^[ \t]*class[ \t]+[\pL_][\pL\pN_]*[ \t]*(?:\([^\n]*\))?[ \t]*:`)
+	mainRe   = regexp.MustCompile(`(?m)^if[ \t]+__name__[ \t]*==[ \t]*['"]__main__['"][ \t]*:`)
+)
+
+// analyseText return the likelihood that text is Python source code by looking
+// for import statements, function and class definitions, and the test of the
+// main module. The #! line is checked with the Interpreters of the lexer.
+func analyseText(text string) float64 {
+	var c float64
+	if importRe.MatchString(text) {
+		c += 0.3
+	}
+	if defRe.MatchString(text) {
+		c += 0.3
+	}
+	if classRe.MatchString(text) {
+		c += 0.1
+	}
+	if mainRe.MatchString(text) {
+		c += 0.3
+	}
+	return c
+}
+
+func newLexer(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+	l, err := clrcore.NewLexerEngine(lexerDef, text, stopMarkers, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func newReaderLexer(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+	l, err := clrcore.NewReaderLexerEngine(lexerDef, r, 0, stopMarkers, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// wordSet return the set of the words separated by spaces.
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+var keywords = wordSet(`as assert async await break class continue def del elif else
+	except finally for from global if import lambda nonlocal pass raise return try
+	while with yield`)
+
+var wordOperators = wordSet(`and in is not or`)
+
+var constants = wordSet(`True False None Ellipsis NotImplemented __debug__`)
+
+var pseudoVariables = wordSet(`self cls`)
+
+var builtinTypes = wordSet(`bool bytearray bytes complex dict float frozenset int list
+	memoryview object range set slice str tuple type basestring buffer file long
+	unicode xrange`)
+
+var builtinFunctions = wordSet(`__import__ abs aiter all anext any ascii bin breakpoint
+	callable chr classmethod compile delattr dir divmod enumerate eval exec filter
+	format getattr globals hasattr hash help hex id input isinstance issubclass iter
+	len locals map max min next oct open ord pow print property repr reversed round
+	setattr sorted staticmethod sum super vars zip apply cmp coerce execfile intern
+	raw_input reduce reload unichr`)
+
+var builtinExceptions = wordSet(`ArithmeticError AssertionError AttributeError
+	BaseException BaseExceptionGroup BlockingIOError BrokenPipeError BufferError
+	BytesWarning ChildProcessError ConnectionAbortedError ConnectionError
+	ConnectionRefusedError ConnectionResetError DeprecationWarning EOFError
+	EncodingWarning EnvironmentError Exception ExceptionGroup FileExistsError
+	FileNotFoundError FloatingPointError FutureWarning GeneratorExit IOError
+	ImportError ImportWarning IndentationError IndexError InterruptedError
+	IsADirectoryError KeyError KeyboardInterrupt LookupError MemoryError
+	ModuleNotFoundError NameError NotADirectoryError NotImplementedError OSError
+	OverflowError PendingDeprecationWarning PermissionError ProcessLookupError
+	RecursionError ReferenceError ResourceWarning RuntimeError RuntimeWarning
+	StandardError StopAsyncIteration StopIteration SyntaxError SyntaxWarning
+	SystemError SystemExit TabError TimeoutError TypeError UnboundLocalError
+	UnicodeDecodeError UnicodeEncodeError UnicodeError UnicodeTranslateError
+	UnicodeWarning UserWarning ValueError Warning ZeroDivisionError`)
+
+// popIdentifier classifies the matched identifier as keyword, builtin, function
+// call or plain identifier.
+func popIdentifier(l *clrcore.LexerEngine, match []int) bool {
+	text := l.RemainingText()
+	word, rest := text[:match[1]], text[match[1]:]
+	t := clrcore.CodeIdentifier
+	switch {
+	case wordOperators[word]:
+		t = clrcore.CodeIdentifierOperator
+	case keywords[word]:
+		t = clrcore.CodeIdentifierKeyword
+	case constants[word]:
+		t = clrcore.CodeIdentifierLiteral
+	case (word == "print" || word == "exec") && isStatement(rest):
+		// Python 2 print and exec statements
+		t = clrcore.CodeIdentifierKeyword
+	case pseudoVariables[word]:
+		t = clrcore.CodeIdentifierVariable
+	case builtinTypes[word]:
+		t = clrcore.CodeIdentifierType
+	case builtinExceptions[word]:
+		t = clrcore.CodeIdentifierClass
+	case builtinFunctions[word], isCall(rest):
+		t = clrcore.CodeIdentifierFunction
+	}
+	l.PopLexeme(t, match[1])
+	return true
+}
+
+// popAttribute outputs the matched dot, white spaces and attribute name. The
+// attribute is a function when it is called.
+func popAttribute(l *clrcore.LexerEngine, match []int) bool {
+	t := clrcore.CodeIdentifier
+	if isCall(l.RemainingText()[match[1]:]) {
+		t = clrcore.CodeIdentifierFunction
+	}
+	return clrcore.PopMatch(clrcore.CodePunctuation, clrcore.TextWhiteSpace, t)(l, match)
+}
+
+// popShebang outputs the matched #! line as a comment, and adds to the score
+// when its interpreter is a Python interpreter.
+func popShebang(l *clrcore.LexerEngine, match []int) bool {
+	if clrcore.ShebangMatch(l.RemainingText()[:match[1]], interpreters) {
+		clrcore.ScoreAdd(10)(l, match)
+	}
+	l.PopLexeme(clrcore.CodeComment, match[1])
+	return true
+}
+
+// popSoftKeyword outputs the matched indentation and match or case soft keyword
+// when it starts a match statement or a case clause.
+func popSoftKeyword(l *clrcore.LexerEngine, match []int) bool {
+	if !isSoftKeyword(l.RemainingText()[match[1]:]) {
+		return false
+	}
+	return clrcore.PopMatch(clrcore.TextWhiteSpace, clrcore.CodeIdentifierKeyword)(l, match)
+}
+
+// isCall return true if str starts with an opening parenthesis, optionally
+// preceded by white spaces.
+func isCall(str string) bool {
+	for len(str) > 0 {
+		r, n := utf8.DecodeRuneInString(str)
+		if r == '(' {
+			return true
+		}
+		if r == '\n' || !unicode.IsSpace(r) {
+			return false
+		}
+		str = str[n:]
+	}
+	return false
+}
+
+// isStatement return true if str, following a print or exec word, starts with
+// white spaces followed by an expression, as in the Python 2 print and exec
+// statements.
+func isStatement(str string) bool {
+	rest := strings.TrimLeft(str, " \t")
+	if len(rest) == len(str) || rest == "" {
+		return false
+	}
+	c := rest[0]
+	return c == '"' || c == '\'' || c == '_' || strings.HasPrefix(rest, ">>") ||
+		(c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z') || c >= utf8.RuneSelf
+}
+
+// isSoftKeyword return true if str, following a match or case word at the start
+// of a line, is the rest of a match statement or case clause: the word is
+// followed by an expression, and the line ends with a colon.
+func isSoftKeyword(str string) bool {
+	rest := strings.TrimLeft(str, " \t")
+	if rest == "" || strings.IndexByte(":,;=^&|@~)]}.\n#", rest[0]) >= 0 {
+		return false
+	}
+	if len(rest) == len(str) && strings.IndexByte("([{", rest[0]) < 0 {
+		return false
+	}
+	// the line ends with a colon, ignoring the comment
+	var quote byte
+	end := len(rest)
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '"' || c == '\'' {
+			quote = c
+		}
+		if c == '#' || c == '\n' {
+			end = i
+			break
+		}
+	}
+	line := strings.TrimRight(rest[:end], " \t\r")
+	return strings.HasSuffix(line, ":") && !strings.HasSuffix(line, "::")
+}
+
+// Regular expressions of the Python lexemes.
+const (
+	identRe  = `[_\pL][_\pL\pN]*`
+	decRe    = `[0-9](?:_?[0-9])*`
+	expRe    = `[eE][+-]?` + decRe
+	floatRe  = `(?:` + decRe + `\.(?:` + decRe + `)?(?:` + expRe + `)?|\.` + decRe + `(?:` + expRe + `)?|` + decRe + expRe + `)[jJ]?`
+	imagRe   = decRe + `[jJ]`
+	hexRe    = `0[xX](?:_?[0-9a-fA-F])+[lL]?`
+	octRe    = `0[oO](?:_?[0-7])+[lL]?|0[0-7]+[lL]?`
+	binRe    = `0[bB](?:_?[01])+[lL]?`
+	intRe    = `(?:0(?:_?0)*|[1-9](?:_?[0-9])*)[lL]?`
+	prefixRe = `(?i:rb|br|ur|[rbu])?`
+	rawRe    = `(?i:rb|br|ur|r)`
+	fRe      = `(?i:f|fr|rf)`
+)
+
+var (
+	whiteSpaceRule   = &clrcore.RegexDefRule{Re: `[ \t\f]+`, Do: clrcore.PopMatch(clrcore.TextWhiteSpace)}
+	newLineRule      = clrcore.NewLineRule
+	continuationRule = &clrcore.RegexDefRule{Re: `\\\r?\n`, Do: clrcore.PopMatch(clrcore.TextWhiteSpace)}
+	commentRule      = &clrcore.RegexDefRule{Re: `#[^\n]*`, Do: clrcore.PopMatch(clrcore.CodeComment)}
+	// exprRules are the rules of the expressions and statements of all modes.
+	exprRules = []clrcore.LexerDefRule{
+		&clrcore.RegexDefRule{Re: `(def)([ \t]+)(` + identRe + `)`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierFunction), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: `(class)([ \t]+)(` + identRe + `)`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierClass), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: `(from)([ \t]+)(\.*` + identRe + `(?:\.` + identRe + `)*|\.+)([ \t]+)(import)\b`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierNamespace,
+				clrcore.TextWhiteSpace, clrcore.CodeIdentifierKeyword), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: `(import)([ \t]+)(` + identRe + `(?:\.` + identRe + `)*)`,
+			Do: clrcore.All(clrcore.PopMatch(clrcore.CodeIdentifierKeyword, clrcore.TextWhiteSpace, clrcore.CodeIdentifierNamespace), clrcore.ScoreAdd(1))},
+		&clrcore.RegexDefRule{Re: fRe + `"""`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringMultiline), clrcore.PushMode("fstring-tdq"))},
+		&clrcore.RegexDefRule{Re: fRe + `'''`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringMultiline), clrcore.PushMode("fstring-tsq"))},
+		&clrcore.RegexDefRule{Re: fRe + `"`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringDouble), clrcore.PushMode("fstring-dq"))},
+		&clrcore.RegexDefRule{Re: fRe + `'`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeStringSingle), clrcore.PushMode("fstring-sq"))},
+		&clrcore.RegexDefRule{Re: prefixRe + `(""")`, Do: clrcore.PopWith((*clrcore.Lexeme).PopTripleDoubleQuotedString)},
+		&clrcore.RegexDefRule{Re: prefixRe + `(''')`, Do: clrcore.PopWith((*clrcore.Lexeme).PopTripleSingleQuotedString)},
+		&clrcore.RegexDefRule{Re: rawRe + `"(?:[^"\\\n]|\\(?s:.))*"?`, Do: clrcore.PopMatch(clrcore.CodeStringRaw)},
+		&clrcore.RegexDefRule{Re: rawRe + `'(?:[^'\\\n]|\\(?s:.))*'?`, Do: clrcore.PopMatch(clrcore.CodeStringRaw)},
+		&clrcore.RegexDefRule{Re: prefixRe + `"(?:[^"\\\n]|\\(?s:.))*"?`, Do: clrcore.PopMatch(clrcore.CodeStringDouble)},
+		&clrcore.RegexDefRule{Re: prefixRe + `'(?:[^'\\\n]|\\(?s:.))*'?`, Do: clrcore.PopMatch(clrcore.CodeStringSingle)},
+		&clrcore.RegexDefRule{Re: identRe, Do: popIdentifier},
+		&clrcore.RegexDefRule{Re: floatRe, Do: clrcore.PopMatch(clrcore.CodeNumberDecimal)},
+		&clrcore.RegexDefRule{Re: hexRe, Do: clrcore.PopMatch(clrcore.CodeNumberHexadecimal)},
+		&clrcore.RegexDefRule{Re: imagRe, Do: clrcore.PopMatch(clrcore.CodeNumberInteger)},
+		&clrcore.RegexDefRule{Re: octRe, Do: clrcore.PopMatch(clrcore.CodeNumberOctal)},
+		&clrcore.RegexDefRule{Re: binRe, Do: clrcore.PopMatch(clrcore.CodeNumberBinary)},
+		&clrcore.RegexDefRule{Re: intRe, Do: clrcore.PopMatch(clrcore.CodeNumberInteger)},
+		&clrcore.RegexDefRule{Re: `(\.)([ \t]*)(` + identRe + `)`, Do: popAttribute},
+		&clrcore.RegexDefRule{Re: `\*\*=|//=|>>=|<<=|[-+*/%&|^@]=|:=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+		&clrcore.RegexDefRule{Re: `==|!=|<>|<=|>=|->`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `<<|>>|[&|^~]`, Do: clrcore.PopMatch(clrcore.CodeOperatorBinary)},
+		&clrcore.RegexDefRule{Re: `\*\*|//|[-+*/%@]`, Do: clrcore.PopMatch(clrcore.CodeOperatorArithmetic)},
+		&clrcore.RegexDefRule{Re: `[<>]`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+		&clrcore.RegexDefRule{Re: `=`, Do: clrcore.PopMatch(clrcore.CodeOperatorAssignment)},
+		&clrcore.RegexDefRule{Re: `\.\.\.|[.,;:]`, Do: clrcore.PopMatch(clrcore.CodePunctuation)},
+		// Python 2 repr backticks
+		&clrcore.RegexDefRule{Re: "`[^`\n]*`?", Do: clrcore.PopMatch(clrcore.CodeStringRaw)},
+		clrcore.DelimiterRule,
+	}
+)
+
+// fstringRules return the rules of the text of an f-string of type t, ending
+// with the quote. The expressions between braces are lexed by the fstring-expr
+// mode, or by the fstring-texpr mode in a triple quoted f-string. The escaped
+// braces are text.
+func fstringRules(t *clrcore.LexemeType, quote string) []clrcore.LexerDefRule {
+	textRe := `(?:[^` + quote[:1] + `{}\\\n]|\\(?s:[^{}])|\\)+`
+	exprMode := "fstring-expr"
+	if len(quote) == 3 {
+		// a triple quoted f-string contains newlines and single quotes
+		textRe = `(?:[^` + quote[:1] + `{}\\]|\\(?s:[^{}])|\\)+|` + quote[:1]
+		exprMode = "fstring-texpr"
+	}
+	return []clrcore.LexerDefRule{
+		&clrcore.RegexDefRule{Re: quote, Do: clrcore.All(clrcore.PopMatch(t), clrcore.PopMode())},
+		&clrcore.RegexDefRule{Re: `\{\{|\}\}`, Do: clrcore.PopMatch(t)},
+		&clrcore.RegexDefRule{Re: `\{`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode(exprMode))},
+		&clrcore.RegexDefRule{Re: textRe, Do: clrcore.PopMatch(t)},
+		&clrcore.RegexDefRule{Re: `\}`, Do: clrcore.PopMatch(t)},
+	}
+}
+
+// fstringExprRules are the rules of an f-string expression, preceding the
+// rules of the expressions.
+var fstringExprRules = []clrcore.LexerDefRule{
+	&clrcore.RegexDefRule{Re: `\}`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+	&clrcore.RegexDefRule{Re: `![rsa]\b`, Do: clrcore.PopMatch(clrcore.CodeOperator)},
+	&clrcore.RegexDefRule{Re: `:`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodePunctuation), clrcore.PushMode("fstring-spec"))},
+	&clrcore.RegexDefRule{Re: `[(\[{]`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("fstring-nested"))},
+	whiteSpaceRule,
+}
+
+// rules return the concatenation of the rule lists.
+func rules(lists ...[]clrcore.LexerDefRule) []clrcore.LexerDefRule {
+	var res []clrcore.LexerDefRule
+	for _, list := range lists {
+		res = append(res, list...)
+	}
+	return res
+}
+
+var lexerDef = &clrcore.LexerDef{
+	Name:     "python",
+	Recovery: clrcore.RecoverRune | clrcore.RecoverNewLine,
+	InitFunc: func(d *clrcore.LexerDef) {
+		d.Modes = []*clrcore.LexerDefMode{
+			{Name: "root", Rules: rules(
+				[]clrcore.LexerDefRule{
+					&clrcore.RegexDefRule{Re: `\A#![^\n]*`, Do: popShebang, Engine: clrcore.BacktrackEngine},
+					&clrcore.RegexDefRule{Re: `(?m)^([ \t]*)(match|case)\b`, Do: popSoftKeyword, Engine: clrcore.BacktrackEngine},
+					// a decorator starts a line, @ is otherwise the matrix multiplication
+					&clrcore.RegexDefRule{Re: `(?m)^([ \t]*)(@[ \t]*` + identRe + `(?:[ \t]*\.[ \t]*` + identRe + `)*)`,
+						Do: clrcore.PopMatch(clrcore.TextWhiteSpace, clrcore.CodeIdentifierFunction), Engine: clrcore.BacktrackEngine},
+					whiteSpaceRule, newLineRule, continuationRule, commentRule,
+				},
+				exprRules,
+			)},
+			// fstring-expr is an expression of an f-string, ended by a closing
+			// brace, and optionally followed by a conversion and a format spec.
+			{Name: "fstring-expr", Rules: rules(fstringExprRules, exprRules)},
+			// fstring-texpr is an expression of a triple quoted f-string, which
+			// may span several lines.
+			{Name: "fstring-texpr", Rules: rules(
+				fstringExprRules,
+				[]clrcore.LexerDefRule{newLineRule, continuationRule, commentRule},
+				exprRules,
+			)},
+			// fstring-nested is the content of brackets in an f-string expression.
+			{Name: "fstring-nested", Rules: rules(
+				[]clrcore.LexerDefRule{
+					&clrcore.RegexDefRule{Re: `[)\]}]`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopMode())},
+					&clrcore.RegexDefRule{Re: `[(\[{]`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("fstring-nested"))},
+					whiteSpaceRule, newLineRule, continuationRule, commentRule,
+				},
+				exprRules,
+			)},
+			// fstring-spec is the format spec of an f-string expression, which may
+			// contain nested expressions.
+			{Name: "fstring-spec", Rules: []clrcore.LexerDefRule{
+				&clrcore.RegexDefRule{Re: `\}`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PopModes(2))},
+				&clrcore.RegexDefRule{Re: `\{`, Do: clrcore.All(clrcore.PopMatch(clrcore.CodeDelimiter), clrcore.PushMode("fstring-expr"))},
+				&clrcore.RegexDefRule{Re: `[^{}\n"']+`, Do: clrcore.PopMatch(clrcore.CodeString)},
+			}},
+			{Name: "fstring-dq", Rules: fstringRules(clrcore.CodeStringDouble, `"`)},
+			{Name: "fstring-sq", Rules: fstringRules(clrcore.CodeStringSingle, `'`)},
+			{Name: "fstring-tdq", Rules: fstringRules(clrcore.CodeStringMultiline, `"""`)},
+			{Name: "fstring-tsq", Rules: fstringRules(clrcore.CodeStringMultiline, `'''`)},
+		}
+	},
+}
@@ -0,0 +1,280 @@
+package python
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+	"github.com/chmike/clrz/clrcore/lexertest"
+)
+
+func TestRegistered(t *testing.T) {
+	for _, name := range []string{"python", "py", "python3", "py3", "python2", "py2"} {
+		if clrcore.LexerByName(name) != LexerInfo {
+			t.Errorf("lexer not registered with name %q", name)
+		}
+	}
+	if l := clrcore.LexersByMimeType("text/x-python"); len(l) != 1 || l[0] != LexerInfo {
+		t.Errorf("lexer not registered with mime type %q", "text/x-python")
+	}
+	for _, fileName := range []string{"main.py", "gui.pyw"} {
+		if l := clrcore.LexersByFileName(fileName); len(l) != 1 || l[0] != LexerInfo {
+			t.Errorf("lexer not registered with file name %q", fileName)
+		}
+	}
+}
+
+func TestGolden(t *testing.T) {
+	lexertest.Run(t, LexerInfo)
+}
+
+func FuzzLexer(f *testing.F) {
+	lexertest.Fuzz(f, LexerInfo)
+}
+
+func TestLexemes(t *testing.T) {
+	text := "@app.route\ndef f(self, n=0b_1):\n\treturn len(x).bit_length()\n"
+	l := lexertest.ExpectLexemes(t, LexerInfo, text, []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifierFunction, Str: "@app.route"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "def"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierFunction, Str: "f"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeIdentifierVariable, Str: "self"},
+		{Type: clrcore.CodePunctuation, Str: ","},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifier, Str: "n"},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.CodeNumberBinary, Str: "0b_1"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.TextWhiteSpace, Str: "\t"},
+		{Type: clrcore.CodeIdentifierKeyword, Str: "return"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierFunction, Str: "len"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.CodePunctuation, Str: "."},
+		{Type: clrcore.CodeIdentifierFunction, Str: "bit_length"},
+		{Type: clrcore.CodeDelimiter, Str: "("},
+		{Type: clrcore.CodeDelimiter, Str: ")"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.StopEndOfString, Str: ""},
+	})
+	if l.Score() != 1 {
+		t.Errorf("got score %d, expected %d", l.Score(), 1)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		in  string
+		out clrcore.Lexeme
+	}{
+		{in: `"a\"b"`, out: clrcore.Lexeme{Type: clrcore.CodeStringDouble, Str: `"a\"b"`}},
+		{in: `'a\\'`, out: clrcore.Lexeme{Type: clrcore.CodeStringSingle, Str: `'a\\'`}},
+		{in: `B"a"`, out: clrcore.Lexeme{Type: clrcore.CodeStringDouble, Str: `B"a"`}},
+		{in: `Rb'\d'`, out: clrcore.Lexeme{Type: clrcore.CodeStringRaw, Str: `Rb'\d'`}},
+		{in: `ur"\d"`, out: clrcore.Lexeme{Type: clrcore.CodeStringRaw, Str: `ur"\d"`}},
+		{in: "u'''a\n'b''c'''", out: clrcore.Lexeme{Type: clrcore.CodeStringMultiline, Str: "u'''a\n'b''c'''"}},
+		{in: "r\"\"\"a\n\"\"\"", out: clrcore.Lexeme{Type: clrcore.CodeStringMultiline, Str: "r\"\"\"a\n\"\"\""}},
+		{in: "\"\"\"unterminated\n", out: clrcore.Lexeme{Type: clrcore.CodeStringMultiline, Str: "\"\"\"unterminated\n"}},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, LexerInfo, test.in)
+		if got[0] != test.out || !got[1].IsA(clrcore.Stop) {
+			t.Errorf("got %v, expected %s for %q", got, test.out, test.in)
+		}
+	}
+}
+
+func TestFString(t *testing.T) {
+	text := "f'{x!r:>{w}} {{y}} {d[\"k\"]}' fr\"\\d{a}\"\n"
+	lexertest.ExpectLexemes(t, LexerInfo, text, []clrcore.Lexeme{
+		{Type: clrcore.CodeStringSingle, Str: "f'"},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.CodeOperator, Str: "!r"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.CodeString, Str: ">"},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodeIdentifier, Str: "w"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeStringSingle, Str: " "},
+		{Type: clrcore.CodeStringSingle, Str: "{{"},
+		{Type: clrcore.CodeStringSingle, Str: "y"},
+		{Type: clrcore.CodeStringSingle, Str: "}}"},
+		{Type: clrcore.CodeStringSingle, Str: " "},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodeIdentifier, Str: "d"},
+		{Type: clrcore.CodeDelimiter, Str: "["},
+		{Type: clrcore.CodeStringDouble, Str: "\"k\""},
+		{Type: clrcore.CodeDelimiter, Str: "]"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeStringSingle, Str: "'"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeStringDouble, Str: "fr\""},
+		{Type: clrcore.CodeStringDouble, Str: "\\d"},
+		{Type: clrcore.CodeDelimiter, Str: "{"},
+		{Type: clrcore.CodeIdentifier, Str: "a"},
+		{Type: clrcore.CodeDelimiter, Str: "}"},
+		{Type: clrcore.CodeStringDouble, Str: "\""},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.StopEndOfString, Str: ""},
+	})
+}
+
+func TestSoftKeywords(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *clrcore.LexemeType
+	}{
+		{in: "match x:\n", out: clrcore.CodeIdentifierKeyword},
+		{in: "  case (1, 2):  # comment\n", out: clrcore.CodeIdentifierKeyword},
+		{in: "case \"#\":", out: clrcore.CodeIdentifierKeyword},
+		{in: "match[1]:\n", out: clrcore.CodeIdentifierKeyword},
+		{in: "match = 1\n", out: clrcore.CodeIdentifier},
+		{in: "match.group(0)\n", out: clrcore.CodeIdentifier},
+		{in: "match(x)\n", out: clrcore.CodeIdentifierFunction},
+		{in: "case: int\n", out: clrcore.CodeIdentifier},
+		{in: "x = match\n", out: clrcore.CodeIdentifier},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, LexerInfo, test.in)
+		for _, lexeme := range got {
+			if lexeme.Str == "match" || lexeme.Str == "case" {
+				if lexeme.Type != test.out {
+					t.Errorf("got %s, expected %s for %q", lexeme.Type, test.out, test.in)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestDecorators(t *testing.T) {
+	lexertest.ExpectLexemes(t, LexerInfo, "class C:\n    @ functools.cache\n", []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifierKeyword, Str: "class"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifierClass, Str: "C"},
+		{Type: clrcore.CodePunctuation, Str: ":"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.TextWhiteSpace, Str: "    "},
+		{Type: clrcore.CodeIdentifierFunction, Str: "@ functools.cache"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.StopEndOfString},
+	})
+	lexertest.ExpectLexemes(t, LexerInfo, "x = a @ b\nm@n", []clrcore.Lexeme{
+		{Type: clrcore.CodeIdentifier, Str: "x"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeOperatorAssignment, Str: "="},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifier, Str: "a"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeOperatorArithmetic, Str: "@"},
+		{Type: clrcore.TextWhiteSpace, Str: " "},
+		{Type: clrcore.CodeIdentifier, Str: "b"},
+		{Type: clrcore.TextNewLine, Str: "\n"},
+		{Type: clrcore.CodeIdentifier, Str: "m"},
+		{Type: clrcore.CodeOperatorArithmetic, Str: "@"},
+		{Type: clrcore.CodeIdentifier, Str: "n"},
+		{Type: clrcore.StopEndOfString},
+	})
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *clrcore.LexemeType
+	}{
+		{in: "0", out: clrcore.CodeNumberInteger},
+		{in: "1_000", out: clrcore.CodeNumberInteger},
+		{in: "10L", out: clrcore.CodeNumberInteger},
+		{in: "7j", out: clrcore.CodeNumberInteger},
+		{in: "0x_dead_BEEF", out: clrcore.CodeNumberHexadecimal},
+		{in: "0o7_7", out: clrcore.CodeNumberOctal},
+		{in: "0777", out: clrcore.CodeNumberOctal},
+		{in: "0b1_0", out: clrcore.CodeNumberBinary},
+		{in: "1.", out: clrcore.CodeNumberDecimal},
+		{in: ".5e-3", out: clrcore.CodeNumberDecimal},
+		{in: "1_0.0_1E+1_0J", out: clrcore.CodeNumberDecimal},
+		{in: "2e8j", out: clrcore.CodeNumberDecimal},
+	}
+	for _, test := range tests {
+		got, _ := lexertest.LexAll(t, LexerInfo, test.in)
+		if got[0] != (clrcore.Lexeme{Type: test.out, Str: test.in}) || !got[1].IsA(clrcore.Stop) {
+			t.Errorf("got %v, expected %s for %q", got, test.out, test.in)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	_, l := lexertest.LexAll(t, LexerInfo, "#!/usr/bin/env python3\nimport os\n")
+	if l.Score() != 11 {
+		t.Errorf("got score %d, expected %d", l.Score(), 11)
+	}
+	_, l = lexertest.LexAll(t, LexerInfo, "import os\n#!/usr/bin/env python3\n")
+	if l.Score() != 1 {
+		t.Errorf("got score %d, expected %d", l.Score(), 1)
+	}
+	_, l = lexertest.LexAll(t, LexerInfo, "#!/bin/sh\necho hi\n")
+	if l.Score() != 0 {
+		t.Errorf("got score %d, expected %d", l.Score(), 0)
+	}
+	info := clrcore.LexerByScore("#!/usr/bin/python2\nprint 'x'\n", []*clrcore.LexerInfo{LexerInfo})
+	if info != LexerInfo {
+		t.Errorf("Python lexer not selected by score")
+	}
+	candidates := clrcore.DetectLexer("", "", "#!/usr/bin/env python3.11\nx = 1\n")
+	if len(candidates) == 0 || candidates[0].Info != LexerInfo {
+		t.Errorf("Python lexer not detected by its #! line")
+	}
+}
+
+func TestAnalyseText(t *testing.T) {
+	tests := []struct {
+		in  string
+		out float64
+	}{
+		{in: "import os\n\ndef f():\n    pass\n", out: 0.6},
+		{in: "from a.b import (c,\n    d)\n\nclass C(object):\n    pass\n", out: 0.4},
+		{in: "def main() -> None:\n    pass\n\nif __name__ == '__main__':\n    main()\n", out: 0.6},
+		{in: "import java.util.List;\n", out: 0},
+		{in: "package main\n\nimport \"fmt\"\n\nfunc main() {}\n", out: 0},
+	}
+	for _, test := range tests {
+		if out := analyseText(test.in); out < test.out-1e-9 || out > test.out+1e-9 {
+			t.Errorf("got %f, expected %f for %q", out, test.out, test.in)
+		}
+	}
+}
+
+func TestReaderLexer(t *testing.T) {
+	text := strings.Repeat("def f(x):\n    '''doc\n    string'''\n    return f\"{x:>{w}}\" + r'\\d' # c\n", 2000)
+	if err := lexertest.CheckReader(LexerInfo, text); err != nil {
+		t.Error(err)
+	}
+}
+
+// benchText return the Python input texts of the golden tests.
+func benchText(tb testing.TB) string {
+	text, err := lexertest.InputText("python")
+	if err != nil {
+		tb.Fatalf("unexpected error: %s", err)
+	}
+	return text
+}
+
+func TestNoOptimize(t *testing.T) {
+	if err := lexertest.CheckNoOptimize(lexerDef, benchText(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	lexertest.Benchmark(b, lexerDef, benchText(b))
+}
@@ -0,0 +1,120 @@
+package clrregexp
+
+import "unicode"
+
+// charClass is a set of runes.
+type charClass struct {
+	ranges []rune      // pairs of lo, hi runes included in the class
+	items  []classItem // classes included in the class
+	negate bool        // the class matches the runes not in the set
+	fold   bool        // case insensitive
+}
+
+// classItem is a class escape, like \w or \p{Greek}, in a class.
+type classItem struct {
+	fn     func(rune) bool     // class function, or nil
+	table  *unicode.RangeTable // class table, or nil
+	negate bool                // the item matches the runes not in the class
+}
+
+// perlClasses are the functions of \d, \s and \w. As in Python, the classes
+// are Unicode aware.
+var perlClasses = map[rune]func(rune) bool{
+	'd': unicode.IsDigit,
+	's': isSpace,
+	'w': isWord,
+}
+
+// isSpace return true if r is a white space as defined by Python.
+func isSpace(r rune) bool {
+	return unicode.IsSpace(r) || (r >= 0x1c && r <= 0x1f)
+}
+
+// isWord return true if r is a word rune as defined by Python.
+func isWord(r rune) bool {
+	if r < 0x80 {
+		return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+	}
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// isHexDigit return true if r is an hexadecimal digit, as \h of Oniguruma.
+func isHexDigit(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+// posixClasses are the functions of the POSIX bracket classes, like [:alpha:].
+// As in Oniguruma, the classes are Unicode aware.
+var posixClasses = map[string]func(rune) bool{
+	"alnum":  func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) },
+	"alpha":  unicode.IsLetter,
+	"ascii":  func(r rune) bool { return r < 0x80 },
+	"blank":  func(r rune) bool { return r == ' ' || r == '\t' || unicode.Is(unicode.Zs, r) },
+	"cntrl":  unicode.IsControl,
+	"digit":  unicode.IsDigit,
+	"graph":  func(r rune) bool { return unicode.IsGraphic(r) && !unicode.IsSpace(r) },
+	"lower":  unicode.IsLower,
+	"print":  unicode.IsPrint,
+	"punct":  func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) },
+	"space":  unicode.IsSpace,
+	"upper":  unicode.IsUpper,
+	"word":   isWord,
+	"xdigit": isHexDigit,
+}
+
+func (c *charClass) addRange(lo, hi rune) {
+	c.ranges = append(c.ranges, lo, hi)
+}
+
+func (c *charClass) addFunc(fn func(rune) bool, negate bool) {
+	c.items = append(c.items, classItem{fn: fn, negate: negate})
+}
+
+func (c *charClass) addTable(table *unicode.RangeTable, negate bool) {
+	c.items = append(c.items, classItem{table: table, negate: negate})
+}
+
+// matches return true if r is in the class.
+func (c *charClass) matches(r rune) bool {
+	in := c.contains(r)
+	if !in && c.fold {
+		for f := unicode.SimpleFold(r); f != r && !in; f = unicode.SimpleFold(f) {
+			in = c.contains(f)
+		}
+	}
+	return in != c.negate
+}
+
+// contains return true if r is in the ranges or items of the class.
+func (c *charClass) contains(r rune) bool {
+	for i := 0; i < len(c.ranges); i += 2 {
+		if r >= c.ranges[i] && r <= c.ranges[i+1] {
+			return true
+		}
+	}
+	for _, item := range c.items {
+		var in bool
+		if item.fn != nil {
+			in = item.fn(r)
+		} else {
+			in = unicode.Is(item.table, r)
+		}
+		if in != item.negate {
+			return true
+		}
+	}
+	return false
+}
+
+// equalFold return true if a and b are equal under simple case folding.
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
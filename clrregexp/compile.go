@@ -0,0 +1,273 @@
+package clrregexp
+
+import "strings"
+
+// opcode is the operation of a program instruction.
+type opcode uint8
+
+const (
+	opMatch    opcode = iota // end of the program or sub program
+	opLookEnd                // end of a lookbehind: match when pos is reg x
+	opString                 // literal string s
+	opRune                   // rune r
+	opClass                  // rune in class
+	opAny                    // any rune except \n
+	opAnyNL                  // any rune
+	opSplit                  // continue at x, backtrack to y
+	opJump                   // continue at x
+	opSave                   // capture slot x is pos
+	opMark                   // register x is pos
+	opProgress               // fail if pos is register x, to exit empty loops
+	opAssert                 // empty width assertion
+	opBackref                // text of group x
+	opCond                   // continue at pc+1 if group x is set, else at y
+	opLook                   // lookaround with body at pc+1, continue at x
+	opAtomic                 // atomic group with body at pc+1, continue at x
+)
+
+// inst is a program instruction.
+type inst struct {
+	op     opcode
+	x, y   int
+	r      rune
+	s      string
+	class  *charClass
+	fold   bool
+	assert assertKind
+	negate bool // negative opLook
+	behind bool // lookbehind opLook
+	minw   int  // minimum width in runes of a lookbehind
+	maxw   int  // maximum width in runes of a lookbehind, -1 if unbounded
+}
+
+// maxProgSize is the maximum number of instructions of a program.
+const maxProgSize = 100000
+
+// compiler compiles a parsed regular expression into a program.
+type compiler struct {
+	prog  []inst
+	nregs int
+}
+
+// compile return the program of the regular expression n, and its number of
+// registers.
+func compile(n *node) ([]inst, int, bool) {
+	c := &compiler{}
+	c.emit(inst{op: opSave, x: 0})
+	c.compile(n)
+	c.emit(inst{op: opSave, x: 1})
+	c.emit(inst{op: opMatch})
+	if len(c.prog) > maxProgSize {
+		return nil, 0, false
+	}
+	return c.prog, c.nregs, true
+}
+
+// emit appends the instruction to the program and return its index.
+func (c *compiler) emit(i inst) int {
+	c.prog = append(c.prog, i)
+	return len(c.prog) - 1
+}
+
+func (c *compiler) compile(n *node) {
+	if len(c.prog) > maxProgSize {
+		return
+	}
+	switch n.op {
+	case nEmpty:
+	case nLiteral:
+		if n.fold {
+			c.emit(inst{op: opRune, r: n.r, fold: true})
+		} else {
+			c.emit(inst{op: opString, s: string(n.r)})
+		}
+	case nClass:
+		c.emit(inst{op: opClass, class: n.class})
+	case nAny:
+		if n.dotAll {
+			c.emit(inst{op: opAnyNL})
+		} else {
+			c.emit(inst{op: opAny})
+		}
+	case nConcat:
+		c.compileConcat(n.subs)
+	case nAlt:
+		var jumps []int
+		for i, sub := range n.subs {
+			if i == len(n.subs)-1 {
+				c.compile(sub)
+				break
+			}
+			split := c.emit(inst{op: opSplit})
+			c.prog[split].x = len(c.prog)
+			c.compile(sub)
+			jumps = append(jumps, c.emit(inst{op: opJump}))
+			c.prog[split].y = len(c.prog)
+		}
+		for _, j := range jumps {
+			c.prog[j].x = len(c.prog)
+		}
+	case nRepeat:
+		if n.possessive {
+			atomic := c.emit(inst{op: opAtomic})
+			c.compileRepeat(n)
+			c.emit(inst{op: opMatch})
+			c.prog[atomic].x = len(c.prog)
+		} else {
+			c.compileRepeat(n)
+		}
+	case nCapture:
+		c.emit(inst{op: opSave, x: 2 * n.group})
+		c.compile(n.subs[0])
+		c.emit(inst{op: opSave, x: 2*n.group + 1})
+	case nAssert:
+		c.emit(inst{op: opAssert, assert: n.assert})
+	case nBackref:
+		c.emit(inst{op: opBackref, x: n.group, fold: n.fold})
+	case nLook:
+		i := inst{op: opLook, negate: n.negate, behind: n.behind}
+		if n.behind {
+			i.minw, i.maxw = width(n.subs[0])
+			i.y = c.nregs
+			c.nregs++
+		}
+		look := c.emit(i)
+		c.compile(n.subs[0])
+		if n.behind {
+			c.emit(inst{op: opLookEnd, x: i.y})
+		} else {
+			c.emit(inst{op: opMatch})
+		}
+		c.prog[look].x = len(c.prog)
+	case nAtomic:
+		atomic := c.emit(inst{op: opAtomic})
+		c.compile(n.subs[0])
+		c.emit(inst{op: opMatch})
+		c.prog[atomic].x = len(c.prog)
+	case nCond:
+		cond := c.emit(inst{op: opCond, x: n.group})
+		c.compile(n.subs[0])
+		jump := c.emit(inst{op: opJump})
+		c.prog[cond].y = len(c.prog)
+		c.compile(n.subs[1])
+		c.prog[jump].x = len(c.prog)
+	}
+}
+
+// compileConcat compiles the sequence of nodes, merging the adjacent case
+// sensitive literals into one string.
+func (c *compiler) compileConcat(subs []*node) {
+	var lit strings.Builder
+	for _, sub := range subs {
+		if sub.op == nLiteral && !sub.fold {
+			lit.WriteRune(sub.r)
+			continue
+		}
+		if lit.Len() > 0 {
+			c.emit(inst{op: opString, s: lit.String()})
+			lit.Reset()
+		}
+		c.compile(sub)
+	}
+	if lit.Len() > 0 {
+		c.emit(inst{op: opString, s: lit.String()})
+	}
+}
+
+// compileRepeat compiles the repetition n.
+func (c *compiler) compileRepeat(n *node) {
+	sub := n.subs[0]
+	for i := 0; i < n.min; i++ {
+		c.compile(sub)
+	}
+	if n.max < 0 {
+		// loop:  split body, end (reversed when not greedy)
+		// body:  [mark reg] sub [progress reg] jump loop
+		loop := c.emit(inst{op: opSplit})
+		body := len(c.prog)
+		minw, _ := width(sub)
+		reg := -1
+		if minw == 0 {
+			reg = c.nregs
+			c.nregs++
+			c.emit(inst{op: opMark, x: reg})
+		}
+		c.compile(sub)
+		if reg >= 0 {
+			c.emit(inst{op: opProgress, x: reg})
+		}
+		c.emit(inst{op: opJump, x: loop})
+		c.setSplit(loop, body, len(c.prog), n.greedy)
+		return
+	}
+	// optional repetitions: split body, end; body: sub ...
+	var splits []int
+	for i := n.min; i < n.max; i++ {
+		split := c.emit(inst{op: opSplit})
+		splits = append(splits, split)
+		c.prog[split].x = len(c.prog)
+		c.compile(sub)
+	}
+	for _, split := range splits {
+		c.setSplit(split, c.prog[split].x, len(c.prog), n.greedy)
+	}
+}
+
+// setSplit sets the targets of the split instruction, preferring body when greedy.
+func (c *compiler) setSplit(split, body, end int, greedy bool) {
+	if greedy {
+		c.prog[split].x, c.prog[split].y = body, end
+	} else {
+		c.prog[split].x, c.prog[split].y = end, body
+	}
+}
+
+// width return the minimum and maximum number of runes matched by n. The
+// maximum is -1 when unbounded.
+func width(n *node) (min, max int) {
+	switch n.op {
+	case nLiteral, nClass, nAny:
+		return 1, 1
+	case nConcat:
+		for _, sub := range n.subs {
+			lo, hi := width(sub)
+			min += lo
+			if max >= 0 {
+				if hi < 0 {
+					max = -1
+				} else {
+					max += hi
+				}
+			}
+		}
+		return min, max
+	case nAlt, nCond:
+		for i, sub := range n.subs {
+			lo, hi := width(sub)
+			if i == 0 || lo < min {
+				min = lo
+			}
+			if i == 0 || (max >= 0 && (hi < 0 || hi > max)) {
+				max = hi
+			}
+		}
+		return min, max
+	case nRepeat:
+		lo, hi := width(n.subs[0])
+		min = lo * n.min
+		switch {
+		case hi == 0:
+			max = 0
+		case hi < 0 || n.max < 0:
+			max = -1
+		default:
+			max = hi * n.max
+		}
+		return min, max
+	case nCapture, nAtomic:
+		return width(n.subs[0])
+	case nBackref:
+		return 0, -1
+	}
+	return 0, 0
+}
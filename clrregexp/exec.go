@@ -0,0 +1,287 @@
+package clrregexp
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// entryKind is the kind of a backtracking stack entry.
+type entryKind uint8
+
+const (
+	eBranch entryKind = iota // resume at pc a with pos b
+	eCap                     // restore capture slot a to b
+	eReg                     // restore register a to b
+)
+
+// entry is a backtracking stack entry.
+type entry struct {
+	kind entryKind
+	a, b int
+}
+
+// matcher is the state of a match.
+type matcher struct {
+	prog  []inst
+	s     string
+	caps  []int
+	regs  []int
+	stack []entry
+	steps int
+	limit int
+	start int // position where the search started, matched by \G
+	// hitEnd is set when the end of s is examined, so that the match could
+	// change with more text.
+	hitEnd bool
+}
+
+func (m *matcher) push(kind entryKind, a, b int) {
+	m.stack = append(m.stack, entry{kind: kind, a: a, b: b})
+}
+
+// unwind pops the stack entries above base, restoring captures and registers.
+func (m *matcher) unwind(base int) {
+	for i := len(m.stack) - 1; i >= base; i-- {
+		switch e := m.stack[i]; e.kind {
+		case eCap:
+			m.caps[e.a] = e.b
+		case eReg:
+			m.regs[e.a] = e.b
+		}
+	}
+	m.stack = m.stack[:base]
+}
+
+// run executes the program from pc at pos until an opMatch or opLookEnd
+// succeeds, and return the end position of the match. The entries pushed on the
+// stack are left in place on success, and popped on failure.
+func (m *matcher) run(pc, pos int) (int, bool, error) {
+	base := len(m.stack)
+	for {
+		if m.steps++; m.steps > m.limit {
+			return 0, false, ErrStepLimit
+		}
+		in := &m.prog[pc]
+		ok := true
+		switch in.op {
+		case opMatch:
+			return pos, true, nil
+		case opLookEnd:
+			if pos == m.regs[in.x] {
+				return pos, true, nil
+			}
+			ok = false
+		case opString:
+			if ok = strings.HasPrefix(m.s[pos:], in.s); ok {
+				pos += len(in.s)
+				pc++
+			} else if len(m.s)-pos < len(in.s) && strings.HasPrefix(in.s, m.s[pos:]) {
+				m.hitEnd = true
+			}
+		case opRune:
+			r, n := utf8.DecodeRuneInString(m.s[pos:])
+			m.hitEnd = m.hitEnd || n == 0
+			if ok = n > 0 && (r == in.r || (in.fold && equalFold(r, in.r))); ok {
+				pos += n
+				pc++
+			}
+		case opClass:
+			r, n := utf8.DecodeRuneInString(m.s[pos:])
+			m.hitEnd = m.hitEnd || n == 0
+			if ok = n > 0 && in.class.matches(r); ok {
+				pos += n
+				pc++
+			}
+		case opAny, opAnyNL:
+			r, n := utf8.DecodeRuneInString(m.s[pos:])
+			m.hitEnd = m.hitEnd || n == 0
+			if ok = n > 0 && (r != '\n' || in.op == opAnyNL); ok {
+				pos += n
+				pc++
+			}
+		case opSplit:
+			m.push(eBranch, in.y, pos)
+			pc = in.x
+		case opJump:
+			pc = in.x
+		case opSave:
+			m.push(eCap, in.x, m.caps[in.x])
+			m.caps[in.x] = pos
+			pc++
+		case opMark:
+			m.push(eReg, in.x, m.regs[in.x])
+			m.regs[in.x] = pos
+			pc++
+		case opProgress:
+			if ok = pos != m.regs[in.x]; ok {
+				pc++
+			}
+		case opAssert:
+			if ok = m.assert(in.assert, pos); ok {
+				pc++
+			}
+		case opBackref:
+			var n int
+			if n, ok = m.backref(in, pos); ok {
+				pos += n
+				pc++
+			}
+		case opCond:
+			if m.caps[2*in.x+1] >= 0 {
+				pc++
+			} else {
+				pc = in.y
+			}
+		case opLook:
+			var err error
+			if ok, err = m.look(in, pc, pos); err != nil {
+				return 0, false, err
+			}
+			pc = in.x
+		case opAtomic:
+			end, matched, err := m.sub(pc+1, pos)
+			if err != nil {
+				return 0, false, err
+			}
+			if ok = matched; ok {
+				pos = end
+				pc = in.x
+			}
+		}
+		if ok {
+			continue
+		}
+		// backtrack to the last branch
+		for {
+			if len(m.stack) == base {
+				return 0, false, nil
+			}
+			e := m.stack[len(m.stack)-1]
+			m.stack = m.stack[:len(m.stack)-1]
+			if e.kind == eBranch {
+				pc, pos = e.a, e.b
+				break
+			}
+			if e.kind == eCap {
+				m.caps[e.a] = e.b
+			} else {
+				m.regs[e.a] = e.b
+			}
+		}
+	}
+}
+
+// sub runs the sub program at pc as an atomic group: on success, the branches
+// of the sub program are dropped from the stack, but not the restore entries,
+// so that the captures of the sub program are restored when backtracking.
+func (m *matcher) sub(pc, pos int) (int, bool, error) {
+	base := len(m.stack)
+	end, ok, err := m.run(pc, pos)
+	if ok {
+		n := base
+		for _, e := range m.stack[base:] {
+			if e.kind != eBranch {
+				m.stack[n] = e
+				n++
+			}
+		}
+		m.stack = m.stack[:n]
+	}
+	return end, ok, err
+}
+
+// look return true if the lookaround assertion in at pc succeeds at pos.
+func (m *matcher) look(in *inst, pc, pos int) (bool, error) {
+	base := len(m.stack)
+	matched := false
+	if !in.behind {
+		_, ok, err := m.sub(pc+1, pos)
+		if err != nil {
+			return false, err
+		}
+		matched = ok
+	} else {
+		// try the start positions from the nearest
+		m.regs[in.y] = pos
+		start := pos
+		for k := 0; in.maxw < 0 || k <= in.maxw; k++ {
+			if k >= in.minw {
+				_, ok, err := m.sub(pc+1, start)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					matched = true
+					break
+				}
+			}
+			if start == 0 {
+				break
+			}
+			_, n := utf8.DecodeLastRuneInString(m.s[:start])
+			start -= n
+		}
+	}
+	if matched && in.negate {
+		m.unwind(base)
+	}
+	return matched != in.negate, nil
+}
+
+// backref return the length of the text of the group x of in at pos, and true
+// if the text matches.
+func (m *matcher) backref(in *inst, pos int) (int, bool) {
+	beg, end := m.caps[2*in.x], m.caps[2*in.x+1]
+	if beg < 0 || end < 0 {
+		return 0, false
+	}
+	ref := m.s[beg:end]
+	if !in.fold {
+		if len(m.s)-pos < len(ref) && strings.HasPrefix(ref, m.s[pos:]) {
+			m.hitEnd = true
+		}
+		return len(ref), strings.HasPrefix(m.s[pos:], ref)
+	}
+	i := pos
+	for _, r := range ref {
+		c, n := utf8.DecodeRuneInString(m.s[i:])
+		m.hitEnd = m.hitEnd || n == 0
+		if n == 0 || !equalFold(r, c) {
+			return 0, false
+		}
+		i += n
+	}
+	return i - pos, true
+}
+
+// assert return true if the assertion a is true at pos.
+func (m *matcher) assert(a assertKind, pos int) bool {
+	s := m.s
+	if (a == aEndTextNL && pos >= len(s)-1) || (a != aBeginText && a != aBeginLine && a != aSearchStart && pos == len(s)) {
+		m.hitEnd = true
+	}
+	switch a {
+	case aBeginText:
+		return pos == 0
+	case aEndText:
+		return pos == len(s)
+	case aEndTextNL:
+		return pos == len(s) || (pos == len(s)-1 && s[pos] == '\n')
+	case aBeginLine:
+		return pos == 0 || s[pos-1] == '\n'
+	case aEndLine:
+		return pos == len(s) || s[pos] == '\n'
+	case aSearchStart:
+		return pos == m.start
+	}
+	var before, after bool
+	if pos > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:pos])
+		before = isWord(r)
+	}
+	if pos < len(s) {
+		r, _ := utf8.DecodeRuneInString(s[pos:])
+		after = isWord(r)
+	}
+	return (before != after) == (a == aWordBoundary)
+}
@@ -0,0 +1,821 @@
+package clrregexp
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Error is a regular expression syntax error.
+type Error struct {
+	Msg  string // Description of the error.
+	Expr string // Regular expression.
+	Pos  int    // Byte offset of the error in Expr.
+}
+
+// Error return the error message.
+func (e *Error) Error() string {
+	return "error parsing regexp: " + e.Msg + " at position " + strconv.Itoa(e.Pos) + ": `" + e.Expr + "`"
+}
+
+// nodeOp is the operation of a parsed regular expression node.
+type nodeOp uint8
+
+const (
+	nEmpty   nodeOp = iota // empty string
+	nLiteral               // rune r
+	nClass                 // rune in class
+	nAny                   // any rune, except \n when not dotAll
+	nConcat                // subs in sequence
+	nAlt                   // one of subs, in order of preference
+	nRepeat                // subs[0] repeated min to max (-1 = infinite) times
+	nCapture               // capture group subs[0]
+	nAssert                // empty width assertion
+	nBackref               // text of the capture group
+	nLook                  // lookahead or lookbehind assertion
+	nAtomic                // atomic group
+	nCond                  // subs[0] if group is set, else subs[1]
+)
+
+// assertKind is the kind of an empty width assertion.
+type assertKind uint8
+
+const (
+	aBeginText      assertKind = iota // \A or ^ when not multiline
+	aEndText                          // \Z, \z
+	aEndTextNL                        // $ when not multiline: end of text or before a final \n
+	aBeginLine                        // ^ when multiline
+	aEndLine                          // $ when multiline
+	aWordBoundary                     // \b
+	aNoWordBoundary                   // \B
+	aSearchStart                      // \G: position where the search started
+)
+
+// node is a parsed regular expression.
+type node struct {
+	op         nodeOp
+	r          rune       // rune of nLiteral
+	class      *charClass // class of nClass
+	subs       []*node
+	min, max   int        // repetition bounds of nRepeat
+	greedy     bool       // greedy nRepeat
+	possessive bool       // possessive nRepeat
+	group      int        // group number of nCapture, nBackref and nCond
+	assert     assertKind // assertion of nAssert
+	negate     bool       // negative nLook
+	behind     bool       // lookbehind nLook
+	fold       bool       // case insensitive nLiteral, nClass and nBackref
+	dotAll     bool       // nAny matching \n
+}
+
+// flags are the inline flags of a group.
+type flags struct {
+	fold, multiline, dotAll, verbose bool
+}
+
+// parser parses a regular expression.
+type parser struct {
+	expr   string
+	pos    int
+	flags  flags
+	ncap   int            // number of capture groups
+	names  map[string]int // named groups
+	groups []string       // name of the capture groups, "" if unnamed
+	refs   []groupRef     // group references checked at the end
+}
+
+// groupRef is a reference to a capture group.
+type groupRef struct {
+	group int
+	pos   int
+}
+
+// parse return the parsed regular expression, its number of capture groups
+// and their names.
+func parse(expr string) (*node, []string, error) {
+	p := &parser{expr: expr, names: make(map[string]int), groups: []string{""}}
+	n, err := p.parseAlt()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.expr) {
+		return nil, nil, p.error("unbalanced parenthesis", p.pos)
+	}
+	for _, ref := range p.refs {
+		if ref.group > p.ncap {
+			return nil, nil, p.error("invalid group reference "+strconv.Itoa(ref.group), ref.pos)
+		}
+	}
+	return n, p.groups, nil
+}
+
+func (p *parser) error(msg string, pos int) error {
+	return &Error{Msg: msg, Expr: p.expr, Pos: pos}
+}
+
+func (p *parser) more() bool {
+	return p.pos < len(p.expr)
+}
+
+func (p *parser) peek() byte {
+	return p.expr[p.pos]
+}
+
+func (p *parser) next() rune {
+	r, n := utf8.DecodeRuneInString(p.expr[p.pos:])
+	p.pos += n
+	return r
+}
+
+func (p *parser) consume(prefix string) bool {
+	if strings.HasPrefix(p.expr[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// skipVerbose skips white spaces and comments in verbose mode.
+func (p *parser) skipVerbose() {
+	for p.flags.verbose && p.more() {
+		switch c := p.peek(); {
+		case c == '#':
+			for p.more() && p.peek() != '\n' {
+				p.pos++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// parseAlt parses alternatives up to the end of the group. The flags set in
+// the group are restored at its end.
+func (p *parser) parseAlt() (*node, error) {
+	saved := p.flags
+	defer func() { p.flags = saved }()
+	var alts []*node
+	for {
+		n, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, n)
+		if !p.more() || p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return &node{op: nAlt, subs: alts}, nil
+}
+
+// parseConcat parses a sequence of quantified atoms.
+func (p *parser) parseConcat() (*node, error) {
+	var subs []*node
+	for {
+		p.skipVerbose()
+		if !p.more() || p.peek() == '|' || p.peek() == ')' {
+			break
+		}
+		n, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		if n == nil { // flags or comment
+			continue
+		}
+		if n, err = p.parseQuantifiers(n); err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+	}
+	switch len(subs) {
+	case 0:
+		return &node{op: nEmpty}, nil
+	case 1:
+		return subs[0], nil
+	}
+	return &node{op: nConcat, subs: subs}, nil
+}
+
+// parseQuantifiers parses the quantifier following the atom n.
+func (p *parser) parseQuantifiers(n *node) (*node, error) {
+	p.skipVerbose()
+	if !p.more() {
+		return n, nil
+	}
+	pos := p.pos
+	min, max := 0, 0
+	switch p.peek() {
+	case '*':
+		min, max = 0, -1
+		p.pos++
+	case '+':
+		min, max = 1, -1
+		p.pos++
+	case '?':
+		min, max = 0, 1
+		p.pos++
+	case '{':
+		var ok bool
+		if min, max, ok = p.parseRepeat(); !ok {
+			return n, nil
+		}
+	default:
+		return n, nil
+	}
+	if n.op == nAssert || n.op == nLook {
+		return nil, p.error("nothing to repeat", pos)
+	}
+	if max >= 0 && min > max {
+		return nil, p.error("min repeat greater than max repeat", pos)
+	}
+	if min > maxRepeat || max > maxRepeat {
+		return nil, p.error("repeat count too large", pos)
+	}
+	rep := &node{op: nRepeat, subs: []*node{n}, min: min, max: max, greedy: true}
+	if p.more() {
+		switch p.peek() {
+		case '?':
+			rep.greedy = false
+			p.pos++
+		case '+':
+			rep.possessive = true
+			p.pos++
+		}
+	}
+	p.skipVerbose()
+	if p.more() {
+		switch c := p.peek(); {
+		case c == '*' || c == '+' || c == '?':
+			return nil, p.error("multiple repeat", p.pos)
+		case c == '{':
+			save := p.pos
+			if _, _, ok := p.parseRepeat(); ok {
+				return nil, p.error("multiple repeat", save)
+			}
+			p.pos = save
+		}
+	}
+	return rep, nil
+}
+
+// maxRepeat is the maximum repetition count.
+const maxRepeat = 1000
+
+// parseRepeat parses {n}, {n,}, {,m} or {n,m}. It return false and leaves the
+// position unchanged if the text is not a repetition, in which case { is a
+// literal.
+func (p *parser) parseRepeat() (min, max int, ok bool) {
+	save := p.pos
+	p.pos++ // {
+	readInt := func() (int, bool) {
+		beg := p.pos
+		for p.more() && p.peek() >= '0' && p.peek() <= '9' {
+			p.pos++
+		}
+		if beg == p.pos {
+			return 0, false
+		}
+		v, err := strconv.Atoi(p.expr[beg:p.pos])
+		if err != nil || v > maxRepeat {
+			v = maxRepeat + 1
+		}
+		return v, true
+	}
+	min, hasMin := readInt()
+	max = min
+	if p.more() && p.peek() == ',' {
+		p.pos++
+		var hasMax bool
+		if max, hasMax = readInt(); !hasMax {
+			max = -1
+		}
+		if !hasMin {
+			min = 0
+		}
+	} else if !hasMin {
+		p.pos = save
+		return 0, 0, false
+	}
+	if !p.more() || p.peek() != '}' {
+		p.pos = save
+		return 0, 0, false
+	}
+	p.pos++
+	return min, max, true
+}
+
+// parseAtom parses an atom. It return nil for a flag group or a comment.
+func (p *parser) parseAtom() (*node, error) {
+	pos := p.pos
+	switch c := p.peek(); c {
+	case '(':
+		return p.parseGroup()
+	case '[':
+		return p.parseClass()
+	case '.':
+		p.pos++
+		return &node{op: nAny, dotAll: p.flags.dotAll}, nil
+	case '^':
+		p.pos++
+		if p.flags.multiline {
+			return &node{op: nAssert, assert: aBeginLine}, nil
+		}
+		return &node{op: nAssert, assert: aBeginText}, nil
+	case '$':
+		p.pos++
+		if p.flags.multiline {
+			return &node{op: nAssert, assert: aEndLine}, nil
+		}
+		return &node{op: nAssert, assert: aEndTextNL}, nil
+	case '\\':
+		return p.parseEscape()
+	case '*', '+', '?':
+		return nil, p.error("nothing to repeat", pos)
+	case '{':
+		if _, _, ok := p.parseRepeat(); ok {
+			return nil, p.error("nothing to repeat", pos)
+		}
+	}
+	return p.literal(p.next()), nil
+}
+
+// literal return the node matching r.
+func (p *parser) literal(r rune) *node {
+	return &node{op: nLiteral, r: r, fold: p.flags.fold}
+}
+
+// parseGroup parses a group starting with (.
+func (p *parser) parseGroup() (*node, error) {
+	pos := p.pos
+	p.pos++ // (
+	n := &node{}
+	var capture bool
+	var name string
+	switch {
+	case p.consume("?#"):
+		for p.more() && p.peek() != ')' {
+			p.pos++
+		}
+		if !p.more() {
+			return nil, p.error("missing ), unterminated comment", pos)
+		}
+		p.pos++
+		return nil, nil
+	case p.consume("?:"):
+	case p.consume("?>"):
+		n.op = nAtomic
+	case p.consume("?="):
+		n.op = nLook
+	case p.consume("?!"):
+		n.op, n.negate = nLook, true
+	case p.consume("?<="):
+		n.op, n.behind = nLook, true
+	case p.consume("?<!"):
+		n.op, n.behind, n.negate = nLook, true, true
+	case p.consume("?P="):
+		name, err := p.parseName(')')
+		if err != nil {
+			return nil, err
+		}
+		group, ok := p.names[name]
+		if !ok {
+			return nil, p.error("unknown group name '"+name+"'", pos)
+		}
+		return &node{op: nBackref, group: group, fold: p.flags.fold}, nil
+	case p.consume("?P<"), p.consume("?<"):
+		var err error
+		if name, err = p.parseName('>'); err != nil {
+			return nil, err
+		}
+		if _, ok := p.names[name]; ok {
+			return nil, p.error("redefinition of group name '"+name+"'", pos)
+		}
+		capture = true
+		p.names[name] = p.ncap + 1
+	case p.consume("?("):
+		return p.parseCond(pos)
+	case p.more() && p.peek() == '?':
+		return p.parseFlags(pos)
+	default:
+		capture = true
+	}
+	if capture {
+		p.ncap++
+		n.op, n.group = nCapture, p.ncap
+		p.groups = append(p.groups, name)
+	}
+	sub, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	if !p.more() || p.peek() != ')' {
+		return nil, p.error("missing ), unterminated subpattern", pos)
+	}
+	p.pos++
+	if n.op == nEmpty { // non capturing group
+		return sub, nil
+	}
+	n.subs = []*node{sub}
+	return n, nil
+}
+
+// parseName parses a group name terminated by end.
+func (p *parser) parseName(end byte) (string, error) {
+	pos := p.pos
+	i := strings.IndexByte(p.expr[p.pos:], end)
+	if i < 0 {
+		return "", p.error("missing "+string(end)+", unterminated name", pos)
+	}
+	name := p.expr[p.pos : p.pos+i]
+	for j, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (j == 0 || !unicode.IsDigit(r)) {
+			return "", p.error("bad character in group name '"+name+"'", pos)
+		}
+	}
+	if name == "" {
+		return "", p.error("missing group name", pos)
+	}
+	p.pos += i + 1
+	return name, nil
+}
+
+// parseCond parses the conditional group (?(group)yes|no).
+func (p *parser) parseCond(pos int) (*node, error) {
+	i := strings.IndexByte(p.expr[p.pos:], ')')
+	if i < 0 {
+		return nil, p.error("missing ), unterminated name", p.pos)
+	}
+	ref := p.expr[p.pos : p.pos+i]
+	group, err := strconv.Atoi(ref)
+	if err != nil {
+		var ok bool
+		if group, ok = p.names[ref]; !ok {
+			return nil, p.error("unknown group name '"+ref+"'", p.pos)
+		}
+	}
+	p.refs = append(p.refs, groupRef{group: group, pos: p.pos})
+	p.pos += i + 1
+	saved := p.flags
+	yes, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	no := &node{op: nEmpty}
+	if p.more() && p.peek() == '|' {
+		p.pos++
+		if no, err = p.parseConcat(); err != nil {
+			return nil, err
+		}
+	}
+	p.flags = saved
+	if !p.more() || p.peek() != ')' {
+		if p.more() && p.peek() == '|' {
+			return nil, p.error("conditional group with more than two branches", p.pos)
+		}
+		return nil, p.error("missing ), unterminated subpattern", pos)
+	}
+	p.pos++
+	return &node{op: nCond, group: group, subs: []*node{yes, no}}, nil
+}
+
+// parseFlags parses (?flags), (?flags:re) and (?flags-flags:re).
+func (p *parser) parseFlags(pos int) (*node, error) {
+	p.pos++ // ?
+	f := p.flags
+	set := true
+	for p.more() {
+		c := p.peek()
+		p.pos++
+		switch c {
+		case 'i':
+			f.fold = set
+		case 'm':
+			f.multiline = set
+		case 's':
+			f.dotAll = set
+		case 'x':
+			f.verbose = set
+		case 'a', 'u', 'L', 'U':
+			// character set flags are ignored: matching is always Unicode aware
+		case '-':
+			if !set {
+				return nil, p.error("unknown flag", p.pos-1)
+			}
+			set = false
+		case ')':
+			p.flags = f
+			return nil, nil
+		case ':':
+			saved := p.flags
+			p.flags = f
+			sub, err := p.parseAlt()
+			p.flags = saved
+			if err != nil {
+				return nil, err
+			}
+			if !p.more() || p.peek() != ')' {
+				return nil, p.error("missing ), unterminated subpattern", pos)
+			}
+			p.pos++
+			return sub, nil
+		default:
+			return nil, p.error("unknown extension ?"+string(c), pos+1)
+		}
+	}
+	return nil, p.error("missing -, : or )", p.pos)
+}
+
+// parseEscape parses an escape sequence outside of a class.
+func (p *parser) parseEscape() (*node, error) {
+	pos := p.pos
+	p.pos++ // \
+	if !p.more() {
+		return nil, p.error("bad escape (end of pattern)", pos)
+	}
+	c := p.peek()
+	switch c {
+	case 'A':
+		p.pos++
+		return &node{op: nAssert, assert: aBeginText}, nil
+	case 'Z', 'z':
+		p.pos++
+		return &node{op: nAssert, assert: aEndText}, nil
+	case 'b':
+		p.pos++
+		return &node{op: nAssert, assert: aWordBoundary}, nil
+	case 'B':
+		p.pos++
+		return &node{op: nAssert, assert: aNoWordBoundary}, nil
+	case 'G':
+		p.pos++
+		return &node{op: nAssert, assert: aSearchStart}, nil
+	case 'k':
+		p.pos++
+		if !p.consume("<") {
+			return nil, p.error("bad escape \\k", pos)
+		}
+		name, err := p.parseName('>')
+		if err != nil {
+			return nil, err
+		}
+		group, ok := p.names[name]
+		if !ok {
+			return nil, p.error("unknown group name '"+name+"'", pos)
+		}
+		return &node{op: nBackref, group: group, fold: p.flags.fold}, nil
+	}
+	if c >= '1' && c <= '9' {
+		// octal escape with 3 digits, else group reference
+		if p.pos+3 <= len(p.expr) && isOctal(p.expr[p.pos]) && isOctal(p.expr[p.pos+1]) && isOctal(p.expr[p.pos+2]) {
+			v, _ := strconv.ParseUint(p.expr[p.pos:p.pos+3], 8, 32)
+			p.pos += 3
+			if v > 0377 {
+				return nil, p.error("octal escape value outside of range 0-0o377", pos)
+			}
+			return p.literal(rune(v)), nil
+		}
+		beg := p.pos
+		p.pos++
+		if p.more() && p.peek() >= '0' && p.peek() <= '9' {
+			p.pos++
+		}
+		group, _ := strconv.Atoi(p.expr[beg:p.pos])
+		if group > p.ncap {
+			return nil, p.error("invalid group reference "+strconv.Itoa(group), pos)
+		}
+		return &node{op: nBackref, group: group, fold: p.flags.fold}, nil
+	}
+	cls, r, err := p.parseClassEscape(pos)
+	if err != nil {
+		return nil, err
+	}
+	if cls != nil {
+		cls.fold = p.flags.fold
+		return &node{op: nClass, class: cls}, nil
+	}
+	return p.literal(r), nil
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+// parseClassEscape parses an escape sequence, following \, that is valid in a
+// class. It return the class of a class escape, or else the escaped rune.
+func (p *parser) parseClassEscape(pos int) (*charClass, rune, error) {
+	c := p.next()
+	switch c {
+	case 'd', 'D', 'w', 'W', 's', 'S':
+		cls := &charClass{}
+		cls.addFunc(perlClasses[unicode.ToLower(c)], unicode.IsUpper(c))
+		return cls, 0, nil
+	case 'h', 'H':
+		// Oniguruma hexadecimal digit class
+		cls := &charClass{}
+		cls.addFunc(isHexDigit, c == 'H')
+		return cls, 0, nil
+	case 'p', 'P':
+		table, negate, err := p.parseUnicodeClass(pos)
+		if err != nil {
+			return nil, 0, err
+		}
+		cls := &charClass{}
+		cls.addTable(table, negate != (c == 'P'))
+		return cls, 0, nil
+	case 'a':
+		return nil, '\a', nil
+	case 'f':
+		return nil, '\f', nil
+	case 'n':
+		return nil, '\n', nil
+	case 'r':
+		return nil, '\r', nil
+	case 't':
+		return nil, '\t', nil
+	case 'v':
+		return nil, '\v', nil
+	case '0':
+		// octal escape of up to 3 digits
+		beg := p.pos - 1
+		for p.pos < beg+3 && p.more() && isOctal(p.peek()) {
+			p.pos++
+		}
+		v, _ := strconv.ParseUint(p.expr[beg:p.pos], 8, 32)
+		return nil, rune(v), nil
+	case 'x', 'u', 'U':
+		size := map[rune]int{'x': 2, 'u': 4, 'U': 8}[c]
+		if c == 'x' && p.more() && p.peek() == '{' {
+			// Go and Perl syntax \x{hhhh}
+			i := strings.IndexByte(p.expr[p.pos:], '}')
+			if i < 0 {
+				return nil, 0, p.error("missing }", pos)
+			}
+			v, err := strconv.ParseUint(p.expr[p.pos+1:p.pos+i], 16, 32)
+			if err != nil || v > unicode.MaxRune {
+				return nil, 0, p.error("bad escape \\x", pos)
+			}
+			p.pos += i + 1
+			return nil, rune(v), nil
+		}
+		if p.pos+size > len(p.expr) {
+			return nil, 0, p.error("incomplete escape \\"+string(c), pos)
+		}
+		v, err := strconv.ParseUint(p.expr[p.pos:p.pos+size], 16, 32)
+		if err != nil || v > unicode.MaxRune {
+			return nil, 0, p.error("bad escape \\"+string(c), pos)
+		}
+		p.pos += size
+		return nil, rune(v), nil
+	}
+	if c < utf8.RuneSelf && (unicode.IsLetter(c) || unicode.IsDigit(c)) {
+		return nil, 0, p.error("bad escape \\"+string(c), pos)
+	}
+	return nil, c, nil
+}
+
+// parseUnicodeClass parses the Unicode class name following \p or \P.
+func (p *parser) parseUnicodeClass(pos int) (*unicode.RangeTable, bool, error) {
+	if !p.more() {
+		return nil, false, p.error("missing Unicode class name", pos)
+	}
+	name := ""
+	if p.peek() == '{' {
+		i := strings.IndexByte(p.expr[p.pos:], '}')
+		if i < 0 {
+			return nil, false, p.error("missing }", pos)
+		}
+		name = p.expr[p.pos+1 : p.pos+i]
+		p.pos += i + 1
+	} else {
+		name = string(p.next())
+	}
+	negate := strings.HasPrefix(name, "^")
+	if negate {
+		name = name[1:]
+	}
+	if name == "Any" {
+		return &unicode.RangeTable{R32: []unicode.Range32{{Lo: 0, Hi: unicode.MaxRune, Stride: 1}}}, negate, nil
+	}
+	if t, ok := unicode.Categories[name]; ok {
+		return t, negate, nil
+	}
+	if t, ok := unicode.Scripts[name]; ok {
+		return t, negate, nil
+	}
+	return nil, false, p.error("unknown Unicode class '"+name+"'", pos)
+}
+
+// parseClass parses a character class starting with [.
+func (p *parser) parseClass() (*node, error) {
+	pos := p.pos
+	p.pos++ // [
+	cls := &charClass{fold: p.flags.fold}
+	if p.more() && p.peek() == '^' {
+		cls.negate = true
+		p.pos++
+	}
+	first := true
+	for {
+		if !p.more() {
+			return nil, p.error("unterminated character set", pos)
+		}
+		if p.peek() == ']' && !first {
+			p.pos++
+			break
+		}
+		first = false
+		if ok, err := p.parsePosixClass(cls); err != nil {
+			return nil, err
+		} else if ok {
+			continue
+		}
+		lo, isRune, err := p.parseClassItem(cls)
+		if err != nil {
+			return nil, err
+		}
+		if !isRune {
+			continue
+		}
+		hi := lo
+		if p.pos+1 < len(p.expr) && p.peek() == '-' && p.expr[p.pos+1] != ']' {
+			rangePos := p.pos
+			p.pos++
+			var ok bool
+			if hi, ok, err = p.parseClassItem(cls); err != nil {
+				return nil, err
+			}
+			if !ok || hi < lo {
+				return nil, p.error("bad character range", rangePos)
+			}
+		}
+		cls.addRange(lo, hi)
+	}
+	return &node{op: nClass, class: cls}, nil
+}
+
+// parsePosixClass parses a POSIX bracket class, like [:alpha:] or [:^alpha:],
+// of a class and adds it to cls. It return false when the class doesn't start
+// with a POSIX bracket class.
+func (p *parser) parsePosixClass(cls *charClass) (bool, error) {
+	if !strings.HasPrefix(p.expr[p.pos:], "[:") {
+		return false, nil
+	}
+	end := strings.Index(p.expr[p.pos+2:], ":]")
+	if end < 0 {
+		return false, nil
+	}
+	pos := p.pos
+	name := p.expr[p.pos+2 : p.pos+2+end]
+	negate := strings.HasPrefix(name, "^")
+	f, ok := posixClasses[strings.TrimPrefix(name, "^")]
+	if !ok {
+		return false, p.error("unknown POSIX class '"+name+"'", pos)
+	}
+	p.pos += end + 4
+	sub := &charClass{}
+	sub.addFunc(f, negate)
+	cls.items = append(cls.items, sub.items...)
+	return true, nil
+}
+
+// parseClassItem parses a rune or a class escape of a class. Class escapes
+// are added to cls, and false is returned.
+func (p *parser) parseClassItem(cls *charClass) (rune, bool, error) {
+	if p.peek() != '\\' {
+		return p.next(), true, nil
+	}
+	pos := p.pos
+	p.pos++
+	if !p.more() {
+		return 0, false, p.error("bad escape (end of pattern)", pos)
+	}
+	if p.peek() == 'b' {
+		p.pos++
+		return '\b', true, nil
+	}
+	if c := p.peek(); c >= '1' && c <= '7' {
+		beg := p.pos
+		for p.pos < beg+3 && p.more() && isOctal(p.peek()) {
+			p.pos++
+		}
+		v, _ := strconv.ParseUint(p.expr[beg:p.pos], 8, 32)
+		return rune(v), true, nil
+	}
+	sub, r, err := p.parseClassEscape(pos)
+	if err != nil {
+		return 0, false, err
+	}
+	if sub != nil {
+		cls.items = append(cls.items, sub.items...)
+		return 0, false, nil
+	}
+	return r, true, nil
+}
@@ -0,0 +1,183 @@
+// Package clrregexp implements a backtracking regular expression engine
+// compatible with the Python re syntax used by the Pygments lexers.
+//
+// Unlike the linear time RE2 engine of the regexp package, it supports
+// lookahead (?=...) (?!...), lookbehind (?<=...) (?<!...), backreferences \1
+// (?P=name) \k<name>, possessive quantifiers *+ ++ ?+ {n,m}+, atomic groups
+// (?>...) and conditional groups (?(1)yes|no). Because backtracking may take
+// an exponential time, the number of steps of a match is limited.
+//
+// The classes \d, \w, \s and \b are Unicode aware, as in Python. The Go and Perl
+// syntax \pL, \p{Greek} and \x{hhhh} are also supported, as well as the
+// Oniguruma syntax of the TextMate grammars: \h and \H for the hexadecimal
+// digits, the POSIX bracket classes like [[:alpha:]], and \G matching at the
+// position where the search started.
+package clrregexp
+
+import (
+	"errors"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultStepLimit is the default maximum number of steps of a match.
+const DefaultStepLimit = 1000000
+
+// ErrStepLimit is returned when a match exceeds the step limit.
+var ErrStepLimit = errors.New("regexp step limit exceeded")
+
+// Regexp is a compiled regular expression. It is safe for concurrent use.
+type Regexp struct {
+	expr      string
+	prog      []inst
+	names     []string
+	nregs     int
+	stepLimit int
+	pool      *sync.Pool
+}
+
+// Compile parses a regular expression and return a Regexp with the
+// DefaultStepLimit.
+func Compile(expr string) (*Regexp, error) {
+	n, names, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	prog, nregs, ok := compile(n)
+	if !ok {
+		return nil, &Error{Msg: "expression too large", Expr: expr}
+	}
+	return &Regexp{
+		expr:      expr,
+		prog:      prog,
+		names:     names,
+		nregs:     nregs,
+		stepLimit: DefaultStepLimit,
+		pool:      new(sync.Pool),
+	}, nil
+}
+
+// MustCompile is like Compile but panics if the expression can't be parsed.
+func MustCompile(expr string) *Regexp {
+	re, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// WithStepLimit return a copy of re with the given step limit, or the
+// DefaultStepLimit if limit <= 0.
+func (re *Regexp) WithStepLimit(limit int) *Regexp {
+	if limit <= 0 {
+		limit = DefaultStepLimit
+	}
+	c := *re
+	c.stepLimit = limit
+	return &c
+}
+
+// StepLimit return the maximum number of steps of a match.
+func (re *Regexp) StepLimit() int {
+	return re.stepLimit
+}
+
+// String return the source text of the regular expression.
+func (re *Regexp) String() string {
+	return re.expr
+}
+
+// NumSubexp return the number of capture groups.
+func (re *Regexp) NumSubexp() int {
+	return len(re.names) - 1
+}
+
+// SubexpNames return the names of the capture groups. The name of the whole
+// match, at index 0, and of the unnamed groups is the empty string.
+func (re *Regexp) SubexpNames() []string {
+	return re.names
+}
+
+// MatchAt return the index pairs of the match of re starting exactly at pos in
+// s, and of its capture groups, or nil if there is no match. The unmatched
+// groups have the index -1. As with Python's Pattern.match(s, pos), the text
+// before pos is visible to the lookbehind and \b assertions, and ^ and \A only
+// match at the start of s. ErrStepLimit is returned when the match exceeds
+// the step limit.
+func (re *Regexp) MatchAt(s string, pos int) ([]int, error) {
+	match, _, err := re.MatchAtHitEnd(s, pos)
+	return match, err
+}
+
+// MatchAtHitEnd is like MatchAt, but it also return true when the end of s
+// was examined by the match, in which case appending text to s could change
+// the result.
+func (re *Regexp) MatchAtHitEnd(s string, pos int) (match []int, hitEnd bool, err error) {
+	m := re.get(s)
+	defer re.pool.Put(m)
+	m.start = pos
+	match, err = m.match(pos)
+	return match, m.hitEnd, err
+}
+
+// FindAt return the index pairs of the leftmost match of re in s starting at
+// or after pos, and of its capture groups, or nil if there is no match. The text
+// before pos is visible to the lookbehind and \b assertions, and \G matches at
+// pos. ErrStepLimit is returned when the search exceeds the step limit.
+func (re *Regexp) FindAt(s string, pos int) ([]int, error) {
+	m := re.get(s)
+	defer re.pool.Put(m)
+	m.start = pos
+	for {
+		match, err := m.match(pos)
+		if match != nil || err != nil || pos == len(s) {
+			return match, err
+		}
+		_, n := utf8.DecodeRuneInString(s[pos:])
+		pos += n
+	}
+}
+
+// FindStringSubmatchIndex return the index pairs of the leftmost match of re in
+// s and of its capture groups, or nil if there is no match. ErrStepLimit is
+// returned when the search exceeds the step limit.
+func (re *Regexp) FindStringSubmatchIndex(s string) ([]int, error) {
+	m := re.get(s)
+	defer re.pool.Put(m)
+	for pos := 0; ; {
+		match, err := m.match(pos)
+		if match != nil || err != nil || pos == len(s) {
+			return match, err
+		}
+		_, n := utf8.DecodeRuneInString(s[pos:])
+		pos += n
+	}
+}
+
+// get return a matcher of s.
+func (re *Regexp) get(s string) *matcher {
+	m, _ := re.pool.Get().(*matcher)
+	if m == nil {
+		m = &matcher{
+			prog: re.prog,
+			caps: make([]int, 2*len(re.names)),
+			regs: make([]int, re.nregs),
+		}
+	}
+	m.s, m.steps, m.limit, m.hitEnd, m.start = s, 0, re.stepLimit, false, 0
+	return m
+}
+
+// match return the match starting at pos.
+func (m *matcher) match(pos int) ([]int, error) {
+	for i := range m.caps {
+		m.caps[i] = -1
+	}
+	m.stack = m.stack[:0]
+	_, ok, err := m.run(0, pos)
+	m.stack = m.stack[:0]
+	if !ok || err != nil {
+		return nil, err
+	}
+	return append([]int(nil), m.caps...), nil
+}
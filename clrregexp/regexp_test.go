@@ -0,0 +1,219 @@
+package clrregexp
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestMatchAt(t *testing.T) {
+	tests := []struct {
+		re    string
+		s     string
+		pos   int
+		match []int
+	}{
+		{re: `abc`, s: "abcd", match: []int{0, 3}},
+		{re: `abc`, s: "xabc", match: nil},
+		{re: `abc`, s: "xabc", pos: 1, match: []int{1, 4}},
+		// lookahead
+		{re: `\w+(?=\()`, s: "foo(x)", match: []int{0, 3}},
+		{re: `\w+(?=\()`, s: "foo x", match: nil},
+		{re: `\w+(?!\()`, s: "foo(x)", match: []int{0, 2}},
+		{re: `(?=(a+))a`, s: "aaa", match: []int{0, 1, 0, 3}},
+		// lookbehind sees the text before pos
+		{re: `(?<=\.)\w+`, s: "a.b", pos: 2, match: []int{2, 3}},
+		{re: `(?<=\.)\w+`, s: "a b", pos: 2, match: nil},
+		{re: `(?<!\.)\w+`, s: "a b", pos: 2, match: []int{2, 3}},
+		{re: `(?<=ab|c)d`, s: "abd", pos: 2, match: []int{2, 3}},
+		{re: `(?<=é)x`, s: "éx", pos: 2, match: []int{2, 3}},
+		{re: `\bx`, s: "ax", pos: 1, match: nil},
+		{re: `^x`, s: "ax", pos: 1, match: nil},
+		{re: `(?m)^x`, s: "a\nx", pos: 2, match: []int{2, 3}},
+		// backreferences
+		{re: `(['"]).*?\1`, s: `"a'b"c"`, match: []int{0, 5, 0, 1}},
+		{re: `(?P<q>['"]).*?(?P=q)`, s: `'a"b'`, match: []int{0, 5, 0, 1}},
+		{re: `(?<q>x)\k<q>`, s: `xx`, match: []int{0, 2, 0, 1}},
+		{re: `(?i)(a)\1`, s: `aA`, match: []int{0, 2, 0, 1}},
+		{re: `(a)?\1`, s: `b`, match: nil},
+		// possessive quantifiers and atomic groups
+		{re: `a*+a`, s: "aaa", match: nil},
+		{re: `a*a`, s: "aaa", match: []int{0, 3}},
+		{re: `(?>a|ab)c`, s: "abc", match: nil},
+		{re: `(?:a|ab)c`, s: "abc", match: []int{0, 3}},
+		{re: `"(?:[^"\\]++|\\.)*+"`, s: `"a\"b"`, match: []int{0, 6}},
+		// conditional groups
+		{re: `(<)?a(?(1)>|$)`, s: "<a>", match: []int{0, 3, 0, 1}},
+		{re: `(<)?a(?(1)>|$)`, s: "a", match: []int{0, 1, -1, -1}},
+		{re: `(<)?a(?(1)>|$)`, s: "<a", match: nil},
+		// python syntax
+		{re: `(?x) a  b # comment`, s: "ab", match: []int{0, 2}},
+		{re: `(?s).`, s: "\n", match: []int{0, 1}},
+		{re: `.`, s: "\n", match: nil},
+		{re: `a$`, s: "a\n", match: []int{0, 1}},
+		{re: `a\Z`, s: "a\n", match: nil},
+		{re: `x{,2}`, s: "xxx", match: []int{0, 2}},
+		{re: `x{2`, s: "x{2", match: []int{0, 3}},
+		{re: `\d+`, s: "١٢3", match: []int{0, 5}},
+		{re: `\w+`, s: "é_1-", match: []int{0, 4}},
+		{re: `[\w.]+`, s: "a.b c", match: []int{0, 3}},
+		{re: `\pL+`, s: "éa1", match: []int{0, 3}},
+		{re: `\p{Greek}`, s: "α", match: []int{0, 2}},
+		{re: `\x41B\101`, s: "ABA", match: []int{0, 3}},
+		{re: `(?i:K)`, s: "k", match: []int{0, 1}},
+		{re: `(?i)[a-c]+`, s: "ABC", match: []int{0, 3}},
+		{re: `(?:a*)*b`, s: "aab", match: []int{0, 3}},
+		{re: `(?#comment)a`, s: "a", match: []int{0, 1}},
+		// oniguruma syntax
+		{re: `\h+`, s: "0aFg", match: []int{0, 3}},
+		{re: `[\H]+`, s: "xy0", match: []int{0, 2}},
+		{re: `[[:alpha:]_]+`, s: "é_a1", match: []int{0, 4}},
+		{re: `[[:^digit:]]+`, s: "ab1", match: []int{0, 2}},
+		{re: `[[:xdigit:][:space:]]+`, s: "a f!", match: []int{0, 3}},
+		{re: `\Gx`, s: "ax", pos: 1, match: []int{1, 2}},
+	}
+	for _, test := range tests {
+		re, err := Compile(test.re)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", test.re, err)
+			continue
+		}
+		match, err := re.MatchAt(test.s, test.pos)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", test.re, err)
+			continue
+		}
+		if !reflect.DeepEqual(match, test.match) {
+			t.Errorf("%q on %q at %d: got %v, expected %v", test.re, test.s, test.pos, match, test.match)
+		}
+	}
+}
+
+// TestRE2 checks that the matches are the same as with the regexp package for
+// expressions it supports.
+func TestRE2(t *testing.T) {
+	exprs := []string{
+		`a+b*`, `(a|ab)(c|bcd)(d*)`, `(a+)(b+)?`, `[^a-c]+`, `(?i)hello`, `x*?y`,
+		`(\w+)\s*=\s*(\d+)`, `a{2,3}?`, `(a*)+`, `(a|b)*c`, `\bfoo\b`, `(?m)^\s*#.*$`,
+		`"(?:[^"\\\n]|\\.)*"`,
+	}
+	texts := []string{
+		"", "aab", "abcd", "abbcd", "xxy", "HeLLo", "key = 42", "aaaa", "ababc",
+		"a foo b", "x\n  # c\ny", `"a\"b" c`, "abc",
+	}
+	for _, expr := range exprs {
+		re2 := regexp.MustCompile(expr)
+		re, err := Compile(expr)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", expr, err)
+			continue
+		}
+		for _, text := range texts {
+			expect := re2.FindStringSubmatchIndex(text)
+			match, err := re.FindStringSubmatchIndex(text)
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", expr, err)
+				continue
+			}
+			if !reflect.DeepEqual(match, expect) {
+				t.Errorf("%q on %q: got %v, expected %v", expr, text, match, expect)
+			}
+		}
+	}
+}
+
+func TestFindAt(t *testing.T) {
+	tests := []struct {
+		re    string
+		s     string
+		pos   int
+		match []int
+	}{
+		{re: `b+`, s: "abba", match: []int{1, 3}},
+		{re: `b+`, s: "abba", pos: 2, match: []int{2, 3}},
+		{re: `b+`, s: "abba", pos: 3, match: nil},
+		{re: `\Gb`, s: "abba", pos: 1, match: []int{1, 2}},
+		{re: `\Ga`, s: "abba", pos: 1, match: nil},
+		{re: `(?<=b)a`, s: "abba", pos: 3, match: []int{3, 4}},
+		{re: `x*`, s: "ab", pos: 2, match: []int{2, 2}},
+	}
+	for _, test := range tests {
+		match, err := MustCompile(test.re).FindAt(test.s, test.pos)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", test.re, err)
+			continue
+		}
+		if !reflect.DeepEqual(match, test.match) {
+			t.Errorf("%q on %q at %d: got %v, expected %v", test.re, test.s, test.pos, match, test.match)
+		}
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	re := MustCompile(`(a*)*b`)
+	text := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	if _, err := re.MatchAt(text, 0); err != ErrStepLimit {
+		t.Errorf("got error %v, expected %v", err, ErrStepLimit)
+	}
+	re = MustCompile(`a+b`).WithStepLimit(10)
+	if re.StepLimit() != 10 {
+		t.Errorf("got step limit %d, expected 10", re.StepLimit())
+	}
+	if _, err := re.MatchAt("aaaaaaaaaaaa", 0); err != ErrStepLimit {
+		t.Errorf("got error %v, expected %v", err, ErrStepLimit)
+	}
+	if match, err := re.MatchAt("ab", 0); err != nil || match == nil {
+		t.Errorf("got %v, %v, expected a match", match, err)
+	}
+}
+
+func TestSubexpNames(t *testing.T) {
+	re := MustCompile(`(a)(?P<x>b)(?:c)(?<y>d)(?=(e))`)
+	expect := []string{"", "", "x", "y", ""}
+	if !reflect.DeepEqual(re.SubexpNames(), expect) {
+		t.Errorf("got %q, expected %q", re.SubexpNames(), expect)
+	}
+	if re.NumSubexp() != 4 {
+		t.Errorf("got %d groups, expected 4", re.NumSubexp())
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	exprs := []string{
+		`(`, `)`, `[a`, `*a`, `a**`, `a{2}{3}`, `\q`, `\1(a)`, `(?P<1a>x)`,
+		`(?P<a>x)(?P<a>y)`, `(?P=b)`, `(?z)`, `[z-a]`, `\p{Foo}`, `a{3,2}`,
+		`a{1001}`, `(?(1)a|b|c)(x)`, `\`, `(?#x`, `\b+`, `[[:foo:]]`,
+	}
+	for _, expr := range exprs {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("unexpected nil error for %q", expr)
+		} else if _, ok := err.(*Error); !ok {
+			t.Errorf("got error type %T, expected *Error for %q", err, expr)
+		}
+	}
+}
+
+func TestMatchAtHitEnd(t *testing.T) {
+	tests := []struct {
+		re     string
+		s      string
+		hitEnd bool
+	}{
+		{re: `abc`, s: "ab", hitEnd: true},
+		{re: `abc`, s: "ax", hitEnd: false},
+		{re: `a+`, s: "aa", hitEnd: true},
+		{re: `a+`, s: "aab", hitEnd: false},
+		{re: `\w+(?=\()`, s: "foo", hitEnd: true},
+		{re: `a$`, s: "a", hitEnd: true},
+		{re: `a\b`, s: "a b", hitEnd: false},
+	}
+	for _, test := range tests {
+		_, hitEnd, err := MustCompile(test.re).MatchAtHitEnd(test.s, 0)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", test.re, err)
+		}
+		if hitEnd != test.hitEnd {
+			t.Errorf("%q on %q: got hitEnd %t, expected %t", test.re, test.s, hitEnd, test.hitEnd)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package clrstyles is a registry of ready-made styles, mostly imported
+// from Pygments, looked up by name.
+package clrstyles
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+var stylesByName = make(map[string]clrcore.Style) // index styles by name
+
+// Register registers the Pygments style definition text under the given name.
+// See clrcore.NewStyleFromPygments for the format of text. Panics if the name
+// is already registered or the style definition is invalid.
+func Register(name string, text string) {
+	if _, ok := stylesByName[name]; ok {
+		panic(fmt.Sprintf("style name %q already registered", name))
+	}
+	style, err := clrcore.NewStyleFromPygments(text)
+	if err != nil {
+		panic(fmt.Sprintf("style %q: %s", name, err))
+	}
+	stylesByName[name] = style
+}
+
+// Get return the style registered with the given name, or nil if none.
+func Get(name string) clrcore.Style {
+	return stylesByName[name]
+}
+
+// Names return the sorted list of registered style names.
+func Names() []string {
+	names := make([]string, 0, len(stylesByName))
+	for name := range stylesByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,62 @@
+package clrstyles
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+func TestNames(t *testing.T) {
+	expected := []string{"dracula", "github", "monokai", "solarized-dark", "solarized-light", "vs"}
+	if names := Names(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("got %v, expected %v", names, expected)
+	}
+}
+
+func TestGet(t *testing.T) {
+	if Get("unknown") != nil {
+		t.Error("expected nil style for unknown name")
+	}
+	style := Get("monokai")
+	if style == nil {
+		t.Fatal("monokai style not found")
+	}
+	index := style.Index()
+	tests := []struct {
+		t   *clrcore.LexemeType
+		out string
+	}{
+		{t: clrcore.Text, out: "text#F8F8F2 back#272822"},
+		{t: clrcore.CodeIdentifierKeyword, out: "text#66D9EF back#272822"},
+		{t: clrcore.CodeIdentifierFunction, out: "text#A6E22E back#272822"},
+		{t: clrcore.CodeStringDouble, out: "text#E6DB74 back#272822"},
+		{t: clrcore.CodeNumberInteger, out: "text#AE81FF back#272822"},
+	}
+	for _, test := range tests {
+		if out := index.TypeStyle(test.t).String(); out != test.out {
+			t.Errorf("got '%s', expected '%s' for %s", out, test.out, test.t.Name)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer delete(stylesByName, "test")
+	Register("test", "Token: '#123456'")
+	if Get("test") == nil {
+		t.Fatal("test style not found")
+	}
+	for _, name := range []string{"test", "invalid"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for %q", name)
+				}
+			}()
+			Register(name, "Token: 'blink'")
+		}()
+	}
+	if Get("invalid") != nil {
+		t.Error("unexpected invalid style registered")
+	}
+}
@@ -0,0 +1,260 @@
+package clrstyles
+
+func init() {
+	Register("monokai", monokai)
+	Register("solarized-dark", solarizedDark)
+	Register("solarized-light", solarizedLight)
+	Register("github", github)
+	Register("dracula", dracula)
+	Register("vs", vs)
+}
+
+// monokai is the Pygments monokai style.
+const monokai = `
+background_color = "#272822"
+
+Token:                     "#f8f8f2",
+Whitespace:                "",
+Error:                     "#ed007e bg:#1e0010",
+Comment:                   "#959077",
+Comment.Multiline:         "",
+Comment.Preproc:           "",
+Comment.Single:            "",
+Comment.Special:           "",
+Keyword:                   "#66d9ef",
+Keyword.Constant:          "",
+Keyword.Declaration:       "",
+Keyword.Namespace:         "#ff4689",
+Keyword.Pseudo:            "",
+Keyword.Reserved:          "",
+Keyword.Type:              "",
+Operator:                  "#ff4689",
+Operator.Word:             "",
+Punctuation:               "#f8f8f2",
+Name:                      "#f8f8f2",
+Name.Attribute:            "#a6e22e",
+Name.Builtin:               "",
+Name.Builtin.Pseudo:        "",
+Name.Class:                "#a6e22e",
+Name.Constant:             "#66d9ef",
+Name.Decorator:            "#a6e22e",
+Name.Exception:            "#a6e22e",
+Name.Function:             "#a6e22e",
+Name.Namespace:            "",
+Name.Other:                "#a6e22e",
+Name.Tag:                  "#ff4689",
+Name.Variable:             "",
+Number:                    "#ae81ff",
+Literal:                   "#ae81ff",
+Literal.Date:              "#e6db74",
+String:                    "#e6db74",
+String.Doc:                "",
+String.Escape:             "#ae81ff",
+Generic.Deleted:           "#ff4689",
+Generic.Emph:              "italic",
+Generic.Inserted:          "#a6e22e",
+Generic.Output:            "#66d9ef",
+Generic.Prompt:            "bold #ff4689",
+Generic.Strong:            "bold",
+Generic.Subheading:        "#959077",
+`
+
+// solarizedDark is the Pygments solarized-dark style.
+const solarizedDark = `
+background_color = "#002b36"
+
+Token:                     "#839496",
+Whitespace:                "#586e75",
+Error:                     "#dc322f",
+Comment:                   "italic #586e75",
+Comment.Hashbang:          "",
+Comment.Multiline:         "",
+Comment.Preproc:           "noitalic #d33682",
+Comment.PreprocFile:       "",
+Comment.Special:           "",
+Keyword:                   "#859900",
+Keyword.Constant:          "#2aa198",
+Keyword.Declaration:       "#268bd2",
+Keyword.Namespace:         "#dc322f",
+Keyword.Pseudo:            "",
+Keyword.Reserved:          "",
+Keyword.Type:              "#b58900",
+Name:                      "",
+Name.Attribute:            "#268bd2",
+Name.Builtin:              "#cb4b16",
+Name.Builtin.Pseudo:       "#268bd2",
+Name.Class:                "#268bd2",
+Name.Constant:             "#268bd2",
+Name.Decorator:            "#268bd2",
+Name.Entity:               "#268bd2",
+Name.Exception:            "#b58900",
+Name.Function:             "#268bd2",
+Name.Function.Magic:       "#268bd2",
+Name.Label:                "#268bd2",
+Name.Namespace:            "#268bd2",
+Name.Tag:                  "#268bd2",
+Name.Variable:             "#268bd2",
+Number:                    "#2aa198",
+String:                    "#2aa198",
+String.Doc:                "",
+String.Escape:             "#cb4b16",
+String.Regex:              "#cb4b16",
+Operator:                  "#839496",
+Operator.Word:             "#859900",
+Punctuation:               "#839496",
+Generic.Deleted:           "#dc322f",
+Generic.Emph:              "italic",
+Generic.Heading:           "bold #b58900",
+Generic.Inserted:          "#859900",
+Generic.Output:            "#839496",
+Generic.Prompt:            "#839496",
+Generic.Strong:            "bold",
+Generic.Subheading:        "underline #b58900",
+`
+
+// solarizedLight is the Pygments solarized-light style.
+const solarizedLight = `
+background_color = "#fdf6e3"
+
+Token:                     "#657b83",
+Whitespace:                "#93a1a1",
+Error:                     "#dc322f",
+Comment:                   "italic #93a1a1",
+Comment.Preproc:           "noitalic #d33682",
+Keyword:                   "#859900",
+Keyword.Constant:          "#2aa198",
+Keyword.Declaration:       "#268bd2",
+Keyword.Namespace:         "#dc322f",
+Keyword.Type:              "#b58900",
+Name.Attribute:            "#268bd2",
+Name.Builtin:              "#cb4b16",
+Name.Builtin.Pseudo:       "#268bd2",
+Name.Class:                "#268bd2",
+Name.Constant:             "#268bd2",
+Name.Decorator:            "#268bd2",
+Name.Exception:            "#b58900",
+Name.Function:             "#268bd2",
+Name.Namespace:            "#268bd2",
+Name.Tag:                  "#268bd2",
+Name.Variable:             "#268bd2",
+Number:                    "#2aa198",
+String:                    "#2aa198",
+String.Escape:             "#cb4b16",
+String.Regex:              "#cb4b16",
+Operator:                  "#657b83",
+Operator.Word:             "#859900",
+Punctuation:               "#657b83",
+Generic.Deleted:           "#dc322f",
+Generic.Emph:              "italic",
+Generic.Heading:           "bold #b58900",
+Generic.Inserted:          "#859900",
+Generic.Strong:            "bold",
+Generic.Subheading:        "underline #b58900",
+`
+
+// github is a light style with the colors of the GitHub code view.
+const github = `
+background_color = "#ffffff"
+
+Token:                     "#24292f",
+Error:                     "#f6f8fa bg:#82071e",
+Comment:                   "italic #6e7781",
+Comment.Preproc:           "noitalic bold #6e7781",
+Comment.Special:           "noitalic bold #6e7781",
+Keyword:                   "#cf222e",
+Keyword.Constant:          "#0550ae",
+Keyword.Pseudo:            "#cf222e",
+Keyword.Type:              "#cf222e",
+Operator:                  "#0550ae",
+Operator.Word:             "#cf222e",
+Punctuation:               "#24292f",
+Name:                      "#24292f",
+Name.Attribute:            "#0550ae",
+Name.Builtin:              "#6639ba",
+Name.Builtin.Pseudo:       "#24292f",
+Name.Class:                "bold #953800",
+Name.Constant:             "#0550ae",
+Name.Decorator:            "bold #8250df",
+Name.Exception:            "bold #953800",
+Name.Function:             "bold #8250df",
+Name.Namespace:            "#24292f",
+Name.Tag:                  "#116329",
+Name.Variable:             "#953800",
+Number:                    "#0550ae",
+String:                    "#0a3069",
+String.Escape:             "#0550ae",
+String.Regex:              "#0a3069",
+Generic.Deleted:           "#82071e bg:#ffebe9",
+Generic.Emph:              "italic",
+Generic.Heading:           "bold #0550ae",
+Generic.Inserted:          "#116329 bg:#dafbe1",
+Generic.Strong:            "bold",
+Generic.Subheading:        "bold #0550ae",
+`
+
+// dracula is the Pygments dracula style.
+const dracula = `
+background_color = "#282a36"
+
+Token:                     "#f8f8f2",
+Error:                     "#f8f8f2",
+Comment:                   "#6272a4",
+Comment.Hashbang:          "#6272a4",
+Comment.Preproc:           "#ff79c6",
+Keyword:                   "#ff79c6",
+Keyword.Constant:          "#ff79c6",
+Keyword.Declaration:       "italic #8be9fd",
+Keyword.Namespace:         "#ff79c6",
+Keyword.Pseudo:            "#ff79c6",
+Keyword.Reserved:          "#ff79c6",
+Keyword.Type:              "#8be9fd",
+Literal:                   "#f8f8f2",
+Name:                      "#f8f8f2",
+Name.Attribute:            "#50fa7b",
+Name.Builtin:              "italic #8be9fd",
+Name.Builtin.Pseudo:       "#f8f8f2",
+Name.Class:                "#50fa7b",
+Name.Constant:             "#f8f8f2",
+Name.Decorator:            "#f8f8f2",
+Name.Exception:            "#f8f8f2",
+Name.Function:             "#50fa7b",
+Name.Label:                "italic #8be9fd",
+Name.Namespace:            "#f8f8f2",
+Name.Tag:                  "#ff79c6",
+Name.Variable:             "italic #8be9fd",
+Number:                    "#ffb86c",
+Operator:                  "#ff79c6",
+Operator.Word:             "#ff79c6",
+Punctuation:               "#f8f8f2",
+String:                    "#bd93f9",
+String.Char:               "#f1fa8c",
+String.Double:             "#f1fa8c",
+String.Single:             "#f1fa8c",
+String.Backtick:           "#f1fa8c",
+String.Regex:              "#f1fa8c",
+Generic.Deleted:           "#ff5555",
+Generic.Emph:              "italic #f8f8f2",
+Generic.Heading:           "bold #f8f8f2",
+Generic.Inserted:          "#50fa7b",
+Generic.Strong:            "bold #f8f8f2",
+Generic.Subheading:        "bold #f8f8f2",
+`
+
+// vs is the Pygments vs style (Visual Studio).
+const vs = `
+background_color = "#ffffff"
+
+Comment:                   "#008000",
+Comment.Preproc:           "#0000ff",
+Keyword:                   "#0000ff",
+Operator.Word:             "#0000ff",
+Keyword.Type:              "#2b91af",
+Name.Class:                "#2b91af",
+String:                    "#a31515",
+Generic.Heading:           "bold",
+Generic.Subheading:        "bold",
+Generic.Emph:              "italic",
+Generic.Strong:            "bold",
+Generic.Prompt:            "bold",
+Error:                     "border:#FF0000",
+`
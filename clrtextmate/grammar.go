@@ -0,0 +1,169 @@
+// Package clrtextmate runs TextMate grammars (.tmLanguage and .tmLanguage.json
+// files) as clrz lexers.
+//
+// A grammar is converted into a clrcore.LexerDef whose modes are the contexts
+// of the grammar: the top level patterns, the begin/end and begin/while rules,
+// and the captures with patterns. Entering a context pushes its mode on the
+// mode stack of the LexerEngine, and its end pops it. The rules are matched as
+// in TextMate: the text of a line is searched for the leftmost match of the
+// patterns of the current context and of its end pattern. The regexes are
+// matched by the clrregexp engine, which supports the Oniguruma syntax used by
+// the grammars.
+//
+// The scope names of the tokens, like keyword.control.go, are mapped to the
+// lexeme types with a ScopeTypes table. The includes of the patterns of other
+// grammars, like source.js#expression, are resolved with the grammars
+// registered with RegisterGrammar when the lexer is first used.
+package clrtextmate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Grammar is a TextMate grammar.
+type Grammar struct {
+	Name           string           `json:"name"`           // Name of the language.
+	ScopeName      string           `json:"scopeName"`      // Scope name of the grammar (e.g. "source.go").
+	FileTypes      []string         `json:"fileTypes"`      // File name extensions of the language.
+	FirstLineMatch string           `json:"firstLineMatch"` // Regex matching the first line of a text in the language.
+	Patterns       []*Rule          `json:"patterns"`       // Top level patterns.
+	Repository     map[string]*Rule `json:"repository"`     // Rules included with "#name".
+}
+
+// Rule is a pattern of a TextMate grammar. It is a match rule when Match is
+// set, a begin/end or begin/while rule when Begin is set, an include when
+// Include is set, and otherwise a list of patterns.
+type Rule struct {
+	Name                string           `json:"name"`                // Scope name of the match.
+	ContentName         string           `json:"contentName"`         // Scope name of the text between begin and end.
+	Match               string           `json:"match"`               // Regex of a match rule.
+	Begin               string           `json:"begin"`               // Regex starting the context.
+	End                 string           `json:"end"`                 // Regex ending the context.
+	While               string           `json:"while"`               // Regex that must match at the start of each line of the context.
+	Captures            Captures         `json:"captures"`            // Captures of Match, or default of the other captures.
+	BeginCaptures       Captures         `json:"beginCaptures"`       // Captures of Begin.
+	EndCaptures         Captures         `json:"endCaptures"`         // Captures of End.
+	WhileCaptures       Captures         `json:"whileCaptures"`       // Captures of While.
+	Patterns            []*Rule          `json:"patterns"`            // Patterns of the context.
+	Include             string           `json:"include"`             // Included rule: "#name", "$self", "$base", "scope" or "scope#name".
+	Repository          map[string]*Rule `json:"repository"`          // Rules included with "#name" by the patterns.
+	ApplyEndPatternLast flag             `json:"applyEndPatternLast"` // Match the end after the patterns.
+	Disabled            flag             `json:"disabled"`            // Ignore the rule.
+}
+
+// Captures are the rules of the groups of a match, indexed by group number.
+// The rule of a group gives its scope name and optionally its patterns.
+type Captures map[int]*Rule
+
+// UnmarshalJSON decodes the captures object whose keys are group numbers.
+// The other keys are ignored.
+func (c *Captures) UnmarshalJSON(data []byte) error {
+	var m map[string]*Rule
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*c = make(Captures, len(m))
+	for k, r := range m {
+		if i, err := strconv.Atoi(k); err == nil && i >= 0 && r != nil {
+			(*c)[i] = r
+		}
+	}
+	return nil
+}
+
+// flag is a boolean encoded as a boolean or as a number.
+type flag bool
+
+// UnmarshalJSON decodes a boolean, or a number that is true when not 0.
+func (f *flag) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*f = flag(b)
+		return nil
+	}
+	var n float64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return errors.New("expected a boolean or a number")
+	}
+	*f = n != 0
+	return nil
+}
+
+// ParseGrammar return the grammar of a .tmLanguage file, in the XML property
+// list format, or of a .tmLanguage.json file.
+func ParseGrammar(data []byte) (*Grammar, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '<' {
+		v, err := parsePlist(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	g := &Grammar{}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, err
+	}
+	if g.ScopeName == "" {
+		return nil, errors.New("grammar has no scopeName")
+	}
+	return g, nil
+}
+
+// LoadGrammar reads the grammar file with ParseGrammar, and registers the
+// grammar with RegisterGrammar.
+func LoadGrammar(fileName string) (*Grammar, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	g, err := ParseGrammar(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s (File=%q)", err, fileName)
+	}
+	RegisterGrammar(g)
+	return g, nil
+}
+
+var (
+	grammarsMu      sync.RWMutex
+	grammarsByScope = make(map[string]*Grammar) // index of grammars by scope name
+)
+
+// RegisterGrammar registers the grammar under its scope name, replacing the
+// grammar previously registered with the same scope name. The registered
+// grammars resolve the includes of other grammars.
+func RegisterGrammar(g *Grammar) {
+	grammarsMu.Lock()
+	defer grammarsMu.Unlock()
+	grammarsByScope[g.ScopeName] = g
+}
+
+// GrammarByScope return the grammar registered with the scope name or nil if
+// none is found.
+func GrammarByScope(scopeName string) *Grammar {
+	grammarsMu.RLock()
+	defer grammarsMu.RUnlock()
+	return grammarsByScope[scopeName]
+}
+
+// Grammars return the registered grammars sorted by scope name.
+func Grammars() []*Grammar {
+	grammarsMu.RLock()
+	defer grammarsMu.RUnlock()
+	list := make([]*Grammar, 0, len(grammarsByScope))
+	for _, g := range grammarsByScope {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ScopeName < list[j].ScopeName })
+	return list
+}
@@ -0,0 +1,142 @@
+package clrtextmate
+
+import (
+	"reflect"
+	"testing"
+)
+
+const plistGrammar = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>name</key>
+	<string>Plist &amp; Test</string>
+	<key>scopeName</key>
+	<string>source.plist-test</string>
+	<key>fileTypes</key>
+	<array>
+		<string>pt</string>
+	</array>
+	<key>patterns</key>
+	<array>
+		<dict>
+			<key>begin</key>
+			<string>&lt;(\w+)</string>
+			<key>end</key>
+			<string>&gt;</string>
+			<key>applyEndPatternLast</key>
+			<integer>1</integer>
+			<key>beginCaptures</key>
+			<dict>
+				<key>1</key>
+				<dict>
+					<key>name</key>
+					<string>entity.name.tag</string>
+				</dict>
+			</dict>
+			<key>patterns</key>
+			<array>
+				<dict>
+					<key>include</key>
+					<string>#attr</string>
+				</dict>
+			</array>
+		</dict>
+	</array>
+	<key>repository</key>
+	<dict>
+		<key>attr</key>
+		<dict>
+			<key>match</key>
+			<string>\w+</string>
+			<key>name</key>
+			<string>entity.other.attribute-name</string>
+			<key>disabled</key>
+			<false/>
+		</dict>
+	</dict>
+	<key>version</key>
+	<real>1.5</real>
+</dict>
+</plist>
+`
+
+func TestParseGrammarPlist(t *testing.T) {
+	g, err := ParseGrammar([]byte(plistGrammar))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := &Grammar{
+		Name:      "Plist & Test",
+		ScopeName: "source.plist-test",
+		FileTypes: []string{"pt"},
+		Patterns: []*Rule{{
+			Begin:               `<(\w+)`,
+			End:                 `>`,
+			ApplyEndPatternLast: true,
+			BeginCaptures:       Captures{1: {Name: "entity.name.tag"}},
+			Patterns:            []*Rule{{Include: "#attr"}},
+		}},
+		Repository: map[string]*Rule{
+			"attr": {Match: `\w+`, Name: "entity.other.attribute-name"},
+		},
+	}
+	if !reflect.DeepEqual(g, expect) {
+		t.Errorf("got grammar %+v, expected %+v", g, expect)
+	}
+}
+
+func TestParseGrammarJSON(t *testing.T) {
+	data := "\xef\xbb\xbf" + `{
+		"scopeName": "source.json-test",
+		"patterns": [{"match": "(a)(b)", "captures": {"1": {"name": "x"}, "name": {"name": "y"}}, "disabled": true}],
+		"uuid": "ignored"
+	}`
+	g, err := ParseGrammar([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := &Grammar{
+		ScopeName: "source.json-test",
+		Patterns:  []*Rule{{Match: "(a)(b)", Captures: Captures{1: {Name: "x"}}, Disabled: true}},
+	}
+	if !reflect.DeepEqual(g, expect) {
+		t.Errorf("got grammar %+v, expected %+v", g, expect)
+	}
+}
+
+func TestParseGrammarErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`{"name": "x"}`,
+		`{"scopeName": "source.x", "patterns": {}}`,
+		`{"scopeName": "source.x", "patterns": [{"disabled": "yes"}]}`,
+		`<plist></plist>`,
+		`<plist><dict><string>x</string></dict></plist>`,
+		`<plist><dict><key>x</key></dict></plist>`,
+		`<plist><dict><key>x</key><integer>a</integer></dict></plist>`,
+		`<plist><dict><key>x</key><real>a</real></dict></plist>`,
+		`<plist><dict><key>x</key><foo/></dict></plist>`,
+		`<plist><dict><key>x</key><string>a</dict></plist>`,
+	}
+	for _, test := range tests {
+		if _, err := ParseGrammar([]byte(test)); err == nil {
+			t.Errorf("unexpected nil error for %q", test)
+		}
+	}
+}
+
+func TestRegisterGrammar(t *testing.T) {
+	g := &Grammar{ScopeName: "source.register-test"}
+	RegisterGrammar(g)
+	if GrammarByScope("source.register-test") != g {
+		t.Error("grammar not registered")
+	}
+	found := false
+	for _, r := range Grammars() {
+		found = found || r == g
+	}
+	if !found {
+		t.Error("grammar not listed")
+	}
+}
@@ -0,0 +1,840 @@
+package clrtextmate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/chmike/clrz/clrcore"
+	"github.com/chmike/clrz/clrregexp"
+)
+
+// LexerInfo return the information of a lexer running the grammar, whose scope
+// names are mapped to lexeme types with types, or with DefaultScopeTypes when
+// types is nil. The names of the lexer are the lower case name of the grammar
+// and its scope name, and its file name patterns are derived from the file
+// types of the grammar. The text whose first line matches the FirstLineMatch
+// regex of the grammar has an AnalyseText likelihood of 1.
+//
+// The contexts of the grammar are built when the lexer is first used. The
+// includes of the rules that can't be found, like the includes of grammars not
+// registered by then, are ignored, as in TextMate.
+func (g *Grammar) LexerInfo(types ScopeTypes) *clrcore.LexerInfo {
+	if types == nil {
+		types = DefaultScopeTypes
+	}
+	gd := newGrammarDef(g, types)
+	info := &clrcore.LexerInfo{
+		Names:    grammarNames(g),
+		NewLexer: gd.newLexer,
+	}
+	for _, ft := range g.FileTypes {
+		switch {
+		case ft == "":
+		case strings.ContainsAny(ft, "*?[") || strings.HasPrefix(ft, ".") || (ft[0] >= 'A' && ft[0] <= 'Z'):
+			info.FileNames = append(info.FileNames, ft)
+		default:
+			info.FileNames = append(info.FileNames, "*."+ft)
+		}
+	}
+	if g.FirstLineMatch != "" {
+		var once sync.Once
+		var re *clrregexp.Regexp
+		info.AnalyseText = func(text string) float64 {
+			once.Do(func() { re, _ = clrregexp.Compile(g.FirstLineMatch) })
+			if i := strings.IndexByte(text, '\n'); i >= 0 {
+				text = text[:i+1]
+			}
+			if re == nil {
+				return 0
+			}
+			if m, err := re.FindAt(text, 0); err != nil || m == nil {
+				return 0
+			}
+			return 1
+		}
+	}
+	return info
+}
+
+// grammarNames return the lexer names of the grammar.
+func grammarNames(g *Grammar) []string {
+	var names []string
+	if name := strings.ToLower(strings.TrimSpace(g.Name)); name != "" && name != g.ScopeName {
+		names = append(names, name)
+	}
+	return append(names, g.ScopeName)
+}
+
+// LoadLexer loads the grammar file with LoadGrammar, and registers the lexer
+// running the grammar with clrcore.RegisterLexer. See Grammar.LexerInfo. The
+// names of the lexer already registered, like the name of a builtin lexer of
+// the language, are dropped.
+func LoadLexer(fileName string, types ScopeTypes) (*clrcore.LexerInfo, error) {
+	g, err := LoadGrammar(fileName)
+	if err != nil {
+		return nil, err
+	}
+	info := g.LexerInfo(types)
+	var names []string
+	for _, name := range info.Names {
+		if clrcore.LexerByName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("lexer names %q already registered (File=%q)", info.Names, fileName)
+	}
+	info.Names = names
+	clrcore.RegisterLexer(info)
+	return info, nil
+}
+
+// grammarDef is the LexerDef of a grammar.
+type grammarDef struct {
+	def  *clrcore.LexerDef
+	root *context            // context of the top level patterns, set by InitFunc
+	typ  *clrcore.LexemeType // lexeme type of the text of the root context
+}
+
+// newGrammarDef return the LexerDef of the grammar. Its modes are built by its
+// InitFunc.
+func newGrammarDef(g *Grammar, types ScopeTypes) *grammarDef {
+	gd := &grammarDef{typ: typeOr(types.Type(g.ScopeName), clrcore.Text)}
+	gd.def = &clrcore.LexerDef{
+		Name: g.ScopeName,
+		InitFunc: func(d *clrcore.LexerDef) {
+			b := &builder{
+				base:  g,
+				types: types,
+				rules: make(map[*Rule]*rule),
+				roots: make(map[*Grammar]*Rule),
+			}
+			gd.root = b.build()
+			d.Modes = b.modes
+		},
+	}
+	return gd
+}
+
+// newLexer return a LexerEngine running the grammar on text.
+func (gd *grammarDef) newLexer(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+	st := &state{text: text, stopMarkers: stopMarkers, lineStart: -1, anchor: -1}
+	l, err := clrcore.NewLexerEngine(gd.def, text, stopMarkers, st)
+	if err != nil {
+		return nil, err
+	}
+	st.frames = []*frame{{ctx: gd.root, typ: gd.typ, contentTyp: gd.typ, anchor: -1}}
+	return l, nil
+}
+
+// pattern is a regex of a rule.
+type pattern struct {
+	src      string
+	backrefs bool              // the end or while regex references the groups of the begin regex
+	re       *clrregexp.Regexp // compiled regex
+	noG      *clrregexp.Regexp // regex whose \G never matches, nil if the regex has no \G
+	once     sync.Once
+	err      error
+}
+
+// newPattern return the pattern of the regex. The groups of the begin regex
+// referenced by an end or while regex are substituted when the context is
+// entered.
+func newPattern(src string, isEnd bool) *pattern {
+	return &pattern{src: src, backrefs: isEnd && hasBackrefs(src)}
+}
+
+// init compiles the regex once, unless it references the groups of the begin
+// regex.
+func (p *pattern) init() error {
+	p.once.Do(func() {
+		if !p.backrefs {
+			p.re, p.noG, p.err = compilePattern(p.src)
+		}
+	})
+	return p.err
+}
+
+// compilePattern compiles the regex and, when it has a \G, its variant whose \G
+// never matches.
+func compilePattern(src string) (re, noG *clrregexp.Regexp, err error) {
+	if re, err = clrregexp.Compile(src); err != nil {
+		return nil, nil, err
+	}
+	if alt, ok := replaceEscape(src, 'G', "(?!)"); ok {
+		if noG, err = clrregexp.Compile(alt); err != nil {
+			return nil, nil, err
+		}
+	}
+	return re, noG, nil
+}
+
+// replaceEscape return src with the escape sequences \c replaced by repl, and
+// true if there was one.
+func replaceEscape(src string, c byte, repl string) (string, bool) {
+	var b strings.Builder
+	found := false
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\\' && i+1 < len(src) {
+			if src[i+1] == c {
+				b.WriteString(repl)
+				found = true
+			} else {
+				b.WriteString(src[i : i+2])
+			}
+			i++
+			continue
+		}
+		b.WriteByte(src[i])
+	}
+	return b.String(), found
+}
+
+// hasBackrefs return true if src has a backreference \1 to \9.
+func hasBackrefs(src string) bool {
+	for i := 0; i+1 < len(src); i++ {
+		if src[i] == '\\' {
+			if c := src[i+1]; c >= '1' && c <= '9' {
+				return true
+			}
+			i++
+		}
+	}
+	return false
+}
+
+// resolveBackrefs return src whose backreferences \1 to \9 are replaced by the
+// escaped text of the groups of the match m of line.
+func resolveBackrefs(src, line string, m []int) string {
+	var b strings.Builder
+	for i := 0; i < len(src); i++ {
+		if src[i] != '\\' || i+1 == len(src) {
+			b.WriteByte(src[i])
+			continue
+		}
+		i++
+		c := src[i]
+		if c < '1' || c > '9' {
+			b.WriteByte('\\')
+			b.WriteByte(c)
+			continue
+		}
+		if g := int(c - '0'); 2*g+1 < len(m) && m[2*g] >= 0 {
+			b.WriteString(escapeRegex(line[m[2*g]:m[2*g+1]]))
+		}
+	}
+	return b.String()
+}
+
+// escapeRegex return s with its ASCII punctuation, spaces and control chars
+// escaped so that it matches s literally.
+func escapeRegex(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x80 && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '_' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// rule is a match or begin rule of a grammar.
+type rule struct {
+	match, begin  *pattern
+	end, while    *pattern            // end or while of a begin rule, or nil
+	typ           *clrcore.LexemeType // type of the name, or nil
+	contentTyp    *clrcore.LexemeType // type of the content name, or nil
+	captures      []*capture          // captures of the match rule
+	beginCaptures []*capture
+	endCaptures   []*capture
+	whileCaptures []*capture
+	endLast       bool     // apply the end pattern after the patterns
+	ctx           *context // context of the begin rule
+}
+
+// capture is the rule of a group of a match.
+type capture struct {
+	typ *clrcore.LexemeType // type of the name, or nil
+	ctx *context            // context tokenizing the group, or nil
+}
+
+// context is the list of match and begin rules of a mode, with the includes
+// expanded.
+type context struct {
+	mode     string
+	owner    *rule // begin rule of the context, or nil
+	rules    []*rule
+	patterns []*Rule // patterns of the rules, cleared once expanded
+	env      env     // environment of the patterns
+	once     sync.Once
+	err      error
+}
+
+// init compiles the regexes of the context.
+func (c *context) init() error {
+	c.once.Do(func() {
+		var pats []*pattern
+		if c.owner != nil {
+			pats = append(pats, c.owner.end, c.owner.while)
+		}
+		for _, r := range c.rules {
+			pats = append(pats, r.match, r.begin)
+		}
+		for _, p := range pats {
+			if p == nil {
+				continue
+			}
+			if c.err = p.init(); c.err != nil {
+				return
+			}
+		}
+	})
+	return c.err
+}
+
+// contextRule is the rule of the mode of a context.
+type contextRule struct {
+	ctx *context
+}
+
+// Init compiles the regexes of the context.
+func (r *contextRule) Init() error {
+	return r.ctx.init()
+}
+
+// Exec tokenizes the text up to the next change of context, or the end of the
+// line, or the next stop marker. At the start of a line, the while regexes of
+// the contexts are checked first.
+func (r *contextRule) Exec(l *clrcore.LexerEngine) bool {
+	st, ok := l.Extend().(*state)
+	if !ok {
+		l.QueueLexeme(clrcore.Lexeme{Type: clrcore.StopError, Str: "TextMate context executed without its state"})
+		return true
+	}
+	pos := st.pos(l)
+	lineStart := strings.LastIndexByte(st.text[:pos], '\n') + 1
+	lineEnd := len(st.text)
+	if i := strings.IndexByte(st.text[pos:], '\n'); i >= 0 {
+		lineEnd = pos + i + 1
+	}
+	// the LexerEngine checks the stop markers between the rules
+	for _, marker := range st.stopMarkers {
+		if i := strings.Index(st.text[pos:lineEnd], marker); i > 0 {
+			lineEnd = pos + i
+		}
+	}
+	if lineStart != st.lineStart {
+		st.lineStart, st.anchor = lineStart, -1
+		st.checkWhile(l, lineEnd)
+		return true
+	}
+	st.step(l, lineEnd)
+	return true
+}
+
+// builder builds the contexts and modes of a grammar.
+type builder struct {
+	base  *Grammar
+	types ScopeTypes
+	modes []*clrcore.LexerDefMode
+	rules map[*Rule]*rule    // rules already built
+	roots map[*Grammar]*Rule // rule of the top level patterns of the grammars
+	queue []*context         // contexts whose patterns are not yet expanded
+}
+
+// env is the environment resolving the includes of patterns.
+type env struct {
+	g     *Grammar
+	repos []map[string]*Rule // repositories in scope, innermost last
+}
+
+// with return the environment with the repository in scope.
+func (e env) with(repo map[string]*Rule) env {
+	if len(repo) == 0 {
+		return e
+	}
+	return env{g: e.g, repos: append(e.repos[:len(e.repos):len(e.repos)], repo)}
+}
+
+// grammarEnv return the environment of the top level patterns of g.
+func grammarEnv(g *Grammar) env {
+	return env{g: g}.with(g.Repository)
+}
+
+// build builds the modes of the base grammar and return its root context.
+func (b *builder) build() *context {
+	root := b.newContext("root", b.base.Patterns, grammarEnv(b.base), nil)
+	for len(b.queue) > 0 {
+		c := b.queue[0]
+		b.queue = b.queue[1:]
+		b.expand(c.patterns, c.env, make(map[*Rule]bool), &c.rules)
+		c.patterns = nil
+	}
+	return root
+}
+
+// newContext return a new context, with its mode, whose patterns will be
+// expanded.
+func (b *builder) newContext(name string, patterns []*Rule, e env, owner *rule) *context {
+	if len(b.modes) > 0 {
+		name = fmt.Sprintf("%s#%d", name, len(b.modes))
+	}
+	c := &context{mode: name, owner: owner, patterns: patterns, env: e}
+	b.modes = append(b.modes, &clrcore.LexerDefMode{Name: name, Rules: []clrcore.LexerDefRule{&contextRule{ctx: c}}})
+	b.queue = append(b.queue, c)
+	return c
+}
+
+// expand appends the match and begin rules of the patterns to rules, replacing
+// the includes by the rules they include. seen are the included rules.
+func (b *builder) expand(patterns []*Rule, e env, seen map[*Rule]bool, rules *[]*rule) {
+	for _, p := range patterns {
+		switch {
+		case p == nil || bool(p.Disabled):
+		case p.Include != "":
+			target, te := b.resolve(p.Include, e)
+			if target == nil || seen[target] {
+				continue
+			}
+			seen[target] = true
+			b.expand([]*Rule{target}, te, seen, rules)
+		case p.Match != "" || p.Begin != "":
+			*rules = append(*rules, b.rule(p, e))
+		default:
+			b.expand(p.Patterns, e.with(p.Repository), seen, rules)
+		}
+	}
+}
+
+// resolve return the rule included by include in the environment, and the
+// environment of the rule. It return a nil rule when none is found.
+func (b *builder) resolve(include string, e env) (*Rule, env) {
+	switch {
+	case include == "$self":
+		return b.root(e.g), grammarEnv(e.g)
+	case include == "$base":
+		return b.root(b.base), grammarEnv(b.base)
+	case strings.HasPrefix(include, "#"):
+		for i := len(e.repos) - 1; i >= 0; i-- {
+			if r := e.repos[i][include[1:]]; r != nil {
+				return r, env{g: e.g, repos: e.repos[:i+1]}
+			}
+		}
+		return nil, e
+	}
+	scope, name := include, ""
+	if i := strings.IndexByte(include, '#'); i >= 0 {
+		scope, name = include[:i], include[i+1:]
+	}
+	var g *Grammar
+	switch scope {
+	case e.g.ScopeName:
+		g = e.g
+	case b.base.ScopeName:
+		g = b.base
+	default:
+		g = GrammarByScope(scope)
+	}
+	if g == nil {
+		return nil, e
+	}
+	if name == "" {
+		return b.root(g), grammarEnv(g)
+	}
+	return g.Repository[name], grammarEnv(g)
+}
+
+// root return the rule of the top level patterns of g.
+func (b *builder) root(g *Grammar) *Rule {
+	r := b.roots[g]
+	if r == nil {
+		r = &Rule{Patterns: g.Patterns}
+		b.roots[g] = r
+	}
+	return r
+}
+
+// rule return the match or begin rule p.
+func (b *builder) rule(p *Rule, e env) *rule {
+	if r := b.rules[p]; r != nil {
+		return r
+	}
+	r := &rule{
+		typ:        b.types.Type(p.Name),
+		contentTyp: b.types.Type(p.ContentName),
+		endLast:    bool(p.ApplyEndPatternLast),
+	}
+	b.rules[p] = r
+	if p.Match != "" {
+		r.match = newPattern(p.Match, false)
+		r.captures = b.captures(p.Captures, e)
+		return r
+	}
+	r.begin = newPattern(p.Begin, false)
+	r.beginCaptures = b.captures(capturesOr(p.BeginCaptures, p.Captures), e)
+	switch {
+	case p.While != "":
+		r.while = newPattern(p.While, true)
+		r.whileCaptures = b.captures(capturesOr(p.WhileCaptures, p.Captures), e)
+	case p.End != "":
+		r.end = newPattern(p.End, true)
+		r.endCaptures = b.captures(capturesOr(p.EndCaptures, p.Captures), e)
+	}
+	r.ctx = b.newContext(contextName(p), p.Patterns, e.with(p.Repository), r)
+	return r
+}
+
+// captures return the captures indexed by group number.
+func (b *builder) captures(c Captures, e env) []*capture {
+	n := -1
+	for i := range c {
+		if i > n {
+			n = i
+		}
+	}
+	if n < 0 {
+		return nil
+	}
+	caps := make([]*capture, n+1)
+	for i, r := range c {
+		cp := &capture{typ: b.types.Type(r.Name)}
+		if len(r.Patterns) > 0 {
+			cp.ctx = b.newContext(contextName(r), r.Patterns, e.with(r.Repository), nil)
+		}
+		caps[i] = cp
+	}
+	return caps
+}
+
+// capturesOr return c, or def when c is empty.
+func capturesOr(c, def Captures) Captures {
+	if len(c) == 0 {
+		return def
+	}
+	return c
+}
+
+// contextName return the name of the mode of the context of r.
+func contextName(r *Rule) string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.ContentName != "":
+		return r.ContentName
+	}
+	return "context"
+}
+
+// typeOr return t, or def when t is nil.
+func typeOr(t, def *clrcore.LexemeType) *clrcore.LexemeType {
+	if t == nil {
+		return def
+	}
+	return t
+}
+
+// state is the state of a LexerEngine running a grammar. It is the extend
+// information of the LexerEngine.
+type state struct {
+	text        string   // text given to the LexerEngine
+	stopMarkers []string // stop markers of the LexerEngine
+	frames      []*frame // contexts entered, in the order of the mode stack
+	lineStart   int      // offset of the current line, -1 before the first line
+	anchor      int      // offset matched by \G, -1 if none
+	gen         int      // incremented when the frames change
+	cacheKey    [3]int   // gen, line start and limit of the cached matches
+	cache       []cached // matches of the rules of the current context
+	failed      bool     // a StopError lexeme was queued
+}
+
+// frame is an entered context.
+type frame struct {
+	ctx        *context
+	rule       *rule               // begin rule of the context, or nil
+	end, while *clrregexp.Regexp   // end or while regex, or nil
+	endNoG     *clrregexp.Regexp   // end or while regex whose \G never matches, or nil
+	typ        *clrcore.LexemeType // type of the name of the begin rule
+	contentTyp *clrcore.LexemeType // type of the text of the context
+	enterPos   int                 // offset where the begin regex was searched
+	anchor     int                 // anchor when the context was entered
+}
+
+// cached is the last match of a rule searched from the offset from.
+type cached struct {
+	from  int // -1 if none
+	match []int
+}
+
+// pos return the offset of the remaining text of l.
+func (st *state) pos(l *clrcore.LexerEngine) int {
+	return len(st.text) - len(l.RemainingText())
+}
+
+// fail queues a StopError lexeme with the error.
+func (st *state) fail(l *clrcore.LexerEngine, err error) {
+	l.QueueLexeme(clrcore.Lexeme{Type: clrcore.StopError, Str: err.Error()})
+	st.failed = true
+}
+
+// emit queues a lexeme of type t with the n next bytes of the text.
+func (st *state) emit(l *clrcore.LexerEngine, t *clrcore.LexemeType, n int) {
+	if n > 0 {
+		l.PopLexeme(t, n)
+	}
+}
+
+// push enters the context of f.
+func (st *state) push(l *clrcore.LexerEngine, f *frame) {
+	st.frames = append(st.frames, f)
+	st.gen++
+	l.PushMode(f.ctx.mode)
+}
+
+// popTo leaves the contexts until n contexts remain.
+func (st *state) popTo(l *clrcore.LexerEngine, n int) {
+	for len(st.frames) > n {
+		st.frames = st.frames[:len(st.frames)-1]
+		l.PopMode()
+	}
+	st.gen++
+}
+
+// find return the leftmost match of re in line from p. pos is the offset of p.
+// The matches of the rule k of the current context are cached, unless its regex
+// has a \G whose match depends on the anchor.
+func (st *state) find(k int, re, noG *clrregexp.Regexp, line string, p, pos int) ([]int, error) {
+	if noG != nil {
+		if st.anchor != pos {
+			re = noG
+		}
+		return re.FindAt(line, p)
+	}
+	if k < 0 {
+		return re.FindAt(line, p)
+	}
+	c := &st.cache[k]
+	if c.from >= 0 && c.from <= p && (c.match == nil || c.match[0] >= p) {
+		return c.match, nil
+	}
+	m, err := re.FindAt(line, p)
+	c.from, c.match = p, m
+	return m, err
+}
+
+// checkWhile checks the while regexes of the contexts at the start of the line.
+// The contexts from the first whose while regex doesn't match are left.
+func (st *state) checkWhile(l *clrcore.LexerEngine, lineEnd int) {
+	for i := 1; i < len(st.frames); i++ {
+		f := st.frames[i]
+		if f.while == nil {
+			continue
+		}
+		pos := st.pos(l)
+		line, p := st.text[st.lineStart:lineEnd], pos-st.lineStart
+		m, err := st.find(-1, f.while, f.endNoG, line, p, pos)
+		if err != nil {
+			st.fail(l, fmt.Errorf("%s (Mode='%s')", err, f.ctx.mode))
+			return
+		}
+		if m == nil {
+			st.popTo(l, i)
+			return
+		}
+		st.emit(l, f.contentTyp, m[0]-p)
+		st.emitCaptures(l, line, m, f.rule.whileCaptures, f.contentTyp)
+		st.anchor = st.lineStart + m[1]
+	}
+}
+
+// step tokenizes the text of the current line, up to the offset limit, until
+// the next change of context.
+func (st *state) step(l *clrcore.LexerEngine, limit int) {
+	pos := st.pos(l)
+	line, p := st.text[st.lineStart:limit], pos-st.lineStart
+	top := st.frames[len(st.frames)-1]
+	rules := top.ctx.rules
+	n := len(rules)
+	if top.end != nil {
+		n++
+	}
+	if key := [3]int{st.gen, st.lineStart, limit}; key != st.cacheKey || len(st.cache) != n {
+		st.cacheKey = key
+		st.cache = st.cache[:0]
+		for i := 0; i < n; i++ {
+			st.cache = append(st.cache, cached{from: -1})
+		}
+	}
+	// search the leftmost match, the end regex first unless applied last
+	best, bestRule, isEnd := []int(nil), (*rule)(nil), false
+	for k := 0; k < n; k++ {
+		var r *rule
+		var re, noG *clrregexp.Regexp
+		switch i := k; {
+		case top.end != nil && top.rule.endLast && k == n-1, top.end != nil && !top.rule.endLast && k == 0:
+			re, noG = top.end, top.endNoG
+		default:
+			if top.end != nil && !top.rule.endLast {
+				i--
+			}
+			r = rules[i]
+			pat := r.match
+			if pat == nil {
+				pat = r.begin
+			}
+			re, noG = pat.re, pat.noG
+		}
+		m, err := st.find(k, re, noG, line, p, pos)
+		if err != nil {
+			st.fail(l, fmt.Errorf("%s (Mode='%s')", err, top.ctx.mode))
+			return
+		}
+		if m != nil && (best == nil || m[0] < best[0]) {
+			best, bestRule, isEnd = m, r, r == nil
+			if m[0] == p {
+				break
+			}
+		}
+	}
+	if best == nil {
+		st.emit(l, top.contentTyp, limit-pos)
+		return
+	}
+	st.emit(l, top.contentTyp, best[0]-p)
+	advanced := best[1] > p
+	switch {
+	case isEnd:
+		if !advanced && top.enterPos == pos {
+			// the context was entered and left without advancing
+			st.popTo(l, len(st.frames)-1)
+			st.emit(l, st.frames[len(st.frames)-1].contentTyp, limit-pos)
+			return
+		}
+		st.emitCaptures(l, line, best, top.rule.endCaptures, top.typ)
+		st.popTo(l, len(st.frames)-1)
+		st.anchor = top.anchor
+	case bestRule.match != nil:
+		st.emitCaptures(l, line, best, bestRule.captures, typeOr(bestRule.typ, top.contentTyp))
+		if !advanced {
+			st.emit(l, top.contentTyp, limit-st.pos(l))
+		}
+	default:
+		if !advanced && st.entered(bestRule, pos) {
+			// the context would be entered again without advancing
+			st.emit(l, top.contentTyp, limit-pos)
+			return
+		}
+		typ := typeOr(bestRule.typ, top.contentTyp)
+		st.emitCaptures(l, line, best, bestRule.beginCaptures, typ)
+		f := &frame{
+			ctx:        bestRule.ctx,
+			rule:       bestRule,
+			typ:        typ,
+			contentTyp: typeOr(bestRule.contentTyp, typ),
+			enterPos:   pos,
+			anchor:     st.anchor,
+		}
+		if err := f.resolve(line, best); err != nil {
+			st.fail(l, fmt.Errorf("%s (Mode='%s')", err, f.ctx.mode))
+			return
+		}
+		st.anchor = st.lineStart + best[1]
+		st.push(l, f)
+	}
+}
+
+// entered return true if the context of the begin rule r was entered at pos.
+func (st *state) entered(r *rule, pos int) bool {
+	for i := len(st.frames) - 1; i > 0 && st.frames[i].enterPos == pos; i-- {
+		if st.frames[i].rule == r {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve sets the end or while regex of the frame, substituting the groups of
+// the match m of line of its begin regex.
+func (f *frame) resolve(line string, m []int) error {
+	pat := f.rule.end
+	if pat == nil {
+		pat = f.rule.while
+	}
+	if pat == nil {
+		return nil
+	}
+	re, noG := pat.re, pat.noG
+	if pat.backrefs {
+		var err error
+		if re, noG, err = compilePattern(resolveBackrefs(pat.src, line, m)); err != nil {
+			return err
+		}
+	}
+	if f.rule.end != nil {
+		f.end = re
+	} else {
+		f.while = re
+	}
+	f.endNoG = noG
+	return nil
+}
+
+// emitCaptures queues the lexemes of the match m of line. The text of the
+// groups with a capture has the type of its name, or is tokenized by its
+// patterns. The other text has the type typ.
+func (st *state) emitCaptures(l *clrcore.LexerEngine, line string, m []int, caps []*capture, typ *clrcore.LexemeType) {
+	type span struct {
+		end int
+		typ *clrcore.LexemeType
+	}
+	spans := []span{{end: m[1], typ: typ}}
+	cur := m[0]
+	for i, c := range caps {
+		if c == nil || 2*i+1 >= len(m) {
+			continue
+		}
+		beg, end := m[2*i], m[2*i+1]
+		if beg < cur || beg >= end || beg >= m[1] {
+			continue
+		}
+		for len(spans) > 1 && spans[len(spans)-1].end <= beg {
+			s := spans[len(spans)-1]
+			st.emit(l, s.typ, s.end-cur)
+			cur = s.end
+			spans = spans[:len(spans)-1]
+		}
+		outer := spans[len(spans)-1]
+		if end > outer.end {
+			end = outer.end
+		}
+		st.emit(l, outer.typ, beg-cur)
+		cur = beg
+		t := typeOr(c.typ, outer.typ)
+		if c.ctx == nil {
+			spans = append(spans, span{end: end, typ: t})
+			continue
+		}
+		st.tokenize(l, c.ctx, t, st.lineStart+end)
+		if st.failed {
+			return
+		}
+		cur = end
+	}
+	for i := len(spans) - 1; i >= 0; i-- {
+		st.emit(l, spans[i].typ, spans[i].end-cur)
+		cur = spans[i].end
+	}
+}
+
+// tokenize tokenizes the text up to the offset end with the patterns of the
+// context, whose text has the type typ.
+func (st *state) tokenize(l *clrcore.LexerEngine, ctx *context, typ *clrcore.LexemeType, end int) {
+	n := len(st.frames)
+	st.push(l, &frame{ctx: ctx, typ: typ, contentTyp: typ, enterPos: st.pos(l), anchor: st.anchor})
+	for !st.failed && st.pos(l) < end {
+		st.step(l, end)
+	}
+	st.popTo(l, n)
+}
@@ -0,0 +1,238 @@
+package clrtextmate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+const miniGrammar = `{
+  "name": "Mini",
+  "scopeName": "source.mini",
+  "fileTypes": ["mini", "Minifile"],
+  "firstLineMatch": "^#!.*\\bmini\\b",
+  "patterns": [
+    {"include": "#comment"},
+    {"match": "\\b(func)\\s+(\\w+)", "captures": {
+      "1": {"name": "storage.type.function.mini"},
+      "2": {"name": "entity.name.function.mini"}}},
+    {"match": "\\b(?:if|return)\\b", "name": "keyword.control.mini"},
+    {"include": "#number"},
+    {"begin": "\"", "end": "\"", "name": "string.quoted.double.mini",
+     "patterns": [{"match": "\\\\.", "name": "constant.character.escape.mini"}]},
+    {"begin": "<<(\\w+)", "end": "^\\1$", "name": "string.unquoted.heredoc.mini"},
+    {"begin": "^(>)", "while": "^(>)", "contentName": "comment.block.mini",
+     "captures": {"1": {"name": "punctuation.definition.quote.mini"}}},
+    {"begin": "\\[", "end": "\\]", "name": "meta.list.mini",
+     "beginCaptures": {"0": {"name": "punctuation.section.list.begin.mini"}},
+     "endCaptures": {"0": {"name": "punctuation.section.list.end.mini"}},
+     "patterns": [{"include": "$self"}]},
+    {"begin": "\\b(use)\\b", "end": "(?!\\G)",
+     "beginCaptures": {"1": {"name": "keyword.other.use.mini"}},
+     "patterns": [{"match": "\\G\\s+(\\w+)", "captures": {"1": {"name": "entity.name.namespace.mini"}}}]},
+    {"match": "(\\w+)(=)(\\w+)", "captures": {
+      "0": {"name": "meta.assignment.mini"},
+      "1": {"name": "variable.other.mini"},
+      "2": {"name": "keyword.operator.assignment.mini"},
+      "3": {"patterns": [{"include": "#number"}]}}},
+    {"begin": "(?=%)", "end": "(?=%)"},
+    {"begin": "\\(", "end": "\\)", "applyEndPatternLast": 1,
+     "patterns": [{"match": "\\)\\)", "name": "keyword.operator.paren.mini"}]},
+    {"include": "source.mini-other#word"},
+    {"include": "source.unknown"}
+  ],
+  "repository": {
+    "comment": {"patterns": [{"match": "//.*$", "name": "comment.line.double-slash.mini"}]},
+    "number": {"match": "\\b\\d+\\b", "name": "constant.numeric.integer.mini"}
+  }
+}`
+
+const otherGrammar = `{
+  "scopeName": "source.mini-other",
+  "repository": {
+    "word": {"match": "@\\w+", "name": "support.function.other"}
+  }
+}`
+
+func TestLexer(t *testing.T) {
+	g, err := ParseGrammar([]byte(miniGrammar))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	other, err := ParseGrammar([]byte(otherGrammar))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	RegisterGrammar(other)
+	info := g.LexerInfo(nil)
+	text := "func f // c\n" +
+		"x=12 y=ab [1 \"a\\\"b\"]\n" +
+		"<<EOT\nreturn\nEOT\n" +
+		"> q\n> r\ns\n" +
+		"use pkg 2\n" +
+		"@w %a @w\n" +
+		"(a)))\n" +
+		"\"unterminated\nif"
+	l, err := info.NewLexer(text)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []string
+	var all strings.Builder
+	for {
+		lexeme := l.NextLexeme()
+		if lexeme.IsA(clrcore.Stop) {
+			if lexeme.Type != clrcore.StopEndOfString {
+				t.Fatalf("unexpected stop lexeme %s %q", lexeme.Type, lexeme.Str)
+			}
+			break
+		}
+		got = append(got, fmt.Sprintf("%s %q", lexeme.Type, lexeme.Str))
+		all.WriteString(lexeme.Str)
+	}
+	if all.String() != text {
+		t.Errorf("got text %q, expected %q", all.String(), text)
+	}
+	expect := []string{
+		`Code.Identifier.Type "func"`, `Text " "`, `Code.Identifier.Function "f"`, `Text " "`,
+		`Code.Comment "// c"`, `Text "\n"`,
+		`Code.Identifier.Variable "x"`, `Code.Operator.Assignment "="`, `Code.Number.Integer "12"`, `Text " "`,
+		`Code.Identifier.Variable "y"`, `Code.Operator.Assignment "="`, `Text "ab"`, `Text " "`,
+		`Code.Punctuation "["`, `Code.Number.Integer "1"`, `Text " "`,
+		`Code.String.Double "\""`, `Code.String.Double "a"`, `Code.String "\\\""`, `Code.String.Double "b"`,
+		`Code.String.Double "\""`, `Code.Punctuation "]"`, `Text "\n"`,
+		`Code.String.Multiline "<<EOT"`, `Code.String.Multiline "\n"`, `Code.String.Multiline "return\n"`,
+		`Code.String.Multiline "EOT"`, `Text "\n"`,
+		`Code.Punctuation ">"`, `Code.Comment " q\n"`, `Code.Punctuation ">"`, `Code.Comment " r\n"`, `Text "s\n"`,
+		`Code.Identifier.Keyword "use"`, `Text " "`, `Code.Identifier.Namespace "pkg"`, `Text " "`,
+		`Code.Number.Integer "2"`, `Text "\n"`,
+		`Code.Identifier.Function "@w"`, `Text " "`, `Text "%a @w\n"`,
+		`Text "("`, `Text "a"`, `Code.Operator "))"`, `Text ")"`, `Text "\n"`,
+		`Code.String.Double "\""`, `Code.String.Double "unterminated\n"`, `Code.String.Double "if"`,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got lexemes:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expect, "\n"))
+	}
+}
+
+func TestLexerInfo(t *testing.T) {
+	g, err := ParseGrammar([]byte(miniGrammar))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	info := g.LexerInfo(ScopeTypes{"keyword": clrcore.TextWord})
+	if expect := []string{"mini", "source.mini"}; !reflect.DeepEqual(info.Names, expect) {
+		t.Errorf("got names %q, expected %q", info.Names, expect)
+	}
+	if expect := []string{"*.mini", "Minifile"}; !reflect.DeepEqual(info.FileNames, expect) {
+		t.Errorf("got file names %q, expected %q", info.FileNames, expect)
+	}
+	if v := info.AnalyseText("#!/usr/bin/env mini\nx"); v != 1 {
+		t.Errorf("got likelihood %v, expected 1", v)
+	}
+	if v := info.AnalyseText("x\n#!/usr/bin/env mini"); v != 0 {
+		t.Errorf("got likelihood %v, expected 0", v)
+	}
+	l, err := info.NewLexer("if 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lexeme := l.NextLexeme(); lexeme.Type != clrcore.TextWord {
+		t.Errorf("got lexeme %v, expected a Text.Word", lexeme)
+	}
+	// the numbers are not mapped by the table
+	l.NextLexeme()
+	if lexeme := l.NextLexeme(); lexeme.Type != clrcore.Text || lexeme.Str != "1" {
+		t.Errorf("got lexeme %v, expected a Text", lexeme)
+	}
+}
+
+func TestLexerStopMarker(t *testing.T) {
+	g, err := ParseGrammar([]byte(miniGrammar))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	l, err := g.LexerInfo(nil).NewLexer("[1 ?>2]", "?>")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var lexeme clrcore.Lexeme
+	for lexeme = l.NextLexeme(); !lexeme.IsA(clrcore.Stop); lexeme = l.NextLexeme() {
+	}
+	if lexeme.Type != clrcore.StopLexer || l.RemainingText() != "2]" {
+		t.Errorf("got stop lexeme %v and remaining text %q", lexeme, l.RemainingText())
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	g := &Grammar{
+		ScopeName: "source.bad",
+		Patterns:  []*Rule{{Begin: "a", End: "(b", Name: "string.bad"}},
+	}
+	_, err := g.LexerInfo(nil).NewLexer("ab")
+	if err == nil {
+		t.Fatal("unexpected nil error")
+	}
+	if expect := `(LexerDef="source.bad", Mode="string.bad#1", Rule=0)`; !strings.HasSuffix(err.Error(), expect) {
+		t.Errorf("got error %q, expected suffix %q", err, expect)
+	}
+	// the end regex referencing the begin groups is compiled when entered
+	g = &Grammar{
+		ScopeName: "source.bad",
+		Patterns:  []*Rule{{Begin: "(a)", End: "\\1(", Name: "string.bad"}},
+	}
+	l, err := g.LexerInfo(nil).NewLexer("ab")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lexeme := l.NextLexeme(); lexeme.Type != clrcore.CodeString {
+		t.Errorf("got lexeme %v, expected the begin match", lexeme)
+	}
+	if lexeme := l.NextLexeme(); lexeme.Type != clrcore.StopError || !strings.HasSuffix(lexeme.Str, "(Mode='string.bad#1')") {
+		t.Errorf("got lexeme %v, expected a StopError", lexeme)
+	}
+}
+
+func TestLoadLexer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clrtextmate")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "load.tmLanguage.json")
+	data := `{"name": "Test Load", "scopeName": "source.test-load", "patterns": [{"match": "\\d+", "name": "constant.numeric"}]}`
+	if err := ioutil.WriteFile(fileName, []byte(data), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	info, err := LoadLexer(fileName, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if clrcore.LexerByName("test load") != info || GrammarByScope("source.test-load") == nil {
+		t.Error("lexer or grammar not registered")
+	}
+	if _, err := LoadLexer(fileName, nil); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("got error %v, expected already registered error", err)
+	}
+	// the name of the Go lexer is dropped
+	data = `{"name": "Go", "scopeName": "source.test-go", "patterns": []}`
+	if err := ioutil.WriteFile(fileName, []byte(data), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	clrcore.RegisterLexer(&clrcore.LexerInfo{Names: []string{"go"}, NewLexer: info.NewLexer})
+	if info, err = LoadLexer(fileName, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expect := []string{"source.test-go"}; !reflect.DeepEqual(info.Names, expect) {
+		t.Errorf("got names %q, expected %q", info.Names, expect)
+	}
+	if _, err := LoadLexer(filepath.Join(dir, "missing.json"), nil); err == nil {
+		t.Error("unexpected nil error for missing file")
+	}
+}
@@ -0,0 +1,125 @@
+package clrtextmate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parsePlist return the value of an XML property list. A dict is returned as a
+// map[string]interface{}, an array as a []interface{}, a string, data or date
+// as a string, an integer as an int64, a real as a float64, and true and false
+// as a bool.
+func parsePlist(data []byte) (interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	for {
+		start, err := nextStart(d)
+		if err == io.EOF {
+			return nil, errors.New("plist has no value")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start.Name.Local != "plist" {
+			return parsePlistValue(d, start)
+		}
+	}
+}
+
+// nextStart return the next start element, skipping the other tokens. It
+// return io.EOF at the end of the document or of the enclosing element.
+func nextStart(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			return xml.StartElement{}, io.EOF
+		}
+	}
+}
+
+// parsePlistValue return the value of the element started by start.
+func parsePlistValue(d *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		m := make(map[string]interface{})
+		for {
+			key, err := nextStart(d)
+			if err == io.EOF {
+				return m, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if key.Name.Local != "key" {
+				return nil, fmt.Errorf("plist dict has a '%s' element instead of a key", key.Name.Local)
+			}
+			var name string
+			if err := d.DecodeElement(&name, &key); err != nil {
+				return nil, err
+			}
+			elem, err := nextStart(d)
+			if err == io.EOF {
+				return nil, fmt.Errorf("plist dict key '%s' has no value", name)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if m[name], err = parsePlistValue(d, elem); err != nil {
+				return nil, err
+			}
+		}
+	case "array":
+		a := []interface{}{}
+		for {
+			elem, err := nextStart(d)
+			if err == io.EOF {
+				return a, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := parsePlistValue(d, elem)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "string", "data", "date":
+		return text, nil
+	case "integer":
+		v, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plist integer '%s'", text)
+		}
+		return v, nil
+	case "real":
+		v, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plist real '%s'", text)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown plist element '%s'", start.Name.Local)
+}
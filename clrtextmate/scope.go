@@ -0,0 +1,85 @@
+package clrtextmate
+
+import (
+	"strings"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+// ScopeTypes maps TextMate scope names to lexeme types. A scope name is mapped
+// by its longest prefix, ending at a dot, found in the table. For instance, with
+// the DefaultScopeTypes, keyword.control.go is mapped by keyword.control to
+// clrcore.CodeIdentifierKeyword.
+type ScopeTypes map[string]*clrcore.LexemeType
+
+// DefaultScopeTypes maps the scope names of the TextMate naming conventions to
+// the lexeme types.
+var DefaultScopeTypes = ScopeTypes{
+	"comment":                      clrcore.CodeComment,
+	"constant":                     clrcore.CodeIdentifierLiteral,
+	"constant.character":           clrcore.CodeStringSingle,
+	"constant.character.escape":    clrcore.CodeString,
+	"constant.numeric":             clrcore.CodeNumber,
+	"constant.numeric.integer":     clrcore.CodeNumberInteger,
+	"constant.numeric.decimal":     clrcore.CodeNumberDecimal,
+	"constant.numeric.float":       clrcore.CodeNumberDecimal,
+	"constant.numeric.hex":         clrcore.CodeNumberHexadecimal,
+	"constant.numeric.octal":       clrcore.CodeNumberOctal,
+	"constant.numeric.binary":      clrcore.CodeNumberBinary,
+	"entity.name":                  clrcore.CodeIdentifier,
+	"entity.name.class":            clrcore.CodeIdentifierClass,
+	"entity.name.function":         clrcore.CodeIdentifierFunction,
+	"entity.name.namespace":        clrcore.CodeIdentifierNamespace,
+	"entity.name.package":          clrcore.CodeIdentifierNamespace,
+	"entity.name.tag":              clrcore.CodeIdentifierKeyword,
+	"entity.name.type":             clrcore.CodeIdentifierType,
+	"entity.other.attribute-name":  clrcore.CodeIdentifierVariable,
+	"entity.other.inherited-class": clrcore.CodeIdentifierClass,
+	"invalid":                      clrcore.TextInvalid,
+	"keyword":                      clrcore.CodeIdentifierKeyword,
+	"keyword.operator":             clrcore.CodeOperator,
+	"keyword.operator.assignment":  clrcore.CodeOperatorAssignment,
+	"keyword.operator.arithmetic":  clrcore.CodeOperatorArithmetic,
+	"keyword.operator.logical":     clrcore.CodeOperatorLogical,
+	"keyword.operator.bitwise":     clrcore.CodeOperatorBinary,
+	"keyword.operator.word":        clrcore.CodeIdentifierOperator,
+	"meta.preprocessor":            clrcore.CodePreprocessor,
+	"punctuation":                  clrcore.CodePunctuation,
+	"storage":                      clrcore.CodeIdentifierKeyword,
+	"storage.type":                 clrcore.CodeIdentifierType,
+	"string":                       clrcore.CodeString,
+	"string.quoted.single":         clrcore.CodeStringSingle,
+	"string.quoted.double":         clrcore.CodeStringDouble,
+	"string.quoted.triple":         clrcore.CodeStringMultiline,
+	"string.quoted.raw":            clrcore.CodeStringRaw,
+	"string.quoted.other.lt-gt":    clrcore.CodePreprocessorFile,
+	"string.unquoted.heredoc":      clrcore.CodeStringMultiline,
+	"string.regexp":                clrcore.CodeStringRegex,
+	"support.class":                clrcore.CodeIdentifierClass,
+	"support.constant":             clrcore.CodeIdentifierLiteral,
+	"support.function":             clrcore.CodeIdentifierFunction,
+	"support.type":                 clrcore.CodeIdentifierType,
+	"support.variable":             clrcore.CodeIdentifierVariable,
+	"variable":                     clrcore.CodeIdentifierVariable,
+	"variable.function":            clrcore.CodeIdentifierFunction,
+}
+
+// Type return the lexeme type of the scope name, or nil if none of its prefixes
+// is in the table. The name may be a list of scope names separated by spaces, in
+// which case the last mapped name gives the type.
+func (s ScopeTypes) Type(name string) *clrcore.LexemeType {
+	names := strings.Fields(name)
+	for i := len(names) - 1; i >= 0; i-- {
+		for prefix := names[i]; prefix != ""; {
+			if t, ok := s[prefix]; ok {
+				return t
+			}
+			j := strings.LastIndexByte(prefix, '.')
+			if j < 0 {
+				break
+			}
+			prefix = prefix[:j]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package clrtextmate
+
+import (
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+func TestScopeTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect *clrcore.LexemeType
+	}{
+		{"keyword.control.go", clrcore.CodeIdentifierKeyword},
+		{"keyword.operator.assignment.go", clrcore.CodeOperatorAssignment},
+		{"keyword", clrcore.CodeIdentifierKeyword},
+		{"keywords", nil},
+		{"constant.numeric.hex.c", clrcore.CodeNumberHexadecimal},
+		{"meta.function.go", nil},
+		{"string.quoted.double.go meta.embedded", clrcore.CodeStringDouble},
+		{"comment.line entity.name.function", clrcore.CodeIdentifierFunction},
+		{"", nil},
+	}
+	for _, test := range tests {
+		if got := DefaultScopeTypes.Type(test.name); got != test.expect {
+			t.Errorf("%q: got type %v, expected %v", test.name, got, test.expect)
+		}
+	}
+}
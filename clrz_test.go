@@ -0,0 +1,31 @@
+package clrz
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chmike/clrz/clrcore"
+	"github.com/chmike/clrz/clrcore/lexertest"
+)
+
+// FuzzLexers checks the invariants of the lexers available out of the box.
+func FuzzLexers(f *testing.F) {
+	lexertest.Fuzz(f, clrcore.Lexers()...)
+}
+
+func TestFormatHTMLLanguages(t *testing.T) {
+	text := "import os\n\ndef f(x):\n    return os.path.join(x)\n"
+	var expect, got bytes.Buffer
+	if _, err := FormatHTML(&expect, text, "python"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := FormatHTML(&got, text, "go", "unknown", "c", "python", "go"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.String() != expect.String() {
+		t.Errorf("got:\n%s\nexpected:\n%s", got.String(), expect.String())
+	}
+	if _, err := FormatHTML(&got, text, "unknown", "other"); err == nil {
+		t.Error("unexpected nil error for unknown languages")
+	}
+}
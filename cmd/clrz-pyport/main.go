@@ -0,0 +1,123 @@
+// Command clrz-pyport generates the Go source of a clrz lexer from the JSON dump
+// of the tokens table of a Pygments RegexLexer.
+//
+//	clrz-pyport [-pkg name] [-engine auto|re2|backtrack] [-o out.go] [lexer.json]
+//
+// The JSON dump is read from the file, or from the standard input when no file
+// is given. It is produced by the pygments_dump.py script of this directory
+// (e.g. python3 pygments_dump.py ini ini.json) and has the following form.
+//
+//	{
+//	  "name": "INI",
+//	  "class": "IniLexer",
+//	  "aliases": ["ini", "cfg"],
+//	  "filenames": ["*.ini", "*.cfg"],
+//	  "mimetypes": ["text/x-ini"],
+//	  "flags": "m",
+//	  "tokens": {
+//	    "root": [
+//	      ["\\s+", "Token.Text.Whitespace"],
+//	      ["(\\[)(.*?)(\\])", {"bygroups": ["Token.Keyword", null, "Token.Keyword"]}],
+//	      ["[a-z]+", "Token.Name", "value"],
+//	      {"include": "comments"}
+//	    ],
+//	    ...
+//	  }
+//	}
+//
+// The flags are the letters of the Python regex flags of the lexer (i, m, s and x).
+// The states are listed in the order of the Pygments tokens table. A rule is a
+// [regex, action] or [regex, action, state] array, an {"include": state} object
+// or a {"default": state} object. An action is one of
+//
+//	"Token.Name"                       the match is a lexeme of the token type
+//	null                               the match is a Text lexeme
+//	{"bygroups": [action, ...]}        the groups are lexemes of the token types
+//	{"using": "this", "state": state}  the match is lexed by the lexer in the state
+//	{"using": "lexer name"}            the match is lexed by the named lexer
+//	{"callback": "function name"}      a Python function, can't be translated
+//
+// A state transition is a state name, "#pop", "#pop:n", "#push", a list of them,
+// or a {"combined": [state, ...]} object.
+//
+// The generated file registers the lexer with the Pygments aliases as names. The
+// Pygments token names are mapped to the clrz lexeme types with
+// clrcore.PygmentsTokenType, and Token to clrcore.Text. The rules are translated with clrcore.PopMatch,
+// clrcore.ByGroups, clrcore.LexMatch, clrcore.PushMode, clrcore.PopModes and
+// clrcore.IncludeRule. The combined states are modes including the rules of
+// their states. The rules that can't be translated are reported on the standard
+// error and by a comment in the generated file. Their match is then output as a
+// Text lexeme.
+//
+// As in Pygments, an unmatched character is output as a Text.Invalid lexeme and
+// an unmatched newline resets the lexer to the root state (see clrcore.Recovery).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/chmike/clrz/clrcore"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "clrz-pyport:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command with the given arguments. The untranslated items are
+// reported to stderr.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) (err error) {
+	fs := flag.NewFlagSet("clrz-pyport", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	pkg := fs.String("pkg", "", "`name` of the generated package (default first lexer alias)")
+	engineName := fs.String("engine", "auto", "regex `engine` of the rules: auto, re2 or backtrack")
+	outFile := fs.String("o", "", "output `file` (default standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var engine clrcore.RegexEngine
+	switch *engineName {
+	case "auto":
+		engine = clrcore.AutoEngine
+	case "re2":
+		engine = clrcore.RE2Engine
+	case "backtrack":
+		engine = clrcore.BacktrackEngine
+	default:
+		return fmt.Errorf("unknown regex engine %q", *engineName)
+	}
+	var data []byte
+	switch fs.NArg() {
+	case 0:
+		data, err = ioutil.ReadAll(stdin)
+	case 1:
+		data, err = ioutil.ReadFile(fs.Arg(0))
+	default:
+		return fmt.Errorf("expected one JSON file, got %d", fs.NArg())
+	}
+	if err != nil {
+		return err
+	}
+	spec, err := parseSpec(data)
+	if err != nil {
+		return err
+	}
+	src, issues, err := port(spec, *pkg, engine)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(stderr, "clrz-pyport:", issue)
+	}
+	if *outFile == "" {
+		_, err = stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*outFile, src, 0644)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkTypes checks that the token type table of the generated source src is
+// expect.
+func checkTypes(t *testing.T, src, expect string) {
+	t.Helper()
+	var table string
+	if i := strings.Index(src, "var tokenTypes = "); i >= 0 {
+		table = src[i:]
+		if j := strings.Index(table, "\n}\n"); j >= 0 {
+			table = table[:j+3]
+		}
+	}
+	if table != expect {
+		t.Errorf("got token types:\n%s\nexpected:\n%s", table, expect)
+	}
+}
+
+func TestRunIni(t *testing.T) {
+	var out, report bytes.Buffer
+	if err := run([]string{"testdata/ini.json"}, nil, &out, &report); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if report.Len() != 0 {
+		t.Errorf("unexpected report:\n%s", report.String())
+	}
+	for _, expect := range []string{
+		"// Code generated by clrz-pyport from the Pygments IniLexer. DO NOT EDIT.\n\npackage ini\n",
+		"\tNames:          []string{\"ini\", \"cfg\", \"dosini\"},\n",
+		"\t\t\t{Name: \"root\", Rules: []clrcore.LexerDefRule{\n\t\t\t\t&clrcore.RegexDefRule{Re: `(?m)\\s+`, Do: clrcore.PopMatch(t[\"Text.Whitespace\"])},\n",
+		"Do: clrcore.All(clrcore.PopMatch(t[\"Name.Attribute\"], t[\"Text.Whitespace\"], t[\"Operator\"], t[\"Text.Whitespace\"], t[\"Literal.String\"]), clrcore.PushMode(\"quoted_value\"))},\n",
+		"&clrcore.RegexDefRule{Re: `(?m)(.+?)$`, Do: clrcore.PopMatchAs(t[\"Name.Attribute\"])},\n",
+		"&clrcore.RegexDefRule{Re: `(?m).*$`, Do: clrcore.All(clrcore.PopMatch(t[\"Literal.String\"]), clrcore.PopModes(1))},\n",
+	} {
+		if !strings.Contains(out.String(), expect) {
+			t.Errorf("got:\n%s\nexpected to contain:\n%s", out.String(), expect)
+		}
+	}
+	checkTypes(t, out.String(), `var tokenTypes = map[string]*clrcore.LexemeType{
+	"Comment.Single":  clrcore.LexemeTypeByName("Code.Comment"),
+	"Keyword":         clrcore.LexemeTypeByName("Code.Identifier.Keyword"),
+	"Literal.String":  clrcore.LexemeTypeByName("Code.String"),
+	"Name.Attribute":  clrcore.LexemeTypeByName("Code.Identifier.Variable"),
+	"Operator":        clrcore.LexemeTypeByName("Code.Operator"),
+	"Text":            clrcore.LexemeTypeByName("Text"),
+	"Text.Whitespace": clrcore.LexemeTypeByName("Text.WhiteSpace"),
+}
+`)
+}
+
+func TestRunRules(t *testing.T) {
+	var out, report bytes.Buffer
+	if err := run([]string{"-pkg", "rules", "-engine", "backtrack", "testdata/rules.json"}, nil, &out, &report); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	src := out.String()
+	for _, expect := range []string{
+		"package rules\n",
+		"\tRecovery: clrcore.RecoverRune | clrcore.RecoverNewLine,\n",
+		"\t\t\t{Name: \"root\", Rules: []clrcore.LexerDefRule{\n\t\t\t\t&clrcore.IncludeRule{Mode: \"space\"},\n",
+		"Do: clrcore.All(clrcore.PopMatch(t[\"Name.Function\"], t[\"Punctuation\"]), clrcore.PushMode(\"args\")), Engine: clrcore.BacktrackEngine},\n",
+		"Do: clrcore.ByGroups(clrcore.PopMatch(t[\"Name.Variable\"]), clrcore.PopMatch(clrcore.Text), clrcore.PopMatch(t[\"Operator\"]), clrcore.LexMatch(\"\", \"value\")), Engine",
+		"Do: clrcore.PopMatchAs(t[\"Name.Label\"]), Engine",
+		"Do: clrcore.All(clrcore.PopMatch(t[\"Literal.String\"]), clrcore.PushMode(\"combined(escape,string)\")), Engine",
+		"\t\t\t\t// clrz-pyport: callback function 'heredoc_callback'\n\t\t\t\t&clrcore.RegexDefRule{Re: `<<`, Do: clrcore.PopMatch(clrcore.Text), Engine",
+		"\t\t\t\t// clrz-pyport: bygroups with 3 actions for 2 groups\n\t\t\t\t&clrcore.RegexDefRule{Re: `(a)(b)`, Do: clrcore.PopMatchAs(clrcore.Text), Engine",
+		"\t\t\t\t// clrz-pyport: unknown state \"backtick\"\n\t\t\t\t&clrcore.RegexDefRule{Re: \"`\", Do: clrcore.PopMatch(t[\"Literal.String.Backtick\"]), Engine",
+		"\t\t\t\t// clrz-pyport: invalid regex `[`: ",
+		"\t\t\t\t// clrz-pyport: include of unknown state 'missing'\n\t\t\t}},\n",
+		"Re: `\\(`, Do: clrcore.All(clrcore.PopMatch(t[\"Punctuation\"]), clrcore.PushCurrentMode()), Engine",
+		"Re: `\\)\\)`, Do: clrcore.All(clrcore.PopMatch(t[\"Punctuation\"]), clrcore.PopModes(2)), Engine",
+		"Re: `[^()]+`, Do: clrcore.PopMatch(clrcore.Text), Engine",
+		"&clrcore.RegexDefRule{Re: ``, Do: clrcore.All(clrcore.PopModes(1), clrcore.PushMode(\"value\")), Engine",
+		"\t\t\t{Name: \"combined(escape,string)\", Rules: []clrcore.LexerDefRule{\n\t\t\t\t&clrcore.IncludeRule{Mode: \"escape\"},\n\t\t\t\t&clrcore.IncludeRule{Mode: \"string\"},\n\t\t\t}},\n",
+	} {
+		if !strings.Contains(src, expect) {
+			t.Errorf("got:\n%s\nexpected to contain:\n%s", src, expect)
+		}
+	}
+	if !strings.HasPrefix(src[strings.Index(src, "d.Modes"):], "d.Modes = []*clrcore.LexerDefMode{\n\t\t\t{Name: \"root\"") {
+		t.Error("root is not the first mode")
+	}
+	expect := `clrz-pyport: callback function 'heredoc_callback' (State='root', Rule=5)
+clrz-pyport: bygroups with 3 actions for 2 groups (State='root', Rule=6)
+clrz-pyport: unknown state "backtick" (State='root', Rule=7)
+clrz-pyport: invalid regex ` + "`[`" + `: error parsing regexp: unterminated character set at position 0: ` + "`[`" + ` (State='root', Rule=8)
+clrz-pyport: include of unknown state 'missing' (State='root', Rule=9)
+`
+	if report.String() != expect {
+		t.Errorf("got report:\n%s\nexpected:\n%s", report.String(), expect)
+	}
+	checkTypes(t, src, `var tokenTypes = map[string]*clrcore.LexemeType{
+	"Literal.Number.Integer":  clrcore.LexemeTypeByName("Code.Number.Integer"),
+	"Literal.String":          clrcore.LexemeTypeByName("Code.String"),
+	"Literal.String.Backtick": clrcore.LexemeTypeByName("Code.String.Raw"),
+	"Literal.String.Escape":   clrcore.LexemeTypeByName("Code.String"),
+	"Name.Function":           clrcore.LexemeTypeByName("Code.Identifier.Function"),
+	"Name.Label":              clrcore.LexemeTypeByName("Code.Identifier"),
+	"Name.Variable":           clrcore.LexemeTypeByName("Code.Identifier.Variable"),
+	"Operator":                clrcore.LexemeTypeByName("Code.Operator"),
+	"Punctuation":             clrcore.LexemeTypeByName("Code.Punctuation"),
+	"Text.Whitespace":         clrcore.LexemeTypeByName("Text.WhiteSpace"),
+	"Token":                   clrcore.LexemeTypeByName("Text"),
+}
+`)
+}
+
+func TestGeneratedBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build of the generated sources in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "clrz-pyport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gomod := "module gen\n\ngo 1.18\n\nrequire github.com/chmike/clrz v0.0.0\n\nreplace github.com/chmike/clrz => " + root + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-o", filepath.Join(dir, "ini", "ini.go"), "testdata/ini.json"},
+		{"-pkg", "rules", "-engine", "backtrack", "-o", filepath.Join(dir, "rules", "rules.go"), "testdata/rules.json"},
+	} {
+		if err := os.MkdirAll(filepath.Dir(args[len(args)-2]), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := run(args, nil, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+			t.Fatalf("unexpected error for %v: %s", args, err)
+		}
+	}
+	cmd := exec.Command(goTool, "vet", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off", "GOPROXY=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("generated sources don't build: %s\n%s", err, out)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		args  []string
+		input string
+	}{
+		{args: []string{"-engine", "pcre"}, input: `{"name": "a", "tokens": {"root": []}}`},
+		{args: []string{"a.json", "b.json"}},
+		{args: []string{"testdata/missing.json"}},
+		{input: `{"name": "a", "tokens": {"root": [}}`},
+		{input: `{"tokens": {"root": []}}`},
+		{input: `{"name": "a", "flags": "mu", "tokens": {"root": []}}`},
+		{input: `{"name": "a", "tokens": []}`},
+		{input: `{"name": "a", "tokens": {"other": []}}`},
+		{input: `{"name": "a", "tokens": {"root": 1}}`},
+	}
+	for _, test := range tests {
+		if err := run(test.args, strings.NewReader(test.input), &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+			t.Errorf("unexpected nil error for %v %s", test.args, test.input)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chmike/clrz/clrcore"
+	"github.com/chmike/clrz/clrregexp"
+)
+
+// lexerSpec is the JSON dump of a Pygments lexer.
+type lexerSpec struct {
+	Name      string          `json:"name"`
+	Class     string          `json:"class"`
+	Aliases   []string        `json:"aliases"`
+	FileNames []string        `json:"filenames"`
+	MimeTypes []string        `json:"mimetypes"`
+	Flags     string          `json:"flags"`
+	Tokens    json.RawMessage `json:"tokens"`
+	states    []state         // states of Tokens in order
+}
+
+// state is a state of the tokens table of a Pygments lexer.
+type state struct {
+	name  string
+	rules []interface{}
+}
+
+// parseSpec return the lexer spec decoded from the JSON data.
+func parseSpec(data []byte) (*lexerSpec, error) {
+	spec := &lexerSpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+	if len(spec.Aliases) == 0 && spec.Name == "" {
+		return nil, errors.New("lexer has no name and no aliases")
+	}
+	if !regexp.MustCompile(`^[imsx]*$`).MatchString(spec.Flags) {
+		return nil, fmt.Errorf("invalid regex flags %q", spec.Flags)
+	}
+	// the states are decoded one by one to keep their order
+	dec := json.NewDecoder(bytes.NewReader(spec.Tokens))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("tokens is not a JSON object")
+	}
+	hasRoot := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		st := state{name: tok.(string)}
+		if err := dec.Decode(&st.rules); err != nil {
+			return nil, fmt.Errorf("state '%s': %v", st.name, err)
+		}
+		if st.name == "root" {
+			// root is the first mode
+			hasRoot = true
+			spec.states = append([]state{st}, spec.states...)
+		} else {
+			spec.states = append(spec.states, st)
+		}
+	}
+	if !hasRoot {
+		return nil, errors.New("tokens has no root state")
+	}
+	return spec, nil
+}
+
+// porter translates the tokens table of a Pygments lexer into modes.
+type porter struct {
+	spec   *lexerSpec
+	engine clrcore.RegexEngine
+	states map[string]bool   // names of the states of the spec
+	types  map[string]string // Pygments token name to lexeme type name
+	modes  []*mode           // modes translated from the states
+	extra  []*mode           // modes of the combined states
+	issues []string          // items that can't be translated
+}
+
+// mode is a translated state.
+type mode struct {
+	name  string
+	rules []string // Go source of the rules, preceded by the comments of their issues
+}
+
+// ruleCtx is the context of the translation of a rule.
+type ruleCtx struct {
+	*porter
+	state    string
+	idx      int
+	comments []string
+}
+
+// issue reports an item of the rule that can't be translated.
+func (c *ruleCtx) issue(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	c.comments = append(c.comments, "// clrz-pyport: "+msg)
+	c.issues = append(c.issues, fmt.Sprintf("%s (State='%s', Rule=%d)", msg, c.state, c.idx))
+}
+
+// port return the formatted Go source of the lexer of the spec in the package
+// pkg, and the items that couldn't be translated.
+func port(spec *lexerSpec, pkg string, engine clrcore.RegexEngine) ([]byte, []string, error) {
+	p := &porter{
+		spec:   spec,
+		engine: engine,
+		states: make(map[string]bool),
+		types:  make(map[string]string),
+	}
+	for _, st := range spec.states {
+		p.states[st.name] = true
+	}
+	for _, st := range spec.states {
+		m := &mode{name: st.name}
+		p.modes = append(p.modes, m)
+		for i, r := range st.rules {
+			c := &ruleCtx{porter: p, state: st.name, idx: i}
+			if src := c.rule(r); src != "" {
+				c.comments = append(c.comments, src+",")
+			}
+			m.rules = append(m.rules, strings.Join(c.comments, "\n"))
+		}
+	}
+	if pkg == "" {
+		pkg = packageName(spec.names()[0])
+	}
+	src, err := format.Source(p.source(pkg))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid generated source: %v", err)
+	}
+	return src, p.issues, nil
+}
+
+// names return the names of the lexer.
+func (s *lexerSpec) names() []string {
+	if len(s.Aliases) == 0 {
+		return []string{strings.ToLower(s.Name)}
+	}
+	return s.Aliases
+}
+
+// packageName return a Go package name derived from the lexer name.
+func packageName(name string) string {
+	name = regexp.MustCompile(`[^a-z0-9_]`).ReplaceAllString(strings.ToLower(name), "")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "lexer" + name
+	}
+	return name
+}
+
+// rule return the Go source of the rule r, or an empty string when it can't be
+// translated at all.
+func (c *ruleCtx) rule(r interface{}) string {
+	switch r := r.(type) {
+	case []interface{}:
+		return c.regexRule(r)
+	case map[string]interface{}:
+		if name, ok := r["include"].(string); ok {
+			if !c.states[name] {
+				c.issue("include of unknown state '%s'", name)
+				return ""
+			}
+			return fmt.Sprintf("&clrcore.IncludeRule{Mode: %q}", name)
+		}
+		if st, ok := r["default"]; ok {
+			do := c.transition(st)
+			if len(do) == 0 {
+				c.issue("default rule without state")
+				return ""
+			}
+			return fmt.Sprintf("&clrcore.RegexDefRule{Re: ``, Do: %s%s}", all(do), c.engineField())
+		}
+	}
+	c.issue("unknown rule %s", jsonString(r))
+	return ""
+}
+
+// regexRule return the Go source of the [regex, action, state] rule r.
+func (c *ruleCtx) regexRule(r []interface{}) string {
+	re, ok := r[0].(string)
+	if len(r) < 2 || len(r) > 3 || !ok {
+		c.issue("invalid rule %s", jsonString(r))
+		return ""
+	}
+	if c.spec.Flags != "" {
+		re = "(?" + c.spec.Flags + ")" + re
+	}
+	if err := (&clrcore.RegexDefRule{Re: re, Engine: c.engine}).Init(); err != nil {
+		c.issue("invalid regex %s: %v", quote(re), err)
+		return ""
+	}
+	do := append([]string{c.action(r[1], numGroups(re))}, c.transition(ruleState(r))...)
+	return fmt.Sprintf("&clrcore.RegexDefRule{Re: %s, Do: %s%s}", quote(re), all(do), c.engineField())
+}
+
+// ruleState return the state of the regex rule r, or nil if none.
+func ruleState(r []interface{}) interface{} {
+	if len(r) < 3 {
+		return nil
+	}
+	return r[2]
+}
+
+// engineField return the Engine field of the regex rules.
+func (p *porter) engineField() string {
+	switch p.engine {
+	case clrcore.RE2Engine:
+		return ", Engine: clrcore.RE2Engine"
+	case clrcore.BacktrackEngine:
+		return ", Engine: clrcore.BacktrackEngine"
+	}
+	return ""
+}
+
+// numGroups return the number of capture groups of the valid regex re.
+func numGroups(re string) int {
+	if bt, err := clrregexp.Compile(re); err == nil {
+		return bt.NumSubexp()
+	}
+	return regexp.MustCompile(re).NumSubexp()
+}
+
+// action return the Go source of the function queuing the lexemes of the
+// action a of a regex with n groups.
+func (c *ruleCtx) action(a interface{}, n int) string {
+	switch a := a.(type) {
+	case nil:
+		return popMatch("clrcore.Text", n)
+	case string:
+		return popMatch(c.tokenType(a), n)
+	case map[string]interface{}:
+		if groups, ok := a["bygroups"].([]interface{}); ok {
+			if len(groups) > n {
+				c.issue("bygroups with %d actions for %d groups", len(groups), n)
+				return popMatch("clrcore.Text", n)
+			}
+			// PopMatch requires a lexeme type per group, ByGroups is more general
+			simple := len(groups) == n
+			types := make([]string, len(groups))
+			actions := make([]string, len(groups))
+			for i, g := range groups {
+				if t, ok := c.groupType(g); ok {
+					types[i], actions[i] = t, popMatch(t, 0)
+				} else {
+					simple, actions[i] = false, c.action(g, 0)
+				}
+			}
+			if simple {
+				return "clrcore.PopMatch(" + strings.Join(types, ", ") + ")"
+			}
+			return "clrcore.ByGroups(" + strings.Join(actions, ", ") + ")"
+		}
+		if name, ok := a["using"].(string); ok {
+			st, _ := a["state"].(string)
+			if _, ok := a["state"]; ok && st == "" {
+				c.issue("using with state %s", jsonString(a["state"]))
+			}
+			if name == "this" {
+				if st != "" && !c.states[st] {
+					c.issue("using unknown state '%s'", st)
+					st = ""
+				}
+				return fmt.Sprintf("clrcore.LexMatch(\"\", %q)", st)
+			}
+			if st != "" {
+				c.issue("using lexer '%s' with state '%s'", name, st)
+			}
+			return fmt.Sprintf("clrcore.LexMatch(%q, \"\")", name)
+		}
+		if name, ok := a["callback"].(string); ok {
+			c.issue("callback function '%s'", name)
+			return popMatch("clrcore.Text", n)
+		}
+	}
+	c.issue("unknown action %s", jsonString(a))
+	return popMatch("clrcore.Text", n)
+}
+
+// groupType return the Go source of the lexeme type of the bygroups action a,
+// and false if a is not a token type.
+func (c *ruleCtx) groupType(a interface{}) (string, bool) {
+	switch a := a.(type) {
+	case nil:
+		return "clrcore.Text", true
+	case string:
+		return c.tokenType(a), true
+	}
+	return "", false
+}
+
+// popMatch return the Go source of the function queuing the match of a regex
+// with n groups as a lexeme of type t.
+func popMatch(t string, n int) string {
+	if n == 0 {
+		return "clrcore.PopMatch(" + t + ")"
+	}
+	return "clrcore.PopMatchAs(" + t + ")"
+}
+
+// tokenType return the Go source of the lexeme type of the Pygments token name,
+// and adds it to the token type table.
+func (c *ruleCtx) tokenType(name string) string {
+	key := strings.TrimPrefix(name, "Token.")
+	if _, ok := c.types[key]; !ok {
+		t := clrcore.PygmentsTokenType(name)
+		if key == "Token" {
+			t = clrcore.Text
+		} else if t == nil {
+			c.issue("unknown token type '%s'", name)
+			t = clrcore.Text
+		}
+		c.types[key] = t.Name
+	}
+	return fmt.Sprintf("t[%q]", key)
+}
+
+// transition return the Go source of the functions changing the mode as the
+// Pygments state transition st.
+func (c *ruleCtx) transition(st interface{}) []string {
+	switch st := st.(type) {
+	case nil:
+		return nil
+	case string:
+		switch {
+		case st == "#pop":
+			return []string{"clrcore.PopModes(1)"}
+		case strings.HasPrefix(st, "#pop:"):
+			n, err := strconv.Atoi(st[len("#pop:"):])
+			if err != nil || n <= 0 {
+				break
+			}
+			return []string{fmt.Sprintf("clrcore.PopModes(%d)", n)}
+		case st == "#push":
+			return []string{"clrcore.PushCurrentMode()"}
+		case c.states[st]:
+			return []string{fmt.Sprintf("clrcore.PushMode(%q)", st)}
+		}
+	case []interface{}:
+		var do []string
+		for _, s := range st {
+			do = append(do, c.transition(s)...)
+		}
+		return do
+	case map[string]interface{}:
+		if names, ok := st["combined"].([]interface{}); ok {
+			if name := c.combined(names); name != "" {
+				return []string{fmt.Sprintf("clrcore.PushMode(%q)", name)}
+			}
+			return nil
+		}
+	}
+	c.issue("unknown state %s", jsonString(st))
+	return nil
+}
+
+// combined return the name of the mode including the rules of the named states,
+// and adds it to the modes if required. Return an empty string if a state is
+// unknown.
+func (c *ruleCtx) combined(names []interface{}) string {
+	var rules, states []string
+	for _, n := range names {
+		st, ok := n.(string)
+		if !ok || !c.states[st] {
+			c.issue("combined unknown state %s", jsonString(n))
+			return ""
+		}
+		rules = append(rules, fmt.Sprintf("&clrcore.IncludeRule{Mode: %q},", st))
+		states = append(states, st)
+	}
+	name := "combined(" + strings.Join(states, ",") + ")"
+	for _, m := range c.extra {
+		if m.name == name {
+			return name
+		}
+	}
+	c.extra = append(c.extra, &mode{name: name, rules: rules})
+	return name
+}
+
+// all return the Go source of the function calling the functions do in sequence.
+func all(do []string) string {
+	if len(do) == 1 {
+		return do[0]
+	}
+	return "clrcore.All(" + strings.Join(do, ", ") + ")"
+}
+
+// quote return s as a Go string literal, raw when possible.
+func quote(s string) string {
+	if strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// jsonString return v in JSON for the issue messages.
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// source return the unformatted Go source of the lexer in the package pkg.
+func (p *porter) source(pkg string) []byte {
+	spec := p.spec
+	b := &bytes.Buffer{}
+	from := "lexer " + spec.Name
+	if spec.Class != "" {
+		from = spec.Class
+	}
+	fmt.Fprintf(b, "// Code generated by clrz-pyport from the Pygments %s. DO NOT EDIT.\n\n", from)
+	fmt.Fprintf(b, "package %s\n\n", pkg)
+	fmt.Fprintf(b, "import (\n\"io\"\n\n\"github.com/chmike/clrz/clrcore\"\n)\n\n")
+	fmt.Fprintf(b, "// LexerInfo is the registered %s lexer information.\n", spec.Name)
+	fmt.Fprintf(b, "var LexerInfo = &clrcore.LexerInfo{\nNames: %s,\n", stringList(spec.names()))
+	if len(spec.MimeTypes) > 0 {
+		fmt.Fprintf(b, "MimeTypes: %s,\n", stringList(spec.MimeTypes))
+	}
+	if len(spec.FileNames) > 0 {
+		fmt.Fprintf(b, "FileNames: %s,\n", stringList(spec.FileNames))
+	}
+	fmt.Fprintf(b, "NewLexer: newLexer,\nNewReaderLexer: newReaderLexer,\n}\n\n")
+	fmt.Fprintf(b, "func init() {\nclrcore.RegisterLexer(LexerInfo)\n}\n\n")
+	fmt.Fprintf(b, `func newLexer(text string, stopMarkers ...string) (clrcore.Lexer, error) {
+	l, err := clrcore.NewLexerEngine(lexerDef, text, stopMarkers, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func newReaderLexer(r io.Reader, stopMarkers ...string) (clrcore.Lexer, error) {
+	l, err := clrcore.NewReaderLexerEngine(lexerDef, r, 0, stopMarkers, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+`)
+	fmt.Fprintf(b, "// tokenTypes maps the Pygments token names of the lexer to lexeme types.\n")
+	fmt.Fprintf(b, "var tokenTypes = map[string]*clrcore.LexemeType{\n")
+	keys := make([]string, 0, len(p.types))
+	for key := range p.types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(b, "%q: clrcore.LexemeTypeByName(%q),\n", key, p.types[key])
+	}
+	fmt.Fprintf(b, "}\n\n")
+	fmt.Fprintf(b, "var lexerDef = &clrcore.LexerDef{\nName: %q,\nRecovery: clrcore.RecoverRune | clrcore.RecoverNewLine,\nInitFunc: func(d *clrcore.LexerDef) {\n", spec.names()[0])
+	if len(p.types) > 0 {
+		fmt.Fprintf(b, "t := tokenTypes\n")
+	}
+	fmt.Fprintf(b, "d.Modes = []*clrcore.LexerDefMode{\n")
+	for _, m := range append(p.modes, p.extra...) {
+		fmt.Fprintf(b, "{Name: %q, Rules: []clrcore.LexerDefRule{\n%s\n}},\n", m.name, strings.Join(m.rules, "\n"))
+	}
+	fmt.Fprintf(b, "}\n},\n}\n")
+	return b.Bytes()
+}
+
+// stringList return the Go source of the string slice.
+func stringList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = strconv.Quote(s)
+	}
+	return "[]string{" + strings.Join(quoted, ", ") + "}"
+}
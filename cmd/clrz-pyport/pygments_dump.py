@@ -0,0 +1,114 @@
+#!/usr/bin/env python3
+"""Dump the tokens table of a Pygments RegexLexer as JSON for clrz-pyport.
+
+Usage: pygments_dump.py name [output.json]
+
+The lexer is selected by alias (e.g. "ini") or by class name (e.g. "IniLexer").
+The format is described in the documentation of the clrz-pyport command.
+"""
+
+import importlib
+import json
+import re
+import sys
+
+import pygments.lexer as pl
+from pygments.lexers import LEXERS, find_lexer_class_by_name
+from pygments.token import _TokenType
+from pygments.util import ClassNotFound
+
+FLAGS = [(re.IGNORECASE, "i"), (re.MULTILINE, "m"), (re.DOTALL, "s"), (re.VERBOSE, "x")]
+
+
+def lexer_class(name):
+    if name in LEXERS:
+        return getattr(importlib.import_module(LEXERS[name][0]), name)
+    try:
+        return find_lexer_class_by_name(name)
+    except ClassNotFound:
+        raise SystemExit("unknown lexer %r" % name)
+
+
+def closure(fn):
+    names = fn.__code__.co_freevars
+    return {n: c.cell_contents for n, c in zip(names, fn.__closure__ or ())}
+
+
+def lexer_name(cls):
+    return cls.aliases[0] if cls.aliases else cls.name.lower()
+
+
+def dump_state(state):
+    if state is None or isinstance(state, str):
+        return state
+    if isinstance(state, int):
+        return "#pop:%d" % -state
+    if isinstance(state, pl.combined):
+        return {"combined": list(state)}
+    if isinstance(state, (list, tuple)):
+        return [dump_state(s) for s in state]
+    return {"unknown": repr(state)}
+
+
+def dump_action(action):
+    if action is None:
+        return None
+    if isinstance(action, _TokenType):
+        return str(action)
+    if callable(action):
+        qualname = getattr(action, "__qualname__", repr(action))
+        if qualname.startswith("bygroups."):
+            return {"bygroups": [dump_action(a) for a in closure(action)["args"]]}
+        if qualname.startswith("using."):
+            cells = closure(action)
+            other = cells.get("_other")
+            state = cells.get("gt_kwargs", {}).get("stack")
+            if isinstance(state, tuple) and len(state) == 2 and state[0] == "root":
+                state = state[1]
+            using = {"using": "this" if other is None else lexer_name(other)}
+            if state is not None:
+                using["state"] = state if isinstance(state, str) else list(state)
+            return using
+        return {"callback": qualname}
+    return {"unknown": repr(action)}
+
+
+def dump_rule(rule):
+    if isinstance(rule, pl.include):
+        return {"include": str(rule)}
+    if isinstance(rule, pl.default):
+        return {"default": dump_state(rule.state)}
+    regex = rule[0]
+    if isinstance(regex, pl.words):
+        regex = regex.get()
+    out = [regex, dump_action(rule[1])]
+    if len(rule) > 2:
+        out.append(dump_state(rule[2]))
+    return out
+
+
+def main(argv):
+    if len(argv) < 2:
+        raise SystemExit(__doc__)
+    cls = lexer_class(argv[1])
+    if not issubclass(cls, pl.RegexLexer):
+        raise SystemExit("%s is not a RegexLexer" % cls.__name__)
+    spec = {
+        "name": cls.name,
+        "class": cls.__name__,
+        "aliases": list(cls.aliases),
+        "filenames": list(cls.filenames),
+        "mimetypes": list(cls.mimetypes),
+        "flags": "".join(c for f, c in FLAGS if cls.flags & f),
+        "tokens": {
+            name: [dump_rule(r) for r in rules]
+            for name, rules in cls.get_tokendefs().items()
+        },
+    }
+    out = open(argv[2], "w") if len(argv) > 2 else sys.stdout
+    json.dump(spec, out, indent=1)
+    out.write("\n")
+
+
+if __name__ == "__main__":
+    main(sys.argv)
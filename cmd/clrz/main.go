@@ -0,0 +1,320 @@
+// Command clrz colorizes source code files for display in HTML or in a terminal.
+//
+//	clrz [-lexer-file desc]... [-l lang] [-f format] [-s style] [-classes naming] [-class-prefix prefix] [-nested] [-o out] [file ...]
+//	clrz -f css [-s style] [-classes naming] [-class-prefix prefix] [-nested] [-o out]
+//	clrz -list-lexers
+//	clrz -list-styles
+//	clrz -list-types
+//
+// The text is read from the files, or from the standard input when no file is
+// given. The lexer is selected by name with -l, or else by file name, shebang,
+// modeline and score with clrcore.DetectLexer. The html and css formats must be generated with the same
+// class naming (short, pygments or full), prefix and nesting to agree. The style is the name of a bundled style, or a style
+// definition file. A file with the .py extension contains a Pygments style
+// definition. The lexers described in the -lexer-file JSON or YAML files are
+// loaded with clrcore.LoadLexer, and the TextMate grammars of the .tmLanguage
+// and .tmLanguage.json files with clrtextmate.LoadLexer.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chmike/clrz/clrcore"
+	"github.com/chmike/clrz/clrfmt"
+	"github.com/chmike/clrz/clrstyles"
+	"github.com/chmike/clrz/clrtextmate"
+
+	// Register the lexers.
+	_ "github.com/chmike/clrz/clrlexers/cfamily"
+	_ "github.com/chmike/clrz/clrlexers/golang"
+	_ "github.com/chmike/clrz/clrlexers/javascript"
+	_ "github.com/chmike/clrz/clrlexers/python"
+)
+
+// defaultStyle is the style used when no style is given.
+const defaultStyle = `
+Code.Comment text#808080 italic
+Code.Identifier.Keyword text#0000C0 bold
+Code.Identifier.Type text#008080
+Code.Identifier.Literal text#800080
+Code.Identifier.Function text#804000
+Code.Identifier.Method text#804000
+Code.Identifier.Class text#804000 bold
+Code.Identifier.Namespace text#008000
+Code.String text#C00000
+Code.Number text#0080C0
+Code.Preprocessor text#806000
+Text.Invalid text#FF0000
+`
+
+// formats maps the format names to their description.
+var formats = map[string]string{
+	"html":        "HTML with CSS class names",
+	"html-inline": "HTML with inline styles",
+	"css":         "CSS style sheet of the html format",
+	"ansi":        "ANSI escape sequences, color mode detected from the environment",
+	"ansi16":      "ANSI escape sequences with 16 colors",
+	"ansi256":     "ANSI escape sequences with 256 colors",
+	"truecolor":   "ANSI escape sequences with 24 bit colors",
+	"lexemes":     "list of lexemes with their type",
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "clrz:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command with the given arguments.
+func run(args []string, stdin io.Reader, stdout io.Writer) (err error) {
+	fs := flag.NewFlagSet("clrz", flag.ContinueOnError)
+	lang := fs.String("l", "", "language `name` of the lexer")
+	format := fs.String("f", "html", "output `format`: "+formatNames())
+	styleName := fs.String("s", "", "style `name` or definition file")
+	classNaming := fs.String("classes", "short", "CSS class `naming`: short, pygments or full")
+	classPrefix := fs.String("class-prefix", "", "CSS class name `prefix`")
+	nested := fs.Bool("nested", false, "set the class names of the lexeme type ancestors in html and css")
+	outFile := fs.String("o", "", "output `file` (default standard output)")
+	listLexers := fs.Bool("list-lexers", false, "list the registered lexers")
+	listStyles := fs.Bool("list-styles", false, "list the bundled styles")
+	listTypes := fs.Bool("list-types", false, "list the lexeme types")
+	var lexerFiles fileList
+	fs.Var(&lexerFiles, "lexer-file", "load the lexer described in the JSON, YAML or TextMate grammar `file` (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	for _, fileName := range lexerFiles {
+		if err := loadLexer(fileName); err != nil {
+			return err
+		}
+	}
+	w := stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+	switch {
+	case *listLexers:
+		return printLexers(w)
+	case *listStyles:
+		_, err = fmt.Fprintln(w, strings.Join(clrstyles.Names(), "\n"))
+		return err
+	case *listTypes:
+		return printLexemeTypes(w)
+	}
+	if _, ok := formats[*format]; !ok {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	style, err := loadStyle(*styleName)
+	if err != nil {
+		return err
+	}
+	classNames := clrfmt.ClassNames{Prefix: *classPrefix}
+	switch *classNaming {
+	case "short":
+		classNames.Naming = clrfmt.ShortClassNames
+	case "pygments":
+		classNames.Naming = clrfmt.PygmentsClassNames
+	case "full":
+		classNames.Naming = clrfmt.FullClassNames
+	default:
+		return fmt.Errorf("unknown class naming %q", *classNaming)
+	}
+	if *format == "css" {
+		_, err = clrfmt.CSSWithOptions(w, style, &clrfmt.CSSOptions{ClassNames: classNames, NestedClasses: *nested})
+		return err
+	}
+	if fs.NArg() == 0 {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		return colorize(w, "", string(data), *lang, *format, style, classNames, *nested)
+	}
+	for _, fileName := range fs.Args() {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		if err = colorize(w, fileName, string(data), *lang, *format, style, classNames, *nested); err != nil {
+			return fmt.Errorf("%s: %s", fileName, err)
+		}
+	}
+	return nil
+}
+
+// fileList is a list of file names set by a repeated flag.
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(fileName string) error {
+	*f = append(*f, fileName)
+	return nil
+}
+
+// loadLexer registers the lexer described by the file, a TextMate grammar when
+// its extension is .tmLanguage or .tmLanguage.json.
+func loadLexer(fileName string) (err error) {
+	lower := strings.ToLower(fileName)
+	if strings.HasSuffix(lower, ".tmlanguage") || strings.HasSuffix(lower, ".tmlanguage.json") {
+		_, err = clrtextmate.LoadLexer(fileName, nil)
+	} else {
+		_, err = clrcore.LoadLexer(fileName)
+	}
+	return err
+}
+
+// loadStyle return the bundled style with the given name, or else the style
+// defined in the file with the given name.
+func loadStyle(name string) (clrcore.Style, error) {
+	if name == "" {
+		return clrcore.NewStyle(defaultStyle)
+	}
+	if style := clrstyles.Get(name); style != nil {
+		return style, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(name, ".py") {
+		return clrcore.NewStyleFromPygments(string(data))
+	}
+	return clrcore.NewStyle(string(data))
+}
+
+func formatNames() string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// selectLexer return the lexer named lang, or else the lexer detected with the
+// highest confidence.
+func selectLexer(lang, fileName, text string) (*clrcore.LexerInfo, error) {
+	if lang != "" {
+		info := clrcore.LexerByName(lang)
+		if info == nil {
+			return nil, fmt.Errorf("unknown language %q", lang)
+		}
+		return info, nil
+	}
+	candidates := clrcore.DetectLexer(fileName, "", text)
+	if len(candidates) == 0 {
+		return nil, errors.New("no matching lexer found")
+	}
+	return candidates[0].Info, nil
+}
+
+// colorize writes text in the given format.
+func colorize(w io.Writer, fileName, text, lang, format string, style clrcore.Style, classNames clrfmt.ClassNames, nested bool) (err error) {
+	info, err := selectLexer(lang, fileName, text)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "html":
+		_, _, err = clrfmt.HTMLWithOptions(w, info, text, &clrfmt.HTMLOptions{PreCode: true, ClassNames: classNames, NestedClasses: nested})
+	case "html-inline":
+		_, _, err = clrfmt.HTMLWithOptions(w, info, text, &clrfmt.HTMLOptions{PreCode: true, InlineStyle: style})
+	case "ansi":
+		_, _, err = clrfmt.ANSI(w, info, text, style, &clrfmt.ANSIOptions{Mode: clrfmt.AutoColor, ResetAtNewLine: true})
+	case "ansi16":
+		_, _, err = clrfmt.ANSI(w, info, text, style, &clrfmt.ANSIOptions{Mode: clrfmt.Color16, ResetAtNewLine: true})
+	case "ansi256":
+		_, _, err = clrfmt.ANSI(w, info, text, style, &clrfmt.ANSIOptions{Mode: clrfmt.Color256, ResetAtNewLine: true})
+	case "truecolor":
+		_, _, err = clrfmt.ANSI(w, info, text, style, &clrfmt.ANSIOptions{Mode: clrfmt.TrueColor, ResetAtNewLine: true})
+	case "lexemes":
+		err = printLexemes(w, info, text)
+	}
+	return err
+}
+
+// printLexemes writes the lexemes produced by the lexer, one per line,
+// preceded by their position when the lexer provides it.
+func printLexemes(w io.Writer, info *clrcore.LexerInfo, text string) error {
+	lexer, err := info.NewLexer(text)
+	if err != nil {
+		return err
+	}
+	positioner, _ := lexer.(clrcore.Positioner)
+	for {
+		lexeme := lexer.NextLexeme()
+		if positioner != nil {
+			if _, err := fmt.Fprintf(w, "%-8s", positioner.Position()); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, lexeme); err != nil {
+			return err
+		}
+		if lexeme.Type == nil || lexeme.IsA(clrcore.Stop) {
+			break
+		}
+	}
+	if rem := lexer.RemainingText(); rem != "" {
+		if _, err := fmt.Fprintf(w, "remaining text: %q\n", rem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printLexers writes the list of registered lexers.
+func printLexers(w io.Writer) error {
+	lexers := clrcore.Lexers()
+	sort.Slice(lexers, func(i, j int) bool { return lexers[i].Names[0] < lexers[j].Names[0] })
+	for _, l := range lexers {
+		_, err := fmt.Fprintf(w, "%s\n  names:      %s\n  mime types: %s\n  file names: %s\n",
+			l.Names[0], strings.Join(l.Names, ", "), strings.Join(l.MimeTypes, ", "), strings.Join(l.FileNames, ", "))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printLexemeTypes writes the tree of lexeme types.
+func printLexemeTypes(w io.Writer) error {
+	var printType func(t *clrcore.LexemeType, depth int) error
+	printType = func(t *clrcore.LexemeType, depth int) error {
+		if _, err := fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth), t.Name); err != nil {
+			return err
+		}
+		for _, c := range t.Children {
+			if err := printType(c, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, t := range clrcore.LexemeClassTypes() {
+		if err := printType(t, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
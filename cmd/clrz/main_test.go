@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunListLexers(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"-list-lexers"}, nil, &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(out.String(), "go\n  names:      go, golang\n  mime types: text/x-go") {
+		t.Errorf("go lexer not listed in:\n%s", out.String())
+	}
+}
+
+func TestRunListTypes(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"-list-types"}, nil, &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(out.String(), "\nCode\n  Code.Identifier\n    Code.Identifier.Variable\n") {
+		t.Errorf("unexpected lexeme type tree:\n%s", out.String())
+	}
+}
+
+func TestRunFormats(t *testing.T) {
+	text := "package main\n"
+	tests := []struct {
+		args   []string
+		expect string
+	}{
+		{args: []string{"-l", "go"}, expect: `<pre><code><span class="x">package</span>`},
+		{args: []string{"-f", "html-inline"}, expect: `<pre><code><span style="color:#0000c0;font-weight:bold">package</span>`},
+		{args: []string{"-f", "truecolor"}, expect: "\x1b[1;38;2;0;0;192mpackage\x1b[0m"},
+		{args: []string{"-f", "lexemes"}, expect: "1:1     [Code.Identifier.Keyword] \"package\"\n1:8     [Text.WhiteSpace] \" \"\n"},
+		{args: []string{"-f", "css"}, expect: "{font-weight: bold; color: #0000c0}"},
+		{args: []string{"-f", "truecolor", "-s", "monokai"}, expect: "\x1b[38;2;102;217;239;48;2;39;40;34mpackage"},
+		{args: []string{"-classes", "pygments", "-class-prefix", "hl-"}, expect: `<pre><code><span class="hl-k">package</span>`},
+		{args: []string{"-f", "css", "-classes", "full"}, expect: ".Code-Identifier-Keyword  /*    Code.Identifier.Keyword */ {font-weight: bold; color: #0000c0}"},
+		{args: []string{"-classes", "full", "-nested"}, expect: `<pre><code><span class="Code Code-Identifier Code-Identifier-Keyword">package</span>`},
+		{args: []string{"-list-styles"}, expect: "dracula\ngithub\nmonokai\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := run(test.args, strings.NewReader(text), &out); err != nil {
+			t.Errorf("unexpected error: %s for %v", err, test.args)
+			continue
+		}
+		if !strings.Contains(out.String(), test.expect) {
+			t.Errorf("got:\n%q\nexpected to contain:\n%q\nfor %v", out.String(), test.expect, test.args)
+		}
+	}
+	if err := run([]string{"-f", "pdf"}, strings.NewReader(text), &bytes.Buffer{}); err == nil {
+		t.Error("unexpected nil error for unknown format")
+	}
+	if err := run([]string{"-classes", "long"}, strings.NewReader(text), &bytes.Buffer{}); err == nil {
+		t.Error("unexpected nil error for unknown class naming")
+	}
+	if err := run([]string{"-l", "cobol"}, strings.NewReader(text), &bytes.Buffer{}); err == nil {
+		t.Error("unexpected nil error for unknown language")
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clrz")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	inFile := filepath.Join(dir, "main.go")
+	styleFile := filepath.Join(dir, "style.txt")
+	outFile := filepath.Join(dir, "out.html")
+	if err = ioutil.WriteFile(inFile, []byte("var x = 1"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = ioutil.WriteFile(styleFile, []byte("Code.Number bold"), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = run([]string{"-f", "html-inline", "-s", styleFile, "-o", outFile, inFile}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := `<pre><code>var x = <span style="font-weight:bold">1</span></code></pre>`
+	if string(data) != expect {
+		t.Errorf("got %q, expected %q", data, expect)
+	}
+}
+
+func TestRunLexerFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clrz")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	lexerFile := filepath.Join(dir, "words.yaml")
+	desc := "names: [words]\nfilenames: ['*.words']\nmodes:\n  - name: root\n    rules:\n      - regex: '\\w+'\n        type: Text.Word\n      - regex: '\\s+'\n        type: Text.WhiteSpace\n"
+	if err = ioutil.WriteFile(lexerFile, []byte(desc), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{"-lexer-file", lexerFile, "-l", "words", "-f", "lexemes"}, strings.NewReader("a b"), &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := "1:1     [Text.Word] \"a\"\n1:2     [Text.WhiteSpace] \" \"\n1:3     [Text.Word] \"b\"\n"
+	if !strings.HasPrefix(out.String(), expect) {
+		t.Errorf("got:\n%s\nexpected to start with:\n%s", out.String(), expect)
+	}
+	if err := run([]string{"-lexer-file", filepath.Join(dir, "missing.yaml")}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("unexpected nil error for missing lexer file")
+	}
+	grammarFile := filepath.Join(dir, "words.tmLanguage.json")
+	grammar := `{"name": "TM Words", "scopeName": "source.tm-words", "patterns": [{"match": "\\w+", "name": "keyword.other"}]}`
+	if err = ioutil.WriteFile(grammarFile, []byte(grammar), 0644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out.Reset()
+	if err := run([]string{"-lexer-file", grammarFile, "-l", "tm words", "-f", "lexemes"}, strings.NewReader("a b"), &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect = "1:1     [Code.Identifier.Keyword] \"a\"\n1:2     [Text] \" \"\n1:3     [Code.Identifier.Keyword] \"b\"\n"
+	if !strings.HasPrefix(out.String(), expect) {
+		t.Errorf("got:\n%s\nexpected to start with:\n%s", out.String(), expect)
+	}
+}
@@ -3,10 +3,15 @@ package clrz
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 
 	"github.com/chmike/clrz/clrcore"
 	"github.com/chmike/clrz/clrfmt"
+
+	// Register the lexers available out of the box.
+	_ "github.com/chmike/clrz/clrlexers/cfamily"
+	_ "github.com/chmike/clrz/clrlexers/golang"
+	_ "github.com/chmike/clrz/clrlexers/javascript"
+	_ "github.com/chmike/clrz/clrlexers/python"
 )
 
 // FormatCSS writes into w a list of CSS classes with styles definition for HTML formatted text.
@@ -31,48 +36,39 @@ func FormatCSS(w io.Writer, textStyle string, prefix ...string) (int, error) {
 }
 
 // FormatHTML return an HTML encoded string using the CSS style classes.
-// When more than one or no language are specified, the language with highest score is picked.
+// When more than one language are specified, the language is selected with
+// clrcore.LexerByScore.
+// When no language is specified, the language is detected with clrcore.DetectLexer.
 func FormatHTML(w io.Writer, text string, lang ...string) (int, error) {
 	if len(lang) == 1 {
 		_, n, err := clrfmt.HTML(w, clrcore.LexerByName(lang[0]), text)
 		return n, err
 	}
-	var bestScore int
-	var bestLexerInfo *clrcore.LexerInfo
-	var lexerInfos []*clrcore.LexerInfo
 	if len(lang) == 0 {
-		lexerInfos = clrcore.Lexers()
-	} else {
-		unique := make(map[*clrcore.LexerInfo]struct{})
-		lexerInfos = make([]*clrcore.LexerInfo, 0, len(lang))
-		for _, name := range lang {
-			lexerInfo := clrcore.LexerByName(name)
-			if lexerInfo == nil {
-				continue
-			}
-			if _, ok := unique[lexerInfo]; ok {
-				continue
-			}
-			unique[lexerInfo] = struct{}{}
-			lexerInfos = append(lexerInfos, lexerInfo)
+		candidates := clrcore.DetectLexer("", "", text)
+		if len(candidates) == 0 {
+			return 0, fmt.Errorf("failed HTML formatting: no matching lexer found")
 		}
+		_, n, err := clrfmt.HTML(w, candidates[0].Info, text)
+		return n, err
 	}
-	for _, lexerInfo := range lexerInfos {
-		score, _, err := clrfmt.HTML(ioutil.Discard, lexerInfo, text)
-		if err != nil {
-			if len(lang) == 1 {
-				return 0, err
-			}
+	unique := make(map[*clrcore.LexerInfo]struct{})
+	lexerInfos := make([]*clrcore.LexerInfo, 0, len(lang))
+	for _, name := range lang {
+		lexerInfo := clrcore.LexerByName(name)
+		if lexerInfo == nil {
 			continue
 		}
-		if score > bestScore {
-			bestLexerInfo = lexerInfo
-			bestScore = score
+		if _, ok := unique[lexerInfo]; ok {
+			continue
 		}
+		unique[lexerInfo] = struct{}{}
+		lexerInfos = append(lexerInfos, lexerInfo)
 	}
+	bestLexerInfo := clrcore.LexerByScore(text, lexerInfos)
 	if bestLexerInfo == nil {
 		return 0, fmt.Errorf("failed HTML formatting: no matching lexer found")
 	}
-	_, n, _ := clrfmt.HTML(w, bestLexerInfo, text)
-	return n, nil
+	_, n, err := clrfmt.HTML(w, bestLexerInfo, text)
+	return n, err
 }